@@ -0,0 +1,67 @@
+// Command calf-netd is the CALF privileged helper daemon. It runs as root from
+// a LaunchDaemon and loads/unloads the pf SMB-block anchor on behalf of the
+// calf CLI, unloading it automatically when the watched tart process exits.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/will-head/coding-agent-loader/internal/netd"
+)
+
+func main() {
+	socketPath := flag.String("socket", netd.DefaultSocketPath, "Unix socket to listen on")
+	statePath := flag.String("state", netd.DefaultStatePath, "File recording the loaded anchor for crash recovery")
+	allowUIDs := flag.String("allow-uids", "", "Comma-separated UIDs allowed to send requests (root is always allowed)")
+	flag.Parse()
+
+	uids, err := parseUIDs(*allowUIDs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+
+	server := netd.NewServer(*statePath, netd.WithAllowedUIDs(uids...))
+	if err := server.Reconcile(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Leave any loaded anchor in place on shutdown: the VM may still be
+	// running, and Reconcile unloads it on the next start if tart has exited.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		<-signals
+		os.Remove(*socketPath)
+		os.Exit(0)
+	}()
+
+	if err := server.ListenAndServe(*socketPath); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// parseUIDs parses a comma-separated UID list. An empty string yields no UIDs.
+func parseUIDs(list string) ([]uint32, error) {
+	var uids []uint32
+	for _, field := range strings.Split(list, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		uid, err := strconv.ParseUint(field, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid uid '%s' in --allow-uids", field)
+		}
+		uids = append(uids, uint32(uid))
+	}
+	return uids, nil
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+	"github.com/will-head/coding-agent-loader/internal/config"
+	"github.com/will-head/coding-agent-loader/internal/isolation"
+)
+
+// newExportCmd creates the export command, which archives a VM together with
+// a calf sidecar manifest.
+func newExportCmd(providers providerFactory, images *isolation.ImageStore, stdin io.Reader) *cobra.Command {
+	var tart *isolation.TartClient
+	var encrypt bool
+
+	exportCmd := &cobra.Command{
+		Use:   "export <vm> <file>",
+		Short: "Export a VM to a portable archive",
+		Long: `Export a stopped VM to a Tart archive and write a calf manifest next to it
+(<file>.calf.yaml) with the VM's config, isolation mode, base image digest,
+and the archive checksum. Keep both files together.
+
+With --encrypt, the archive is encrypted with a passphrase read from stdin.`,
+		Args: cobra.ExactArgs(2),
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			var err error
+			tart, err = tartProvider(cmd, providers)
+			return err
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runExport(cmd, tart, images, stdin, args[0], args[1], encrypt)
+		},
+	}
+	exportCmd.Flags().BoolVar(&encrypt, "encrypt", false, "Encrypt the archive with a passphrase read from stdin")
+	return exportCmd
+}
+
+// newImportCmd creates the import command, which verifies and imports an
+// archive created by export.
+func newImportCmd(providers providerFactory, stdin io.Reader) *cobra.Command {
+	var tart *isolation.TartClient
+
+	return &cobra.Command{
+		Use:   "import <file> [name]",
+		Short: "Import a VM from an archive",
+		Long: `Verify an archive against its calf manifest (<file>.calf.yaml) and import it
+as a VM, restoring its config and isolation mode. The VM keeps its exported
+name unless [name] is given. Encrypted archives read the passphrase from stdin.`,
+		Args: cobra.RangeArgs(1, 2),
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			var err error
+			tart, err = tartProvider(cmd, providers)
+			return err
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := ""
+			if len(args) == 2 {
+				name = args[1]
+			}
+			return runImport(cmd, tart, stdin, args[0], name)
+		},
+	}
+}
+
+// runExport exports a stopped VM and reports the manifest location.
+func runExport(cmd *cobra.Command, tart *isolation.TartClient, images *isolation.ImageStore, stdin io.Reader, vmName, path string, encrypt bool) error {
+	out := cmd.OutOrStdout()
+
+	switch tart.GetState(vmName) {
+	case isolation.StateNotFound:
+		return fmt.Errorf("%s does not exist", vmName)
+	case isolation.StateStopped:
+	default:
+		return fmt.Errorf("%s must be stopped before exporting", vmName)
+	}
+
+	opts, err := baseImageOptions(images, vmName, loadOptions(cmd)...)
+	if err != nil {
+		return err
+	}
+	if encrypt {
+		// A mistyped passphrase would make the archive unrecoverable, so one
+		// typed blind on a terminal is asked for twice.
+		_, terminal := terminalFd(stdin)
+		opts.Passphrase, err = readPassphrase(cmd, stdin, terminal)
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(out, "Exporting %s to %s...\n", vmName, path)
+	manifest, err := tart.ExportArchive(vmName, path, opts)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Archive: %s (%d bytes)\n", path, manifest.Archive.Size)
+	fmt.Fprintf(out, "Manifest: %s\n", isolation.ManifestPath(path))
+	fmt.Fprintf(out, "SHA-256: %s\n", manifest.Archive.SHA256)
+	if manifest.Archive.Encryption != nil {
+		fmt.Fprintln(out, "Encrypted: yes (the passphrase is required to import)")
+	}
+	return nil
+}
+
+// runImport verifies and imports an archive.
+func runImport(cmd *cobra.Command, tart *isolation.TartClient, stdin io.Reader, path, name string) error {
+	out := cmd.OutOrStdout()
+
+	manifest, err := isolation.ReadArchiveManifest(path)
+	if err != nil {
+		return err
+	}
+	passphrase := ""
+	if manifest.Archive.Encryption != nil {
+		passphrase, err = readPassphrase(cmd, stdin, false)
+		if err != nil {
+			return err
+		}
+	}
+	if name == "" {
+		name = manifest.VM
+	}
+
+	fmt.Fprintf(out, "Verifying and importing %s as %s...\n", path, name)
+	if _, err := tart.ImportArchive(path, name, passphrase); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Imported %s\n", name)
+	fmt.Fprintf(out, "Isolation: %s\n", manifest.Isolation.Description())
+	if manifest.BaseImage != "" {
+		fmt.Fprintf(out, "Base image: %s\n", manifest.BaseImage)
+	}
+	if manifest.BaseImageDigest != "" {
+		fmt.Fprintf(out, "Base image digest: %s\n", manifest.BaseImageDigest)
+	}
+	return nil
+}
+
+// baseImageOptions looks up a VM's base image from its effective config and
+// the digest recorded for it by 'calf isolation image'.
+func baseImageOptions(images *isolation.ImageStore, vmName string, loadOpts ...config.LoadOption) (isolation.ExportOptions, error) {
+	globalConfigPath, err := config.GetDefaultConfigPath()
+	if err != nil {
+		return isolation.ExportOptions{}, fmt.Errorf("getting default config path: %w", err)
+	}
+	vmConfigPath, err := config.GetVMConfigPath(vmName)
+	if err != nil {
+		return isolation.ExportOptions{}, fmt.Errorf("getting VM config path: %w", err)
+	}
+	cfg, err := config.LoadConfig(globalConfigPath, vmConfigPath, loadOpts...)
+	if err != nil {
+		return isolation.ExportOptions{}, fmt.Errorf("loading configuration: %w", err)
+	}
+
+	opts := isolation.ExportOptions{BaseImage: cfg.Isolation.Defaults.VM.BaseImage}
+	ref, err := isolation.ParseImageRef(opts.BaseImage)
+	if err != nil {
+		return opts, nil
+	}
+	if ref.Digest != "" {
+		opts.BaseImageDigest = ref.Digest
+		return opts, nil
+	}
+	rec, found, err := images.Get(ref.String())
+	if err != nil {
+		return isolation.ExportOptions{}, err
+	}
+	if found {
+		opts.BaseImageDigest = rec.Digest
+	}
+	return opts, nil
+}
+
+// readPassphrase prompts on stderr and reads an archive passphrase from
+// stdin, without echo on a terminal. With confirm, the passphrase is read a
+// second time and must match.
+func readPassphrase(cmd *cobra.Command, stdin io.Reader, confirm bool) (string, error) {
+	errOut := cmd.ErrOrStderr()
+	passphrase, err := readSecret(errOut, stdin, "Archive passphrase: ", "passphrase")
+	if err != nil || !confirm {
+		return passphrase, err
+	}
+	again, err := readSecret(errOut, stdin, "Repeat archive passphrase: ", "passphrase")
+	if err != nil {
+		return "", err
+	}
+	if again != passphrase {
+		return "", fmt.Errorf("passphrases do not match")
+	}
+	return passphrase, nil
+}
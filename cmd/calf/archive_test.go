@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/will-head/coding-agent-loader/internal/isolation"
+)
+
+// setupArchiveCmd creates a fresh export or import command in an isolated
+// temp HOME, with tart export/import simulated by the mock runner writing and
+// reading archive files.
+func setupArchiveCmd(t *testing.T, vms string, images *isolation.ImageStore, stdinContent string, args ...string) (*cobra.Command, *bytes.Buffer, map[string]string) {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	imported := map[string]string{}
+	run := func(args ...string) (string, error) {
+		switch args[0] {
+		case "list":
+			return vms, nil
+		case "export":
+			return "", os.WriteFile(args[2], []byte("tvm-data"), 0644)
+		case "import":
+			data, err := os.ReadFile(args[1])
+			imported[args[2]] = string(data)
+			return "", err
+		}
+		return "", nil
+	}
+	tart := isolation.NewTartClient(
+		isolation.WithTartPath("/mock/tart"),
+		isolation.WithRunCommand(run),
+		isolation.WithModeStore(isolation.NewModeStore(home)),
+	)
+
+	var cmd *cobra.Command
+	if args[0] == "export" {
+		cmd = newExportCmd(staticProvider(tart, nil), images, strings.NewReader(stdinContent))
+	} else {
+		cmd = newImportCmd(staticProvider(tart, nil), strings.NewReader(stdinContent))
+	}
+	out := &bytes.Buffer{}
+	cmd.SetOut(out)
+	cmd.SetErr(&bytes.Buffer{})
+	cmd.SetArgs(args[1:])
+	return cmd, out, imported
+}
+
+func TestExport(t *testing.T) {
+	t.Run("when VM is stopped should write archive and manifest with base image digest", func(t *testing.T) {
+		// Arrange
+		images := isolation.NewImageStore(t.TempDir())
+		if err := images.Record(isolation.ImageRecord{Reference: "ghcr.io/cirruslabs/macos-sequoia-base:latest", Digest: digestA}); err != nil {
+			t.Fatal(err)
+		}
+		archive := filepath.Join(t.TempDir(), "calf-dev.tvm")
+		cmd, out, _ := setupArchiveCmd(t, `[{"name":"calf-dev","state":"stopped"}]`, images, "", "export", "calf-dev", archive)
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		manifest, err := isolation.ReadArchiveManifest(archive)
+		if err != nil {
+			t.Fatalf("expected manifest next to archive: %v", err)
+		}
+		if manifest.BaseImageDigest != digestA {
+			t.Errorf("expected base image digest %s, got %q", digestA, manifest.BaseImageDigest)
+		}
+		if !strings.Contains(out.String(), "Manifest: "+archive+".calf.yaml") {
+			t.Errorf("expected manifest path in output, got: %s", out.String())
+		}
+	})
+
+	t.Run("when VM is running should return error", func(t *testing.T) {
+		// Arrange
+		archive := filepath.Join(t.TempDir(), "calf-dev.tvm")
+		cmd, _, _ := setupArchiveCmd(t, `[{"name":"calf-dev","state":"running"}]`, isolation.NewImageStore(t.TempDir()), "", "export", "calf-dev", archive)
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "must be stopped") {
+			t.Errorf("expected must be stopped error, got: %v", err)
+		}
+	})
+
+	t.Run("when encrypt set with empty passphrase should return error", func(t *testing.T) {
+		// Arrange
+		archive := filepath.Join(t.TempDir(), "calf-dev.tvm")
+		cmd, _, _ := setupArchiveCmd(t, `[{"name":"calf-dev","state":"stopped"}]`, isolation.NewImageStore(t.TempDir()), "\n", "export", "calf-dev", archive, "--encrypt")
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "passphrase must not be empty") {
+			t.Errorf("expected empty passphrase error, got: %v", err)
+		}
+	})
+}
+
+func TestImport(t *testing.T) {
+	t.Run("when archive is valid should import under given name", func(t *testing.T) {
+		// Arrange
+		archive := filepath.Join(t.TempDir(), "calf-dev.tvm")
+		exportCmd, _, _ := setupArchiveCmd(t, `[{"name":"calf-dev","state":"stopped"}]`, isolation.NewImageStore(t.TempDir()), "", "export", "calf-dev", archive)
+		if err := exportCmd.Execute(); err != nil {
+			t.Fatal(err)
+		}
+		cmd, out, imported := setupArchiveCmd(t, `[]`, nil, "", "import", archive, "client-a")
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if imported["client-a"] != "tvm-data" {
+			t.Errorf("expected archive imported as client-a, got %v", imported)
+		}
+		if !strings.Contains(out.String(), "Imported client-a") {
+			t.Errorf("expected import message, got: %s", out.String())
+		}
+	})
+}
+
+func TestArchiveProvider(t *testing.T) {
+	t.Run("when tart runs on a remote host should refuse to export", func(t *testing.T) {
+		// Arrange
+		remote, err := isolation.NewRemoteHost("dev@studio.local")
+		if err != nil {
+			t.Fatal(err)
+		}
+		tart := isolation.NewTartClient(isolation.WithRemoteHost(remote), isolation.WithRunCommand(func(args ...string) (string, error) {
+			t.Fatalf("expected no tart command, got %v", args)
+			return "", nil
+		}))
+		cmd := newExportCmd(staticProvider(tart, nil), isolation.NewImageStore(t.TempDir()), strings.NewReader(""))
+		cmd.SetOut(&bytes.Buffer{})
+		cmd.SetErr(&bytes.Buffer{})
+		cmd.SetArgs([]string{"calf-dev", filepath.Join(t.TempDir(), "calf-dev.tvm")})
+
+		// Act
+		err = cmd.Execute()
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "not supported on a remote host (dev@studio.local)") {
+			t.Errorf("expected remote host error, got: %v", err)
+		}
+	})
+}
+
+func TestReadPassphrase(t *testing.T) {
+	t.Run("when confirming and the passphrases differ should return error", func(t *testing.T) {
+		// Arrange
+		cmd := &cobra.Command{}
+		cmd.SetErr(&bytes.Buffer{})
+		stdin := bufio.NewReader(strings.NewReader("correct horse\ncorrect hrose\n"))
+
+		// Act
+		_, err := readPassphrase(cmd, stdin, true)
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "passphrases do not match") {
+			t.Errorf("expected mismatch error, got: %v", err)
+		}
+	})
+
+	t.Run("when confirming and the passphrases match should return it", func(t *testing.T) {
+		// Arrange
+		cmd := &cobra.Command{}
+		errOut := &bytes.Buffer{}
+		cmd.SetErr(errOut)
+		stdin := bufio.NewReader(strings.NewReader("correct horse\ncorrect horse\n"))
+
+		// Act
+		passphrase, err := readPassphrase(cmd, stdin, true)
+
+		// Assert
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if passphrase != "correct horse" {
+			t.Errorf("passphrase = %q, want correct horse", passphrase)
+		}
+		if !strings.Contains(errOut.String(), "Repeat archive passphrase: ") {
+			t.Errorf("expected repeat prompt, got: %s", errOut.String())
+		}
+	})
+}
@@ -15,18 +15,28 @@ import (
 // newCacheCmd creates the cache command group with injectable stdin and homeDir.
 // Pass an empty homeDir to use the default (current user's home directory).
 func newCacheCmd(stdin io.Reader, homeDir string) *cobra.Command {
+	var hostName string
+
 	cacheCmd := &cobra.Command{
 		Use:   "cache",
 		Short: "Manage package download caches",
-		Long:  `Manage package download caches for faster VM bootstraps.`,
+		Long: `Manage package download caches for faster VM bootstraps.
+
+With --host (or $CALF_HOST, or isolation.host in config), the caches of a
+remote Mac are managed over SSH instead.`,
 	}
+	cacheCmd.PersistentFlags().StringVar(&hostName, "host", "", "Manage the caches of a remote Mac over SSH (e.g. dev@studio.local)")
 
 	cacheStatusCmd := &cobra.Command{
 		Use:   "status",
 		Short: "Show cache status and sizes",
 		Long:  `Display information about package download caches, including size, location, and availability.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			cm := newCacheManager(homeDir)
+			_, host := selectedTarget("", hostName, cmd.ErrOrStderr(), loadOptions(cmd)...)
+			cm, err := newCacheManager(homeDir, host, cmd.ErrOrStderr())
+			if err != nil {
+				return err
+			}
 			return cm.Status(cmd.OutOrStdout())
 		},
 	}
@@ -49,7 +59,11 @@ With --all, shows a final confirmation before clearing all caches.
 With --all --force, skips all confirmations (for automation).
 Use --homebrew, --npm, --go, or --git to clear a specific cache type.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			cm := newCacheManager(homeDir)
+			_, host := selectedTarget("", hostName, cmd.ErrOrStderr(), loadOptions(cmd)...)
+			cm, err := newCacheManager(homeDir, host, cmd.ErrOrStderr())
+			if err != nil {
+				return err
+			}
 			types := cacheTypeFlags{clearHomebrew, clearNpm, clearGo, clearGit}
 			return runCacheClear(cmd, stdin, cm, clearAll, force, dryRun, types)
 		},
@@ -69,12 +83,21 @@ Use --homebrew, --npm, --go, or --git to clear a specific cache type.`,
 	return cacheCmd
 }
 
-// newCacheManager creates a CacheManager, using a custom homeDir when non-empty.
-func newCacheManager(homeDir string) *isolation.CacheManager {
+// newCacheManager creates a CacheManager for the caches of a remote host when
+// host is non-empty, else using a custom homeDir when non-empty. Warnings
+// from a remote CacheManager are written to errOut.
+func newCacheManager(homeDir, host string, errOut io.Writer) (*isolation.CacheManager, error) {
+	if host != "" {
+		remote, err := isolation.NewRemoteHost(host)
+		if err != nil {
+			return nil, err
+		}
+		return isolation.NewRemoteCacheManager(remote, errOut)
+	}
 	if homeDir != "" {
-		return isolation.NewCacheManagerWithDirs(homeDir, filepath.Join(homeDir, ".calf-cache"))
+		return isolation.NewCacheManagerWithDirs(homeDir, filepath.Join(homeDir, ".calf-cache")), nil
 	}
-	return isolation.NewCacheManager()
+	return isolation.NewCacheManager(), nil
 }
 
 // cacheTypeFlags holds per-type clear flags.
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/will-head/coding-agent-loader/internal/config"
@@ -20,60 +23,420 @@ func newConfigCmd() *cobra.Command {
 		RunE:  runConfigShow,
 	}
 	configShowCmd.Flags().StringP("vm", "v", "", "VM name to show config for")
+	configShowCmd.Flags().Bool("origin", false, "Show where each value came from (file and line, env, flag, or default)")
+	addOverrideFlags(configShowCmd)
 	configCmd.AddCommand(configShowCmd)
 
+	configGetCmd := &cobra.Command{
+		Use:   "get <key>",
+		Short: "Print an effective configuration value",
+		Long: `Print the effective value of a configuration key, e.g. isolation.defaults.vm.cpu
+or its short form vm.cpu, after merging config files and CALF_* environment variables.`,
+		Args: cobra.ExactArgs(1),
+		RunE: runConfigGet,
+	}
+	configGetCmd.Flags().StringP("vm", "v", "", "VM name to get config for")
+	configCmd.AddCommand(configGetCmd)
+
+	configSetCmd := &cobra.Command{
+		Use:   "set <key> <value>",
+		Short: "Set a value in the global or a per-VM config file",
+		Long: `Set a configuration key in ~/.calf/config.yaml, or with --vm in the VM's vm.yaml.
+Per-VM keys may be named as they appear in vm.yaml (resources.cpu, agent,
+isolation.no_network) or by their config key (vm.cpu).
+
+Comments and ordering in the file are preserved. The change is validated
+before the file is written; invalid values leave the file untouched.`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runConfigEdit(cmd, args[0], &args[1])
+		},
+	}
+	configSetCmd.Flags().StringP("vm", "v", "", "VM name whose vm.yaml to edit")
+	configCmd.AddCommand(configSetCmd)
+
+	configUnsetCmd := &cobra.Command{
+		Use:   "unset <key>",
+		Short: "Remove a value from the global or a per-VM config file",
+		Long:  `Remove a configuration key from ~/.calf/config.yaml, or with --vm from the VM's vm.yaml, so it falls back to the next layer.`,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runConfigEdit(cmd, args[0], nil)
+		},
+	}
+	configUnsetCmd.Flags().StringP("vm", "v", "", "VM name whose vm.yaml to edit")
+	configCmd.AddCommand(configUnsetCmd)
+
+	configValidateCmd := &cobra.Command{
+		Use:   "validate [file...]",
+		Short: "Check config files for unknown keys and invalid values",
+		Long: `Check config files strictly, reporting unknown keys (with their line, column and
+a suggested fix) and out-of-range values. Files named vm.yaml are checked against
+the per-VM schema, .calf.yaml files against the project schema, and others against
+the global one.
+
+Without arguments, ~/.calf/config.yaml is checked, and with --vm also the VM's
+vm.yaml. Exits non-zero if any file is invalid, so it can run as a pre-commit
+hook on shared config.`,
+		RunE: runConfigValidate,
+	}
+	configValidateCmd.Flags().StringP("vm", "v", "", "VM name whose vm.yaml to check as well")
+	configCmd.AddCommand(configValidateCmd)
+
+	configMigrateCmd := &cobra.Command{
+		Use:   "migrate [file...]",
+		Short: "Upgrade config files to the current schema version",
+		Long: `Upgrade config files written by an older calf to the current schema version.
+The original of each upgraded file is kept next to it as <file>.v<old version>.bak.
+Files named vm.yaml are upgraded as per-VM files, and .calf.yaml files as project
+files.
+
+Without arguments, ~/.calf/config.yaml and every VM's vm.yaml are upgraded.
+Files from a newer calf are reported and left untouched.`,
+		RunE: runConfigMigrate,
+	}
+	configCmd.AddCommand(configMigrateCmd)
+
+	configTrustCmd := &cobra.Command{
+		Use:   "trust [file]",
+		Short: "Trust a project .calf.yaml that runs commands",
+		Long: `Trust the current contents of a project config file, so its agent install
+commands and setup hooks are applied without asking. Without arguments, the
+nearest .calf.yaml in the current directory or its parents is trusted.
+
+Trust is recorded in ~/.calf/trusted-projects.yaml by path and content: editing
+the file revokes it.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: runConfigTrust,
+	}
+	configCmd.AddCommand(configTrustCmd)
+
 	return configCmd
 }
 
-func runConfigShow(cmd *cobra.Command, args []string) error {
+// addOverrideFlags registers a flag for every config key that can be
+// overridden on the command line, named by config.FlagName (e.g. --vm-cpu).
+func addOverrideFlags(cmd *cobra.Command) {
+	for _, key := range config.OverridableKeys() {
+		cmd.Flags().String(config.FlagName(key), "", fmt.Sprintf("Override %s (also $%s)", key, config.EnvName(key)))
+	}
+}
+
+// overrideFlags returns the override flags set on cmd, keyed by flag name.
+func overrideFlags(cmd *cobra.Command) map[string]string {
+	flags := map[string]string{}
+	for _, key := range config.OverridableKeys() {
+		name := config.FlagName(key)
+		if cmd.Flags().Changed(name) {
+			flags[name], _ = cmd.Flags().GetString(name)
+		}
+	}
+	return flags
+}
+
+// hostProbeKey is the context key of the config.HostProbe that commands size
+// and check VM resources with.
+type hostProbeKey struct{}
+
+// withHostProbe returns ctx carrying probe, for loadOptions.
+func withHostProbe(ctx context.Context, probe config.HostProbe) context.Context {
+	return context.WithValue(ctx, hostProbeKey{}, probe)
+}
+
+// loadOptions returns the config load options selected by the root flags of
+// cmd (--lenient and --profile) and the host probe of cmd's context, if any.
+// The commands of untrusted project files are withheld; commands that run
+// them must add config.WithTrustPrompt.
+func loadOptions(cmd *cobra.Command) []config.LoadOption {
+	var opts []config.LoadOption
+	if ctx := cmd.Context(); ctx != nil {
+		if probe, ok := ctx.Value(hostProbeKey{}).(config.HostProbe); ok {
+			opts = append(opts, config.WithHostProbe(probe))
+		}
+	}
+	if lenient, _ := cmd.Flags().GetBool("lenient"); lenient {
+		opts = append(opts, config.WithLenient())
+	}
+	if profile, _ := cmd.Flags().GetString("profile"); profile != "" {
+		opts = append(opts, config.WithProfile(profile))
+	}
+	return opts
+}
+
+// configPaths returns the global config path and, when the --vm flag of cmd
+// is set, the VM's config path.
+func configPaths(cmd *cobra.Command) (globalPath, vmPath string, err error) {
 	vmName, err := cmd.Flags().GetString("vm")
 	if err != nil {
-		return fmt.Errorf("getting vm flag: %w", err)
+		return "", "", fmt.Errorf("getting vm flag: %w", err)
+	}
+	globalPath, err = config.GetDefaultConfigPath()
+	if err != nil {
+		return "", "", fmt.Errorf("getting default config path: %w", err)
 	}
+	if vmName != "" {
+		vmPath, err = config.GetVMConfigPath(vmName)
+		if err != nil {
+			return "", "", fmt.Errorf("getting VM config path: %w", err)
+		}
+	}
+	return globalPath, vmPath, nil
+}
 
-	globalConfigPath, err := config.GetDefaultConfigPath()
+func runConfigGet(cmd *cobra.Command, args []string) error {
+	globalPath, vmPath, err := configPaths(cmd)
+	if err != nil {
+		return err
+	}
+	cfg, err := config.LoadConfig(globalPath, vmPath, loadOptions(cmd)...)
+	if err != nil {
+		return fmt.Errorf("loading configuration: %w", err)
+	}
+	value, err := config.Get(cfg, args[0])
 	if err != nil {
-		return fmt.Errorf("getting default config path: %w", err)
+		return err
 	}
+	fmt.Fprintln(cmd.OutOrStdout(), value)
+	return nil
+}
 
-	var vmConfigPath string
-	if vmName != "" {
-		vmConfigPath, err = config.GetVMConfigPath(vmName)
+// runConfigValidate checks the files named in args, or the global config and
+// --vm file, reporting every problem before failing.
+func runConfigValidate(cmd *cobra.Command, args []string) error {
+	files := args
+	if len(files) == 0 {
+		globalPath, vmPath, err := configPaths(cmd)
 		if err != nil {
-			return fmt.Errorf("getting VM config path: %w", err)
+			return err
+		}
+		for _, path := range []string{globalPath, vmPath} {
+			if path == "" {
+				continue
+			}
+			if _, err := os.Stat(path); err != nil {
+				fmt.Fprintf(cmd.OutOrStdout(), "%s: not found, defaults apply\n", path)
+				continue
+			}
+			files = append(files, path)
 		}
 	}
 
-	cfg, err := config.LoadConfig(globalConfigPath, vmConfigPath)
+	invalid := 0
+	for _, path := range files {
+		if err := config.ValidateFile(path, loadOptions(cmd)...); err != nil {
+			fmt.Fprintln(cmd.ErrOrStderr(), err)
+			invalid++
+			continue
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "%s: OK\n", path)
+	}
+	if invalid > 0 {
+		return fmt.Errorf("%d of %d config files are invalid", invalid, len(files))
+	}
+	return nil
+}
+
+// runConfigMigrate upgrades the files named in args, or the global config
+// and every per-VM config, reporting every failure before failing.
+func runConfigMigrate(cmd *cobra.Command, args []string) error {
+	files := args
+	if len(files) == 0 {
+		globalPath, err := config.GetDefaultConfigPath()
+		if err != nil {
+			return fmt.Errorf("getting default config path: %w", err)
+		}
+		if _, err := os.Stat(globalPath); err == nil {
+			files = append(files, globalPath)
+		}
+		vmPaths, err := config.VMConfigPaths()
+		if err != nil {
+			return err
+		}
+		files = append(files, vmPaths...)
+	}
+
+	out := cmd.OutOrStdout()
+	failed := 0
+	for _, path := range files {
+		result, err := config.MigrateFile(path)
+		if err != nil {
+			fmt.Fprintln(cmd.ErrOrStderr(), err)
+			failed++
+			continue
+		}
+		if result.Backup == "" {
+			fmt.Fprintf(out, "%s: already at version %d\n", path, result.To)
+			continue
+		}
+		fmt.Fprintf(out, "%s: upgraded from version %d to %d (backup: %s)\n", path, result.From, result.To, result.Backup)
+		for _, step := range result.Steps {
+			fmt.Fprintf(out, "  - %s\n", step)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d config files could not be migrated", failed, len(files))
+	}
+	return nil
+}
+
+// runConfigTrust trusts the project config file named in args, or the
+// nearest one to the current directory.
+func runConfigTrust(cmd *cobra.Command, args []string) error {
+	var path string
+	if len(args) > 0 {
+		path = args[0]
+	} else {
+		dir, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("getting current directory: %w", err)
+		}
+		path, err = config.FindProjectConfig(dir)
+		if err != nil {
+			return err
+		}
+		if path == "" {
+			return fmt.Errorf("no %s found in %s or its parents", config.ProjectFileName, dir)
+		}
+	}
+	if err := config.NewDefaultTrustStore().TrustProjectConfig(path); err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "Trusted %s\n", path)
+	return nil
+}
+
+// runConfigEdit sets key to *value, or unsets it if value is nil, in the
+// global config file or the --vm file.
+func runConfigEdit(cmd *cobra.Command, key string, value *string) error {
+	globalPath, vmPath, err := configPaths(cmd)
+	if err != nil {
+		return err
+	}
+	path, vm := globalPath, vmPath != ""
+	if vm {
+		path = vmPath
+	}
+
+	if value == nil {
+		if err := config.UnsetInFile(globalPath, path, vm, key, loadOptions(cmd)...); err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Unset %s in %s\n", key, path)
+		return nil
+	}
+	if err := config.SetInFile(globalPath, path, vm, key, *value, loadOptions(cmd)...); err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "Set %s = %s in %s\n", key, *value, path)
+	return nil
+}
+
+func runConfigShow(cmd *cobra.Command, args []string) error {
+	vmName, err := cmd.Flags().GetString("vm")
+	if err != nil {
+		return fmt.Errorf("getting vm flag: %w", err)
+	}
+	showOrigin, err := cmd.Flags().GetBool("origin")
+	if err != nil {
+		return fmt.Errorf("getting origin flag: %w", err)
+	}
+
+	globalConfigPath, vmConfigPath, err := configPaths(cmd)
+	if err != nil {
+		return err
+	}
+
+	opts := append(loadOptions(cmd), config.WithFlagOverrides(overrideFlags(cmd)))
+	cfg, origins, err := config.LoadConfigWithOrigins(globalConfigPath, vmConfigPath, opts...)
 	if err != nil {
 		return fmt.Errorf("loading configuration: %w", err)
 	}
 
 	out := cmd.OutOrStdout()
 
+	// field prints a labelled value, followed by its origin with --origin.
+	field := func(format, key string, value any) {
+		line := fmt.Sprintf(format, value)
+		if showOrigin {
+			line += fmt.Sprintf("  (%s)", origins[key])
+		}
+		fmt.Fprintln(out, line)
+	}
+
 	fmt.Fprintln(out, "CALF Configuration")
 	fmt.Fprintln(out, "=================")
 	fmt.Fprintln(out)
 
+	profile := cfg.Profile
+	if profile == "" {
+		profile = "none"
+	}
+	field("Profile: %s", "profile", profile)
+	project := cfg.Project
+	if project == "" {
+		project = "none"
+	}
+	fmt.Fprintf(out, "Project: %s\n", project)
+	if len(cfg.WithheldCommands) > 0 {
+		fmt.Fprintf(out, "  Commands withheld until trusted ('calf config trust'): %s\n", strings.Join(cfg.WithheldCommands, "; "))
+	}
+	field("Provider: %s", "isolation.provider", cfg.Isolation.Provider)
+	if cfg.Isolation.Host != "" {
+		field("Host: %s", "isolation.host", cfg.Isolation.Host)
+	}
+	if cfg.Host != nil {
+		fmt.Fprintf(out, "Host Capacity: %s\n", cfg.Host)
+	}
+	fmt.Fprintln(out)
+
+	// sized prints an amount with its unit and, if it was sized for the
+	// host, the setting it was sized from, e.g. "12288 MB (50%)".
+	sized := func(amount int, unit, name string) string {
+		if spec, ok := cfg.Isolation.Defaults.VM.Relative[name]; ok {
+			return fmt.Sprintf("%d %s (%s)", amount, unit, spec)
+		}
+		return fmt.Sprintf("%d %s", amount, unit)
+	}
 	fmt.Fprintln(out, "VM Defaults:")
-	fmt.Fprintf(out, "  CPU: %d cores\n", cfg.Isolation.Defaults.VM.CPU)
-	fmt.Fprintf(out, "  Memory: %d MB\n", cfg.Isolation.Defaults.VM.Memory)
-	fmt.Fprintf(out, "  Disk Size: %d GB\n", cfg.Isolation.Defaults.VM.DiskSize)
-	fmt.Fprintf(out, "  Base Image: %s\n", cfg.Isolation.Defaults.VM.BaseImage)
+	field("  CPU: %s", "isolation.defaults.vm.cpu", sized(cfg.Isolation.Defaults.VM.CPU, "cores", "cpu"))
+	field("  Memory: %s", "isolation.defaults.vm.memory", sized(cfg.Isolation.Defaults.VM.Memory, "MB", "memory"))
+	field("  Disk Size: %s", "isolation.defaults.vm.disk_size", sized(cfg.Isolation.Defaults.VM.DiskSize, "GB", "disk_size"))
+	field("  Base Image: %s", "isolation.defaults.vm.base_image", cfg.Isolation.Defaults.VM.BaseImage)
 	fmt.Fprintln(out)
 
 	fmt.Fprintln(out, "GitHub:")
-	fmt.Fprintf(out, "  Default Branch Prefix: %s\n", cfg.Isolation.Defaults.GitHub.DefaultBranchPrefix)
+	field("  Default Branch Prefix: %s", "isolation.defaults.github.default_branch_prefix", cfg.Isolation.Defaults.GitHub.DefaultBranchPrefix)
 	fmt.Fprintln(out)
 
 	fmt.Fprintln(out, "Output:")
-	fmt.Fprintf(out, "  Sync Directory: %s\n", cfg.Isolation.Defaults.Output.SyncDir)
+	field("  Sync Directory: %s", "isolation.defaults.output.sync_dir", cfg.Isolation.Defaults.Output.SyncDir)
 	fmt.Fprintln(out)
 
 	fmt.Fprintln(out, "Proxy:")
-	fmt.Fprintf(out, "  Mode: %s\n", cfg.Isolation.Defaults.Proxy.Mode)
+	field("  Mode: %s", "isolation.defaults.proxy.mode", cfg.Isolation.Defaults.Proxy.Mode)
 	fmt.Fprintln(out)
 
+	if vmName != "" || cfg.Project != "" {
+		fmt.Fprintln(out, "VM:")
+		if vmName != "" {
+			field("  Name: %s", "vm.name", cfg.VM.Name)
+		}
+		field("  Agent: %s", "vm.agent", cfg.VM.Agent)
+		field("  Environments: %s", "vm.environments", strings.Join(cfg.VM.Environments, ", "))
+		repos := make([]string, 0, len(cfg.VM.Repos))
+		for _, repo := range cfg.VM.Repos {
+			if repo.Branch != "" {
+				repos = append(repos, repo.Name+"@"+repo.Branch)
+			} else {
+				repos = append(repos, repo.Name)
+			}
+		}
+		field("  Repos: %s", "vm.repos", strings.Join(repos, ", "))
+		field("  No Mount: %t", "vm.isolation.no_mount", cfg.VM.Isolation.NoMount)
+		field("  No Network: %t", "vm.isolation.no_network", cfg.VM.Isolation.NoNetwork)
+		fmt.Fprintln(out)
+	}
+
 	if vmName != "" {
 		fmt.Fprintf(out, "(Showing config for VM: %s)\n", vmName)
 	} else {
@@ -2,12 +2,14 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/spf13/cobra"
+	"github.com/will-head/coding-agent-loader/internal/config"
 )
 
 // writeGlobalConfig creates ~/.calf/config.yaml in home with the given YAML content.
@@ -161,3 +163,462 @@ func TestConfigShow(t *testing.T) {
 		}
 	})
 }
+
+func TestConfigShowOrigin(t *testing.T) {
+	t.Run("when origin flag provided should show file and line or default for each value", func(t *testing.T) {
+		// Arrange
+		cmd, home, out, _ := setupConfigShow(t, "--vm", "calf-dev", "--origin")
+		writeGlobalConfig(t, home, "version: 1\nisolation:\n  defaults:\n    vm:\n      cpu: 8\n")
+		vmDir := filepath.Join(home, ".calf", "isolation", "vms", "calf-dev")
+		if err := os.MkdirAll(vmDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		vmPath := filepath.Join(vmDir, "vm.yaml")
+		if err := os.WriteFile(vmPath, []byte("memory: 16384\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		globalPath := filepath.Join(home, ".calf", "config.yaml")
+		for _, want := range []string{
+			"CPU: 8 cores  (" + globalPath + ":5)",
+			"Memory: 16384 MB  (" + vmPath + ":1)",
+			"Disk Size: 80 GB  (default)",
+		} {
+			if !strings.Contains(out.String(), want) {
+				t.Errorf("expected %q in output, got: %s", want, out.String())
+			}
+		}
+	})
+}
+
+func TestConfigShowVM(t *testing.T) {
+	t.Run("when vm file sets per-VM settings should show vm section", func(t *testing.T) {
+		// Arrange
+		cmd, home, out, _ := setupConfigShow(t, "--vm", "calf-dev")
+		vmDir := filepath.Join(home, ".calf", "isolation", "vms", "calf-dev")
+		if err := os.MkdirAll(vmDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		content := "name: my-workspace\nagent: claude-code\ngithub:\n  repos:\n    - name: my-app\n      branch: agent/login\nisolation:\n  no_mount: true\n"
+		if err := os.WriteFile(filepath.Join(vmDir, "vm.yaml"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for _, want := range []string{
+			"Name: my-workspace",
+			"Agent: claude-code",
+			"Repos: my-app@agent/login",
+			"No Mount: true",
+			"No Network: false",
+		} {
+			if !strings.Contains(out.String(), want) {
+				t.Errorf("expected %q in output, got: %s", want, out.String())
+			}
+		}
+	})
+}
+
+func TestConfigShowOverrides(t *testing.T) {
+	t.Run("when env and flag overrides given should show them with origins", func(t *testing.T) {
+		// Arrange
+		cmd, home, out, _ := setupConfigShow(t, "--vm-cpu", "12", "--origin")
+		writeGlobalConfig(t, home, "version: 1\nisolation:\n  defaults:\n    vm:\n      cpu: 8\n")
+		t.Setenv("CALF_PROXY_MODE", "on")
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !strings.Contains(out.String(), "CPU: 12 cores  (flag --vm-cpu)") {
+			t.Errorf("expected flag CPU with origin, got: %s", out.String())
+		}
+		if !strings.Contains(out.String(), "Mode: on  (env CALF_PROXY_MODE)") {
+			t.Errorf("expected env proxy mode with origin, got: %s", out.String())
+		}
+	})
+}
+
+func TestConfigEdit(t *testing.T) {
+	t.Run("when value set for vm should be returned by get", func(t *testing.T) {
+		// Arrange
+		home := t.TempDir()
+		t.Setenv("HOME", home)
+		out := &bytes.Buffer{}
+		set := newRootCmd("test")
+		set.SetOut(out)
+		set.SetArgs([]string{"config", "set", "vm.cpu", "6", "--vm", "calf-dev"})
+		get := newRootCmd("test")
+		get.SetOut(out)
+		get.SetArgs([]string{"config", "get", "isolation.defaults.vm.cpu", "--vm", "calf-dev"})
+
+		// Act
+		setErr := set.Execute()
+		out.Reset()
+		getErr := get.Execute()
+
+		// Assert
+		if setErr != nil || getErr != nil {
+			t.Fatalf("unexpected errors: %v, %v", setErr, getErr)
+		}
+		if out.String() != "6\n" {
+			t.Errorf("config get output = %q, want 6", out.String())
+		}
+	})
+
+	t.Run("when unsetting should fall back to default", func(t *testing.T) {
+		// Arrange
+		home := t.TempDir()
+		t.Setenv("HOME", home)
+		writeGlobalConfig(t, home, "isolation:\n  defaults:\n    vm:\n      memory: 4096\n")
+		unset := newRootCmd("test")
+		unset.SetOut(&bytes.Buffer{})
+		unset.SetArgs([]string{"config", "unset", "vm.memory"})
+		out := &bytes.Buffer{}
+		get := newRootCmd("test")
+		get.SetOut(out)
+		get.SetArgs([]string{"config", "get", "vm.memory"})
+
+		// Act
+		unsetErr := unset.Execute()
+		getErr := get.Execute()
+
+		// Assert
+		if unsetErr != nil || getErr != nil {
+			t.Fatalf("unexpected errors: %v, %v", unsetErr, getErr)
+		}
+		if out.String() != "8192\n" {
+			t.Errorf("config get output = %q, want default 8192", out.String())
+		}
+	})
+}
+
+func TestConfigLenient(t *testing.T) {
+	t.Run("when config has unknown key should fail unless lenient", func(t *testing.T) {
+		// Arrange
+		strict, home, _, _ := setupConfigShow(t)
+		writeGlobalConfig(t, home, "isolation:\n  defaults:\n    vm:\n      memroy: 16384\n")
+		lenient := newRootCmd("test")
+		lenient.SetOut(&bytes.Buffer{})
+		lenient.SetArgs([]string{"config", "show", "--lenient"})
+
+		// Act
+		strictErr := strict.Execute()
+		lenientErr := lenient.Execute()
+
+		// Assert
+		if strictErr == nil || !strings.Contains(strictErr.Error(), "did you mean memory?") {
+			t.Errorf("strict error = %v, want unknown key with suggestion", strictErr)
+		}
+		if lenientErr != nil {
+			t.Errorf("lenient returned unexpected error: %v", lenientErr)
+		}
+	})
+}
+
+func TestConfigValidate(t *testing.T) {
+	t.Run("when files are given should check each and fail if any is invalid", func(t *testing.T) {
+		// Arrange
+		dir := t.TempDir()
+		good := filepath.Join(dir, "config.yaml")
+		if err := os.WriteFile(good, []byte("isolation:\n  provider: tart\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		bad := filepath.Join(dir, "vm.yaml")
+		if err := os.WriteFile(bad, []byte("resources:\n  cpus: 4\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		out, errOut := &bytes.Buffer{}, &bytes.Buffer{}
+		cmd := newRootCmd("test")
+		cmd.SetOut(out)
+		cmd.SetErr(errOut)
+		cmd.SetArgs([]string{"config", "validate", good, bad})
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "1 of 2 config files are invalid") {
+			t.Errorf("expected validation failure, got: %v", err)
+		}
+		if !strings.Contains(out.String(), good+": OK") {
+			t.Errorf("expected %s reported OK, got: %s", good, out.String())
+		}
+		if !strings.Contains(errOut.String(), bad+":2:3: unknown key resources.cpus (did you mean cpu?)") {
+			t.Errorf("expected unknown key report, got: %s", errOut.String())
+		}
+	})
+
+	t.Run("when no files are given and global config is missing should succeed", func(t *testing.T) {
+		// Arrange
+		home := t.TempDir()
+		t.Setenv("HOME", home)
+		out := &bytes.Buffer{}
+		cmd := newRootCmd("test")
+		cmd.SetOut(out)
+		cmd.SetArgs([]string{"config", "validate"})
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !strings.Contains(out.String(), "not found, defaults apply") {
+			t.Errorf("expected missing file note, got: %s", out.String())
+		}
+	})
+}
+
+func TestConfigMigrate(t *testing.T) {
+	t.Run("when no files are given should upgrade every vm file", func(t *testing.T) {
+		// Arrange
+		home := t.TempDir()
+		t.Setenv("HOME", home)
+		writeGlobalConfig(t, home, "version: 1\n")
+		vmDir := filepath.Join(home, ".calf", "isolation", "vms", "calf-dev")
+		if err := os.MkdirAll(vmDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		vmPath := filepath.Join(vmDir, "vm.yaml")
+		if err := os.WriteFile(vmPath, []byte("memory: 16384\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		out := &bytes.Buffer{}
+		cmd := newRootCmd("test")
+		cmd.SetOut(out)
+		cmd.SetArgs([]string{"config", "migrate"})
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		globalPath := filepath.Join(home, ".calf", "config.yaml")
+		for _, want := range []string{
+			globalPath + ": already at version 1",
+			vmPath + ": upgraded from version 1 to 2 (backup: " + vmPath + ".v1.bak)",
+		} {
+			if !strings.Contains(out.String(), want) {
+				t.Errorf("expected %q in output, got: %s", want, out.String())
+			}
+		}
+		data, _ := os.ReadFile(vmPath)
+		if string(data) != "version: 2\nresources:\n  memory: 16384\n" {
+			t.Errorf("vm file = %q, want upgraded", data)
+		}
+	})
+}
+
+func TestConfigShowProfile(t *testing.T) {
+	t.Run("when profile flag given should report it and apply its values", func(t *testing.T) {
+		// Arrange
+		cmd, home, out, _ := setupConfigShow(t, "--profile", "oss", "--origin")
+		writeGlobalConfig(t, home, "profiles:\n  oss:\n    resources:\n      cpu: 10\n")
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		globalPath := filepath.Join(home, ".calf", "config.yaml")
+		for _, want := range []string{
+			"Profile: oss  (flag --profile)",
+			"CPU: 10 cores  (" + globalPath + ":4)",
+		} {
+			if !strings.Contains(out.String(), want) {
+				t.Errorf("expected %q in output, got: %s", want, out.String())
+			}
+		}
+	})
+
+	t.Run("when no profile selected should report none", func(t *testing.T) {
+		// Arrange
+		cmd, _, out, _ := setupConfigShow(t)
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !strings.Contains(out.String(), "Profile: none") {
+			t.Errorf("expected no profile reported, got: %s", out.String())
+		}
+	})
+}
+
+func TestConfigShowProject(t *testing.T) {
+	t.Run("when a project file is found should report it and its settings", func(t *testing.T) {
+		// Arrange
+		cmd, _, out, _ := setupConfigShow(t)
+		dir := t.TempDir()
+		t.Chdir(dir)
+		projectPath := filepath.Join(dir, ".calf.yaml")
+		if err := os.WriteFile(projectPath, []byte("agent: codex\nenvironments: [node, go]\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for _, want := range []string{"Project: " + projectPath, "Agent: codex", "Environments: node, go"} {
+			if !strings.Contains(out.String(), want) {
+				t.Errorf("expected %q in output, got: %s", want, out.String())
+			}
+		}
+	})
+
+	t.Run("when project file runs untrusted commands should show it without them and not prompt", func(t *testing.T) {
+		// Arrange
+		cmd, _, out, errOut := setupConfigShow(t)
+		dir := t.TempDir()
+		t.Chdir(dir)
+		projectPath := filepath.Join(dir, ".calf.yaml")
+		if err := os.WriteFile(projectPath, []byte("agent: codex\nhooks:\n  setup: [make bootstrap]\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for _, want := range []string{"Project: " + projectPath, "Commands withheld until trusted ('calf config trust'): hooks.setup: make bootstrap", "Agent: codex"} {
+			if !strings.Contains(out.String(), want) {
+				t.Errorf("expected %q in output, got: %s", want, out.String())
+			}
+		}
+		if strings.Contains(errOut.String(), "Trust this file?") {
+			t.Errorf("expected no trust prompt, got: %s", errOut.String())
+		}
+	})
+}
+
+func TestConfigTrust(t *testing.T) {
+	t.Run("when trusting the nearest project file should apply it without asking", func(t *testing.T) {
+		// Arrange
+		home := t.TempDir()
+		t.Setenv("HOME", home)
+		dir := t.TempDir()
+		t.Chdir(dir)
+		projectPath := filepath.Join(dir, ".calf.yaml")
+		if err := os.WriteFile(projectPath, []byte("hooks:\n  setup: [make bootstrap]\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		out := &bytes.Buffer{}
+		cmd := newRootCmd("test")
+		cmd.SetOut(out)
+		cmd.SetArgs([]string{"config", "trust"})
+		showOut := &bytes.Buffer{}
+		show := newRootCmd("test")
+		show.SetOut(showOut)
+		show.SetArgs([]string{"config", "show"})
+
+		// Act
+		err := cmd.Execute()
+		showErr := show.Execute()
+
+		// Assert
+		if err != nil || showErr != nil {
+			t.Fatalf("unexpected errors: %v, %v", err, showErr)
+		}
+		if !strings.Contains(out.String(), "Trusted "+projectPath) {
+			t.Errorf("expected trust confirmation, got: %s", out.String())
+		}
+		if !strings.Contains(showOut.String(), "Project: "+projectPath) {
+			t.Errorf("expected trusted project applied, got: %s", showOut.String())
+		}
+	})
+
+	t.Run("when no project file is found should return error", func(t *testing.T) {
+		// Arrange
+		t.Setenv("HOME", t.TempDir())
+		t.Chdir(t.TempDir())
+		cmd := newRootCmd("test")
+		cmd.SetOut(&bytes.Buffer{})
+		cmd.SetArgs([]string{"config", "trust"})
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "no .calf.yaml found") {
+			t.Errorf("expected not found error, got: %v", err)
+		}
+	})
+}
+
+func TestConfigShowHostSizing(t *testing.T) {
+	t.Run("when resources are relative should show the values sized for the host", func(t *testing.T) {
+		// Arrange
+		cmd, home, out, _ := setupConfigShow(t)
+		writeGlobalConfig(t, home, "isolation:\n  defaults:\n    vm:\n      cpu: auto\n      memory: 50%\n")
+		host := config.HostCapacity{CPUs: 10, MemoryMB: 24576, FreeDiskGB: 200}
+		ctx := withHostProbe(context.Background(), func() (config.HostCapacity, error) { return host, nil })
+
+		// Act
+		err := cmd.ExecuteContext(ctx)
+
+		// Assert
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for _, want := range []string{
+			"Host Capacity: 10 cores, 24576 MB, 200 GB free",
+			"CPU: 5 cores (auto)",
+			"Memory: 12288 MB (50%)",
+			"Disk Size: 80 GB\n",
+		} {
+			if !strings.Contains(out.String(), want) {
+				t.Errorf("expected %q in output, got: %s", want, out.String())
+			}
+		}
+	})
+
+	t.Run("when defaults are shrunk for a small host should mark them auto", func(t *testing.T) {
+		// Arrange
+		cmd, _, out, _ := setupConfigShow(t)
+		host := config.HostCapacity{CPUs: 2, MemoryMB: 4096, FreeDiskGB: 60}
+		ctx := withHostProbe(context.Background(), func() (config.HostCapacity, error) { return host, nil })
+
+		// Act
+		err := cmd.ExecuteContext(ctx)
+
+		// Assert
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !strings.Contains(out.String(), "Memory: 2048 MB (auto)") {
+			t.Errorf("expected shrunk memory marked auto, got: %s", out.String())
+		}
+	})
+}
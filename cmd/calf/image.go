@@ -0,0 +1,229 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/will-head/coding-agent-loader/internal/isolation"
+)
+
+// newImageCmd creates the image command group for publishing and fetching
+// golden images (e.g. a curated calf-init) through an OCI registry. The tart
+// client is resolved from the provider factory when a command runs.
+func newImageCmd(providers providerFactory, images *isolation.ImageStore, stdin io.Reader) *cobra.Command {
+	var tart *isolation.TartClient
+
+	imageCmd := &cobra.Command{
+		Use:   "image",
+		Short: "Push and pull golden images via an OCI registry",
+		Long: `Publish a curated VM (such as calf-init) to a team OCI registry and pull it
+on other machines, recording the manifest digest of every push and pull.
+
+Set the pinned reference printed by push or pull as base_image in
+~/.calf/config.yaml so every engineer starts from exactly the same image.`,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			var err error
+			tart, err = tartProvider(cmd, providers)
+			return err
+		},
+	}
+
+	var pushInsecure bool
+
+	pushCmd := &cobra.Command{
+		Use:   "push <vm> <reference>...",
+		Short: "Push a local VM to a registry",
+		Args:  cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runImagePush(cmd, tart, images, args[0], args[1:], pushInsecure)
+		},
+	}
+	pushCmd.Flags().BoolVar(&pushInsecure, "insecure", false, "Connect to the registry over plain HTTP")
+
+	var pullDigest string
+	var pullInsecure bool
+
+	pullCmd := &cobra.Command{
+		Use:   "pull <reference>",
+		Short: "Pull an image from a registry",
+		Long: `Pull an image into the Tart cache and record its digest.
+Download progress is shown on stderr as a progress bar, or as JSON lines
+when stderr is not a terminal.
+
+With --digest, the image is pulled by digest so Tart verifies the downloaded
+content, and the digest is recorded against the given tag. Without it, a
+warning is printed if the tag now resolves to a different digest than the
+last recorded pull.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runImagePull(cmd, tart, images, args[0], pullDigest, pullInsecure)
+		},
+	}
+	pullCmd.Flags().StringVar(&pullDigest, "digest", "", "Expected manifest digest (sha256:...)")
+	pullCmd.Flags().BoolVar(&pullInsecure, "insecure", false, "Connect to the registry over plain HTTP")
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List recorded images and their digests",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runImageList(cmd, images)
+		},
+	}
+
+	var loginUsername string
+	var loginInsecure bool
+
+	loginCmd := &cobra.Command{
+		Use:   "login <registry>",
+		Short: "Log in to a registry",
+		Long:  `Store registry credentials for Tart. The password is read from stdin.`,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runImageLogin(cmd, tart, stdin, args[0], loginUsername, loginInsecure)
+		},
+	}
+	loginCmd.Flags().StringVarP(&loginUsername, "username", "u", "", "Registry username")
+	loginCmd.Flags().BoolVar(&loginInsecure, "insecure", false, "Connect to the registry over plain HTTP")
+	loginCmd.MarkFlagRequired("username")
+
+	imageCmd.AddCommand(pushCmd)
+	imageCmd.AddCommand(pullCmd)
+	imageCmd.AddCommand(listCmd)
+	imageCmd.AddCommand(loginCmd)
+	return imageCmd
+}
+
+// runImagePush pushes a VM to each reference and records the pushed digest.
+func runImagePush(cmd *cobra.Command, tart *isolation.TartClient, images *isolation.ImageStore, vmName string, remotes []string, insecure bool) error {
+	out := cmd.OutOrStdout()
+
+	refs := make([]isolation.ImageRef, 0, len(remotes))
+	for _, remote := range remotes {
+		ref, err := isolation.ParseImageRef(remote)
+		if err != nil {
+			return err
+		}
+		if ref.Digest != "" {
+			return fmt.Errorf("cannot push to digest reference %s: use a tag", remote)
+		}
+		refs = append(refs, ref)
+	}
+
+	switch tart.GetState(vmName) {
+	case isolation.StateNotFound:
+		return fmt.Errorf("%s does not exist", vmName)
+	case isolation.StateStopped:
+	default:
+		return fmt.Errorf("%s must be stopped before pushing", vmName)
+	}
+
+	fmt.Fprintf(out, "Pushing %s to %s...\n", vmName, strings.Join(remotes, ", "))
+	if err := tart.Push(vmName, remotes, insecure); err != nil {
+		return err
+	}
+
+	for _, ref := range refs {
+		digest, err := tart.ImageDigest(ref)
+		if err != nil {
+			return err
+		}
+		rec := isolation.ImageRecord{Reference: ref.String(), Digest: digest, Source: "push", Time: time.Now()}
+		if err := images.Record(rec); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Pushed %s\n", rec.Pinned())
+	}
+	return nil
+}
+
+// runImagePull pulls an image, verifying or recording its digest.
+func runImagePull(cmd *cobra.Command, tart *isolation.TartClient, images *isolation.ImageStore, remote, expectedDigest string, insecure bool) error {
+	out := cmd.OutOrStdout()
+
+	ref, err := isolation.ParseImageRef(remote)
+	if err != nil {
+		return err
+	}
+
+	pullRef := ref
+	if expectedDigest != "" {
+		if ref.Digest != "" && ref.Digest != expectedDigest {
+			return fmt.Errorf("--digest %s does not match reference %s", expectedDigest, remote)
+		}
+		if _, err := isolation.ParseImageRef(ref.Pinned(expectedDigest).String()); err != nil {
+			return fmt.Errorf("invalid --digest: %w", err)
+		}
+		pullRef = ref.Pinned(expectedDigest)
+	}
+
+	previous, found, err := images.Get(ref.String())
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Pulling %s...\n", pullRef)
+	progress := newPullProgressReporter(cmd.ErrOrStderr())
+	if err := tart.PullWithProgress(pullRef.String(), insecure, progress); err != nil {
+		return err
+	}
+
+	digest, err := tart.ImageDigest(pullRef)
+	if err != nil {
+		return err
+	}
+	if found && previous.Digest != digest && expectedDigest == "" {
+		fmt.Fprintf(out, "Warning: %s changed since last recorded %s\n", ref, previous.Source)
+		fmt.Fprintf(out, "  was: %s\n", previous.Digest)
+		fmt.Fprintf(out, "  now: %s\n", digest)
+	}
+
+	rec := isolation.ImageRecord{Reference: ref.String(), Digest: digest, Source: "pull", Time: time.Now()}
+	if err := images.Record(rec); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Pulled %s\n", rec.Pinned())
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "To use this exact image for new VMs, set in ~/.calf/config.yaml:")
+	fmt.Fprintf(out, "  isolation.defaults.vm.base_image: %s\n", rec.Pinned())
+	return nil
+}
+
+// runImageList prints all recorded images.
+func runImageList(cmd *cobra.Command, images *isolation.ImageStore) error {
+	out := cmd.OutOrStdout()
+
+	records, err := images.List()
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		fmt.Fprintln(out, "No images recorded. Use 'calf isolation image pull' or 'push'.")
+		return nil
+	}
+
+	for _, rec := range records {
+		fmt.Fprintf(out, "%s\n", rec.Reference)
+		fmt.Fprintf(out, "  Digest: %s\n", rec.Digest)
+		fmt.Fprintf(out, "  Last %s: %s\n", rec.Source, rec.Time.Local().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// runImageLogin reads a password from stdin, without echo on a terminal, and
+// logs in.
+func runImageLogin(cmd *cobra.Command, tart *isolation.TartClient, stdin io.Reader, host, username string, insecure bool) error {
+	password, err := readSecret(cmd.ErrOrStderr(), stdin, fmt.Sprintf("Password for %s@%s: ", username, host), "password")
+	if err != nil {
+		return err
+	}
+
+	if err := tart.Login(host, username, password, insecure); err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "Logged in to %s\n", host)
+	return nil
+}
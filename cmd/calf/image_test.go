@@ -0,0 +1,331 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/will-head/coding-agent-loader/internal/isolation"
+)
+
+const (
+	digestA = "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	digestB = "sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+)
+
+// fakeRegistry is a test stand-in for a registry reached through tart. Pushes
+// and pulls populate a temporary Tart OCI cache the way tart does, so digests
+// resolve exactly as they would against a real registry.
+type fakeRegistry struct {
+	t        *testing.T
+	tartHome string
+	tags     map[string]string // repository:tag -> digest
+	vms      string            // tart list JSON
+	pushed   string            // digest assigned to pushed images
+	calls    [][]string
+}
+
+func (r *fakeRegistry) run(args ...string) (string, error) {
+	r.calls = append(r.calls, args)
+	switch args[0] {
+	case "list":
+		return r.vms, nil
+	case "pull":
+		ref, _ := isolation.ParseImageRef(args[1])
+		digest := ref.Digest
+		if digest == "" {
+			digest = r.tags[ref.String()]
+		}
+		r.cache(ref, digest)
+	case "push":
+		for _, remote := range args[2:] {
+			if strings.HasPrefix(remote, "--") {
+				continue
+			}
+			ref, _ := isolation.ParseImageRef(remote)
+			r.tags[ref.String()] = r.pushed
+			r.cache(ref, r.pushed)
+		}
+	}
+	return "", nil
+}
+
+// stream emits tart-style pull progress before running the command.
+func (r *fakeRegistry) stream(onLine func(string), args ...string) (string, error) {
+	if args[0] == "pull" {
+		for _, line := range []string{"pulling manifest...", "pulling disk (2.0 GB compressed)...", "50%", "100%"} {
+			onLine(line)
+		}
+	}
+	return r.run(args...)
+}
+
+// cache writes the digest directory and tag symlink for ref.
+func (r *fakeRegistry) cache(ref isolation.ImageRef, digest string) {
+	repoDir := filepath.Join(r.tartHome, "cache", "OCIs", filepath.FromSlash(ref.Repository))
+	if err := os.MkdirAll(filepath.Join(repoDir, digest), 0755); err != nil {
+		r.t.Fatal(err)
+	}
+	if ref.Tag == "" {
+		return
+	}
+	link := filepath.Join(repoDir, ref.Tag)
+	os.Remove(link)
+	if err := os.Symlink(filepath.Join(repoDir, digest), link); err != nil {
+		r.t.Fatal(err)
+	}
+}
+
+// setupImageCmd creates a fresh image command backed by a fake registry.
+// Progress output written to stderr is discarded.
+func setupImageCmd(t *testing.T, registry *fakeRegistry, images *isolation.ImageStore, stdinContent string, args ...string) (*cobra.Command, *bytes.Buffer) {
+	t.Helper()
+	cmd, out, _ := setupImageCmdWithStderr(t, registry, images, stdinContent, args...)
+	return cmd, out
+}
+
+// setupImageCmdWithStderr creates a fresh image command backed by a fake
+// registry, also returning the stderr buffer.
+func setupImageCmdWithStderr(t *testing.T, registry *fakeRegistry, images *isolation.ImageStore, stdinContent string, args ...string) (*cobra.Command, *bytes.Buffer, *bytes.Buffer) {
+	t.Helper()
+	registry.t = t
+	registry.tartHome = t.TempDir()
+	if registry.tags == nil {
+		registry.tags = map[string]string{}
+	}
+	out, errOut := &bytes.Buffer{}, &bytes.Buffer{}
+	tart := isolation.NewTartClient(
+		isolation.WithTartPath("/mock/tart"),
+		isolation.WithRunCommand(registry.run),
+		isolation.WithStreamCommand(registry.stream),
+		isolation.WithTartHome(registry.tartHome),
+	)
+	cmd := newImageCmd(staticProvider(tart, nil), images, strings.NewReader(stdinContent))
+	cmd.SetOut(out)
+	cmd.SetErr(errOut)
+	cmd.SetArgs(args)
+	return cmd, out, errOut
+}
+
+func TestImagePull(t *testing.T) {
+	t.Run("when pulling a tag should record its digest and print pinned reference", func(t *testing.T) {
+		// Arrange
+		registry := &fakeRegistry{tags: map[string]string{"ghcr.io/org/calf-init:latest": digestA}}
+		images := isolation.NewImageStore(t.TempDir())
+		cmd, out := setupImageCmd(t, registry, images, "", "pull", "ghcr.io/org/calf-init")
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		rec, found, _ := images.Get("ghcr.io/org/calf-init:latest")
+		if !found || rec.Digest != digestA || rec.Source != "pull" {
+			t.Errorf("expected pull record with digest A, got %+v (found %v)", rec, found)
+		}
+		if !strings.Contains(out.String(), "ghcr.io/org/calf-init@"+digestA) {
+			t.Errorf("expected pinned reference in output, got: %s", out.String())
+		}
+	})
+
+	t.Run("when stderr is not a terminal should report progress as JSON lines", func(t *testing.T) {
+		// Arrange
+		registry := &fakeRegistry{tags: map[string]string{"ghcr.io/org/calf-init:latest": digestA}}
+		cmd, _, errOut := setupImageCmdWithStderr(t, registry, isolation.NewImageStore(t.TempDir()), "", "pull", "ghcr.io/org/calf-init")
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := `{"event":"pull_progress","stage":"disk","bytes_downloaded":1000000000,"bytes_total":2000000000}`
+		if !strings.Contains(errOut.String(), want) {
+			t.Errorf("expected JSON progress event %s, got: %s", want, errOut.String())
+		}
+		if !strings.Contains(errOut.String(), `"stage":"done"`) {
+			t.Errorf("expected done event, got: %s", errOut.String())
+		}
+	})
+
+	t.Run("when tag digest changed since last pull should warn", func(t *testing.T) {
+		// Arrange
+		registry := &fakeRegistry{tags: map[string]string{"ghcr.io/org/calf-init:latest": digestB}}
+		images := isolation.NewImageStore(t.TempDir())
+		if err := images.Record(isolation.ImageRecord{Reference: "ghcr.io/org/calf-init:latest", Digest: digestA, Source: "pull"}); err != nil {
+			t.Fatal(err)
+		}
+		cmd, out := setupImageCmd(t, registry, images, "", "pull", "ghcr.io/org/calf-init:latest")
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !strings.Contains(out.String(), "Warning: ghcr.io/org/calf-init:latest changed") {
+			t.Errorf("expected digest change warning, got: %s", out.String())
+		}
+	})
+
+	t.Run("when digest flag set should pull by digest and record it against the tag", func(t *testing.T) {
+		// Arrange
+		registry := &fakeRegistry{}
+		images := isolation.NewImageStore(t.TempDir())
+		cmd, _ := setupImageCmd(t, registry, images, "", "pull", "localhost:5000/calf-init:v2", "--digest", digestA, "--insecure")
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		expected := []string{"pull", "localhost:5000/calf-init@" + digestA, "--insecure"}
+		if !slices.Equal(registry.calls[0], expected) {
+			t.Errorf("expected pull by digest %v, got %v", expected, registry.calls[0])
+		}
+		rec, found, _ := images.Get("localhost:5000/calf-init:v2")
+		if !found || rec.Digest != digestA {
+			t.Errorf("expected digest recorded against tag, got %+v (found %v)", rec, found)
+		}
+	})
+
+	t.Run("when digest flag is malformed should return error without pulling", func(t *testing.T) {
+		// Arrange
+		registry := &fakeRegistry{}
+		cmd, _ := setupImageCmd(t, registry, isolation.NewImageStore(t.TempDir()), "", "pull", "ghcr.io/org/calf-init", "--digest", "abc")
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "invalid --digest") {
+			t.Errorf("expected invalid digest error, got: %v", err)
+		}
+		if len(registry.calls) != 0 {
+			t.Errorf("expected no tart calls, got %v", registry.calls)
+		}
+	})
+}
+
+func TestImagePush(t *testing.T) {
+	t.Run("when VM is stopped should push and record digest for each reference", func(t *testing.T) {
+		// Arrange
+		registry := &fakeRegistry{vms: `[{"name":"calf-init","state":"stopped"}]`, pushed: digestA}
+		images := isolation.NewImageStore(t.TempDir())
+		cmd, out := setupImageCmd(t, registry, images, "", "push", "calf-init", "ghcr.io/org/calf-init:v2", "ghcr.io/org/calf-init:latest")
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		records, _ := images.List()
+		if len(records) != 2 || records[0].Digest != digestA || records[1].Digest != digestA {
+			t.Errorf("expected two push records with digest A, got %+v", records)
+		}
+		if !strings.Contains(out.String(), "Pushed ghcr.io/org/calf-init@"+digestA) {
+			t.Errorf("expected pinned reference in output, got: %s", out.String())
+		}
+	})
+
+	t.Run("when VM is running should return error without pushing", func(t *testing.T) {
+		// Arrange
+		registry := &fakeRegistry{vms: `[{"name":"calf-init","state":"running"}]`}
+		cmd, _ := setupImageCmd(t, registry, isolation.NewImageStore(t.TempDir()), "", "push", "calf-init", "ghcr.io/org/calf-init:v2")
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "must be stopped") {
+			t.Errorf("expected must be stopped error, got: %v", err)
+		}
+		if slices.ContainsFunc(registry.calls, func(args []string) bool { return args[0] == "push" }) {
+			t.Errorf("expected no push, got %v", registry.calls)
+		}
+	})
+}
+
+func TestImageList(t *testing.T) {
+	t.Run("when no images recorded should say so", func(t *testing.T) {
+		// Arrange
+		cmd, out := setupImageCmd(t, &fakeRegistry{}, isolation.NewImageStore(t.TempDir()), "", "list")
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !strings.Contains(out.String(), "No images recorded") {
+			t.Errorf("expected empty message, got: %s", out.String())
+		}
+	})
+
+	t.Run("when images recorded should show reference and digest", func(t *testing.T) {
+		// Arrange
+		images := isolation.NewImageStore(t.TempDir())
+		if err := images.Record(isolation.ImageRecord{Reference: "ghcr.io/org/calf-init:v2", Digest: digestA, Source: "push"}); err != nil {
+			t.Fatal(err)
+		}
+		cmd, out := setupImageCmd(t, &fakeRegistry{}, images, "", "list")
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !strings.Contains(out.String(), "ghcr.io/org/calf-init:v2") || !strings.Contains(out.String(), digestA) {
+			t.Errorf("expected reference and digest in output, got: %s", out.String())
+		}
+	})
+}
+
+func TestImageLogin(t *testing.T) {
+	t.Run("when password is empty should return error", func(t *testing.T) {
+		// Arrange
+		cmd, _ := setupImageCmd(t, &fakeRegistry{}, isolation.NewImageStore(t.TempDir()), "\n", "login", "ghcr.io", "--username", "ci")
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "password must not be empty") {
+			t.Errorf("expected empty password error, got: %v", err)
+		}
+	})
+}
+
+func TestImageProvider(t *testing.T) {
+	t.Run("when provider is not tart should refuse", func(t *testing.T) {
+		// Arrange
+		lima := isolation.NewLimaClient(isolation.WithLimactlPath("/mock/limactl"))
+		cmd := newImageCmd(staticProvider(lima, nil), isolation.NewImageStore(t.TempDir()), strings.NewReader(""))
+		cmd.SetOut(&bytes.Buffer{})
+		cmd.SetErr(&bytes.Buffer{})
+		cmd.SetArgs([]string{"pull", "ghcr.io/org/calf-init"})
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "not supported by the lima provider") {
+			t.Errorf("expected unsupported provider error, got: %v", err)
+		}
+	})
+}
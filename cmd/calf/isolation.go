@@ -2,48 +2,422 @@ package main
 
 import (
 	"bufio"
+	"cmp"
 	"fmt"
 	"io"
+	"os"
+	"os/exec"
+	"slices"
 	"strings"
 
 	"github.com/spf13/cobra"
+	"github.com/will-head/coding-agent-loader/internal/config"
 	"github.com/will-head/coding-agent-loader/internal/isolation"
+	"github.com/will-head/coding-agent-loader/internal/netd"
+	"github.com/will-head/coding-agent-loader/internal/smbblock"
 )
 
-// newIsolationCmd creates the isolation command group with injectable tart client and stdin.
-func newIsolationCmd(tart *isolation.TartClient, stdin io.Reader) *cobra.Command {
+// vmUser is the account calf's VM images log in as.
+const vmUser = "admin"
+
+// smbBlocker loads the pf SMB-block anchor for a VM for the lifetime of its
+// tart process, and finds rules left in the anchor by VMs calf-netd does not
+// own. Implemented by netdBlocker, and by simBlocker for simulated VMs.
+type smbBlocker interface {
+	Status() (netd.State, error)
+	LoadAnchor(vmIP string, tartPID int) error
+	ReloadAnchor() error
+	StuckIPs(runningVMIPs []string) ([]string, error)
+}
+
+// netdBlocker is the smbBlocker used by calf: calf-netd owns the anchor, and
+// its rules are read with pfctl through the calf-pfctl sudoers drop-in.
+type netdBlocker struct {
+	*netd.Client
+	*smbblock.Manager
+}
+
+// simBlocker is the smbBlocker for simulated VMs. It keeps the blocked VMs in
+// memory, so the no-network flow can be rehearsed on any host without
+// reaching the real calf-netd or pf.
+type simBlocker struct {
+	vms []netd.BlockedVM
+}
+
+// Status returns the VMs blocked so far.
+func (b *simBlocker) Status() (netd.State, error) {
+	return netd.State{VMs: slices.Clone(b.vms)}, nil
+}
+
+// LoadAnchor records the VM as blocked.
+func (b *simBlocker) LoadAnchor(vmIP string, tartPID int) error {
+	b.vms = append(b.vms, netd.BlockedVM{IP: vmIP, PID: tartPID})
+	return nil
+}
+
+// ReloadAnchor does nothing: the blocked VMs are all the simulator has.
+func (b *simBlocker) ReloadAnchor() error {
+	return nil
+}
+
+// StuckIPs returns nothing: simulated rules are never left behind.
+func (b *simBlocker) StuckIPs(runningVMIPs []string) ([]string, error) {
+	return nil, nil
+}
+
+// newIsolationCmd creates the isolation command group with injectable VM
+// provider factory, SMB blocker, and stdin. The provider and its mode store
+// are chosen when a command runs, so the --provider flag can select them.
+// Simulated VMs get an in-memory simBlocker instead of hostBlocker.
+func newIsolationCmd(providers providerFactory, hostBlocker smbBlocker, stdin io.Reader) *cobra.Command {
+	var provider isolation.Provider
+	var modes *isolation.ModeStore
+	var blocker smbBlocker
+	var providerName string
+	var hostName string
+
 	isolationCmd := &cobra.Command{
 		Use:     "isolation",
 		Aliases: []string{"iso"},
 		Short:   "Manage isolation VMs",
-		Long:    `Manage CALF isolation VMs (calf-dev and calf-init) via Tart.`,
+		Long: `Manage CALF isolation VMs (calf-dev and calf-init) via a VM provider:
+tart (default, macOS), lima (Linux), or sim (simulated VMs for demos and tests).
+The provider is chosen by --provider, else $CALF_PROVIDER, else isolation.provider in config.
+
+With --host (or $CALF_HOST, or isolation.host in config), tart runs on a remote
+Mac over SSH instead, so several machines can share one host.`,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			var err error
+			provider, modes, err = providers(selectedTarget(providerName, hostName, cmd.ErrOrStderr(), loadOptions(cmd)...))
+			if err != nil {
+				return err
+			}
+			blocker = hostBlocker
+			if provider.Name() == isolation.ProviderSim {
+				blocker = &simBlocker{}
+			}
+			return nil
+		},
 	}
+	isolationCmd.PersistentFlags().StringVar(&providerName, "provider", "", "VM provider: tart, lima, or sim")
+	isolationCmd.PersistentFlags().StringVar(&hostName, "host", "", "Run tart on a remote Mac over SSH (e.g. dev@studio.local)")
 
 	var skipConfirm bool
+	var noMount bool
+	var noNetwork bool
+	var safeMode bool
 
 	initCmd := &cobra.Command{
 		Use:   "init",
 		Short: "Initialize isolation VMs",
-		Long:  `Initialize CALF isolation VMs. Creates calf-dev from the base image and calf-init as a snapshot.`,
+		Long: `Initialize CALF isolation VMs. Creates calf-dev from the base image and calf-init as a snapshot.
+
+Isolation modes are set permanently at init and enforced on every start:
+  --no-mount    no host filesystem mounts (isolated filesystem)
+  --no-network  softnet with local network blocked (internet allowed)
+  --safe-mode   both --no-mount and --no-network
+Modes requested in calf-dev's vm.yaml (isolation.no_mount, isolation.no_network)
+apply as well. To change modes, the VMs must be destroyed and recreated.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runIsolationInit(cmd, tart, stdin, skipConfirm)
+			// Init does not provision the VMs yet, so it runs no project
+			// commands and untrusted ones are simply withheld.
+			configured, err := initConfig("calf-dev", loadOptions(cmd)...)
+			if err != nil {
+				return err
+			}
+			mode := isolation.IsolationMode{
+				NoMount:   noMount || safeMode || configured.NoMount,
+				NoNetwork: noNetwork || safeMode || configured.NoNetwork,
+			}
+			return runIsolationInit(cmd, provider, modes, stdin, skipConfirm, mode)
 		},
 	}
 	initCmd.Flags().BoolVarP(&skipConfirm, "yes", "y", false, "Skip all confirmation prompts")
+	initCmd.Flags().BoolVar(&noMount, "no-mount", false, "Create VMs with no host filesystem mounts")
+	initCmd.Flags().BoolVar(&noNetwork, "no-network", false, "Create VMs with network isolation (blocks local network)")
+	initCmd.Flags().BoolVar(&safeMode, "safe-mode", false, "Enable both --no-mount and --no-network")
+
+	statusCmd := &cobra.Command{
+		Use:   "status [vm]",
+		Short: "Show isolation VM status",
+		Long:  `Show the state, size, and isolation mode of an isolation VM (default: calf-dev).`,
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runIsolationStatus(cmd, provider, modes, vmNameArg(args))
+		},
+	}
+
+	var noSMBBlock bool
+	var clearSMBBlock bool
+	var guiNetwork isolation.NetworkOptions
+
+	guiCmd := &cobra.Command{
+		Use:   "gui",
+		Short: "Start calf-dev with VNC",
+		Long: `Start calf-dev in the background with VNC experimental mode (bidirectional clipboard).
+
+The VNC window opens automatically and calf returns immediately. In no-network
+mode, SMB is blocked via calf-netd for as long as the VM window is open; the
+block is removed by calf-netd when the VM stops, even after calf has exited.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if clearSMBBlock {
+				if err := clearStuckSMBBlock(cmd.OutOrStdout(), blocker); err != nil {
+					return err
+				}
+			}
+			return runIsolationGUI(cmd, provider, modes, blocker, "calf-dev", noSMBBlock, guiNetwork)
+		},
+	}
+	guiCmd.Flags().BoolVar(&noSMBBlock, "no-smb-block", false, "Disable SMB blocking in no-network mode (testing only)")
+	guiCmd.Flags().BoolVar(&clearSMBBlock, "clear-smb-block", false, "Remove stuck SMB block rules first (use if calf crashed)")
+	addNetworkFlags(guiCmd, &guiNetwork)
+
+	var startNoSMBBlock bool
+	var startClearSMBBlock bool
+	var startSerial bool
+	var startNetwork isolation.NetworkOptions
+
+	startCmd := &cobra.Command{
+		Use:   "start [vm]",
+		Short: "Start or resume a VM in the background",
+		Long: `Start an isolation VM (default: calf-dev) headless in the background.
+
+VMs are started suspendable, so they can later be suspended with
+'calf isolation suspend'. A suspended VM is resumed from its saved state
+instead of cold-booting.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if startClearSMBBlock {
+				if err := clearStuckSMBBlock(cmd.OutOrStdout(), blocker); err != nil {
+					return err
+				}
+			}
+			return runIsolationStart(cmd, provider, modes, blocker, vmNameArg(args), startNoSMBBlock, false, startSerial, startNetwork)
+		},
+	}
+	startCmd.Flags().BoolVar(&startNoSMBBlock, "no-smb-block", false, "Disable SMB blocking in no-network mode (testing only)")
+	startCmd.Flags().BoolVar(&startClearSMBBlock, "clear-smb-block", false, "Remove stuck SMB block rules first (use if calf crashed)")
+	startCmd.Flags().BoolVar(&startSerial, "serial", false, "Write the serial console to serial.log next to the boot log")
+	addNetworkFlags(startCmd, &startNetwork)
+
+	suspendCmd := &cobra.Command{
+		Use:   "suspend [vm]",
+		Short: "Suspend a running VM to disk",
+		Long:  `Save a running VM's memory to disk and stop it (default: calf-dev). Suspended VMs do not count towards the two-VM limit.`,
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runIsolationSuspend(cmd, provider, vmNameArg(args))
+		},
+	}
+
+	var resumeNoSMBBlock bool
+	var resumeClearSMBBlock bool
+	var resumeSerial bool
+	var resumeNetwork isolation.NetworkOptions
+
+	resumeCmd := &cobra.Command{
+		Use:   "resume [vm]",
+		Short: "Resume a suspended VM",
+		Long:  `Resume a suspended VM (default: calf-dev) from its saved state in the background.`,
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if resumeClearSMBBlock {
+				if err := clearStuckSMBBlock(cmd.OutOrStdout(), blocker); err != nil {
+					return err
+				}
+			}
+			return runIsolationStart(cmd, provider, modes, blocker, vmNameArg(args), resumeNoSMBBlock, true, resumeSerial, resumeNetwork)
+		},
+	}
+	resumeCmd.Flags().BoolVar(&resumeNoSMBBlock, "no-smb-block", false, "Disable SMB blocking in no-network mode (testing only)")
+	resumeCmd.Flags().BoolVar(&resumeClearSMBBlock, "clear-smb-block", false, "Remove stuck SMB block rules first (use if calf crashed)")
+	resumeCmd.Flags().BoolVar(&resumeSerial, "serial", false, "Write the serial console to serial.log next to the boot log")
+	addNetworkFlags(resumeCmd, &resumeNetwork)
+
+	sshCmd := &cobra.Command{
+		Use:   "ssh [vm] [-- command...]",
+		Short: "Open an SSH session to a running VM",
+		Long: `Open an SSH session as admin to a running tart VM (default: calf-dev), or run
+the command given after --. VMs on a remote host are reached by jumping
+through the host (ssh -J), since their addresses are only reachable from it.`,
+		Args: cobra.ArbitraryArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			vmArgs, command := args, []string(nil)
+			if dash := cmd.ArgsLenAtDash(); dash >= 0 {
+				vmArgs, command = args[:dash], args[dash:]
+			}
+			if len(vmArgs) > 1 {
+				return fmt.Errorf("accepts at most 1 VM name, received %d", len(vmArgs))
+			}
+			return runIsolationSSH(cmd, provider, stdin, vmNameArg(vmArgs), command)
+		},
+	}
 
 	isolationCmd.AddCommand(initCmd)
+	isolationCmd.AddCommand(statusCmd)
+	isolationCmd.AddCommand(startCmd)
+	isolationCmd.AddCommand(guiCmd)
+	isolationCmd.AddCommand(suspendCmd)
+	isolationCmd.AddCommand(resumeCmd)
+	isolationCmd.AddCommand(sshCmd)
 	return isolationCmd
 }
 
-// runIsolationInit implements the two-step init flow when VMs already exist.
-func runIsolationInit(cmd *cobra.Command, tart *isolation.TartClient, stdin io.Reader, skipConfirm bool) error {
-	devExists := tart.Exists("calf-dev")
-	initExists := tart.Exists("calf-init")
+// addNetworkFlags adds the flags that set a VM's networking for one run to
+// cmd, storing them in network. They are checked by NetworkOptions.Validate
+// when the command runs; no-network mode still applies on top of them.
+func addNetworkFlags(cmd *cobra.Command, network *isolation.NetworkOptions) {
+	cmd.Flags().StringVar((*string)(&network.Mode), "network", "", "Network mode: softnet, bridged, or host-only (default: shared NAT)")
+	cmd.Flags().StringSliceVar(&network.SoftnetAllow, "softnet-allow", nil, "CIDRs the VM may reach with --network softnet")
+	cmd.Flags().StringSliceVar(&network.SoftnetBlock, "softnet-block", nil, "CIDRs the VM may not reach with --network softnet")
+	cmd.Flags().StringVar(&network.BridgedInterface, "bridged-interface", "", "Host interface to bridge to with --network bridged (e.g. en0)")
+}
+
+// initConfig loads the VM's config for init: it returns the isolation mode
+// requested by the isolation section of the VM's config file, and checks that
+// the VMs init creates fit the host's free disk space.
+func initConfig(vmName string, opts ...config.LoadOption) (isolation.IsolationMode, error) {
+	globalConfigPath, err := config.GetDefaultConfigPath()
+	if err != nil {
+		return isolation.IsolationMode{}, fmt.Errorf("getting default config path: %w", err)
+	}
+	vmConfigPath, err := config.GetVMConfigPath(vmName)
+	if err != nil {
+		return isolation.IsolationMode{}, fmt.Errorf("getting VM config path: %w", err)
+	}
+	cfg, err := config.LoadConfig(globalConfigPath, vmConfigPath, opts...)
+	if err != nil {
+		return isolation.IsolationMode{}, fmt.Errorf("loading configuration: %w", err)
+	}
+	if err := cfg.ValidateForCreate(vmConfigPath); err != nil {
+		return isolation.IsolationMode{}, err
+	}
+	return isolation.IsolationMode{NoMount: cfg.VM.Isolation.NoMount, NoNetwork: cfg.VM.Isolation.NoNetwork}, nil
+}
+
+// providerFactory returns the VM provider with the given name, running on the
+// given remote host, or locally if host is empty, and the store of its VMs'
+// isolation modes.
+type providerFactory func(name, host string) (isolation.Provider, *isolation.ModeStore, error)
+
+// selectedTarget returns the VM provider to use and the remote host to run
+// it on, as resolved by LoadConfig from the --provider and --host flags, the
+// CALF_PROVIDER and CALF_HOST environment variables, and isolation.provider
+// and isolation.host in the global config. An empty host means the VMs run
+// locally. If the config cannot be loaded, a warning is written to errOut and
+// only the flags are used, with tart as the default provider; commands that
+// load the config report the error.
+func selectedTarget(providerFlag, hostFlag string, errOut io.Writer, opts ...config.LoadOption) (provider, host string) {
+	flags := map[string]string{}
+	if providerFlag != "" {
+		flags[config.FlagName("isolation.provider")] = providerFlag
+	}
+	if hostFlag != "" {
+		flags[config.FlagName("isolation.host")] = hostFlag
+	}
+	globalConfigPath, err := config.GetDefaultConfigPath()
+	var cfg *config.Config
+	if err == nil {
+		cfg, err = config.LoadConfig(globalConfigPath, "", append(opts, config.WithFlagOverrides(flags))...)
+	}
+	if err != nil {
+		fmt.Fprintf(errOut, "Warning: %v; ignoring the config file\n", err)
+		return cmp.Or(providerFlag, isolation.ProviderTart), hostFlag
+	}
+	return cmp.Or(cfg.Isolation.Provider, isolation.ProviderTart), cfg.Isolation.Host
+}
+
+// newProvider returns the VM provider with the given name and the store of its
+// VMs' isolation modes. Tart reuses the already configured tart client and
+// the local modes, unless host names a remote Mac to run it on, where the
+// modes and boot logs are kept too; the simulator keeps its state in
+// ~/.calf/isolation/sim.yaml so it persists across calf invocations, and its
+// modes in ~/.calf/isolation/sim-vms, apart from those of real VMs.
+func newProvider(name, host string, tart *isolation.TartClient, modes *isolation.ModeStore) (isolation.Provider, *isolation.ModeStore, error) {
+	if err := isolation.ValidateProvider(name); err != nil {
+		return nil, nil, err
+	}
+	if host != "" {
+		if name != isolation.ProviderTart {
+			return nil, nil, fmt.Errorf("remote hosts are only supported by the %s provider, not %s", isolation.ProviderTart, name)
+		}
+		remote, err := isolation.NewRemoteHost(host)
+		if err != nil {
+			return nil, nil, err
+		}
+		remoteModes := isolation.NewRemoteModeStore(remote)
+		return isolation.NewTartClient(
+			isolation.WithModeStore(remoteModes),
+			isolation.WithLogStore(isolation.NewRemoteLogStore(remote)),
+			isolation.WithStateCacheTTL(stateCacheTTL),
+			isolation.WithCloneProgress(newPullProgressReporter(os.Stderr)),
+			isolation.WithRemoteHost(remote),
+		), remoteModes, nil
+	}
+	switch name {
+	case isolation.ProviderLima:
+		return isolation.NewLimaClient(isolation.WithLimaModeStore(modes)), modes, nil
+	case isolation.ProviderSim:
+		return isolation.NewDefaultSimProvider(), isolation.NewDefaultSimModeStore(), nil
+	}
+	return tart, modes, nil
+}
+
+// tartProvider resolves the VM provider like the isolation commands do, for
+// the image, export and import commands. They work on the local Tart cache and
+// VM directories, so other providers and remote hosts are rejected.
+func tartProvider(cmd *cobra.Command, providers providerFactory) (*isolation.TartClient, error) {
+	providerFlag, _ := cmd.Flags().GetString("provider")
+	hostFlag, _ := cmd.Flags().GetString("host")
+	provider, _, err := providers(selectedTarget(providerFlag, hostFlag, cmd.ErrOrStderr(), loadOptions(cmd)...))
+	if err != nil {
+		return nil, err
+	}
+	tart, ok := provider.(*isolation.TartClient)
+	if !ok {
+		return nil, fmt.Errorf("%s is not supported by the %s provider", cmd.CommandPath(), provider.Name())
+	}
+	if host := tart.RemoteHost(); host != nil {
+		return nil, fmt.Errorf("%s is not supported on a remote host (%s): it uses the local Tart cache", cmd.CommandPath(), host.Target())
+	}
+	return tart, nil
+}
+
+// remoteHost returns the host a provider runs its VMs on, or nil if they run
+// on this machine.
+func remoteHost(provider isolation.Provider) *isolation.RemoteHost {
+	if remote, ok := provider.(isolation.Remote); ok {
+		return remote.RemoteHost()
+	}
+	return nil
+}
+
+// vmNameArg returns the VM named by an optional positional argument,
+// defaulting to calf-dev.
+func vmNameArg(args []string) string {
+	if len(args) == 1 {
+		return args[0]
+	}
+	return "calf-dev"
+}
+
+// runIsolationInit implements the two-step init flow when VMs already exist,
+// then records the requested isolation mode for the new VMs. Modes the
+// provider cannot enforce are refused before anything is changed.
+func runIsolationInit(cmd *cobra.Command, provider isolation.Provider, modes *isolation.ModeStore, stdin io.Reader, skipConfirm bool, mode isolation.IsolationMode) error {
+	if verifier, ok := provider.(isolation.ModeVerifier); ok {
+		if err := verifier.VerifyMode(mode); err != nil {
+			return err
+		}
+	}
+	states, _ := provider.Snapshot()
+	devExists := states.Exists("calf-dev")
+	initExists := states.Exists("calf-init")
+	reader := bufio.NewReader(stdin)
 
 	if devExists && initExists && !skipConfirm {
 		// Step 1: offer to replace calf-init with current calf-dev
 		fmt.Fprintf(cmd.OutOrStdout(), "Do you want to replace calf-init with current calf-dev? (y/N) ")
-		reader := bufio.NewReader(stdin)
 		reply, _ := reader.ReadString('\n')
 		reply = strings.TrimSpace(strings.ToLower(reply))
 		if reply == "y" || reply == "yes" {
@@ -62,26 +436,320 @@ func runIsolationInit(cmd *cobra.Command, tart *isolation.TartClient, stdin io.R
 		}
 	}
 
+	if !mode.IsShared() && !skipConfirm {
+		if !confirmIsolationMode(cmd.OutOrStdout(), reader, mode) {
+			fmt.Fprintln(cmd.OutOrStdout(), "Aborted initialization")
+			return nil
+		}
+	}
+
 	if devExists || initExists {
 		// TODO: git safety check before deleting VMs (1.7)
 		if devExists {
-			if tart.IsRunning("calf-dev") {
-				if err := tart.Stop("calf-dev", false); err != nil {
+			if states.IsRunning("calf-dev") {
+				if err := provider.Stop("calf-dev", false); err != nil {
 					return fmt.Errorf("failed to stop calf-dev: %w", err)
 				}
 			}
-			if err := tart.Delete("calf-dev"); err != nil {
+			if err := provider.Delete("calf-dev"); err != nil {
 				return fmt.Errorf("failed to delete calf-dev: %w", err)
 			}
 		}
 		if initExists {
-			if err := tart.Delete("calf-init"); err != nil {
+			if err := provider.Delete("calf-init"); err != nil {
 				return fmt.Errorf("failed to delete calf-init: %w", err)
 			}
 		}
 	}
 
+	for _, vm := range []string{"calf-dev", "calf-init"} {
+		if err := modes.Save(vm, mode); err != nil {
+			return fmt.Errorf("failed to record isolation mode for %s: %w", vm, err)
+		}
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "Isolation mode: %s\n", mode.Description())
+
 	// TODO: implement full init from base image (1.6)
 	fmt.Fprintln(cmd.OutOrStdout(), "Initializing VMs...")
 	return nil
 }
+
+// confirmIsolationMode warns that isolation modes are permanent and asks the
+// user to continue. An empty reply accepts (Y/n).
+func confirmIsolationMode(out io.Writer, reader *bufio.Reader, mode isolation.IsolationMode) bool {
+	fmt.Fprintln(out, "Isolation Mode Warning")
+	fmt.Fprintf(out, "This will create VMs in %s.\n", strings.ToLower(mode.Description()))
+	if mode.NoMount {
+		fmt.Fprintln(out, "  • No host filesystem mounts (isolated filesystem)")
+	}
+	if mode.NoNetwork {
+		fmt.Fprintln(out, "  • Network isolated (internet allowed, local network blocked)")
+	}
+	fmt.Fprintln(out, "These settings are PERMANENT and cannot be changed later.")
+	fmt.Fprintln(out, "To change modes, you must destroy and recreate the VMs.")
+	fmt.Fprint(out, "Continue? (Y/n) ")
+
+	reply, _ := reader.ReadString('\n')
+	reply = strings.TrimSpace(strings.ToLower(reply))
+	return reply == "" || reply == "y" || reply == "yes"
+}
+
+// runIsolationStatus prints the state, size, and isolation mode of a VM.
+func runIsolationStatus(cmd *cobra.Command, provider isolation.Provider, modes *isolation.ModeStore, vmName string) error {
+	out := cmd.OutOrStdout()
+
+	vms, err := provider.List()
+	if err != nil {
+		return err
+	}
+	idx := slices.IndexFunc(vms, func(vm isolation.VMInfo) bool { return vm.Name == vmName })
+	if idx == -1 {
+		fmt.Fprintf(out, "%s: Not found\n", vmName)
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "Run 'calf isolation init' to set up the environment.")
+		return nil
+	}
+	vm := vms[idx]
+
+	mode, err := modes.Load(vmName)
+	if err != nil {
+		return fmt.Errorf("failed to load isolation mode for %s: %w", vmName, err)
+	}
+
+	fmt.Fprintf(out, "VM: %s\n", vm.Name)
+	fmt.Fprintf(out, "State: %s\n", vm.State)
+	if vm.Size > 0 {
+		fmt.Fprintf(out, "Size: %g GB\n", vm.Size)
+	} else {
+		fmt.Fprintln(out, "Size: unknown")
+	}
+	fmt.Fprintf(out, "Isolation: %s\n", mode.Description())
+	return nil
+}
+
+// runIsolationGUI starts a VM detached with VNC and the given networking. In
+// no-network mode the SMB block is handed to calf-netd, keyed to the tart PID,
+// so it stays in place for the whole GUI session and is removed when the VM
+// window closes.
+func runIsolationGUI(cmd *cobra.Command, provider isolation.Provider, modes *isolation.ModeStore, blocker smbBlocker, vmName string, noSMBBlock bool, network isolation.NetworkOptions) error {
+	out := cmd.OutOrStdout()
+	if err := network.Validate(); err != nil {
+		return err
+	}
+
+	state := provider.GetState(vmName)
+	switch state {
+	case isolation.StateNotFound:
+		return fmt.Errorf("%s does not exist. Run 'calf isolation init' to set up the environment", vmName)
+	case isolation.StateSuspended:
+		return fmt.Errorf("%s is suspended. Run 'calf isolation resume' first, then stop it to restart with VNC", vmName)
+	case isolation.StateRunning:
+		fmt.Fprintf(out, "%s is already running. Stopping to restart with VNC...\n", vmName)
+		if err := provider.Stop(vmName, false); err != nil {
+			return fmt.Errorf("failed to stop %s: %w", vmName, err)
+		}
+	}
+
+	fmt.Fprintf(out, "Starting %s with VNC (experimental mode for clipboard support)...\n", vmName)
+	pid, vmIP, err := launchVM(out, provider, modes, blocker, vmName, noSMBBlock, network, func() (int, error) {
+		return provider.Launch(vmName, isolation.LaunchOptions{VNC: true, Network: network})
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "VNC window should open automatically.")
+	fmt.Fprintf(out, "VM running in background (PID: %d)\n", pid)
+	if vmIP != "" {
+		fmt.Fprintf(out, "VM IP: %s\n", vmIP)
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "To reconnect to VNC if window closes:")
+		fmt.Fprintln(out, "  calf isolation gui")
+	}
+	return nil
+}
+
+// runIsolationStart starts a VM headless with the given networking, and
+// suspendable if the provider supports it. A suspended VM is resumed from its
+// saved state rather than cold-booted. When resumeOnly is set, the VM must be
+// suspended. With serial, the serial console is written next to the VM's boot
+// log.
+func runIsolationStart(cmd *cobra.Command, provider isolation.Provider, modes *isolation.ModeStore, blocker smbBlocker, vmName string, noSMBBlock, resumeOnly, serial bool, network isolation.NetworkOptions) error {
+	out := cmd.OutOrStdout()
+	if err := network.Validate(); err != nil {
+		return err
+	}
+
+	state := provider.GetState(vmName)
+	switch {
+	case state == isolation.StateNotFound:
+		return fmt.Errorf("%s does not exist. Run 'calf isolation init' to set up the environment", vmName)
+	case resumeOnly && state != isolation.StateSuspended:
+		return fmt.Errorf("%s is not suspended (state: %s)", vmName, state)
+	case state == isolation.StateRunning:
+		fmt.Fprintf(out, "%s is already running\n", vmName)
+		return nil
+	case state == isolation.StateSuspended:
+		fmt.Fprintf(out, "Resuming %s...\n", vmName)
+	default:
+		fmt.Fprintf(out, "Starting %s...\n", vmName)
+	}
+
+	pid, vmIP, err := launchVM(out, provider, modes, blocker, vmName, noSMBBlock, network, func() (int, error) {
+		_, suspendable := provider.(isolation.Suspender)
+		return provider.Launch(vmName, isolation.LaunchOptions{Headless: true, Suspendable: suspendable, Serial: serial, Network: network})
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "VM running in background (PID: %d)\n", pid)
+	if vmIP != "" {
+		fmt.Fprintf(out, "VM IP: %s\n", vmIP)
+	}
+	return nil
+}
+
+// runIsolationSuspend suspends a running VM. In no-network mode the tart
+// process exits on suspend, so calf-netd removes the SMB block; start or
+// resume loads it again.
+func runIsolationSuspend(cmd *cobra.Command, provider isolation.Provider, vmName string) error {
+	suspender, ok := provider.(isolation.Suspender)
+	if !ok {
+		return fmt.Errorf("suspend is not supported by the %s provider", provider.Name())
+	}
+
+	state := provider.GetState(vmName)
+	switch state {
+	case isolation.StateNotFound:
+		return fmt.Errorf("%s does not exist", vmName)
+	case isolation.StateSuspended:
+		fmt.Fprintf(cmd.OutOrStdout(), "%s is already suspended\n", vmName)
+		return nil
+	case isolation.StateStopped:
+		return fmt.Errorf("%s is not running", vmName)
+	}
+
+	fmt.Fprintf(cmd.OutOrStdout(), "Suspending %s...\n", vmName)
+	if err := suspender.Suspend(vmName); err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "%s suspended. Run 'calf isolation resume' to continue.\n", vmName)
+	return nil
+}
+
+// runIsolationSSH runs ssh to a running VM with calf's terminal attached.
+func runIsolationSSH(cmd *cobra.Command, provider isolation.Provider, stdin io.Reader, vmName string, command []string) error {
+	if provider.Name() != isolation.ProviderTart {
+		return fmt.Errorf("ssh is not supported by the %s provider", provider.Name())
+	}
+	if state := provider.GetState(vmName); state != isolation.StateRunning {
+		return fmt.Errorf("%s is not running (state: %s). Run 'calf isolation start' first", vmName, state)
+	}
+	vmIP, err := provider.ResolveIP(vmName, isolation.IPOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to find IP of %s: %w", vmName, err)
+	}
+
+	ssh := exec.Command("ssh", sshArgs(remoteHost(provider), vmIP, command)...)
+	ssh.Stdin = stdin
+	ssh.Stdout = cmd.OutOrStdout()
+	ssh.Stderr = cmd.ErrOrStderr()
+	return ssh.Run()
+}
+
+// sshArgs returns the ssh arguments that reach a VM as its admin user and run
+// command, or a login shell if command is empty. VMs on a remote host are
+// reached by jumping through it.
+func sshArgs(host *isolation.RemoteHost, vmIP string, command []string) []string {
+	var args []string
+	if host != nil {
+		args = append(args, host.JumpArgs()...)
+	}
+	args = append(args, vmUser+"@"+vmIP)
+	return append(args, command...)
+}
+
+// clearStuckSMBBlock removes SMB block rules for IPs that calf-netd does not
+// own, e.g. rules left behind by a crashed calf-bootstrap. calf-netd replaces
+// the anchor with the rules for the VMs it owns in one step, so they stay
+// blocked throughout.
+func clearStuckSMBBlock(out io.Writer, blocker smbBlocker) error {
+	state, err := blocker.Status()
+	if err != nil {
+		return fmt.Errorf("failed to clear SMB block: %w", err)
+	}
+	stuck, err := blocker.StuckIPs(state.IPs())
+	if err != nil {
+		return fmt.Errorf("failed to clear SMB block: %w", err)
+	}
+	if len(stuck) == 0 {
+		fmt.Fprintln(out, "No stuck SMB block rules")
+		return nil
+	}
+
+	if err := blocker.ReloadAnchor(); err != nil {
+		return fmt.Errorf("failed to clear SMB block: %w", err)
+	}
+	fmt.Fprintf(out, "Removed stuck SMB block rules for %s\n", strings.Join(stuck, ", "))
+	return nil
+}
+
+// launchVM starts a VM via launch and waits for its IP. In no-network mode it
+// first checks calf-netd is reachable, so the VM never runs without the SMB
+// block, then hands the block for the VM IP and tart PID to calf-netd. VMs on
+// a remote host are refused, since the local calf-netd cannot block them.
+// If the block cannot be loaded the VM is stopped. Returns the tart PID and
+// the VM IP, or an error with the boot log tail if the VM did not acquire one.
+func launchVM(out io.Writer, provider isolation.Provider, modes *isolation.ModeStore, blocker smbBlocker, vmName string, noSMBBlock bool, network isolation.NetworkOptions, launch func() (int, error)) (int, string, error) {
+	mode, err := modes.Load(vmName)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to load isolation mode for %s: %w", vmName, err)
+	}
+	blockSMB := mode.NoNetwork && !noSMBBlock
+
+	if blockSMB {
+		if host := remoteHost(provider); host != nil {
+			return 0, "", fmt.Errorf("cannot start %s in no-network mode on %s: calf-netd blocks SMB only for VMs on this machine; run calf on %s instead", vmName, host.Target(), host.Target())
+		}
+		if _, err := blocker.Status(); err != nil {
+			return 0, "", fmt.Errorf("no-network mode requires calf-netd for SMB blocking: %w", err)
+		}
+	}
+
+	pid, err := launch()
+	if err != nil {
+		return 0, "", err
+	}
+
+	waited := false
+	vmIP, ipErr := provider.ResolveIP(vmName, isolation.IPOptions{
+		Resolver: network.Resolver(),
+		OnWait: func(e isolation.IPWaitEvent) {
+			waited = true
+			fmt.Fprintf(out, "\rWaiting for VM to boot... %ds", int(e.Elapsed.Seconds()))
+		},
+	})
+	if waited {
+		fmt.Fprintln(out)
+	}
+	if ipErr != nil {
+		if blockSMB {
+			provider.Stop(vmName, false)
+			return 0, "", fmt.Errorf("stopped %s: cannot block SMB without a VM IP: %w", vmName, ipErr)
+		}
+		return 0, "", fmt.Errorf("%s is running (PID: %d) but has no IP: %w", vmName, pid, ipErr)
+	}
+	if blockSMB {
+		if err := blocker.LoadAnchor(vmIP, pid); err != nil {
+			provider.Stop(vmName, false)
+			return 0, "", fmt.Errorf("stopped %s: cannot run no-network mode without SMB blocking: %w", vmName, err)
+		}
+		fmt.Fprintf(out, "SMB blocked from VM (%s) until the VM stops\n", vmIP)
+	} else if noSMBBlock && mode.NoNetwork {
+		fmt.Fprintln(out, "Warning: SMB blocking disabled (--no-smb-block)")
+	}
+
+	return pid, vmIP, nil
+}
@@ -2,12 +2,17 @@ package main
 
 import (
 	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
 	"slices"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/will-head/coding-agent-loader/internal/isolation"
+	"github.com/will-head/coding-agent-loader/internal/netd"
 )
 
 // mockTartRunner is a test helper that simulates tart command execution.
@@ -15,6 +20,7 @@ type mockTartRunner struct {
 	outputs    map[string]string
 	errors     map[string]error
 	calledWith [][]string
+	started    [][]string
 }
 
 func (m *mockTartRunner) run(args ...string) (string, error) {
@@ -29,15 +35,81 @@ func (m *mockTartRunner) run(args ...string) (string, error) {
 	return "", nil
 }
 
+// start simulates launching a detached tart process with PID 4242.
+func (m *mockTartRunner) start(_ string, args ...string) (int, error) {
+	m.started = append(m.started, args)
+	return 4242, nil
+}
+
+// staticProvider returns a provider factory that always returns p and modes.
+func staticProvider(p isolation.Provider, modes *isolation.ModeStore) providerFactory {
+	return func(string, string) (isolation.Provider, *isolation.ModeStore, error) { return p, modes, nil }
+}
+
+// fakeSMBBlocker is a test helper that records calf-netd requests.
+type fakeSMBBlocker struct {
+	statusErr error
+	loadErr   error
+	state     netd.State
+	stuck     []string
+	reloads   int
+	loaded    []netd.BlockedVM
+}
+
+func (f *fakeSMBBlocker) Status() (netd.State, error) {
+	return f.state, f.statusErr
+}
+
+func (f *fakeSMBBlocker) ReloadAnchor() error {
+	f.reloads++
+	return nil
+}
+
+func (f *fakeSMBBlocker) StuckIPs(runningVMIPs []string) ([]string, error) {
+	var stuck []string
+	for _, ip := range f.stuck {
+		if !slices.Contains(runningVMIPs, ip) {
+			stuck = append(stuck, ip)
+		}
+	}
+	return stuck, nil
+}
+
+func (f *fakeSMBBlocker) LoadAnchor(vmIP string, tartPID int) error {
+	if f.loadErr != nil {
+		return f.loadErr
+	}
+	f.loaded = append(f.loaded, netd.BlockedVM{IP: vmIP, PID: tartPID})
+	return nil
+}
+
 // setupIsolationInitCmd creates a fresh isolation command configured for testing.
+// Isolation modes are stored under a per-test temporary home directory.
 func setupIsolationInitCmd(t *testing.T, mock *mockTartRunner, stdinContent string, args ...string) (*cobra.Command, *bytes.Buffer, *bytes.Buffer) {
+	t.Helper()
+	return setupIsolationCmdWithModes(t, mock, isolation.NewModeStore(t.TempDir()), stdinContent, args...)
+}
+
+// setupIsolationCmdWithModes creates a fresh isolation command using the given mode store.
+func setupIsolationCmdWithModes(t *testing.T, mock *mockTartRunner, modes *isolation.ModeStore, stdinContent string, args ...string) (*cobra.Command, *bytes.Buffer, *bytes.Buffer) {
+	t.Helper()
+	return setupIsolationCmdWithBlocker(t, mock, modes, &fakeSMBBlocker{}, stdinContent, args...)
+}
+
+// setupIsolationCmdWithBlocker creates a fresh isolation command using the given
+// mode store and SMB blocker.
+func setupIsolationCmdWithBlocker(t *testing.T, mock *mockTartRunner, modes *isolation.ModeStore, blocker smbBlocker, stdinContent string, args ...string) (*cobra.Command, *bytes.Buffer, *bytes.Buffer) {
 	t.Helper()
 	out, errOut := &bytes.Buffer{}, &bytes.Buffer{}
 	tart := isolation.NewTartClient(
 		isolation.WithTartPath("/mock/tart"),
 		isolation.WithRunCommand(mock.run),
+		isolation.WithStartCommand(mock.start),
+		isolation.WithPollInterval(time.Millisecond),
+		isolation.WithPollTimeout(20*time.Millisecond),
+		isolation.WithModeStore(modes),
 	)
-	cmd := newIsolationCmd(tart, strings.NewReader(stdinContent))
+	cmd := newIsolationCmd(staticProvider(tart, modes), blocker, strings.NewReader(stdinContent))
 	cmd.SetOut(out)
 	cmd.SetErr(errOut)
 	cmd.SetArgs(args)
@@ -186,6 +258,36 @@ func TestIsolationInitTwoStepFlow(t *testing.T) {
 		}
 	})
 
+	t.Run("when project file runs untrusted commands should not ask to trust them", func(t *testing.T) {
+		// Arrange
+		t.Setenv("HOME", t.TempDir())
+		dir := t.TempDir()
+		t.Chdir(dir)
+		if err := os.WriteFile(filepath.Join(dir, ".calf.yaml"), []byte("hooks:\n  setup: [make bootstrap]\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		mock := &mockTartRunner{
+			outputs: map[string]string{
+				"list --format json": `[{"name":"calf-dev","state":"stopped"},{"name":"calf-init","state":"stopped"}]`,
+			},
+		}
+		cmd, out, errOut := setupIsolationInitCmd(t, mock, "y\n", "init")
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if strings.Contains(errOut.String(), "Trust this file?") {
+			t.Errorf("expected no trust prompt, got: %s", errOut.String())
+		}
+		if !strings.Contains(out.String(), "Replacing calf-init with current calf-dev") {
+			t.Errorf("expected the first answer to reach init's own prompt, got: %s", out.String())
+		}
+	})
+
 	t.Run("when both VMs exist and user confirms replace should not delete VMs", func(t *testing.T) {
 		// Arrange
 		mock := &mockTartRunner{
@@ -213,3 +315,945 @@ func TestIsolationInitTwoStepFlow(t *testing.T) {
 		}
 	})
 }
+
+func TestIsolationInitModes(t *testing.T) {
+	t.Run("when safe-mode and yes flags set should record safe mode for both VMs", func(t *testing.T) {
+		// Arrange
+		mock := &mockTartRunner{outputs: map[string]string{"list --format json": `[]`}}
+		modes := isolation.NewModeStore(t.TempDir())
+		cmd, out, _ := setupIsolationCmdWithModes(t, mock, modes, "", "init", "--safe-mode", "--yes")
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for _, vm := range []string{"calf-dev", "calf-init"} {
+			got, err := modes.Load(vm)
+			if err != nil {
+				t.Fatalf("Load(%s) unexpected error: %v", vm, err)
+			}
+			if got != isolation.SafeMode() {
+				t.Errorf("Load(%s) = %+v, want safe mode", vm, got)
+			}
+		}
+		if !strings.Contains(out.String(), "Safe mode") {
+			t.Errorf("expected isolation mode in output, got: %s", out.String())
+		}
+	})
+
+	t.Run("when no-mount set and user accepts warning should record no-mount mode", func(t *testing.T) {
+		// Arrange
+		mock := &mockTartRunner{outputs: map[string]string{"list --format json": `[]`}}
+		modes := isolation.NewModeStore(t.TempDir())
+		cmd, out, _ := setupIsolationCmdWithModes(t, mock, modes, "\n", "init", "--no-mount")
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !strings.Contains(out.String(), "PERMANENT") {
+			t.Errorf("expected permanent-setting warning in output, got: %s", out.String())
+		}
+		got, err := modes.Load("calf-dev")
+		if err != nil {
+			t.Fatalf("Load() unexpected error: %v", err)
+		}
+		if got != (isolation.IsolationMode{NoMount: true}) {
+			t.Errorf("Load() = %+v, want no-mount only", got)
+		}
+	})
+
+	t.Run("when no-network set and user declines warning should abort without deleting or recording", func(t *testing.T) {
+		// Arrange
+		mock := &mockTartRunner{
+			outputs: map[string]string{
+				"list --format json": `[{"name":"calf-dev","state":"stopped"}]`,
+			},
+		}
+		modes := isolation.NewModeStore(t.TempDir())
+		cmd, out, _ := setupIsolationCmdWithModes(t, mock, modes, "n\n", "init", "--no-network")
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !strings.Contains(out.String(), "Aborted initialization") {
+			t.Errorf("expected abort message in output, got: %s", out.String())
+		}
+		deletedAnything := slices.ContainsFunc(mock.calledWith, func(args []string) bool {
+			return len(args) >= 1 && args[0] == "delete"
+		})
+		if deletedAnything {
+			t.Error("expected no VMs to be deleted after declining isolation warning")
+		}
+		got, err := modes.Load("calf-dev")
+		if err != nil {
+			t.Fatalf("Load() unexpected error: %v", err)
+		}
+		if !got.IsShared() {
+			t.Errorf("Load() = %+v, want no mode recorded", got)
+		}
+	})
+
+	t.Run("when no mode flags set should record shared mode without prompting", func(t *testing.T) {
+		// Arrange
+		mock := &mockTartRunner{outputs: map[string]string{"list --format json": `[]`}}
+		modes := isolation.NewModeStore(t.TempDir())
+		if err := modes.Save("calf-dev", isolation.SafeMode()); err != nil {
+			t.Fatal(err)
+		}
+		cmd, out, _ := setupIsolationCmdWithModes(t, mock, modes, "", "init")
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if strings.Contains(out.String(), "PERMANENT") {
+			t.Errorf("expected no isolation warning for shared mode, got: %s", out.String())
+		}
+		got, err := modes.Load("calf-dev")
+		if err != nil {
+			t.Fatalf("Load() unexpected error: %v", err)
+		}
+		if !got.IsShared() {
+			t.Errorf("Load() = %+v, want shared mode to replace previous mode", got)
+		}
+	})
+}
+
+func TestIsolationStatus(t *testing.T) {
+	t.Run("when VM exists should show state size and isolation mode", func(t *testing.T) {
+		// Arrange
+		mock := &mockTartRunner{
+			outputs: map[string]string{
+				"list --format json": `[{"name":"calf-dev","state":"running","size":42}]`,
+			},
+		}
+		modes := isolation.NewModeStore(t.TempDir())
+		if err := modes.Save("calf-dev", isolation.IsolationMode{NoNetwork: true}); err != nil {
+			t.Fatal(err)
+		}
+		cmd, out, _ := setupIsolationCmdWithModes(t, mock, modes, "", "status")
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for _, want := range []string{"VM: calf-dev", "State: running", "Size: 42 GB", "Isolation: Isolated network (local network blocked)"} {
+			if !strings.Contains(out.String(), want) {
+				t.Errorf("expected %q in output, got: %s", want, out.String())
+			}
+		}
+	})
+
+	t.Run("when VM name given should show status for that VM", func(t *testing.T) {
+		// Arrange
+		mock := &mockTartRunner{
+			outputs: map[string]string{
+				"list --format json": `[{"name":"calf-dev","state":"running"},{"name":"calf-init","state":"stopped"}]`,
+			},
+		}
+		cmd, out, _ := setupIsolationInitCmd(t, mock, "", "status", "calf-init")
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !strings.Contains(out.String(), "VM: calf-init") || !strings.Contains(out.String(), "State: stopped") {
+			t.Errorf("expected calf-init status in output, got: %s", out.String())
+		}
+	})
+
+	t.Run("when VM does not exist should suggest init", func(t *testing.T) {
+		// Arrange
+		mock := &mockTartRunner{outputs: map[string]string{"list --format json": `[]`}}
+		cmd, out, _ := setupIsolationInitCmd(t, mock, "", "status")
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !strings.Contains(out.String(), "calf-dev: Not found") {
+			t.Errorf("expected not found message in output, got: %s", out.String())
+		}
+		if strings.Contains(out.String(), "Isolation:") {
+			t.Errorf("expected no isolation line for missing VM, got: %s", out.String())
+		}
+	})
+
+	t.Run("when tart list fails should return error", func(t *testing.T) {
+		// Arrange
+		mock := &mockTartRunner{
+			errors: map[string]error{"list --format json": errors.New("tart crashed")},
+		}
+		cmd, _, _ := setupIsolationInitCmd(t, mock, "", "status")
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err == nil {
+			t.Fatal("expected error when tart list fails, got nil")
+		}
+	})
+}
+
+func TestIsolationGUI(t *testing.T) {
+	t.Run("when VM does not exist should return error suggesting init", func(t *testing.T) {
+		// Arrange
+		mock := &mockTartRunner{outputs: map[string]string{"list --format json": `[]`}}
+		cmd, _, _ := setupIsolationInitCmd(t, mock, "", "gui")
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "calf isolation init") {
+			t.Errorf("expected init suggestion error, got: %v", err)
+		}
+		if len(mock.started) != 0 {
+			t.Errorf("expected VM not to be started, got %v", mock.started)
+		}
+	})
+
+	t.Run("when shared mode should start detached with VNC and not block SMB", func(t *testing.T) {
+		// Arrange
+		mock := &mockTartRunner{
+			outputs: map[string]string{
+				"list --format json": `[{"name":"calf-dev","state":"stopped"}]`,
+				"ip calf-dev":        "192.168.64.5",
+			},
+		}
+		blocker := &fakeSMBBlocker{}
+		cmd, out, _ := setupIsolationCmdWithBlocker(t, mock, isolation.NewModeStore(t.TempDir()), blocker, "", "gui")
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(mock.started) != 1 || !slices.Contains(mock.started[0], "--vnc-experimental") {
+			t.Errorf("expected detached start with --vnc-experimental, got %v", mock.started)
+		}
+		if len(blocker.loaded) != 0 {
+			t.Errorf("expected no SMB block in shared mode, got %v", blocker.loaded)
+		}
+		if !strings.Contains(out.String(), "PID: 4242") {
+			t.Errorf("expected tart PID in output, got: %s", out.String())
+		}
+	})
+
+	t.Run("when shared mode VM gets no IP should return the IP error", func(t *testing.T) {
+		// Arrange
+		mock := &mockTartRunner{
+			outputs: map[string]string{
+				"list --format json": `[{"name":"calf-dev","state":"stopped"}]`,
+			},
+		}
+		cmd, _, _ := setupIsolationCmdWithBlocker(t, mock, isolation.NewModeStore(t.TempDir()), &fakeSMBBlocker{}, "", "gui")
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "did not acquire an IP address") {
+			t.Errorf("expected IP timeout error, got: %v", err)
+		}
+	})
+
+	t.Run("when no-network mode should hand SMB block for VM IP and tart PID to calf-netd", func(t *testing.T) {
+		// Arrange
+		mock := &mockTartRunner{
+			outputs: map[string]string{
+				"list --format json": `[{"name":"calf-dev","state":"stopped"}]`,
+				"ip calf-dev":        "192.168.64.5",
+			},
+		}
+		modes := isolation.NewModeStore(t.TempDir())
+		if err := modes.Save("calf-dev", isolation.IsolationMode{NoNetwork: true}); err != nil {
+			t.Fatal(err)
+		}
+		blocker := &fakeSMBBlocker{}
+		cmd, _, _ := setupIsolationCmdWithBlocker(t, mock, modes, blocker, "", "gui")
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !slices.Equal(blocker.loaded, []netd.BlockedVM{{IP: "192.168.64.5", PID: 4242}}) {
+			t.Errorf("expected anchor loaded for VM IP and tart PID, got %v", blocker.loaded)
+		}
+		if !slices.Contains(mock.started[0], "--net-softnet") {
+			t.Errorf("expected softnet in no-network mode, got %v", mock.started[0])
+		}
+	})
+
+	t.Run("when no-network mode and calf-netd unavailable should not start VM", func(t *testing.T) {
+		// Arrange
+		mock := &mockTartRunner{
+			outputs: map[string]string{"list --format json": `[{"name":"calf-dev","state":"stopped"}]`},
+		}
+		modes := isolation.NewModeStore(t.TempDir())
+		if err := modes.Save("calf-dev", isolation.IsolationMode{NoNetwork: true}); err != nil {
+			t.Fatal(err)
+		}
+		blocker := &fakeSMBBlocker{statusErr: errors.New("connection refused")}
+		cmd, _, _ := setupIsolationCmdWithBlocker(t, mock, modes, blocker, "", "gui")
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "requires calf-netd") {
+			t.Errorf("expected calf-netd required error, got: %v", err)
+		}
+		if len(mock.started) != 0 {
+			t.Errorf("expected VM not to be started, got %v", mock.started)
+		}
+	})
+
+	t.Run("when no-network VM runs on a remote host should refuse to start it", func(t *testing.T) {
+		// Arrange
+		mock := &mockTartRunner{
+			outputs: map[string]string{"list --format json": `[{"name":"calf-dev","state":"stopped"}]`},
+		}
+		modes := isolation.NewModeStore(t.TempDir())
+		if err := modes.Save("calf-dev", isolation.IsolationMode{NoNetwork: true}); err != nil {
+			t.Fatal(err)
+		}
+		remote, err := isolation.NewRemoteHost("dev@studio.local")
+		if err != nil {
+			t.Fatal(err)
+		}
+		tart := isolation.NewTartClient(
+			isolation.WithRunCommand(mock.run),
+			isolation.WithStartCommand(mock.start),
+			isolation.WithModeStore(modes),
+			isolation.WithRemoteHost(remote),
+		)
+		blocker := &fakeSMBBlocker{}
+		cmd := newIsolationCmd(staticProvider(tart, modes), blocker, strings.NewReader(""))
+		cmd.SetOut(&bytes.Buffer{})
+		cmd.SetErr(&bytes.Buffer{})
+		cmd.SetArgs([]string{"start"})
+
+		// Act
+		err = cmd.Execute()
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "no-network mode on dev@studio.local") {
+			t.Errorf("expected remote no-network error, got: %v", err)
+		}
+		if len(mock.started) != 0 || len(blocker.loaded) != 0 {
+			t.Errorf("expected no VM started and no block loaded, got %v and %v", mock.started, blocker.loaded)
+		}
+	})
+
+	t.Run("when SMB block fails should stop VM and return error", func(t *testing.T) {
+		// Arrange
+		mock := &mockTartRunner{
+			outputs: map[string]string{
+				"list --format json": `[{"name":"calf-dev","state":"stopped"}]`,
+				"ip calf-dev":        "192.168.64.5",
+			},
+		}
+		modes := isolation.NewModeStore(t.TempDir())
+		if err := modes.Save("calf-dev", isolation.IsolationMode{NoNetwork: true}); err != nil {
+			t.Fatal(err)
+		}
+		blocker := &fakeSMBBlocker{loadErr: errors.New("pfctl failed")}
+		cmd, _, _ := setupIsolationCmdWithBlocker(t, mock, modes, blocker, "", "gui")
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "without SMB blocking") {
+			t.Errorf("expected SMB blocking error, got: %v", err)
+		}
+		stopped := slices.ContainsFunc(mock.calledWith, func(args []string) bool {
+			return len(args) == 2 && args[0] == "stop" && args[1] == "calf-dev"
+		})
+		if !stopped {
+			t.Errorf("expected VM to be stopped after SMB block failure, calls: %v", mock.calledWith)
+		}
+	})
+
+	t.Run("when VM is running should stop it before starting with VNC", func(t *testing.T) {
+		// Arrange
+		mock := &mockTartRunner{
+			outputs: map[string]string{
+				"list --format json": `[{"name":"calf-dev","state":"running"}]`,
+				"ip calf-dev":        "192.168.64.5",
+			},
+		}
+		cmd, out, _ := setupIsolationInitCmd(t, mock, "", "gui")
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		stopped := slices.ContainsFunc(mock.calledWith, func(args []string) bool {
+			return len(args) == 2 && args[0] == "stop" && args[1] == "calf-dev"
+		})
+		if !stopped || len(mock.started) != 1 {
+			t.Errorf("expected stop then start, calls: %v started: %v", mock.calledWith, mock.started)
+		}
+		if !strings.Contains(out.String(), "already running") {
+			t.Errorf("expected restart message, got: %s", out.String())
+		}
+	})
+
+	t.Run("when VM is suspended should return error without starting", func(t *testing.T) {
+		// Arrange
+		mock := &mockTartRunner{
+			outputs: map[string]string{"list --format json": `[{"name":"calf-dev","state":"suspended"}]`},
+		}
+		cmd, _, _ := setupIsolationInitCmd(t, mock, "", "gui")
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "is suspended") {
+			t.Errorf("expected suspended error, got: %v", err)
+		}
+		if len(mock.started) != 0 {
+			t.Errorf("expected VM not to be started, got %v", mock.started)
+		}
+	})
+
+	t.Run("when no-smb-block set in no-network mode should skip calf-netd and warn", func(t *testing.T) {
+		// Arrange
+		mock := &mockTartRunner{
+			outputs: map[string]string{
+				"list --format json": `[{"name":"calf-dev","state":"stopped"}]`,
+				"ip calf-dev":        "192.168.64.5",
+			},
+		}
+		modes := isolation.NewModeStore(t.TempDir())
+		if err := modes.Save("calf-dev", isolation.IsolationMode{NoNetwork: true}); err != nil {
+			t.Fatal(err)
+		}
+		blocker := &fakeSMBBlocker{statusErr: errors.New("not running")}
+		cmd, out, _ := setupIsolationCmdWithBlocker(t, mock, modes, blocker, "", "gui", "--no-smb-block")
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(blocker.loaded) != 0 {
+			t.Errorf("expected no SMB block, got %v", blocker.loaded)
+		}
+		if !strings.Contains(out.String(), "SMB blocking disabled") {
+			t.Errorf("expected warning in output, got: %s", out.String())
+		}
+	})
+}
+
+func TestIsolationClearSMBBlock(t *testing.T) {
+	t.Run("when stuck rules exist should reload the anchor with only the owned VMs", func(t *testing.T) {
+		// Arrange
+		mock := &mockTartRunner{
+			outputs: map[string]string{
+				"list --format json": `[{"name":"calf-dev","state":"running"}]`,
+			},
+		}
+		owned := netd.BlockedVM{IP: "192.168.64.6", PID: 5353}
+		blocker := &fakeSMBBlocker{state: netd.State{VMs: []netd.BlockedVM{owned}}, stuck: []string{"192.168.64.5", "192.168.64.6"}}
+		cmd, out, _ := setupIsolationCmdWithBlocker(t, mock, isolation.NewModeStore(t.TempDir()), blocker, "", "start", "--clear-smb-block")
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if blocker.reloads != 1 || len(blocker.loaded) != 0 {
+			t.Errorf("reloads %d, loaded %v, want one reload of the owned VMs and no separate loads", blocker.reloads, blocker.loaded)
+		}
+		if !strings.Contains(out.String(), "Removed stuck SMB block rules for 192.168.64.5") {
+			t.Errorf("expected stuck IP in output, got: %s", out.String())
+		}
+	})
+
+	t.Run("when no rules are stuck should leave the anchor alone", func(t *testing.T) {
+		// Arrange
+		mock := &mockTartRunner{
+			outputs: map[string]string{
+				"list --format json": `[{"name":"calf-dev","state":"running"}]`,
+				"ip calf-dev":        "192.168.64.5",
+			},
+		}
+		blocker := &fakeSMBBlocker{}
+		cmd, out, _ := setupIsolationCmdWithBlocker(t, mock, isolation.NewModeStore(t.TempDir()), blocker, "", "gui", "--clear-smb-block", "--no-smb-block")
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if blocker.reloads != 0 {
+			t.Errorf("expected no reload, got %d", blocker.reloads)
+		}
+		if !strings.Contains(out.String(), "No stuck SMB block rules") {
+			t.Errorf("expected no stuck rules message, got: %s", out.String())
+		}
+	})
+}
+
+func TestIsolationStartSuspendResume(t *testing.T) {
+	t.Run("when VM is stopped start should launch it headless and suspendable", func(t *testing.T) {
+		// Arrange
+		mock := &mockTartRunner{
+			outputs: map[string]string{
+				"list --format json": `[{"name":"calf-dev","state":"stopped"}]`,
+				"ip calf-dev":        "192.168.64.5",
+			},
+		}
+		cmd, out, _ := setupIsolationInitCmd(t, mock, "", "start")
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(mock.started) != 1 || !slices.Contains(mock.started[0], "--suspendable") || !slices.Contains(mock.started[0], "--headless") {
+			t.Errorf("expected headless suspendable start, got %v", mock.started)
+		}
+		if !strings.Contains(out.String(), "Starting calf-dev") {
+			t.Errorf("expected start message, got: %s", out.String())
+		}
+	})
+
+	t.Run("when VM is running start should not launch it again", func(t *testing.T) {
+		// Arrange
+		mock := &mockTartRunner{
+			outputs: map[string]string{"list --format json": `[{"name":"calf-dev","state":"running"}]`},
+		}
+		cmd, out, _ := setupIsolationInitCmd(t, mock, "", "start")
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(mock.started) != 0 {
+			t.Errorf("expected no start, got %v", mock.started)
+		}
+		if !strings.Contains(out.String(), "already running") {
+			t.Errorf("expected already running message, got: %s", out.String())
+		}
+	})
+
+	t.Run("when VM is suspended start should resume it", func(t *testing.T) {
+		// Arrange
+		mock := &mockTartRunner{
+			outputs: map[string]string{
+				"list --format json": `[{"name":"calf-dev","state":"suspended"}]`,
+				"ip calf-dev":        "192.168.64.5",
+			},
+		}
+		cmd, out, _ := setupIsolationInitCmd(t, mock, "", "start")
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !strings.Contains(out.String(), "Resuming calf-dev") {
+			t.Errorf("expected resume message, got: %s", out.String())
+		}
+	})
+
+	t.Run("when VM is running suspend should run tart suspend", func(t *testing.T) {
+		// Arrange
+		mock := &mockTartRunner{
+			outputs: map[string]string{"list --format json": `[{"name":"calf-dev","state":"running"}]`},
+		}
+		cmd, _, _ := setupIsolationInitCmd(t, mock, "", "suspend")
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		suspended := slices.ContainsFunc(mock.calledWith, func(args []string) bool {
+			return slices.Equal(args, []string{"suspend", "calf-dev"})
+		})
+		if !suspended {
+			t.Errorf("expected tart suspend calf-dev, calls: %v", mock.calledWith)
+		}
+	})
+
+	t.Run("when VM is stopped suspend should return error", func(t *testing.T) {
+		// Arrange
+		mock := &mockTartRunner{
+			outputs: map[string]string{"list --format json": `[{"name":"calf-dev","state":"stopped"}]`},
+		}
+		cmd, _, _ := setupIsolationInitCmd(t, mock, "", "suspend")
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "not running") {
+			t.Errorf("expected not running error, got: %v", err)
+		}
+	})
+
+	t.Run("when VM is not suspended resume should return error", func(t *testing.T) {
+		// Arrange
+		mock := &mockTartRunner{
+			outputs: map[string]string{"list --format json": `[{"name":"calf-dev","state":"stopped"}]`},
+		}
+		cmd, _, _ := setupIsolationInitCmd(t, mock, "", "resume")
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "not suspended") {
+			t.Errorf("expected not suspended error, got: %v", err)
+		}
+		if len(mock.started) != 0 {
+			t.Errorf("expected no start, got %v", mock.started)
+		}
+	})
+
+	t.Run("when resuming in no-network mode should reload SMB block for new tart PID", func(t *testing.T) {
+		// Arrange
+		mock := &mockTartRunner{
+			outputs: map[string]string{
+				"list --format json": `[{"name":"calf-dev","state":"suspended"}]`,
+				"ip calf-dev":        "192.168.64.5",
+			},
+		}
+		modes := isolation.NewModeStore(t.TempDir())
+		if err := modes.Save("calf-dev", isolation.IsolationMode{NoNetwork: true}); err != nil {
+			t.Fatal(err)
+		}
+		blocker := &fakeSMBBlocker{}
+		cmd, _, _ := setupIsolationCmdWithBlocker(t, mock, modes, blocker, "", "resume")
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !slices.Equal(blocker.loaded, []netd.BlockedVM{{IP: "192.168.64.5", PID: 4242}}) {
+			t.Errorf("expected anchor loaded on resume, got %v", blocker.loaded)
+		}
+	})
+}
+
+func TestIsolationNetworkFlags(t *testing.T) {
+	t.Run("when softnet flags are given should pass them to tart", func(t *testing.T) {
+		// Arrange
+		mock := &mockTartRunner{
+			outputs: map[string]string{
+				"list --format json": `[{"name":"calf-dev","state":"stopped"}]`,
+				"ip calf-dev":        "192.168.64.5",
+			},
+		}
+		cmd, _, _ := setupIsolationInitCmd(t, mock, "", "start", "--network", "softnet", "--softnet-allow", "10.0.0.0/8,192.168.1.0/24")
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(mock.started) != 1 || !slices.Contains(mock.started[0], "--net-softnet") || !slices.Contains(mock.started[0], "--net-softnet-allow=10.0.0.0/8,192.168.1.0/24") {
+			t.Errorf("expected softnet with allow list, got %v", mock.started)
+		}
+	})
+
+	t.Run("when bridged mode has no interface should not start VM", func(t *testing.T) {
+		// Arrange
+		mock := &mockTartRunner{
+			outputs: map[string]string{"list --format json": `[{"name":"calf-dev","state":"running"}]`},
+		}
+		cmd, _, _ := setupIsolationInitCmd(t, mock, "", "gui", "--network", "bridged")
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "requires an interface name") {
+			t.Errorf("expected bridged interface error, got: %v", err)
+		}
+		if len(mock.started) != 0 || slices.ContainsFunc(mock.calledWith, func(args []string) bool { return args[0] == "stop" }) {
+			t.Errorf("expected VM neither stopped nor started, got calls %v and starts %v", mock.calledWith, mock.started)
+		}
+	})
+
+	t.Run("when softnet lists are given without softnet should return error", func(t *testing.T) {
+		// Arrange
+		mock := &mockTartRunner{
+			outputs: map[string]string{"list --format json": `[{"name":"calf-dev","state":"suspended"}]`},
+		}
+		cmd, _, _ := setupIsolationInitCmd(t, mock, "", "resume", "--softnet-block", "10.0.0.0/8")
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "require softnet network mode") {
+			t.Errorf("expected softnet mode error, got: %v", err)
+		}
+	})
+}
+
+func TestIsolationProvider(t *testing.T) {
+	t.Run("when config selects lima should use lima provider", func(t *testing.T) {
+		// Arrange
+		home := t.TempDir()
+		t.Setenv("HOME", home)
+		if err := os.MkdirAll(filepath.Join(home, ".calf"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(home, ".calf", "config.yaml"), []byte("isolation:\n  provider: lima\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		// Act
+		name, host := selectedTarget("", "", &bytes.Buffer{})
+		provider, _, err := newProvider(name, host, isolation.NewTartClient(), isolation.NewModeStore(home))
+
+		// Assert
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if provider.Name() != isolation.ProviderLima {
+			t.Errorf("expected lima provider, got %s", provider.Name())
+		}
+	})
+
+	t.Run("when host is set should keep modes on the host", func(t *testing.T) {
+		// Arrange
+		local := isolation.NewModeStore(t.TempDir())
+
+		// Act
+		provider, modes, err := newProvider(isolation.ProviderTart, "dev@studio.local", isolation.NewTartClient(), local)
+
+		// Assert
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if host := remoteHost(provider); host == nil || host.Target() != "dev@studio.local" {
+			t.Errorf("expected tart on dev@studio.local, got %v", host)
+		}
+		if modes == nil || modes == local {
+			t.Errorf("expected a mode store on the host, got %v", modes)
+		}
+	})
+
+	t.Run("when flags and environment are set should resolve them through the config", func(t *testing.T) {
+		// Arrange
+		t.Setenv("HOME", t.TempDir())
+		t.Setenv("CALF_PROVIDER", "lima")
+		t.Setenv("CALF_HOST", "dev@studio.local")
+
+		// Act
+		envName, envHost := selectedTarget("", "", &bytes.Buffer{})
+		flagName, flagHost := selectedTarget("sim", "ci@mini.local", &bytes.Buffer{})
+
+		// Assert
+		if envName != isolation.ProviderLima || envHost != "dev@studio.local" {
+			t.Errorf("from environment got %s on %q, want lima on dev@studio.local", envName, envHost)
+		}
+		if flagName != isolation.ProviderSim || flagHost != "ci@mini.local" {
+			t.Errorf("from flags got %s on %q, want sim on ci@mini.local", flagName, flagHost)
+		}
+	})
+
+	t.Run("when config is invalid should warn and use tart", func(t *testing.T) {
+		// Arrange
+		home := t.TempDir()
+		t.Setenv("HOME", home)
+		if err := os.MkdirAll(filepath.Join(home, ".calf"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(home, ".calf", "config.yaml"), []byte("isolation:\n  provider: qemu\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		errOut := &bytes.Buffer{}
+
+		// Act
+		name, _ := selectedTarget("", "", errOut)
+
+		// Assert
+		if name != isolation.ProviderTart {
+			t.Errorf("expected tart fallback, got %s", name)
+		}
+		if !strings.Contains(errOut.String(), "invalid provider 'qemu'") {
+			t.Errorf("expected warning about invalid provider, got: %s", errOut.String())
+		}
+	})
+
+	t.Run("when lima init requests no-network mode should refuse without recording it", func(t *testing.T) {
+		// Arrange
+		t.Setenv("HOME", t.TempDir())
+		modes := isolation.NewModeStore(t.TempDir())
+		lima := isolation.NewLimaClient(
+			isolation.WithLimactlPath("/mock/limactl"),
+			isolation.WithLimaRunCommand(func(args ...string) (string, error) {
+				return "", nil
+			}),
+		)
+		cmd := newIsolationCmd(staticProvider(lima, modes), &fakeSMBBlocker{}, strings.NewReader(""))
+		cmd.SetOut(&bytes.Buffer{})
+		cmd.SetErr(&bytes.Buffer{})
+		cmd.SetArgs([]string{"init", "-y", "--no-network"})
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "no-network isolation is not supported by the lima provider") {
+			t.Errorf("expected no-network unsupported error, got: %v", err)
+		}
+		if mode, _ := modes.Load("calf-dev"); mode.NoNetwork {
+			t.Errorf("expected no mode recorded, got %+v", mode)
+		}
+	})
+
+	t.Run("when provider cannot suspend should return unsupported error", func(t *testing.T) {
+		// Arrange
+		lima := isolation.NewLimaClient(
+			isolation.WithLimactlPath("/mock/limactl"),
+			isolation.WithLimaRunCommand(func(args ...string) (string, error) {
+				return `{"name":"calf-dev","status":"Running"}`, nil
+			}),
+		)
+		cmd := newIsolationCmd(staticProvider(lima, isolation.NewModeStore(t.TempDir())), &fakeSMBBlocker{}, strings.NewReader(""))
+		cmd.SetOut(&bytes.Buffer{})
+		cmd.SetErr(&bytes.Buffer{})
+		cmd.SetArgs([]string{"suspend"})
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "suspend is not supported by the lima provider") {
+			t.Errorf("expected unsupported error, got: %v", err)
+		}
+	})
+}
+
+func TestIsolationSSH(t *testing.T) {
+	// setupSSHCmd returns an isolation command whose tart runs on a remote
+	// host, with a fake ssh on the PATH that prints its arguments.
+	setupSSHCmd := func(t *testing.T, mock *mockTartRunner, args ...string) (*cobra.Command, *bytes.Buffer) {
+		t.Helper()
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, "ssh"), []byte("#!/bin/sh\necho \"$@\"\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+		remote, err := isolation.NewRemoteHost("dev@studio.local")
+		if err != nil {
+			t.Fatal(err)
+		}
+		tart := isolation.NewTartClient(
+			isolation.WithRunCommand(mock.run),
+			isolation.WithPollInterval(time.Millisecond),
+			isolation.WithPollTimeout(20*time.Millisecond),
+			isolation.WithRemoteHost(remote),
+		)
+		out := &bytes.Buffer{}
+		cmd := newIsolationCmd(staticProvider(tart, isolation.NewModeStore(t.TempDir())), &fakeSMBBlocker{}, strings.NewReader(""))
+		cmd.SetOut(out)
+		cmd.SetErr(&bytes.Buffer{})
+		cmd.SetArgs(args)
+		return cmd, out
+	}
+
+	t.Run("when VM runs on a remote host should jump through the host", func(t *testing.T) {
+		// Arrange
+		mock := &mockTartRunner{
+			outputs: map[string]string{
+				"list --format json": `[{"name":"calf-dev","state":"running"}]`,
+				"ip calf-dev":        "192.168.64.5",
+			},
+		}
+		cmd, out := setupSSHCmd(t, mock, "ssh", "--", "uptime")
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if strings.TrimSpace(out.String()) != "-J dev@studio.local admin@192.168.64.5 uptime" {
+			t.Errorf("expected ssh through the host, got: %q", out.String())
+		}
+	})
+
+	t.Run("when VM is stopped should return error", func(t *testing.T) {
+		// Arrange
+		mock := &mockTartRunner{
+			outputs: map[string]string{"list --format json": `[{"name":"calf-init","state":"stopped"}]`},
+		}
+		cmd, out := setupSSHCmd(t, mock, "ssh", "calf-init")
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "calf-init is not running") {
+			t.Errorf("expected not running error, got: %v", err)
+		}
+		if strings.Contains(out.String(), "admin@") {
+			t.Errorf("expected ssh not to run, got: %q", out.String())
+		}
+	})
+}
@@ -1,11 +1,16 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/will-head/coding-agent-loader/internal/config"
 	"github.com/will-head/coding-agent-loader/internal/isolation"
+	"github.com/will-head/coding-agent-loader/internal/netd"
+	"github.com/will-head/coding-agent-loader/internal/smbblock"
 )
 
 var (
@@ -13,6 +18,10 @@ var (
 	Version = "dev"
 )
 
+// stateCacheTTL lets the state checks of a single command share one
+// `tart list`. It is short because VMs can change state on their own.
+const stateCacheTTL = 2 * time.Second
+
 // newRootCmd constructs the root cobra command with all subcommands wired.
 func newRootCmd(version string) *cobra.Command {
 	cmd := &cobra.Command{
@@ -24,14 +33,33 @@ CALF provides isolated macOS VMs (via Tart) for running AI coding agents safely,
 with automated setup, snapshot management, and GitHub workflow integration.`,
 		Version: version,
 	}
+	cmd.PersistentFlags().Bool("lenient", false, "Ignore unknown keys in config files instead of rejecting them")
+	cmd.PersistentFlags().String("profile", "", "Config profile to apply from config.yaml (also $CALF_PROFILE)")
 	cmd.AddCommand(newConfigCmd())
 	cmd.AddCommand(newCacheCmd(os.Stdin, ""))
-	cmd.AddCommand(newIsolationCmd(isolation.NewTartClient(), os.Stdin))
+	modes := isolation.NewDefaultModeStore()
+	tart := isolation.NewTartClient(
+		isolation.WithModeStore(modes),
+		isolation.WithLogStore(isolation.NewDefaultLogStore()),
+		isolation.WithStateCacheTTL(stateCacheTTL),
+		isolation.WithCloneProgress(newPullProgressReporter(os.Stderr)),
+	)
+	providers := func(name, host string) (isolation.Provider, *isolation.ModeStore, error) {
+		return newProvider(name, host, tart, modes)
+	}
+	blocker := netdBlocker{netd.NewClient(netd.DefaultSocketPath), smbblock.NewManager()}
+	isolationCmd := newIsolationCmd(providers, blocker, os.Stdin)
+	images := isolation.NewDefaultImageStore()
+	isolationCmd.AddCommand(newImageCmd(providers, images, os.Stdin))
+	isolationCmd.AddCommand(newExportCmd(providers, images, os.Stdin))
+	isolationCmd.AddCommand(newImportCmd(providers, os.Stdin))
+	cmd.AddCommand(isolationCmd)
 	return cmd
 }
 
 func main() {
-	if err := newRootCmd(Version).Execute(); err != nil {
+	ctx := withHostProbe(context.Background(), config.ProbeHost)
+	if err := newRootCmd(Version).ExecuteContext(ctx); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
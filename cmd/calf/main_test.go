@@ -2,10 +2,13 @@ package main
 
 import (
 	"bytes"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/spf13/cobra"
+	"github.com/will-head/coding-agent-loader/internal/isolation"
 )
 
 // setupRootCmd creates a fresh root command configured for testing with
@@ -121,3 +124,136 @@ func TestCacheSubcommand(t *testing.T) {
 		}
 	})
 }
+
+// simulatedHost sets up a temp HOME with a persisted simulator holding
+// stopped calf-dev and calf-init VMs.
+func simulatedHost(t *testing.T) *isolation.SimProvider {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	sim := isolation.NewSimProvider(isolation.WithSimStateFile(filepath.Join(home, ".calf", "isolation", "sim.yaml")))
+	if err := sim.Clone("ghcr.io/cirruslabs/macos-sequoia-base:latest", "calf-dev"); err != nil {
+		t.Fatal(err)
+	}
+	if err := sim.Clone("calf-dev", "calf-init"); err != nil {
+		t.Fatal(err)
+	}
+	return sim
+}
+
+func TestSimulatorEndToEnd(t *testing.T) {
+	t.Run("when provider flag is sim should start suspend and resume across invocations", func(t *testing.T) {
+		// Arrange
+		simulatedHost(t)
+		run := func(args ...string) string {
+			cmd, out, _ := setupRootCmd(t, append([]string{"isolation", "--provider=sim"}, args...)...)
+			if err := cmd.Execute(); err != nil {
+				t.Fatalf("calf isolation %v: unexpected error: %v", args, err)
+			}
+			return out.String()
+		}
+
+		// Act
+		started := run("start")
+		running := run("status")
+		run("suspend")
+		suspended := run("status")
+		resumed := run("resume")
+
+		// Assert
+		if !strings.Contains(started, "VM IP: 192.168.64.2") {
+			t.Errorf("expected simulated IP on start, got: %s", started)
+		}
+		if !strings.Contains(running, "State: running") || !strings.Contains(suspended, "State: suspended") {
+			t.Errorf("expected running then suspended status, got: %s / %s", running, suspended)
+		}
+		if !strings.Contains(resumed, "Resuming calf-dev") {
+			t.Errorf("expected resume of suspended VM, got: %s", resumed)
+		}
+	})
+
+	t.Run("when sim VMs are initialized in no-network mode should keep modes and SMB block apart from real VMs", func(t *testing.T) {
+		// Arrange
+		sim := simulatedHost(t)
+		home, _ := os.UserHomeDir()
+		real := isolation.NewModeStore(home)
+		if err := real.Save("calf-dev", isolation.SafeMode()); err != nil {
+			t.Fatal(err)
+		}
+		run := func(args ...string) string {
+			cmd, out, _ := setupRootCmd(t, append([]string{"isolation", "--provider=sim"}, args...)...)
+			if err := cmd.Execute(); err != nil {
+				t.Fatalf("calf isolation %v: unexpected error: %v", args, err)
+			}
+			return out.String()
+		}
+
+		// Act
+		run("init", "-y", "--no-network")
+		// init does not create the VMs yet, so clone calf-dev back.
+		if err := sim.Clone("ghcr.io/cirruslabs/macos-sequoia-base:latest", "calf-dev"); err != nil {
+			t.Fatal(err)
+		}
+		started := run("start")
+
+		// Assert
+		if mode, _ := real.Load("calf-dev"); mode != isolation.SafeMode() {
+			t.Errorf("real calf-dev mode = %+v, want safe mode kept", mode)
+		}
+		if mode, _ := isolation.NewDefaultSimModeStore().Load("calf-dev"); !mode.NoNetwork {
+			t.Errorf("simulated calf-dev mode = %+v, want no-network", mode)
+		}
+		if !strings.Contains(started, "SMB blocked from VM (192.168.64.") {
+			t.Errorf("expected simulated SMB block on start, got: %s", started)
+		}
+	})
+
+	t.Run("when CALF_PROVIDER is sim should use simulator", func(t *testing.T) {
+		// Arrange
+		simulatedHost(t)
+		t.Setenv("CALF_PROVIDER", "sim")
+		cmd, out, _ := setupRootCmd(t, "isolation", "status", "calf-init")
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !strings.Contains(out.String(), "State: stopped") || !strings.Contains(out.String(), "Size: 50 GB") {
+			t.Errorf("expected simulated calf-init status, got: %s", out.String())
+		}
+	})
+
+	t.Run("when simulated launch fails should report failure", func(t *testing.T) {
+		// Arrange
+		sim := simulatedHost(t)
+		if err := sim.Fail(isolation.SimLaunch, "hypervisor unavailable"); err != nil {
+			t.Fatal(err)
+		}
+		cmd, _, _ := setupRootCmd(t, "isolation", "--provider=sim", "start")
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "hypervisor unavailable") {
+			t.Errorf("expected injected launch failure, got: %v", err)
+		}
+	})
+
+	t.Run("when provider flag is unknown should return error", func(t *testing.T) {
+		// Arrange
+		simulatedHost(t)
+		cmd, _, _ := setupRootCmd(t, "isolation", "--provider=vbox", "status")
+
+		// Act
+		err := cmd.Execute()
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "unknown VM provider 'vbox'") {
+			t.Errorf("expected unknown provider error, got: %v", err)
+		}
+	})
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/will-head/coding-agent-loader/internal/isolation"
+	"golang.org/x/term"
+)
+
+// progressBarWidth is the number of cells in the terminal progress bar.
+const progressBarWidth = 30
+
+// pullProgressEvent is the JSON line written for each progress update when
+// output is not a terminal, so CI logs and wrappers can track long pulls.
+type pullProgressEvent struct {
+	Event           string `json:"event"`
+	Stage           string `json:"stage"`
+	BytesDownloaded int64  `json:"bytes_downloaded"`
+	BytesTotal      int64  `json:"bytes_total"`
+}
+
+// newPullProgressReporter returns a progress callback that renders a
+// redrawing progress bar when w is a terminal and JSON lines otherwise.
+func newPullProgressReporter(w io.Writer) isolation.ProgressFunc {
+	if isTerminal(w) {
+		return progressBarReporter(w)
+	}
+	return progressJSONReporter(w)
+}
+
+// progressBarReporter redraws a single progress line with \r.
+func progressBarReporter(w io.Writer) isolation.ProgressFunc {
+	return func(p isolation.PullProgress) {
+		switch p.Stage {
+		case isolation.PullStageManifest:
+			fmt.Fprintln(w, "Pulling manifest...")
+		case isolation.PullStageDisk:
+			fmt.Fprintf(w, "\r%s", renderProgressBar(p))
+		case isolation.PullStageDone:
+			if p.BytesTotal > 0 {
+				fmt.Fprintf(w, "\r%s\n", renderProgressBar(p))
+			}
+		}
+	}
+}
+
+// progressJSONReporter writes one JSON object per update.
+func progressJSONReporter(w io.Writer) isolation.ProgressFunc {
+	enc := json.NewEncoder(w)
+	return func(p isolation.PullProgress) {
+		enc.Encode(pullProgressEvent{
+			Event:           "pull_progress",
+			Stage:           string(p.Stage),
+			BytesDownloaded: p.BytesDownloaded,
+			BytesTotal:      p.BytesTotal,
+		})
+	}
+}
+
+// renderProgressBar formats a disk download line, e.g.
+// "Pulling disk [#######-------] 45% 11.3 GB / 25.0 GB".
+func renderProgressBar(p isolation.PullProgress) string {
+	if p.BytesTotal <= 0 {
+		return "Pulling disk..."
+	}
+	filled := int(p.BytesDownloaded * progressBarWidth / p.BytesTotal)
+	filled = min(max(filled, 0), progressBarWidth)
+	percent := p.BytesDownloaded * 100 / p.BytesTotal
+	return fmt.Sprintf("Pulling disk [%s%s] %3d%% %s / %s",
+		strings.Repeat("#", filled), strings.Repeat("-", progressBarWidth-filled),
+		percent, formatGB(p.BytesDownloaded), formatGB(p.BytesTotal))
+}
+
+// formatGB formats a byte count in decimal gigabytes, matching Tart's units.
+func formatGB(bytes int64) string {
+	return fmt.Sprintf("%.1f GB", float64(bytes)/1e9)
+}
+
+// isTerminal reports whether w is a terminal.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	return ok && term.IsTerminal(int(f.Fd()))
+}
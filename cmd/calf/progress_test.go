@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/will-head/coding-agent-loader/internal/isolation"
+)
+
+func TestRenderProgressBar(t *testing.T) {
+	t.Run("when half downloaded should fill half the bar", func(t *testing.T) {
+		// Arrange
+		p := isolation.PullProgress{Stage: isolation.PullStageDisk, BytesDownloaded: 12_500_000_000, BytesTotal: 25_000_000_000}
+
+		// Act
+		got := renderProgressBar(p)
+
+		// Assert
+		want := "Pulling disk [###############---------------]  50% 12.5 GB / 25.0 GB"
+		if got != want {
+			t.Errorf("renderProgressBar() = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("when total is unknown should not divide by zero", func(t *testing.T) {
+		// Arrange
+		p := isolation.PullProgress{Stage: isolation.PullStageDisk}
+
+		// Act
+		got := renderProgressBar(p)
+
+		// Assert
+		if got != "Pulling disk..." {
+			t.Errorf("renderProgressBar() = %q, want placeholder", got)
+		}
+	})
+}
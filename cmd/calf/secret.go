@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// readSecret prompts on errOut and reads a secret, such as a password, from
+// stdin. On a terminal the secret is read without echo; otherwise it is the
+// next line of stdin, which callers reading several secrets should wrap in a
+// single bufio.Reader. what names the secret in errors.
+func readSecret(errOut io.Writer, stdin io.Reader, prompt, what string) (string, error) {
+	fmt.Fprint(errOut, prompt)
+	var secret string
+	if fd, ok := terminalFd(stdin); ok {
+		data, err := term.ReadPassword(fd)
+		fmt.Fprintln(errOut)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", what, err)
+		}
+		secret = string(data)
+	} else {
+		reader, ok := stdin.(*bufio.Reader)
+		if !ok {
+			reader = bufio.NewReader(stdin)
+		}
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return "", fmt.Errorf("failed to read %s: %w", what, err)
+		}
+		secret = strings.TrimRight(line, "\r\n")
+	}
+	if secret == "" {
+		return "", fmt.Errorf("%s must not be empty", what)
+	}
+	return secret, nil
+}
+
+// terminalFd returns the file descriptor of v if it is a terminal.
+func terminalFd(v any) (int, bool) {
+	f, ok := v.(*os.File)
+	if !ok || !term.IsTerminal(int(f.Fd())) {
+		return 0, false
+	}
+	return int(f.Fd()), true
+}
@@ -4,6 +4,8 @@ go 1.25.6
 
 require (
 	github.com/spf13/cobra v1.10.2
+	golang.org/x/sys v0.10.0
+	golang.org/x/term v0.10.0
 	gopkg.in/yaml.v3 v3.0.1
 )
 
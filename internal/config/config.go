@@ -1,13 +1,18 @@
 // Package config provides configuration management for CALF.
-// It supports loading from global (~/.calf/config.yaml) and per-VM
+// It supports loading from global (~/.calf/config.yaml), project (.calf.yaml
+// in the working directory or a parent) and per-VM
 // (~/.calf/isolation/vms/{name}/vm.yaml) configuration files with
-// proper precedence: hard-coded defaults → global config → per-VM config.
+// proper precedence: hard-coded defaults → global config → selected profile
+// → project config → per-VM config → CALF_* environment variables →
+// command-line flags.
 package config
 
 import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
@@ -26,17 +31,72 @@ const (
 	minDiskSize = 10    // Reasonable minimum in GB
 	maxDiskSize = 500   // Reasonable maximum in GB
 
-	currentVersion = 1
+	// Schema versions of the global and per-VM config files. Older files are
+	// upgraded by globalMigrations and vmMigrations.
+	currentVersion   = 1
+	currentVMVersion = 2
 )
 
 // Config represents the top-level CALF configuration structure.
 type Config struct {
 	Version   int             `yaml:"version"`
 	Isolation IsolationConfig `yaml:"isolation"`
+	// VM holds the settings with no global default, set by a per-VM file, a
+	// project file or, for the agent and isolation mode, a profile.
+	VM VMSettings `yaml:"vm"`
+	// Profile is the name of the profile applied, or empty if none was
+	// selected (see WithProfile).
+	Profile string `yaml:"-"`
+	// Project is the path of the project config file applied, or empty if
+	// none was found (see FindProjectConfig).
+	Project string `yaml:"-"`
+	// Host is the capacity resources were sized and validated against, or
+	// nil if it is unknown (see WithHostProbe).
+	Host *HostCapacity `yaml:"-"`
+	// Agents configures the coding agents that can be installed, by name.
+	Agents map[string]AgentConfig `yaml:"agents"`
+	// Hooks are commands a project file asks to run (see TrustStore).
+	Hooks HooksConfig `yaml:"hooks"`
+	// WithheldCommands are the commands of an untrusted project file, which
+	// were not applied, each labelled with its key.
+	WithheldCommands []string `yaml:"-"`
+}
+
+// HooksConfig lists commands to run in a VM.
+type HooksConfig struct {
+	Setup []string `yaml:"setup"` // Run in the VM once it is provisioned
+}
+
+// AgentConfig describes how to install a coding agent.
+type AgentConfig struct {
+	InstallCommand string `yaml:"install_command"`
+}
+
+// VMSettings are the per-VM settings with no global default.
+type VMSettings struct {
+	Name         string            `yaml:"name"`         // Display name of the workspace
+	Agent        string            `yaml:"agent"`        // Coding agent to run, e.g. claude-code
+	Environments []string          `yaml:"environments"` // Environment plugins to install, e.g. node
+	Repos        []RepoConfig      `yaml:"repos"`        // Repositories to check out in the VM
+	Isolation    VMIsolationConfig `yaml:"isolation"`
+}
+
+// RepoConfig is a GitHub repository checked out in a VM.
+type RepoConfig struct {
+	Name   string `yaml:"name"`
+	Branch string `yaml:"branch"`
+}
+
+// VMIsolationConfig is the isolation mode requested for a VM.
+type VMIsolationConfig struct {
+	NoMount   bool `yaml:"no_mount"`   // No host filesystem mounts
+	NoNetwork bool `yaml:"no_network"` // Softnet with the local network blocked
 }
 
 // IsolationConfig contains isolation-specific settings.
 type IsolationConfig struct {
+	Provider string         `yaml:"provider"` // VM backend. One of: tart, lima, sim (empty means tart)
+	Host     string         `yaml:"host"`     // Remote Mac running tart, as an ssh destination (empty means local)
 	Defaults DefaultsConfig `yaml:"defaults"`
 }
 
@@ -54,6 +114,10 @@ type VMConfig struct {
 	Memory    int    `yaml:"memory"`    // Memory in MB
 	DiskSize  int    `yaml:"disk_size"` // Disk size in GB
 	BaseImage string `yaml:"base_image"`
+	// Relative holds the resources set to "auto" or a percentage of the
+	// host, such as "50%", by yaml name. Loading resolves them into the
+	// fields above.
+	Relative map[string]string `yaml:"-"`
 }
 
 // GitHubConfig contains GitHub-related settings.
@@ -73,27 +137,63 @@ type ProxyConfig struct {
 
 // LoadConfig loads configuration from global and per-VM paths with proper precedence.
 // If paths are empty or files don't exist, hard-coded defaults are used.
-// Per-VM config overrides global config, which overrides defaults.
+// The global config overrides defaults; the profile selected by WithProfile
+// or CALF_PROFILE overrides the global config; the project config found by
+// FindProjectConfig (see WithProjectDir) overrides the profile; and per-VM
+// config overrides the project config. CALF_* environment variables (see
+// EnvName) override the files, and flag overrides (see WithFlagOverrides)
+// override everything.
 // Returns error if files exist but cannot be read/parsed, or if validation fails.
-func LoadConfig(globalPath, vmPath string) (*Config, error) {
-	cfg := &Config{
-		Version: currentVersion,
-		Isolation: IsolationConfig{
-			Defaults: getHardcodedDefaults(),
-		},
+func LoadConfig(globalPath, vmPath string, opts ...LoadOption) (*Config, error) {
+	cfg, _, err := LoadConfigWithOrigins(globalPath, vmPath, opts...)
+	return cfg, err
+}
+
+// LoadConfigWithOrigins loads configuration like LoadConfig and also reports
+// where each effective value came from. The origin of the selected profile,
+// if any, is recorded under the key "profile".
+func LoadConfigWithOrigins(globalPath, vmPath string, opts ...LoadOption) (*Config, Origins, error) {
+	o := defaultLoadOptions(opts)
+	origins := defaultOrigins()
+	cfg := newDefaultConfig()
+
+	profileOrigin := Origin{Kind: OriginFlag, Name: "profile"}
+	if o.profile == "" {
+		o.profile, _ = o.lookupEnv(profileEnv)
+		profileOrigin = Origin{Kind: OriginEnv, Name: profileEnv}
 	}
 
 	// Load global config if path provided
 	if globalPath != "" {
-		if err := loadConfigFile(cfg, globalPath); err != nil {
-			return nil, err
+		if err := loadConfigFile(cfg, origins, globalPath, o); err != nil {
+			return nil, nil, err
+		}
+	}
+	if o.profile != "" {
+		if cfg.Profile == "" {
+			return nil, nil, fmt.Errorf("unknown profile '%s': no config file defines profiles", o.profile)
+		}
+		origins["profile"] = profileOrigin
+	}
+
+	// Load the project config found from the working directory (overrides
+	// global and profile)
+	if o.projectDir != "" {
+		projectPath, err := FindProjectConfig(o.projectDir)
+		if err != nil {
+			return nil, nil, err
+		}
+		if projectPath != "" {
+			if err := loadProjectConfigFile(cfg, origins, projectPath, o); err != nil {
+				return nil, nil, err
+			}
 		}
 	}
 
 	// Load per-VM config if path provided (overrides global)
 	if vmPath != "" {
-		if err := loadVMConfigFile(cfg, vmPath); err != nil {
-			return nil, err
+		if err := loadVMConfigFile(cfg, origins, vmPath, o); err != nil {
+			return nil, nil, err
 		}
 	}
 
@@ -101,15 +201,118 @@ func LoadConfig(globalPath, vmPath string) (*Config, error) {
 	validationPath := ""
 	if vmPath != "" {
 		validationPath = vmPath
+	} else if cfg.Project != "" {
+		validationPath = cfg.Project
 	} else if globalPath != "" {
 		validationPath = globalPath
 	}
 
-	if err := cfg.Validate(validationPath); err != nil {
-		return nil, err
+	// Resources are sized for, and checked against, the host after each
+	// layer that can set them.
+	host := hostSizer(o.probe)
+	validate := func(path string) error {
+		capacity, unknown := host(cfg)
+		if err := cfg.sizeForHost(capacity, unknown, origins); err != nil {
+			return fmt.Errorf("invalid resources in %s: %w", path, err)
+		}
+		return cfg.Validate(path)
 	}
 
-	return cfg, nil
+	if err := validate(validationPath); err != nil {
+		return nil, nil, err
+	}
+
+	// Each override layer is validated on its own, so errors name the
+	// variables or flags that introduced them.
+	env, err := applyOverrides(cfg, origins, OriginEnv, EnvName, func(key string) string {
+		value, _ := o.lookupEnv(EnvName(key))
+		return value
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(env) > 0 {
+		if err := validate(strings.Join(env, ", ")); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	flags, err := applyOverrides(cfg, origins, OriginFlag, FlagName, func(key string) string {
+		return o.flags[FlagName(key)]
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(flags) > 0 {
+		if err := validate(strings.Join(flags, ", ")); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return cfg, origins, nil
+}
+
+// ValidateFile checks a single config file strictly, as LoadConfig does by
+// default: keys outside the schema are reported as an UnknownKeysError, and
+// the file's values, applied over the hard-coded defaults, must pass
+// Validate, with each of its profiles applied in turn. Resources are checked
+// against the host if WithHostProbe is given, and otherwise against their
+// fixed bounds only; other options are ignored. Files named vm.yaml are
+// checked against the per-VM schema, and .calf.yaml files against the
+// project schema, without asking to trust them.
+func ValidateFile(path string, opts ...LoadOption) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file '%s': %w", path, err)
+	}
+	kind := kindOf(path)
+	probe := defaultLoadOptions(opts).probe
+	cfg := newDefaultConfig()
+	origins := defaultOrigins()
+	switch kind {
+	case kindVM:
+		err = loadVMConfigData(cfg, origins, data, path, loadOptions{})
+	case kindProject:
+		err = loadProjectConfigFile(cfg, origins, path, loadOptions{trustAll: true})
+	default:
+		err = loadConfigData(cfg, origins, data, path, loadOptions{})
+	}
+	if err != nil {
+		return err
+	}
+	if err := cfg.validateForHost(path, probe, origins); err != nil {
+		return err
+	}
+	if kind != kindGlobal {
+		return nil
+	}
+
+	root, _ := parseConfigNode(data)
+	if root == nil {
+		return nil
+	}
+	for _, name := range profileNames(mappingValue(root, "profiles")) {
+		cfg := newDefaultConfig()
+		origins := defaultOrigins()
+		if err := loadConfigData(cfg, origins, data, path, loadOptions{profile: name}); err != nil {
+			return err
+		}
+		if err := cfg.validateForHost(fmt.Sprintf("%s (profile %s)", path, name), probe, origins); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newDefaultConfig returns the configuration made of hard-coded defaults.
+func newDefaultConfig() *Config {
+	return &Config{
+		Version: currentVersion,
+		Isolation: IsolationConfig{
+			Provider: "tart",
+			Defaults: getHardcodedDefaults(),
+		},
+	}
 }
 
 func getHardcodedDefaults() DefaultsConfig {
@@ -132,7 +335,7 @@ func getHardcodedDefaults() DefaultsConfig {
 	}
 }
 
-func loadConfigFile(cfg *Config, path string) error {
+func loadConfigFile(cfg *Config, origins Origins, path string, o loadOptions) error {
 	data, err := os.ReadFile(path)
 	if os.IsNotExist(err) {
 		return nil
@@ -140,39 +343,46 @@ func loadConfigFile(cfg *Config, path string) error {
 	if err != nil {
 		return fmt.Errorf("failed to read config file '%s': %w", path, err)
 	}
+	return loadConfigData(cfg, origins, data, path, o)
+}
 
-	var loaded struct {
-		Version   *int `yaml:"version"`
-		Isolation struct {
-			Defaults struct {
-				VM struct {
-					CPU       *int    `yaml:"cpu"`
-					Memory    *int    `yaml:"memory"`
-					DiskSize  *int    `yaml:"disk_size"`
-					BaseImage *string `yaml:"base_image"`
-				} `yaml:"vm"`
-				GitHub struct {
-					DefaultBranchPrefix *string `yaml:"default_branch_prefix"`
-				} `yaml:"github"`
-				Output struct {
-					SyncDir *string `yaml:"sync_dir"`
-				} `yaml:"output"`
-				Proxy struct {
-					Mode *string `yaml:"mode"`
-				} `yaml:"proxy"`
-			} `yaml:"defaults"`
-		} `yaml:"isolation"`
-	}
-
-	if err := yaml.Unmarshal(data, &loaded); err != nil {
+// loadConfigData merges global config file contents read from path.
+func loadConfigData(cfg *Config, origins Origins, data []byte, path string, o loadOptions) error {
+	root, err := parseConfigNode(data)
+	if err != nil {
 		return fmt.Errorf("failed to parse config file '%s': %w", path, err)
 	}
-
-	mergeConfig(cfg, &loaded)
+	if root == nil {
+		return nil
+	}
+	if _, err := upgrade(root, path, globalMigrations, currentVersion); err != nil {
+		return err
+	}
+	profiles := mappingValue(root, "profiles")
+	if profiles != nil && profiles.Kind != yaml.MappingNode && profiles.Tag != "!!null" {
+		return fmt.Errorf("failed to parse config file '%s': line %d: profiles must be a mapping", path, profiles.Line)
+	}
+	if !o.lenient {
+		unknown := unknownKeys(reflect.TypeOf(Config{}), withoutKey(root, "profiles"), "")
+		if profiles != nil {
+			unknown = append(unknown, unknownKeys(reflect.TypeOf(map[string]profileFile{}), profiles, "profiles")...)
+		}
+		if len(unknown) > 0 {
+			return &UnknownKeysError{Path: path, Keys: unknown}
+		}
+	}
+	// Per-VM settings only come from per-VM files.
+	if err := overlay(reflect.ValueOf(cfg).Elem(), withoutKey(root, "vm"), "", origins.recorder(path)); err != nil {
+		return fmt.Errorf("failed to parse config file '%s': %w", path, err)
+	}
+	// The selected profile overlays the rest of the file.
+	if o.profile != "" {
+		return applyProfile(cfg, origins, profiles, o.profile, path)
+	}
 	return nil
 }
 
-func loadVMConfigFile(cfg *Config, path string) error {
+func loadVMConfigFile(cfg *Config, origins Origins, path string, o loadOptions) error {
 	data, err := os.ReadFile(path)
 	if os.IsNotExist(err) {
 		return nil
@@ -180,91 +390,69 @@ func loadVMConfigFile(cfg *Config, path string) error {
 	if err != nil {
 		return fmt.Errorf("failed to read VM config file '%s': %w", path, err)
 	}
+	return loadVMConfigData(cfg, origins, data, path, o)
+}
 
-	var vmConfig struct {
-		CPU       *int   `yaml:"cpu"`
-		Memory    *int   `yaml:"memory"`
-		DiskSize  *int   `yaml:"disk_size"`
-		BaseImage string `yaml:"base_image"`
-	}
-
-	if err := yaml.Unmarshal(data, &vmConfig); err != nil {
+// loadVMConfigData merges per-VM config file contents read from path. See
+// vmFile for the schema.
+func loadVMConfigData(cfg *Config, origins Origins, data []byte, path string, o loadOptions) error {
+	root, err := parseConfigNode(data)
+	if err != nil {
 		return fmt.Errorf("failed to parse VM config file '%s': %w", path, err)
 	}
-
-	if vmConfig.CPU != nil {
-		cfg.Isolation.Defaults.VM.CPU = *vmConfig.CPU
-	}
-	if vmConfig.Memory != nil {
-		cfg.Isolation.Defaults.VM.Memory = *vmConfig.Memory
+	if root == nil {
+		return nil
 	}
-	if vmConfig.DiskSize != nil {
-		cfg.Isolation.Defaults.VM.DiskSize = *vmConfig.DiskSize
+	if _, err := upgrade(root, path, vmMigrations, currentVMVersion); err != nil {
+		return err
 	}
-	if vmConfig.BaseImage != "" {
-		cfg.Isolation.Defaults.VM.BaseImage = vmConfig.BaseImage
+	if !o.lenient {
+		if err := checkKeys(reflect.TypeOf(vmFile{}), root, path); err != nil {
+			return err
+		}
 	}
 
+	keys := vmFileKeys()
+	record := origins.recorder(path)
+	file := newVMFile(cfg)
+	err = overlay(reflect.ValueOf(file).Elem(), root, "", func(key string, node *yaml.Node) {
+		record(keys[key], node)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to parse VM config file '%s': %w", path, err)
+	}
 	return nil
 }
 
-func mergeConfig(cfg *Config, loaded *struct {
-	Version   *int `yaml:"version"`
-	Isolation struct {
-		Defaults struct {
-			VM struct {
-				CPU       *int    `yaml:"cpu"`
-				Memory    *int    `yaml:"memory"`
-				DiskSize  *int    `yaml:"disk_size"`
-				BaseImage *string `yaml:"base_image"`
-			} `yaml:"vm"`
-			GitHub struct {
-				DefaultBranchPrefix *string `yaml:"default_branch_prefix"`
-			} `yaml:"github"`
-			Output struct {
-				SyncDir *string `yaml:"sync_dir"`
-			} `yaml:"output"`
-			Proxy struct {
-				Mode *string `yaml:"mode"`
-			} `yaml:"proxy"`
-		} `yaml:"defaults"`
-	} `yaml:"isolation"`
-}) {
-	if loaded.Isolation.Defaults.VM.CPU != nil {
-		cfg.Isolation.Defaults.VM.CPU = *loaded.Isolation.Defaults.VM.CPU
-	}
-	if loaded.Isolation.Defaults.VM.Memory != nil {
-		cfg.Isolation.Defaults.VM.Memory = *loaded.Isolation.Defaults.VM.Memory
-	}
-	if loaded.Isolation.Defaults.VM.DiskSize != nil {
-		cfg.Isolation.Defaults.VM.DiskSize = *loaded.Isolation.Defaults.VM.DiskSize
-	}
-	if loaded.Isolation.Defaults.VM.BaseImage != nil {
-		cfg.Isolation.Defaults.VM.BaseImage = *loaded.Isolation.Defaults.VM.BaseImage
-	}
-	if loaded.Isolation.Defaults.GitHub.DefaultBranchPrefix != nil {
-		cfg.Isolation.Defaults.GitHub.DefaultBranchPrefix = *loaded.Isolation.Defaults.GitHub.DefaultBranchPrefix
-	}
-	if loaded.Isolation.Defaults.Output.SyncDir != nil {
-		cfg.Isolation.Defaults.Output.SyncDir = *loaded.Isolation.Defaults.Output.SyncDir
-	}
-	if loaded.Isolation.Defaults.Proxy.Mode != nil {
-		cfg.Isolation.Defaults.Proxy.Mode = *loaded.Isolation.Defaults.Proxy.Mode
+// parseConfigNode parses a config file into its top-level node, or nil if
+// the file is empty.
+func parseConfigNode(data []byte) (*yaml.Node, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
 	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+	return doc.Content[0], nil
 }
 
 // Validate checks that all configuration values are within valid ranges.
-// Returns a detailed error message including field name, invalid value,
-// expected range, and file path (if provided).
+// CPU and memory must also fit the host's capacity when it is known (see
+// Host); the disk size is checked against it by ValidateForCreate. Returns a
+// detailed error message including field name, invalid value, expected range,
+// and file path (if provided).
 func (c *Config) Validate(path string) error {
-	if c.Isolation.Defaults.VM.CPU < minCPU || c.Isolation.Defaults.VM.CPU > maxCPU {
-		return c.validationError("CPU", c.Isolation.Defaults.VM.CPU, fmt.Sprintf("between %d and %d", minCPU, maxCPU), path)
-	}
-	if c.Isolation.Defaults.VM.Memory < minMemory || c.Isolation.Defaults.VM.Memory > maxMemory {
-		return c.validationError("memory", c.Isolation.Defaults.VM.Memory, fmt.Sprintf("between %d and %d MB", minMemory, maxMemory), path)
-	}
-	if c.Isolation.Defaults.VM.DiskSize < minDiskSize || c.Isolation.Defaults.VM.DiskSize > maxDiskSize {
-		return c.validationError("disk_size", c.Isolation.Defaults.VM.DiskSize, fmt.Sprintf("between %d and %d GB", minDiskSize, maxDiskSize), path)
+	vm := c.Isolation.Defaults.VM
+	for _, r := range resources {
+		host := c.Host
+		if r.atCreate {
+			host = nil
+		}
+		amount := *r.field(&vm)
+		if limit, expected := r.limit(host); amount < r.min || amount > limit {
+			return c.validationError(r.label, amount, expected, path)
+		}
 	}
 	if c.Isolation.Defaults.VM.BaseImage == "" {
 		return c.validationError("base_image", c.Isolation.Defaults.VM.BaseImage, "a non-empty string", path)
@@ -272,6 +460,17 @@ func (c *Config) Validate(path string) error {
 	if c.Isolation.Defaults.Proxy.Mode != "auto" && c.Isolation.Defaults.Proxy.Mode != "on" && c.Isolation.Defaults.Proxy.Mode != "off" {
 		return c.validationError("proxy mode", c.Isolation.Defaults.Proxy.Mode, "one of: auto, on, off", path)
 	}
+	if c.Isolation.Provider != "" && c.Isolation.Provider != "tart" && c.Isolation.Provider != "lima" && c.Isolation.Provider != "sim" {
+		return c.validationError("provider", c.Isolation.Provider, "one of: tart, lima, sim", path)
+	}
+	for i, repo := range c.VM.Repos {
+		if repo.Name == "" {
+			return c.validationError(fmt.Sprintf("repo #%d name", i+1), repo.Name, "a non-empty string", path)
+		}
+	}
+	if strings.HasPrefix(c.Isolation.Host, "-") || strings.ContainsAny(c.Isolation.Host, " \t\n") {
+		return c.validationError("host", c.Isolation.Host, "an ssh destination such as user@host", path)
+	}
 	return nil
 }
 
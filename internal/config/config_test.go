@@ -36,6 +36,9 @@ func TestLoadConfig(t *testing.T) {
 		if cfg.Isolation.Defaults.Proxy.Mode != "auto" {
 			t.Errorf("Expected Proxy mode default 'auto', got %s", cfg.Isolation.Defaults.Proxy.Mode)
 		}
+		if cfg.Isolation.Provider != "tart" {
+			t.Errorf("Expected provider default 'tart', got %s", cfg.Isolation.Provider)
+		}
 	})
 
 	// Test loading config when both paths are empty (should use defaults)
@@ -151,6 +154,44 @@ isolation:
 		}
 	})
 
+	// Test VM provider selection
+	t.Run("when config selects lima provider should load provider", func(t *testing.T) {
+		// Arrange
+		tmpDir := t.TempDir()
+		configPath := filepath.Join(tmpDir, "config.yaml")
+		if err := os.WriteFile(configPath, []byte("isolation:\n  provider: lima\n"), 0644); err != nil {
+			t.Fatalf("Failed to write config file: %v", err)
+		}
+
+		// Act
+		cfg, err := LoadConfig(configPath, "")
+
+		// Assert
+		if err != nil {
+			t.Fatalf("LoadConfig returned unexpected error: %v", err)
+		}
+		if cfg.Isolation.Provider != "lima" {
+			t.Errorf("Expected provider 'lima', got %s", cfg.Isolation.Provider)
+		}
+	})
+
+	t.Run("when config has unknown provider should return validation error", func(t *testing.T) {
+		// Arrange
+		tmpDir := t.TempDir()
+		configPath := filepath.Join(tmpDir, "config.yaml")
+		if err := os.WriteFile(configPath, []byte("isolation:\n  provider: vmware\n"), 0644); err != nil {
+			t.Fatalf("Failed to write config file: %v", err)
+		}
+
+		// Act
+		_, err := LoadConfig(configPath, "")
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "invalid provider 'vmware'") {
+			t.Errorf("Expected invalid provider error, got: %v", err)
+		}
+	})
+
 	// Test malformed YAML file (should return error)
 	t.Run("when config file contains malformed YAML should return parse error", func(t *testing.T) {
 		// Arrange
@@ -656,3 +697,294 @@ func TestConfigPathValidation(t *testing.T) {
 		}
 	})
 }
+
+func TestLoadConfigWithOrigins(t *testing.T) {
+	t.Run("when values come from files and defaults should record each origin", func(t *testing.T) {
+		// Arrange
+		tmpDir := t.TempDir()
+		globalConfigPath := filepath.Join(tmpDir, "config.yaml")
+		vmConfigPath := filepath.Join(tmpDir, "vm.yaml")
+		globalConfigContent := "version: 1\nisolation:\n  defaults:\n    vm:\n      cpu: 4\n      memory: 8192\n"
+		if err := os.WriteFile(globalConfigPath, []byte(globalConfigContent), 0644); err != nil {
+			t.Fatalf("Failed to write global config: %v", err)
+		}
+		if err := os.WriteFile(vmConfigPath, []byte("# calf-dev\ncpu: 6\n"), 0644); err != nil {
+			t.Fatalf("Failed to write VM config: %v", err)
+		}
+
+		// Act
+		cfg, origins, err := LoadConfigWithOrigins(globalConfigPath, vmConfigPath)
+
+		// Assert
+		if err != nil {
+			t.Fatalf("LoadConfigWithOrigins returned unexpected error: %v", err)
+		}
+		if cfg.Isolation.Defaults.VM.CPU != 6 {
+			t.Errorf("CPU = %d, want 6", cfg.Isolation.Defaults.VM.CPU)
+		}
+		if got := origins["isolation.defaults.vm.cpu"].String(); got != vmConfigPath+":2" {
+			t.Errorf("cpu origin = %q, want %s:2", got, vmConfigPath)
+		}
+		if got := origins["isolation.defaults.vm.memory"].String(); got != globalConfigPath+":6" {
+			t.Errorf("memory origin = %q, want %s:6", got, globalConfigPath)
+		}
+		if got := origins["isolation.defaults.vm.base_image"]; got.Kind != OriginDefault {
+			t.Errorf("base_image origin = %v, want default", got)
+		}
+		if got := origins["isolation.defaults.proxy.mode"]; got.Kind != OriginDefault {
+			t.Errorf("proxy mode origin = %v, want default", got)
+		}
+	})
+}
+
+func TestKeys(t *testing.T) {
+	t.Run("when listing keys should derive every leaf from yaml tags", func(t *testing.T) {
+		// Act
+		keys := Keys()
+
+		// Assert
+		want := []string{
+			"version",
+			"isolation.provider",
+			"isolation.host",
+			"isolation.defaults.vm.cpu",
+			"isolation.defaults.vm.memory",
+			"isolation.defaults.vm.disk_size",
+			"isolation.defaults.vm.base_image",
+			"isolation.defaults.github.default_branch_prefix",
+			"isolation.defaults.output.sync_dir",
+			"isolation.defaults.proxy.mode",
+			"vm.name",
+			"vm.agent",
+			"vm.environments",
+			"vm.repos",
+			"vm.isolation.no_mount",
+			"vm.isolation.no_network",
+			"agents",
+			"hooks.setup",
+		}
+		if strings.Join(keys, ",") != strings.Join(want, ",") {
+			t.Errorf("Keys() = %v, want %v", keys, want)
+		}
+	})
+}
+
+// envLookup returns an environment lookup backed by vars.
+func envLookup(vars map[string]string) LoadOption {
+	return WithEnvLookup(func(name string) (string, bool) {
+		value, ok := vars[name]
+		return value, ok
+	})
+}
+
+func TestLoadConfigOverrides(t *testing.T) {
+	t.Run("when env and flags set should override files with flags winning", func(t *testing.T) {
+		// Arrange
+		tmpDir := t.TempDir()
+		vmConfigPath := filepath.Join(tmpDir, "vm.yaml")
+		if err := os.WriteFile(vmConfigPath, []byte("cpu: 6\nmemory: 4096\n"), 0644); err != nil {
+			t.Fatalf("Failed to write VM config: %v", err)
+		}
+		env := envLookup(map[string]string{"CALF_VM_CPU": "8", "CALF_VM_MEMORY": "12288", "CALF_PROXY_MODE": "off"})
+
+		// Act
+		cfg, origins, err := LoadConfigWithOrigins("", vmConfigPath, env, WithFlagOverrides(map[string]string{"vm-cpu": "10"}))
+
+		// Assert
+		if err != nil {
+			t.Fatalf("LoadConfigWithOrigins returned unexpected error: %v", err)
+		}
+		if cfg.Isolation.Defaults.VM.CPU != 10 || cfg.Isolation.Defaults.VM.Memory != 12288 || cfg.Isolation.Defaults.Proxy.Mode != "off" {
+			t.Errorf("VM = %+v, proxy = %s, want flag CPU 10, env memory 12288 and proxy off", cfg.Isolation.Defaults.VM, cfg.Isolation.Defaults.Proxy.Mode)
+		}
+		if got := origins["isolation.defaults.vm.cpu"].String(); got != "flag --vm-cpu" {
+			t.Errorf("cpu origin = %q, want flag --vm-cpu", got)
+		}
+		if got := origins["isolation.defaults.vm.memory"].String(); got != "env CALF_VM_MEMORY" {
+			t.Errorf("memory origin = %q, want env CALF_VM_MEMORY", got)
+		}
+	})
+
+	t.Run("when env value out of range should name the variable", func(t *testing.T) {
+		// Act
+		_, err := LoadConfig("", "", envLookup(map[string]string{"CALF_VM_CPU": "99"}))
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "invalid CPU '99' in CALF_VM_CPU") {
+			t.Errorf("LoadConfig error = %v, want range error naming CALF_VM_CPU", err)
+		}
+	})
+
+	t.Run("when flag value is not an integer should return error", func(t *testing.T) {
+		// Act
+		_, err := LoadConfig("", "", envLookup(nil), WithFlagOverrides(map[string]string{"vm-memory": "lots"}))
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "invalid --vm-memory: 'lots' is not an integer") {
+			t.Errorf("LoadConfig error = %v, want integer error", err)
+		}
+	})
+
+	t.Run("when env value is empty should be ignored", func(t *testing.T) {
+		// Act
+		cfg, err := LoadConfig("", "", envLookup(map[string]string{"CALF_PROVIDER": ""}))
+
+		// Assert
+		if err != nil || cfg.Isolation.Provider != "tart" {
+			t.Errorf("LoadConfig = %+v, %v, want default provider", cfg, err)
+		}
+	})
+}
+
+func TestOverrideNames(t *testing.T) {
+	t.Run("when naming overrides should derive env and flag names from keys", func(t *testing.T) {
+		// Act
+		env := EnvName("isolation.defaults.github.default_branch_prefix")
+		flag := FlagName("isolation.defaults.vm.disk_size")
+		provider := EnvName("isolation.provider")
+
+		// Assert
+		if env != "CALF_GITHUB_DEFAULT_BRANCH_PREFIX" || flag != "vm-disk-size" || provider != "CALF_PROVIDER" {
+			t.Errorf("names = %s, %s, %s, want CALF_GITHUB_DEFAULT_BRANCH_PREFIX, vm-disk-size, CALF_PROVIDER", env, flag, provider)
+		}
+	})
+}
+
+func TestSetInFile(t *testing.T) {
+	t.Run("when setting existing key should preserve comments and ordering", func(t *testing.T) {
+		// Arrange
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		content := "# CALF config\nversion: 1\nisolation:\n  defaults:\n    vm:\n      cpu: 4 # cores\n      memory: 8192\n"
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+
+		// Act
+		err := SetInFile(path, path, false, "vm.cpu", "8")
+
+		// Assert
+		if err != nil {
+			t.Fatalf("SetInFile returned unexpected error: %v", err)
+		}
+		data, _ := os.ReadFile(path)
+		want := "# CALF config\nversion: 1\nisolation:\n  defaults:\n    vm:\n      cpu: 8 # cores\n      memory: 8192\n"
+		if string(data) != want {
+			t.Errorf("file = %q, want %q", data, want)
+		}
+	})
+
+	t.Run("when file is private should keep its mode", func(t *testing.T) {
+		// Arrange
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(path, []byte("version: 1\n"), 0600); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+
+		// Act
+		err := SetInFile(path, path, false, "vm.cpu", "8")
+
+		// Assert
+		if err != nil {
+			t.Fatalf("SetInFile returned unexpected error: %v", err)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("Failed to stat config: %v", err)
+		}
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("mode = %o, want 600", info.Mode().Perm())
+		}
+	})
+
+	t.Run("when setting new nested key should create mappings", func(t *testing.T) {
+		// Arrange
+		path := filepath.Join(t.TempDir(), ".calf", "config.yaml")
+
+		// Act
+		err := SetInFile(path, path, false, "isolation.defaults.proxy.mode", "off")
+
+		// Assert
+		if err != nil {
+			t.Fatalf("SetInFile returned unexpected error: %v", err)
+		}
+		cfg, err := LoadConfig(path, "", WithEnvLookup(func(string) (string, bool) { return "", false }))
+		if err != nil || cfg.Isolation.Defaults.Proxy.Mode != "off" {
+			t.Errorf("LoadConfig = %+v, %v, want proxy mode off", cfg, err)
+		}
+	})
+
+	t.Run("when value is invalid should leave file untouched", func(t *testing.T) {
+		// Arrange
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		content := "isolation:\n  defaults:\n    vm:\n      cpu: 4\n"
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+
+		// Act
+		rangeErr := SetInFile(path, path, false, "vm.cpu", "64")
+		typeErr := SetInFile(path, path, false, "vm.memory", "lots")
+
+		// Assert
+		if rangeErr == nil || !strings.Contains(rangeErr.Error(), "invalid CPU '64'") {
+			t.Errorf("SetInFile range error = %v, want CPU validation error", rangeErr)
+		}
+		if typeErr == nil || !strings.Contains(typeErr.Error(), "not an integer") {
+			t.Errorf("SetInFile type error = %v, want integer error", typeErr)
+		}
+		data, _ := os.ReadFile(path)
+		if string(data) != content {
+			t.Errorf("file = %q, want unchanged", data)
+		}
+		entries, _ := os.ReadDir(filepath.Dir(path))
+		if len(entries) != 1 {
+			t.Errorf("expected no temporary files left, got %d entries", len(entries))
+		}
+	})
+
+	t.Run("when editing vm file should accept only vm keys under their schema path", func(t *testing.T) {
+		// Arrange
+		tmpDir := t.TempDir()
+		globalPath := filepath.Join(tmpDir, "config.yaml")
+		vmPath := filepath.Join(tmpDir, "vms", "calf-dev", "vm.yaml")
+
+		// Act
+		err := SetInFile(globalPath, vmPath, true, "memory", "4096")
+		providerErr := SetInFile(globalPath, vmPath, true, "provider", "sim")
+
+		// Assert
+		if err != nil {
+			t.Fatalf("SetInFile returned unexpected error: %v", err)
+		}
+		data, _ := os.ReadFile(vmPath)
+		if string(data) != "version: 2\nresources:\n  memory: 4096\n" {
+			t.Errorf("vm file = %q, want versioned file with memory under resources", data)
+		}
+		if providerErr == nil || !strings.Contains(providerErr.Error(), "cannot be set per VM") {
+			t.Errorf("SetInFile provider error = %v, want per-VM key error", providerErr)
+		}
+	})
+}
+
+func TestUnsetInFile(t *testing.T) {
+	t.Run("when unsetting only key of a section should remove the empty section", func(t *testing.T) {
+		// Arrange
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		content := "version: 1\nisolation:\n  provider: tart\n  defaults:\n    proxy:\n      mode: on\n"
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+
+		// Act
+		err := UnsetInFile(path, path, false, "proxy.mode")
+
+		// Assert
+		if err != nil {
+			t.Fatalf("UnsetInFile returned unexpected error: %v", err)
+		}
+		data, _ := os.ReadFile(path)
+		if string(data) != "version: 1\nisolation:\n  provider: tart\n" {
+			t.Errorf("file = %q, want proxy section removed", data)
+		}
+	})
+}
@@ -0,0 +1,282 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ResolveKey returns the full dotted key for key, which may also be given
+// without its isolation.defaults prefix (e.g. vm.cpu).
+func ResolveKey(key string) (string, error) {
+	for _, k := range Keys() {
+		if k == key || shortKey(k) == key {
+			return k, nil
+		}
+	}
+	return "", fmt.Errorf("unknown config key '%s'", key)
+}
+
+// Get returns the value of key in cfg as text.
+func Get(cfg *Config, key string) (string, error) {
+	key, err := ResolveKey(key)
+	if err != nil {
+		return "", err
+	}
+	v, err := field(cfg, key)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprint(v.Interface()), nil
+}
+
+// SetInFile sets key to value in the config file at path, creating the file
+// if needed. With vm set, path is a per-VM file and only keys its schema
+// holds (see vmFile) are accepted; they may be named by their config key or
+// their key in the file (e.g. resources.cpu). Comments and ordering in the
+// file are preserved. The resulting configuration, merged over globalPath
+// when editing a per-VM file, must pass Validate, against the host if
+// WithHostProbe is given; otherwise the file is left untouched. Other
+// options are ignored. The file is replaced atomically.
+func SetInFile(globalPath, path string, vm bool, key, value string, opts ...LoadOption) error {
+	key, fileKey, err := editKey(key, vm)
+	if err != nil {
+		return err
+	}
+	// Parse the value as its field's type first, for a clear error.
+	if err := setValue(newDefaultConfig(), key, value); err != nil {
+		return fmt.Errorf("invalid value for %s: %w", key, err)
+	}
+	return editFile(globalPath, path, vm, opts, func(root *yaml.Node) {
+		setNode(root, strings.Split(fileKey, "."), scalarNode(key, value))
+	})
+}
+
+// UnsetInFile removes key from the config file at path, so the value falls
+// back to lower-precedence layers. Like SetInFile, the file is only rewritten
+// if the result is valid. Unsetting a key that is not in the file is not an
+// error.
+func UnsetInFile(globalPath, path string, vm bool, key string, opts ...LoadOption) error {
+	key, fileKey, err := editKey(key, vm)
+	if err != nil {
+		return err
+	}
+	return editFile(globalPath, path, vm, opts, func(root *yaml.Node) {
+		unsetNode(root, strings.Split(fileKey, "."))
+	})
+}
+
+// editKey resolves key and returns it with its path in the file being
+// edited. Per-VM keys may also be named as they appear in vm.yaml
+// (resources.cpu), or by their field name alone (cpu).
+func editKey(key string, vm bool) (string, string, error) {
+	if configKey, ok := vmFileKeys()[key]; ok && vm {
+		key = configKey
+	}
+	resolved, err := ResolveKey(key)
+	if err != nil && vm {
+		resolved, err = ResolveKey("vm." + key)
+	}
+	if err != nil {
+		return "", "", err
+	}
+	key = resolved
+	if !slices.Contains(editableKeys(), key) {
+		return "", "", fmt.Errorf("config key '%s' cannot be edited", key)
+	}
+	if !vm {
+		if strings.HasPrefix(key, "vm.") {
+			return "", "", fmt.Errorf("config key '%s' can only be set per VM", key)
+		}
+		return key, key, nil
+	}
+	fileKey, ok := vmFileKey(key)
+	if !ok {
+		return "", "", fmt.Errorf("config key '%s' cannot be set per VM", key)
+	}
+	return key, fileKey, nil
+}
+
+// editFile applies edit to the YAML document in path, validates the result
+// and atomically replaces the file.
+func editFile(globalPath, path string, vm bool, opts []LoadOption, edit func(root *yaml.Node)) error {
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read config file '%s': %w", path, err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("failed to parse config file '%s': %w", path, err)
+	}
+	if doc.Kind == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("failed to edit config file '%s': top level is not a mapping", path)
+	}
+	// Edits are written in the current schema, so older files are upgraded
+	// first, keeping a backup as MigrateFile does.
+	kind := kindGlobal
+	if vm {
+		kind = kindVM
+	}
+	steps, current := kind.migrations()
+	from, err := upgrade(root, path, steps, current)
+	if err != nil {
+		return err
+	}
+	edit(root)
+
+	edited, err := encodeConfig(&doc, path)
+	if err != nil {
+		return err
+	}
+	if err := validateEdit(globalPath, path, vm, edited, defaultLoadOptions(opts).probe); err != nil {
+		return err
+	}
+	if from != current && len(data) > 0 {
+		if _, err := backupConfig(path, from, data); err != nil {
+			return err
+		}
+	}
+	return writeFileAtomic(path, edited)
+}
+
+// validateEdit checks the configuration that results from replacing the file
+// at path with data, sized for and checked against the host reported by
+// probe, if any, as it will be when loaded. Environment and flag overrides
+// are not applied, since they do not belong to the file, and unknown keys are
+// left for 'calf config validate' to report, so they do not block unrelated
+// edits.
+func validateEdit(globalPath, path string, vm bool, data []byte, probe HostProbe) error {
+	cfg := newDefaultConfig()
+	origins := defaultOrigins()
+	o := loadOptions{lenient: true}
+	if !vm {
+		if err := loadConfigData(cfg, origins, data, path, o); err != nil {
+			return err
+		}
+		return cfg.validateForHost(path, probe, origins)
+	}
+	if globalPath != "" {
+		if err := loadConfigFile(cfg, origins, globalPath, o); err != nil {
+			return err
+		}
+	}
+	if err := loadVMConfigData(cfg, origins, data, path, o); err != nil {
+		return err
+	}
+	return cfg.validateForHost(path, probe, origins)
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames it
+// into place, so readers never see a partial file. An existing file keeps its
+// permissions; a new one is created 0644.
+func writeFileAtomic(path string, data []byte) error {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create config directory '%s': %w", dir, err)
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to write config file '%s': %w", path, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write config file '%s': %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write config file '%s': %w", path, err)
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return fmt.Errorf("failed to write config file '%s': %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write config file '%s': %w", path, err)
+	}
+	return nil
+}
+
+// scalarNode returns a node for value, tagged with the type of key's field
+// so numbers and booleans are written unquoted and strings that look like
+// other types are quoted.
+func scalarNode(key, value string) *yaml.Node {
+	tag := "!!str"
+	v, err := field(newDefaultConfig(), key)
+	switch {
+	case err == nil && v.Kind() == reflect.Int:
+		// Relative resources, such as "50%", stay strings.
+		if n, err := strconv.Atoi(value); err == nil {
+			tag = "!!int"
+			value = strconv.Itoa(n)
+		}
+	case err == nil && v.Kind() == reflect.Bool:
+		tag = "!!bool"
+		b, _ := strconv.ParseBool(value)
+		value = strconv.FormatBool(b)
+	}
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: value}
+}
+
+// setNode sets the value at path in mapping, creating intermediate mappings
+// (and replacing non-mapping values in the way) as needed. An existing value
+// keeps its comments.
+func setNode(mapping *yaml.Node, path []string, value *yaml.Node) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value != path[0] {
+			continue
+		}
+		current := mapping.Content[i+1]
+		if len(path) == 1 {
+			value.HeadComment, value.LineComment, value.FootComment = current.HeadComment, current.LineComment, current.FootComment
+			mapping.Content[i+1] = value
+			return
+		}
+		if current.Kind != yaml.MappingNode {
+			*current = yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", LineComment: current.LineComment}
+		}
+		setNode(current, path[1:], value)
+		return
+	}
+
+	key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: path[0]}
+	if len(path) == 1 {
+		mapping.Content = append(mapping.Content, key, value)
+		return
+	}
+	child := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	mapping.Content = append(mapping.Content, key, child)
+	setNode(child, path[1:], value)
+}
+
+// unsetNode removes the value at path from mapping, along with mappings left
+// empty by the removal. It reports whether mapping is now empty.
+func unsetNode(mapping *yaml.Node, path []string) bool {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value != path[0] {
+			continue
+		}
+		remove := len(path) == 1
+		if !remove && mapping.Content[i+1].Kind == yaml.MappingNode {
+			remove = unsetNode(mapping.Content[i+1], path[1:])
+		}
+		if remove {
+			mapping.Content = slices.Delete(mapping.Content, i, i+2)
+		}
+		break
+	}
+	return len(mapping.Content) == 0
+}
@@ -0,0 +1,254 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// autoPercent is the share of the host that a resource set to auto gets.
+const autoPercent = 50
+
+// HostCapacity is what the machine running the VMs can give them.
+type HostCapacity struct {
+	CPUs       int // Logical cores
+	MemoryMB   int // Physical memory
+	FreeDiskGB int // Free space on the volume holding the home directory
+}
+
+// HostProbe reads the capacity of the host.
+type HostProbe func() (HostCapacity, error)
+
+// ProbeHost reads the capacity of the local machine.
+func ProbeHost() (HostCapacity, error) {
+	memory, err := hostMemoryMB()
+	if err != nil {
+		return HostCapacity{}, fmt.Errorf("failed to read host memory: %w", err)
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return HostCapacity{}, fmt.Errorf("failed to get home directory: %w", err)
+	}
+	disk, err := hostFreeDiskGB(homeDir)
+	if err != nil {
+		return HostCapacity{}, fmt.Errorf("failed to read free disk space: %w", err)
+	}
+	return HostCapacity{CPUs: runtime.NumCPU(), MemoryMB: memory, FreeDiskGB: disk}, nil
+}
+
+// String describes the capacity, e.g. "10 cores, 24576 MB, 120 GB free".
+func (h HostCapacity) String() string {
+	return fmt.Sprintf("%d cores, %d MB, %d GB free", h.CPUs, h.MemoryMB, h.FreeDiskGB)
+}
+
+// resource describes a VM resource that is checked against the host and
+// can be sized relative to it.
+type resource struct {
+	name     string // yaml name in VMConfig
+	label    string // Name in validation errors
+	unit     string // Suffix of amounts in validation errors
+	min, max int    // Fixed bounds, whatever the host
+	// atCreate resources only need to fit the host when a VM is created
+	// (see ValidateForCreate).
+	atCreate bool
+	field    func(vm *VMConfig) *int
+	// capacity returns how much of the resource the host has, and
+	// describes it.
+	capacity func(host HostCapacity) (int, string)
+}
+
+// resources lists the VM resources that fit the host.
+var resources = []resource{
+	{
+		name: "cpu", label: "CPU", min: minCPU, max: maxCPU,
+		field: func(vm *VMConfig) *int { return &vm.CPU },
+		capacity: func(h HostCapacity) (int, string) {
+			return h.CPUs, fmt.Sprintf("%d cores", h.CPUs)
+		},
+	},
+	{
+		name: "memory", label: "memory", unit: " MB", min: minMemory, max: maxMemory,
+		field: func(vm *VMConfig) *int { return &vm.Memory },
+		capacity: func(h HostCapacity) (int, string) {
+			return h.MemoryMB, fmt.Sprintf("%d MB", h.MemoryMB)
+		},
+	},
+	{
+		name: "disk_size", label: "disk_size", unit: " GB", min: minDiskSize, max: maxDiskSize,
+		// Free space changes as the disk fills, and a VM's disk is only
+		// allocated when it is created.
+		atCreate: true,
+		field:    func(vm *VMConfig) *int { return &vm.DiskSize },
+		capacity: func(h HostCapacity) (int, string) {
+			return h.FreeDiskGB, fmt.Sprintf("%d GB free", h.FreeDiskGB)
+		},
+	},
+}
+
+// limit returns the largest valid amount of the resource, its fixed max or
+// what host has if that is less, and describes the valid range. host is nil
+// if its capacity is unknown.
+func (r resource) limit(host *HostCapacity) (int, string) {
+	expected := fmt.Sprintf("between %d and %d%s", r.min, r.max, r.unit)
+	if host == nil {
+		return r.max, expected
+	}
+	available, description := r.capacity(*host)
+	if available >= r.max {
+		return r.max, expected
+	}
+	return available, fmt.Sprintf("between %d and %d%s (the host has %s)", r.min, available, r.unit, description)
+}
+
+// ValidateForCreate checks the resources that only need to fit the host when
+// a VM is created, which Validate checks against their fixed bounds alone:
+// the disk size must fit the free disk space. It passes if the host's
+// capacity is unknown (see Host).
+func (c *Config) ValidateForCreate(path string) error {
+	if c.Host == nil {
+		return nil
+	}
+	vm := c.Isolation.Defaults.VM
+	for _, r := range resources {
+		amount := *r.field(&vm)
+		if limit, expected := r.limit(c.Host); r.atCreate && amount > limit {
+			return c.validationError(r.label, amount, expected, path)
+		}
+	}
+	return nil
+}
+
+// findResource returns the resource with the given yaml name.
+func findResource(name string) (resource, bool) {
+	for _, r := range resources {
+		if r.name == name {
+			return r, true
+		}
+	}
+	return resource{}, false
+}
+
+// parseRelative parses a relative resource amount, "auto" or a percentage
+// such as "50%", into a percentage of the host. It reports false for
+// absolute amounts.
+func parseRelative(raw string) (int, bool, error) {
+	if raw == "auto" {
+		return autoPercent, true, nil
+	}
+	digits, ok := strings.CutSuffix(raw, "%")
+	if !ok {
+		return 0, false, nil
+	}
+	percent, err := strconv.Atoi(digits)
+	if err != nil || percent < 1 || percent > 100 {
+		return 0, false, fmt.Errorf("'%s' is not a percentage between 1%% and 100%%", raw)
+	}
+	return percent, true, nil
+}
+
+// overlayField takes over decoding of resources set to auto or a
+// percentage, keeping them in Relative until they are resolved for the host.
+// An absolute amount clears the relative one of a lower layer.
+func (vm *VMConfig) overlayField(name string, node *yaml.Node) (bool, error) {
+	if _, ok := findResource(name); !ok || node.Kind != yaml.ScalarNode {
+		return false, nil
+	}
+	return vm.setRelative(name, node.Value)
+}
+
+// setRelative records raw as the relative amount of the named resource and
+// reports true, or clears it and reports false if raw is absolute.
+func (vm *VMConfig) setRelative(name, raw string) (bool, error) {
+	_, relative, err := parseRelative(raw)
+	if err != nil {
+		return false, err
+	}
+	if !relative {
+		delete(vm.Relative, name)
+		return false, nil
+	}
+	if vm.Relative == nil {
+		vm.Relative = map[string]string{}
+	}
+	vm.Relative[name] = raw
+	return true, nil
+}
+
+// sizeForHost resolves the resources set to auto or a percentage against
+// host, which is nil if its capacity is unknown, with unknown saying why.
+// Resources left at their defaults that exceed the host are sized as auto,
+// and recorded as such in Relative, so the defaults work on small machines.
+func (c *Config) sizeForHost(host *HostCapacity, unknown error, origins Origins) error {
+	c.Host = host
+	vm := &c.Isolation.Defaults.VM
+	for _, r := range resources {
+		spec, relative := vm.Relative[r.name]
+		if !relative {
+			if host != nil && origins["isolation.defaults.vm."+r.name].Kind == OriginDefault && *r.field(vm) > r.available(*host) {
+				*r.field(vm) = r.size(autoPercent, *host)
+				vm.setRelative(r.name, "auto")
+			}
+			continue
+		}
+		if host == nil {
+			return fmt.Errorf("cannot size %s '%s': %w", r.name, spec, unknown)
+		}
+		percent, _, _ := parseRelative(spec)
+		*r.field(vm) = r.size(percent, *host)
+	}
+	return nil
+}
+
+// validateForHost sizes c's relative resources for the host reported by
+// probe and validates c against it, as LoadConfig does. Without a probe,
+// relative resources are left unsized and only the fixed bounds are checked.
+func (c *Config) validateForHost(path string, probe HostProbe, origins Origins) error {
+	if probe != nil {
+		capacity, unknown := hostSizer(probe)(c)
+		if err := c.sizeForHost(capacity, unknown, origins); err != nil {
+			return fmt.Errorf("invalid resources in %s: %w", path, err)
+		}
+	}
+	return c.Validate(path)
+}
+
+// hostSizer returns a function that reports the capacity to size c against:
+// the local machine's, read once through probe, unless the VMs run on a
+// remote host. If the capacity is unknown it returns nil and the reason.
+func hostSizer(probe HostProbe) func(c *Config) (*HostCapacity, error) {
+	var host *HostCapacity
+	var err error
+	if probe == nil {
+		err = fmt.Errorf("the host's capacity is unknown")
+	}
+	probed := probe == nil
+	return func(c *Config) (*HostCapacity, error) {
+		if c.Isolation.Host != "" {
+			return nil, fmt.Errorf("the capacity of remote host '%s' is unknown: set an absolute value", c.Isolation.Host)
+		}
+		if !probed {
+			probed = true
+			var capacity HostCapacity
+			if capacity, err = probe(); err == nil {
+				host = &capacity
+			}
+		}
+		return host, err
+	}
+}
+
+// available returns how much of the resource host has.
+func (r resource) available(host HostCapacity) int {
+	n, _ := r.capacity(host)
+	return n
+}
+
+// size returns percent of the host's capacity for the resource, kept within
+// the resource's fixed bounds.
+func (r resource) size(percent int, host HostCapacity) int {
+	return min(max(r.available(host)*percent/100, r.min), r.max)
+}
@@ -0,0 +1,14 @@
+//go:build darwin
+
+package config
+
+import "golang.org/x/sys/unix"
+
+// hostMemoryMB returns the physical memory of the machine, from sysctl.
+func hostMemoryMB() (int, error) {
+	bytes, err := unix.SysctlUint64("hw.memsize")
+	if err != nil {
+		return 0, err
+	}
+	return int(bytes / (1 << 20)), nil
+}
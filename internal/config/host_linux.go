@@ -0,0 +1,14 @@
+//go:build linux
+
+package config
+
+import "golang.org/x/sys/unix"
+
+// hostMemoryMB returns the physical memory of the machine, from sysinfo.
+func hostMemoryMB() (int, error) {
+	var info unix.Sysinfo_t
+	if err := unix.Sysinfo(&info); err != nil {
+		return 0, err
+	}
+	return int(uint64(info.Totalram) * uint64(info.Unit) / (1 << 20)), nil
+}
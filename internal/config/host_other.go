@@ -0,0 +1,19 @@
+//go:build !darwin && !linux
+
+package config
+
+import "errors"
+
+// errHostUnsupported reports that the host's capacity cannot be read on this
+// platform.
+var errHostUnsupported = errors.New("not supported on this platform")
+
+// hostMemoryMB is not implemented on this platform.
+func hostMemoryMB() (int, error) {
+	return 0, errHostUnsupported
+}
+
+// hostFreeDiskGB is not implemented on this platform.
+func hostFreeDiskGB(dir string) (int, error) {
+	return 0, errHostUnsupported
+}
@@ -0,0 +1,254 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// laptop is the capacity of a small host: 8 cores, 24 GB RAM, 100 GB free.
+var laptop = HostCapacity{CPUs: 8, MemoryMB: 24576, FreeDiskGB: 100}
+
+// probeFor returns a HostProbe reporting host.
+func probeFor(host HostCapacity) HostProbe {
+	return func() (HostCapacity, error) { return host, nil }
+}
+
+// writeGlobalConfig writes content to a temporary config.yaml.
+func writeGlobalConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	return path
+}
+
+func TestLoadConfigHostSizing(t *testing.T) {
+	t.Run("when resources are relative should size them for the host", func(t *testing.T) {
+		// Arrange
+		path := writeGlobalConfig(t, "isolation:\n  defaults:\n    vm:\n      cpu: auto\n      memory: 50%\n      disk_size: 40%\n")
+
+		// Act
+		cfg, origins, err := LoadConfigWithOrigins(path, "", WithHostProbe(probeFor(laptop)))
+
+		// Assert
+		if err != nil {
+			t.Fatalf("LoadConfigWithOrigins returned unexpected error: %v", err)
+		}
+		vm := cfg.Isolation.Defaults.VM
+		if vm.CPU != 4 || vm.Memory != 12288 || vm.DiskSize != 40 {
+			t.Errorf("VM = %+v, want 4 cores, 12288 MB and 40 GB", vm)
+		}
+		if vm.Relative["memory"] != "50%" || cfg.Host == nil || *cfg.Host != laptop {
+			t.Errorf("Relative %v, Host %v, want memory 50%% sized for the laptop", vm.Relative, cfg.Host)
+		}
+		if got := origins["isolation.defaults.vm.memory"].String(); got != path+":5" {
+			t.Errorf("memory origin = %q, want %s:5", got, path)
+		}
+	})
+
+	t.Run("when a percentage is tiny should keep the minimum", func(t *testing.T) {
+		// Arrange
+		path := writeGlobalConfig(t, "isolation:\n  defaults:\n    vm:\n      cpu: 1%\n")
+
+		// Act
+		cfg, err := LoadConfig(path, "", WithHostProbe(probeFor(laptop)))
+
+		// Assert
+		if err != nil {
+			t.Fatalf("LoadConfig returned unexpected error: %v", err)
+		}
+		if cfg.Isolation.Defaults.VM.CPU != 1 {
+			t.Errorf("CPU = %d, want minimum 1", cfg.Isolation.Defaults.VM.CPU)
+		}
+	})
+
+	t.Run("when memory exceeds the host should name the host's memory", func(t *testing.T) {
+		// Arrange
+		path := writeGlobalConfig(t, "isolation:\n  defaults:\n    vm:\n      memory: 32768\n")
+
+		// Act
+		_, err := LoadConfig(path, "", WithHostProbe(probeFor(laptop)))
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "must be between 256 and 24576 MB (the host has 24576 MB)") {
+			t.Errorf("LoadConfig error = %v, want host memory error", err)
+		}
+	})
+
+	t.Run("when disk size exceeds free space should load and reject it for a new VM", func(t *testing.T) {
+		// Arrange
+		path := writeGlobalConfig(t, "isolation:\n  defaults:\n    vm:\n      disk_size: 200\n")
+
+		// Act
+		cfg, err := LoadConfig(path, "", WithHostProbe(probeFor(laptop)))
+
+		// Assert
+		if err != nil {
+			t.Fatalf("LoadConfig returned unexpected error: %v", err)
+		}
+		if err := cfg.ValidateForCreate(path); err == nil || !strings.Contains(err.Error(), "(the host has 100 GB free)") {
+			t.Errorf("ValidateForCreate error = %v, want free disk error", err)
+		}
+	})
+
+	t.Run("when defaults exceed a small host should size them as auto", func(t *testing.T) {
+		// Arrange
+		small := HostCapacity{CPUs: 2, MemoryMB: 4096, FreeDiskGB: 60}
+
+		// Act
+		cfg, err := LoadConfig("", "", WithHostProbe(probeFor(small)))
+
+		// Assert
+		if err != nil {
+			t.Fatalf("LoadConfig returned unexpected error: %v", err)
+		}
+		vm := cfg.Isolation.Defaults.VM
+		if vm.CPU != 1 || vm.Memory != 2048 || vm.DiskSize != 30 {
+			t.Errorf("VM = %+v, want half of the small host", vm)
+		}
+		if vm.Relative["cpu"] != "auto" || vm.Relative["memory"] != "auto" {
+			t.Errorf("Relative = %v, want the shrunk defaults recorded as auto", vm.Relative)
+		}
+	})
+
+	t.Run("when no probe is given should keep the fixed bounds", func(t *testing.T) {
+		// Arrange
+		path := writeGlobalConfig(t, "isolation:\n  defaults:\n    vm:\n      memory: 32768\n")
+
+		// Act
+		cfg, err := LoadConfig(path, "")
+
+		// Assert
+		if err != nil {
+			t.Fatalf("LoadConfig returned unexpected error: %v", err)
+		}
+		if cfg.Host != nil {
+			t.Errorf("Host = %v, want unknown", cfg.Host)
+		}
+	})
+
+	t.Run("when relative without a known host should return error", func(t *testing.T) {
+		// Arrange
+		path := writeGlobalConfig(t, "isolation:\n  host: dev@studio.local\n  defaults:\n    vm:\n      memory: 50%\n")
+		failing := func() (HostCapacity, error) { return HostCapacity{}, errors.New("no sysctl") }
+
+		// Act
+		_, remoteErr := LoadConfig(path, "", WithHostProbe(probeFor(laptop)))
+		_, unknownErr := LoadConfig(writeGlobalConfig(t, "isolation:\n  defaults:\n    vm:\n      cpu: auto\n"), "", WithHostProbe(failing))
+
+		// Assert
+		if remoteErr == nil || !strings.Contains(remoteErr.Error(), "remote host 'dev@studio.local'") {
+			t.Errorf("remote error = %v, want remote host error", remoteErr)
+		}
+		if unknownErr == nil || !strings.Contains(unknownErr.Error(), "cannot size cpu 'auto': no sysctl") {
+			t.Errorf("probe error = %v, want probe failure", unknownErr)
+		}
+	})
+
+	t.Run("when an override is absolute should replace the relative setting", func(t *testing.T) {
+		// Arrange
+		path := writeGlobalConfig(t, "isolation:\n  defaults:\n    vm:\n      memory: 50%\n")
+		env := envLookup(map[string]string{"CALF_VM_MEMORY": "4096"})
+
+		// Act
+		cfg, err := LoadConfig(path, "", env, WithHostProbe(probeFor(laptop)))
+
+		// Assert
+		if err != nil {
+			t.Fatalf("LoadConfig returned unexpected error: %v", err)
+		}
+		if cfg.Isolation.Defaults.VM.Memory != 4096 || len(cfg.Isolation.Defaults.VM.Relative) != 0 {
+			t.Errorf("Memory = %d, Relative %v, want absolute 4096", cfg.Isolation.Defaults.VM.Memory, cfg.Isolation.Defaults.VM.Relative)
+		}
+	})
+
+	t.Run("when a vm file sets a percentage out of range should report its line", func(t *testing.T) {
+		// Arrange
+		vmPath := filepath.Join(t.TempDir(), "vm.yaml")
+		if err := os.WriteFile(vmPath, []byte("resources:\n  memory: 150%\n"), 0644); err != nil {
+			t.Fatalf("Failed to write VM config: %v", err)
+		}
+
+		// Act
+		_, err := LoadConfig("", vmPath, WithHostProbe(probeFor(laptop)))
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "line 2: resources.memory: '150%' is not a percentage") {
+			t.Errorf("LoadConfig error = %v, want percentage error", err)
+		}
+	})
+}
+
+func TestSetInFileRelative(t *testing.T) {
+	t.Run("when value is a percentage should write it as a string", func(t *testing.T) {
+		// Arrange
+		path := filepath.Join(t.TempDir(), "config.yaml")
+
+		// Act
+		err := SetInFile(path, path, false, "vm.memory", "50%")
+
+		// Assert
+		if err != nil {
+			t.Fatalf("SetInFile returned unexpected error: %v", err)
+		}
+		data, _ := os.ReadFile(path)
+		if !strings.Contains(string(data), "memory: 50%") {
+			t.Errorf("config file = %q, want memory: 50%%", data)
+		}
+	})
+}
+
+func TestEditForHost(t *testing.T) {
+	t.Run("when set exceeds the host should leave the file untouched", func(t *testing.T) {
+		// Arrange
+		path := writeGlobalConfig(t, "isolation:\n  defaults:\n    vm:\n      memory: 8192\n")
+
+		// Act
+		err := SetInFile(path, path, false, "vm.memory", "65536", WithHostProbe(probeFor(laptop)))
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "(the host has 24576 MB)") {
+			t.Errorf("SetInFile error = %v, want host memory error", err)
+		}
+		data, _ := os.ReadFile(path)
+		if !strings.Contains(string(data), "memory: 8192") {
+			t.Errorf("config file = %q, want it unchanged", data)
+		}
+	})
+
+	t.Run("when validating a file that exceeds the host should report it", func(t *testing.T) {
+		// Arrange
+		path := writeGlobalConfig(t, "isolation:\n  defaults:\n    vm:\n      cpu: 16\n")
+
+		// Act
+		fixedErr := ValidateFile(path)
+		hostErr := ValidateFile(path, WithHostProbe(probeFor(laptop)))
+
+		// Assert
+		if fixedErr != nil {
+			t.Errorf("ValidateFile without a probe returned %v, want only fixed bounds checked", fixedErr)
+		}
+		if hostErr == nil || !strings.Contains(hostErr.Error(), "(the host has 8 cores)") {
+			t.Errorf("ValidateFile error = %v, want host cores error", hostErr)
+		}
+	})
+}
+
+func TestProbeHost(t *testing.T) {
+	t.Run("when probing this machine should report its capacity", func(t *testing.T) {
+		// Act
+		host, err := ProbeHost()
+
+		// Assert
+		if err != nil {
+			t.Skipf("host capacity not available: %v", err)
+		}
+		if host.CPUs < 1 || host.MemoryMB < 1 {
+			t.Errorf("ProbeHost() = %+v, want cores and memory", host)
+		}
+	})
+}
@@ -0,0 +1,15 @@
+//go:build darwin || linux
+
+package config
+
+import "golang.org/x/sys/unix"
+
+// hostFreeDiskGB returns the space available to the user on the volume
+// holding dir.
+func hostFreeDiskGB(dir string) (int, error) {
+	var stat unix.Statfs_t
+	if err := unix.Statfs(dir, &stat); err != nil {
+		return 0, err
+	}
+	return int(stat.Bavail * uint64(stat.Bsize) / (1 << 30)), nil
+}
@@ -0,0 +1,154 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// overlay merges a YAML node onto v, a value of the config schema, so the
+// schema is declared once, by the yaml tags of Config, and every file layer
+// is merged the same way:
+//
+//   - mapping keys select struct fields by yaml tag and merge recursively;
+//   - maps merge entry by entry, so a layer can override one entry;
+//   - lists and scalars replace the value below them;
+//   - structs implementing fieldOverlayer may decode their fields themselves.
+//
+// Null values and keys outside the schema are skipped. record, if not nil,
+// is called with the dotted key and node of every value that is set.
+func overlay(v reflect.Value, node *yaml.Node, key string, record func(key string, node *yaml.Node)) error {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	if node.Tag == "!!null" {
+		return nil
+	}
+
+	switch {
+	case v.Kind() == reflect.Pointer && !v.IsNil():
+		// Views such as vmFile point into the schema.
+		return overlay(v.Elem(), node, key, record)
+
+	case v.Kind() == reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			return fmt.Errorf("line %d: %s must be a mapping", node.Line, describeKey(key))
+		}
+		var custom fieldOverlayer
+		if v.CanAddr() {
+			custom, _ = v.Addr().Interface().(fieldOverlayer)
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			name, value := node.Content[i].Value, node.Content[i+1]
+			index, ok := fieldIndex(v.Type(), name)
+			if !ok {
+				continue
+			}
+			if custom != nil {
+				handled, err := custom.overlayField(name, value)
+				if err != nil {
+					return fmt.Errorf("line %d: %s: %w", value.Line, joinKey(key, name), err)
+				}
+				if handled {
+					if record != nil {
+						record(joinKey(key, name), value)
+					}
+					continue
+				}
+			}
+			if err := overlay(v.Field(index), value, joinKey(key, name), record); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case v.Kind() == reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			return fmt.Errorf("line %d: %s must be a mapping", node.Line, describeKey(key))
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			name := reflect.ValueOf(node.Content[i].Value).Convert(v.Type().Key())
+			entry := reflect.New(v.Type().Elem()).Elem()
+			if existing := v.MapIndex(name); existing.IsValid() {
+				entry.Set(existing)
+			}
+			if err := overlay(entry, node.Content[i+1], joinKey(key, node.Content[i].Value), record); err != nil {
+				return err
+			}
+			v.SetMapIndex(name, entry)
+		}
+
+	default:
+		value := reflect.New(v.Type())
+		if err := node.Decode(value.Interface()); err != nil {
+			return err
+		}
+		v.Set(value.Elem())
+	}
+
+	if record != nil {
+		record(key, node)
+	}
+	return nil
+}
+
+// fieldOverlayer is implemented by schema structs with fields that accept
+// more than their type decodes, such as VMConfig's "auto" resources.
+// overlayField reports whether it set the field itself.
+type fieldOverlayer interface {
+	overlayField(name string, node *yaml.Node) (bool, error)
+}
+
+// fieldIndex returns the index of the field of struct type t with the given
+// yaml name.
+func fieldIndex(t reflect.Type, name string) (int, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		if tag, ok := yamlName(t.Field(i)); ok && tag == name {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// yamlName returns the yaml name of a struct field, and false for fields
+// outside the schema.
+func yamlName(field reflect.StructField) (string, bool) {
+	name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	return name, name != "" && name != "-"
+}
+
+// joinKey appends name to a dotted key.
+func joinKey(key, name string) string {
+	if key == "" {
+		return name
+	}
+	return key + "." + name
+}
+
+// describeKey names a key in errors.
+func describeKey(key string) string {
+	if key == "" {
+		return "the top level"
+	}
+	return key
+}
+
+// withoutKey returns a copy of mapping without the given key.
+func withoutKey(mapping *yaml.Node, key string) *yaml.Node {
+	if mapping.Kind != yaml.MappingNode {
+		return mapping
+	}
+	filtered := *mapping
+	filtered.Content = nil
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value != key {
+			filtered.Content = append(filtered.Content, mapping.Content[i], mapping.Content[i+1])
+		}
+	}
+	return &filtered
+}
@@ -0,0 +1,119 @@
+package config
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// overlaySchema exercises the kinds of values overlay merges.
+type overlaySchema struct {
+	Name   string                 `yaml:"name"`
+	Agents map[string]agentSchema `yaml:"agents"`
+	Mounts []string               `yaml:"mounts"`
+}
+
+type agentSchema struct {
+	Install string `yaml:"install"`
+	Version string `yaml:"version"`
+}
+
+// overlayYAML merges each document onto v in turn, like successive layers.
+func overlayYAML(t *testing.T, v any, docs ...string) (map[string]int, error) {
+	t.Helper()
+	lines := map[string]int{}
+	for _, doc := range docs {
+		root, err := parseConfigNode([]byte(doc))
+		if err != nil {
+			t.Fatalf("parseConfigNode() unexpected error = %v", err)
+		}
+		err = overlay(reflect.ValueOf(v).Elem(), root, "", func(key string, node *yaml.Node) { lines[key] = node.Line })
+		if err != nil {
+			return lines, err
+		}
+	}
+	return lines, nil
+}
+
+func TestOverlay(t *testing.T) {
+	t.Run("when layers set map entries should merge entry by entry", func(t *testing.T) {
+		// Arrange
+		var v overlaySchema
+
+		// Act
+		_, err := overlayYAML(t, &v,
+			"agents:\n  claude:\n    install: npm i claude\n    version: \"1\"\n  codex:\n    install: npm i codex\n",
+			"agents:\n  claude:\n    version: \"2\"\n",
+		)
+
+		// Assert
+		if err != nil {
+			t.Fatalf("overlay() unexpected error = %v", err)
+		}
+		want := map[string]agentSchema{
+			"claude": {Install: "npm i claude", Version: "2"},
+			"codex":  {Install: "npm i codex"},
+		}
+		if !reflect.DeepEqual(v.Agents, want) {
+			t.Errorf("Agents = %+v, want %+v", v.Agents, want)
+		}
+	})
+
+	t.Run("when layers set lists should replace the whole list", func(t *testing.T) {
+		// Arrange
+		var v overlaySchema
+
+		// Act
+		_, err := overlayYAML(t, &v, "mounts: [a, b]\n", "mounts: [c]\n")
+
+		// Assert
+		if err != nil || !slices.Equal(v.Mounts, []string{"c"}) {
+			t.Errorf("Mounts = %v, %v, want [c]", v.Mounts, err)
+		}
+	})
+
+	t.Run("when value is null or key unknown should leave value unchanged", func(t *testing.T) {
+		// Arrange
+		v := overlaySchema{Name: "calf"}
+
+		// Act
+		lines, err := overlayYAML(t, &v, "name: ~\nunknown: 1\n")
+
+		// Assert
+		if err != nil || v.Name != "calf" {
+			t.Errorf("Name = %q, %v, want unchanged", v.Name, err)
+		}
+		if len(lines) != 0 {
+			t.Errorf("recorded %v, want nothing", lines)
+		}
+	})
+
+	t.Run("when value has wrong type should return error with line", func(t *testing.T) {
+		// Arrange
+		var cfg Config
+
+		// Act
+		_, err := overlayYAML(t, &cfg, "isolation:\n  defaults:\n    vm:\n      cpu: many\n")
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "line 4") {
+			t.Errorf("overlay() error = %v, want type error on line 4", err)
+		}
+	})
+
+	t.Run("when section is not a mapping should return error", func(t *testing.T) {
+		// Arrange
+		var cfg Config
+
+		// Act
+		_, err := overlayYAML(t, &cfg, "isolation:\n  defaults: [cpu]\n")
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "isolation.defaults must be a mapping") {
+			t.Errorf("overlay() error = %v, want mapping error", err)
+		}
+	})
+}
@@ -0,0 +1,198 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// migrationStep upgrades a config file by one schema version.
+type migrationStep struct {
+	description string
+	apply       func(root *yaml.Node)
+}
+
+// globalMigrations upgrade the global config file. Step i upgrades version
+// i+1 to i+2, so the last step produces currentVersion.
+var globalMigrations = []migrationStep{}
+
+// vmMigrations upgrade per-VM config files. Step i upgrades version i+1 to
+// i+2, so the last step produces currentVMVersion.
+var vmMigrations = []migrationStep{
+	{
+		description: "move cpu, memory, disk_size and base_image under resources",
+		apply:       func(root *yaml.Node) { migrateFlatVMKeys(root) },
+	},
+}
+
+// MigrateResult describes the upgrade of a config file by MigrateFile.
+type MigrateResult struct {
+	From, To int
+	// Steps describes each migration applied, oldest first.
+	Steps []string
+	// Backup is the path of the copy of the original file, or empty if the
+	// file was already current and left untouched.
+	Backup string
+}
+
+// MigrateFile upgrades the config file at path to the current schema
+// version, first copying the original to path.v<old version>.bak. Files
+// named vm.yaml are per-VM files, and .calf.yaml files project files.
+// Comments and ordering are preserved. A file that is already current is
+// not rewritten.
+func MigrateFile(path string) (MigrateResult, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return MigrateResult{}, fmt.Errorf("failed to read config file '%s': %w", path, err)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return MigrateResult{}, fmt.Errorf("failed to parse config file '%s': %w", path, err)
+	}
+	steps, current := kindOf(path).migrations()
+	if len(doc.Content) == 0 {
+		return MigrateResult{From: current, To: current}, nil
+	}
+
+	from, err := upgrade(doc.Content[0], path, steps, current)
+	if err != nil {
+		return MigrateResult{}, err
+	}
+	result := MigrateResult{From: from, To: current}
+	for _, step := range steps[from-1:] {
+		result.Steps = append(result.Steps, step.description)
+	}
+	if from == current {
+		return result, nil
+	}
+
+	upgraded, err := encodeConfig(&doc, path)
+	if err != nil {
+		return MigrateResult{}, err
+	}
+	result.Backup, err = backupConfig(path, from, data)
+	if err != nil {
+		return MigrateResult{}, err
+	}
+	if err := writeFileAtomic(path, upgraded); err != nil {
+		return MigrateResult{}, err
+	}
+	return result, nil
+}
+
+// fileKind identifies the schema of a config file.
+type fileKind int
+
+const (
+	kindGlobal fileKind = iota
+	kindVM
+	kindProject
+)
+
+// kindOf returns the kind of the config file at path, by its name.
+func kindOf(path string) fileKind {
+	switch filepath.Base(path) {
+	case "vm.yaml":
+		return kindVM
+	case ProjectFileName:
+		return kindProject
+	}
+	return kindGlobal
+}
+
+// migrations returns the migration steps and current version of a kind of
+// config file.
+func (k fileKind) migrations() ([]migrationStep, int) {
+	switch k {
+	case kindVM:
+		return vmMigrations, currentVMVersion
+	case kindProject:
+		return projectMigrations, currentProjectVersion
+	}
+	return globalMigrations, currentVersion
+}
+
+// VMConfigPaths returns the paths of the existing per-VM config files.
+func VMConfigPaths() ([]string, error) {
+	path, err := GetVMConfigPath("*")
+	if err != nil {
+		return nil, err
+	}
+	paths, err := filepath.Glob(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list VM config files: %w", err)
+	}
+	return paths, nil
+}
+
+// upgrade applies the migration steps a config file needs, in place, and
+// returns the version it had. A file without a version key is version 1. A
+// file newer than current is rejected rather than misread.
+func upgrade(root *yaml.Node, path string, steps []migrationStep, current int) (int, error) {
+	if root.Kind != yaml.MappingNode {
+		return current, nil
+	}
+	var versionNode *yaml.Node
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "version" {
+			versionNode = root.Content[i+1]
+		}
+	}
+
+	from := 1
+	if versionNode != nil {
+		n, err := strconv.Atoi(versionNode.Value)
+		if err != nil || versionNode.Kind != yaml.ScalarNode || n < 1 {
+			return 0, fmt.Errorf("failed to parse config file '%s': line %d: version must be a positive integer", path, versionNode.Line)
+		}
+		from = n
+	}
+	if from > current {
+		return 0, fmt.Errorf("config file '%s' has version %d, but this calf only supports up to version %d: upgrade calf to use it", path, from, current)
+	}
+	if from == current {
+		return from, nil
+	}
+
+	for _, step := range steps[from-1:] {
+		step.apply(root)
+	}
+	version := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.Itoa(current)}
+	if versionNode != nil {
+		versionNode.Value = version.Value
+	} else {
+		key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "version"}
+		// A comment heading the file stays at the top.
+		if len(root.Content) > 0 {
+			key.HeadComment, root.Content[0].HeadComment = root.Content[0].HeadComment, ""
+		}
+		root.Content = append([]*yaml.Node{key, version}, root.Content...)
+	}
+	return from, nil
+}
+
+// backupConfig saves data, the contents of the config file at path before
+// an upgrade from version from, next to it and returns the backup's path.
+func backupConfig(path string, from int, data []byte) (string, error) {
+	backup := fmt.Sprintf("%s.v%d.bak", path, from)
+	if err := writeFileAtomic(backup, data); err != nil {
+		return "", fmt.Errorf("failed to back up config file '%s': %w", path, err)
+	}
+	return backup, nil
+}
+
+// encodeConfig renders a config document with the indentation calf writes.
+func encodeConfig(doc *yaml.Node, path string) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(doc); err != nil {
+		return nil, fmt.Errorf("failed to encode config file '%s': %w", path, err)
+	}
+	encoder.Close()
+	return buf.Bytes(), nil
+}
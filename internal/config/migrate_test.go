@@ -0,0 +1,189 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMigrations(t *testing.T) {
+	t.Run("when counting steps should produce the current versions", func(t *testing.T) {
+		// Assert
+		if len(globalMigrations)+1 != currentVersion {
+			t.Errorf("%d global migrations for version %d", len(globalMigrations), currentVersion)
+		}
+		if len(vmMigrations)+1 != currentVMVersion {
+			t.Errorf("%d VM migrations for version %d", len(vmMigrations), currentVMVersion)
+		}
+	})
+}
+
+func TestLoadConfigVersion(t *testing.T) {
+	t.Run("when global file is newer than supported should return error", func(t *testing.T) {
+		// Arrange
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(path, []byte("version: 9\n"), 0644); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+
+		// Act
+		_, err := LoadConfig(path, "")
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "has version 9, but this calf only supports up to version 1") {
+			t.Errorf("LoadConfig error = %v, want newer version error", err)
+		}
+	})
+
+	t.Run("when vm file is newer than supported should return error", func(t *testing.T) {
+		// Arrange
+		path := filepath.Join(t.TempDir(), "vm.yaml")
+		if err := os.WriteFile(path, []byte("version: 3\nresources:\n  cpu: 4\n"), 0644); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+
+		// Act
+		_, err := LoadConfig("", path)
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "has version 3") {
+			t.Errorf("LoadConfig error = %v, want newer version error", err)
+		}
+	})
+
+	t.Run("when version is not a number should return error with line", func(t *testing.T) {
+		// Arrange
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(path, []byte("# calf\nversion: one\n"), 0644); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+
+		// Act
+		_, err := LoadConfig(path, "")
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "line 2: version must be a positive integer") {
+			t.Errorf("LoadConfig error = %v, want version error", err)
+		}
+	})
+
+	t.Run("when vm file is version 1 should load it through the migration", func(t *testing.T) {
+		// Arrange
+		path := filepath.Join(t.TempDir(), "vm.yaml")
+		if err := os.WriteFile(path, []byte("version: 1\ncpu: 6\n"), 0644); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+
+		// Act
+		cfg, err := LoadConfig("", path)
+
+		// Assert
+		if err != nil {
+			t.Fatalf("LoadConfig returned unexpected error: %v", err)
+		}
+		if cfg.Isolation.Defaults.VM.CPU != 6 {
+			t.Errorf("CPU = %d, want 6", cfg.Isolation.Defaults.VM.CPU)
+		}
+	})
+}
+
+func TestMigrateFile(t *testing.T) {
+	t.Run("when vm file is older should back it up and write the upgraded file", func(t *testing.T) {
+		// Arrange
+		path := filepath.Join(t.TempDir(), "vm.yaml")
+		content := "# calf-dev\ncpu: 6 # cores\nagent: codex\n"
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+
+		// Act
+		result, err := MigrateFile(path)
+
+		// Assert
+		if err != nil {
+			t.Fatalf("MigrateFile returned unexpected error: %v", err)
+		}
+		if result.From != 1 || result.To != 2 || len(result.Steps) != 1 {
+			t.Errorf("result = %+v, want one step from 1 to 2", result)
+		}
+		if result.Backup != path+".v1.bak" {
+			t.Errorf("Backup = %q, want %s.v1.bak", result.Backup, path)
+		}
+		backup, _ := os.ReadFile(result.Backup)
+		if string(backup) != content {
+			t.Errorf("backup = %q, want original %q", backup, content)
+		}
+		data, _ := os.ReadFile(path)
+		want := "# calf-dev\nversion: 2\nagent: codex\nresources:\n  cpu: 6 # cores\n"
+		if string(data) != want {
+			t.Errorf("upgraded file = %q, want %q", data, want)
+		}
+	})
+
+	t.Run("when file is current should leave it untouched", func(t *testing.T) {
+		// Arrange
+		dir := t.TempDir()
+		path := filepath.Join(dir, "config.yaml")
+		content := "version: 1\nisolation:\n  provider: tart\n"
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+
+		// Act
+		result, err := MigrateFile(path)
+
+		// Assert
+		if err != nil {
+			t.Fatalf("MigrateFile returned unexpected error: %v", err)
+		}
+		if result.From != 1 || result.To != 1 || result.Backup != "" {
+			t.Errorf("result = %+v, want no change", result)
+		}
+		entries, _ := os.ReadDir(dir)
+		if len(entries) != 1 {
+			t.Errorf("expected no backup, got %d entries", len(entries))
+		}
+	})
+
+	t.Run("when file is newer than supported should return error", func(t *testing.T) {
+		// Arrange
+		path := filepath.Join(t.TempDir(), "vm.yaml")
+		if err := os.WriteFile(path, []byte("version: 5\n"), 0644); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+
+		// Act
+		_, err := MigrateFile(path)
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "upgrade calf") {
+			t.Errorf("MigrateFile error = %v, want newer version error", err)
+		}
+	})
+}
+
+func TestSetInFileUpgrades(t *testing.T) {
+	t.Run("when editing an older vm file should upgrade it and keep a backup", func(t *testing.T) {
+		// Arrange
+		path := filepath.Join(t.TempDir(), "vm.yaml")
+		if err := os.WriteFile(path, []byte("cpu: 6\n"), 0644); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+
+		// Act
+		err := SetInFile("", path, true, "agent", "codex")
+
+		// Assert
+		if err != nil {
+			t.Fatalf("SetInFile returned unexpected error: %v", err)
+		}
+		data, _ := os.ReadFile(path)
+		if string(data) != "version: 2\nresources:\n  cpu: 6\nagent: codex\n" {
+			t.Errorf("vm file = %q, want upgraded file", data)
+		}
+		if _, err := os.Stat(path + ".v1.bak"); err != nil {
+			t.Errorf("expected backup: %v", err)
+		}
+	})
+}
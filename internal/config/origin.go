@@ -0,0 +1,93 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+
+	"gopkg.in/yaml.v3"
+)
+
+// OriginKind identifies the layer a configuration value came from.
+type OriginKind string
+
+const (
+	// OriginDefault marks a hard-coded default.
+	OriginDefault OriginKind = "default"
+	// OriginFile marks a value set in the global or a per-VM config file.
+	OriginFile OriginKind = "file"
+	// OriginEnv marks a value set by a CALF_* environment variable.
+	OriginEnv OriginKind = "env"
+	// OriginFlag marks a value set by a command-line flag.
+	OriginFlag OriginKind = "flag"
+)
+
+// Origin records where a configuration value came from.
+type Origin struct {
+	Kind OriginKind
+	// Path and Line locate the value in a config file (OriginFile).
+	Path string
+	Line int
+	// Name is the environment variable or flag that set the value
+	// (OriginEnv, OriginFlag).
+	Name string
+}
+
+// String describes the origin, e.g. "/home/dev/.calf/config.yaml:4",
+// "env CALF_VM_CPU" or "default".
+func (o Origin) String() string {
+	switch o.Kind {
+	case OriginFile:
+		return fmt.Sprintf("%s:%d", o.Path, o.Line)
+	case OriginEnv:
+		return "env " + o.Name
+	case OriginFlag:
+		return "flag --" + o.Name
+	}
+	return string(OriginDefault)
+}
+
+// Origins maps dotted configuration keys, such as "isolation.defaults.vm.cpu",
+// to the origin of their effective value.
+type Origins map[string]Origin
+
+// Keys returns the dotted keys of every configuration value, in declaration
+// order. They are derived from the yaml tags of Config.
+func Keys() []string {
+	var keys []string
+	var walk func(t reflect.Type, prefix string)
+	walk = func(t reflect.Type, prefix string) {
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name, ok := yamlName(field)
+			if !ok {
+				continue
+			}
+			if field.Type.Kind() == reflect.Struct {
+				walk(field.Type, prefix+name+".")
+				continue
+			}
+			keys = append(keys, prefix+name)
+		}
+	}
+	walk(reflect.TypeOf(Config{}), "")
+	return keys
+}
+
+// defaultOrigins returns origins marking every key as a hard-coded default.
+func defaultOrigins() Origins {
+	origins := Origins{}
+	for _, key := range Keys() {
+		origins[key] = Origin{Kind: OriginDefault}
+	}
+	return origins
+}
+
+// recorder returns a function that marks keys set in the config file at
+// path as coming from it, for use with overlay.
+func (o Origins) recorder(path string) func(key string, node *yaml.Node) {
+	return func(key string, node *yaml.Node) {
+		if _, known := o[key]; known {
+			o[key] = Origin{Kind: OriginFile, Path: path, Line: node.Line}
+		}
+	}
+}
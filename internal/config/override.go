@@ -0,0 +1,228 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// LoadOption configures the override layers applied by LoadConfig.
+type LoadOption func(*loadOptions)
+
+type loadOptions struct {
+	lookupEnv func(string) (string, bool)
+	flags     map[string]string
+	lenient   bool
+	profile   string
+	// projectDir is where the search for a project config file starts, or
+	// empty to load none.
+	projectDir   string
+	trust        *TrustStore
+	confirmTrust TrustFunc
+	// trustAll applies project files without checking trust, for callers
+	// that only inspect them.
+	trustAll bool
+	probe    HostProbe
+}
+
+// profileEnv selects a profile when WithProfile is not given.
+const profileEnv = "CALF_PROFILE"
+
+// WithEnvLookup overrides how CALF_* environment variables are read.
+// Intended for use in tests.
+func WithEnvLookup(lookup func(string) (string, bool)) LoadOption {
+	return func(o *loadOptions) { o.lookupEnv = lookup }
+}
+
+// WithLenient makes config files decode leniently: keys outside the schema
+// are ignored instead of rejected with an UnknownKeysError.
+func WithLenient() LoadOption {
+	return func(o *loadOptions) { o.lenient = true }
+}
+
+// WithProfile applies the named profile from the profiles section of the
+// global config file, between the global and per-VM files. Without it, the
+// CALF_PROFILE environment variable selects the profile.
+func WithProfile(name string) LoadOption {
+	return func(o *loadOptions) { o.profile = name }
+}
+
+// WithProjectDir searches for the project config file (see
+// FindProjectConfig) from dir instead of the working directory. An empty dir
+// loads no project config.
+func WithProjectDir(dir string) LoadOption {
+	return func(o *loadOptions) { o.projectDir = dir }
+}
+
+// WithTrustPrompt asks confirm whether to trust a project config file that
+// runs commands, the first time it is loaded, and fails the load if the user
+// declines. Use it only when the commands are about to run. Without it, the
+// commands of files not trusted beforehand (see
+// TrustStore.TrustProjectConfig) are withheld (see Config.WithheldCommands).
+func WithTrustPrompt(confirm TrustFunc) LoadOption {
+	return func(o *loadOptions) { o.confirmTrust = confirm }
+}
+
+// WithTrustStore overrides where trusted project config files are recorded.
+// Intended for use in tests.
+func WithTrustStore(store *TrustStore) LoadOption {
+	return func(o *loadOptions) { o.trust = store }
+}
+
+// WithHostProbe sizes resources set to auto or a percentage, such as
+// "memory: 50%", for the host whose capacity probe reads (see ProbeHost),
+// and checks every resource fits it. Without it the capacity is unknown:
+// relative resources are rejected and only fixed bounds are checked.
+func WithHostProbe(probe HostProbe) LoadOption {
+	return func(o *loadOptions) { o.probe = probe }
+}
+
+// WithFlagOverrides applies values given on the command line, keyed by flag
+// name as returned by FlagName (e.g. "vm-cpu"). They take precedence over
+// environment variables.
+func WithFlagOverrides(flags map[string]string) LoadOption {
+	return func(o *loadOptions) { o.flags = flags }
+}
+
+// OverridableKeys returns the keys that environment variables and flags can
+// set: every editable key except the per-VM settings under vm, which name a
+// single VM and only make sense in its own file.
+func OverridableKeys() []string {
+	return slices.DeleteFunc(editableKeys(), func(key string) bool {
+		return strings.HasPrefix(key, "vm.")
+	})
+}
+
+// editableKeys returns the keys that can be set from text: every scalar key
+// except version.
+func editableKeys() []string {
+	cfg := newDefaultConfig()
+	return slices.DeleteFunc(Keys(), func(key string) bool {
+		v, err := field(cfg, key)
+		if key == "version" || err != nil {
+			return true
+		}
+		return v.Kind() != reflect.Int && v.Kind() != reflect.String && v.Kind() != reflect.Bool
+	})
+}
+
+// shortKey strips the isolation and defaults sections from key, which every
+// overridable value shares: isolation.defaults.vm.cpu becomes vm.cpu.
+func shortKey(key string) string {
+	key = strings.TrimPrefix(key, "isolation.")
+	return strings.TrimPrefix(key, "defaults.")
+}
+
+// EnvName returns the environment variable that overrides key, e.g.
+// CALF_VM_CPU for isolation.defaults.vm.cpu.
+func EnvName(key string) string {
+	return "CALF_" + strings.ToUpper(strings.ReplaceAll(shortKey(key), ".", "_"))
+}
+
+// FlagName returns the flag name that overrides key, e.g. vm-cpu for
+// isolation.defaults.vm.cpu.
+func FlagName(key string) string {
+	return strings.NewReplacer(".", "-", "_", "-").Replace(shortKey(key))
+}
+
+// applyOverrides sets each key for which value returns a non-empty string,
+// recording origins with the given kind and naming each source with name.
+// It returns the names of the sources that were applied.
+func applyOverrides(cfg *Config, origins Origins, kind OriginKind, name func(key string) string, value func(key string) string) ([]string, error) {
+	var applied []string
+	for _, key := range OverridableKeys() {
+		raw := value(key)
+		if raw == "" {
+			continue
+		}
+		source := name(key)
+		if err := setValue(cfg, key, raw); err != nil {
+			if kind == OriginFlag {
+				return nil, fmt.Errorf("invalid --%s: %w", source, err)
+			}
+			return nil, fmt.Errorf("invalid %s: %w", source, err)
+		}
+		origins[key] = Origin{Kind: kind, Name: source}
+		if kind == OriginFlag {
+			source = "--" + source
+		}
+		applied = append(applied, source)
+	}
+	return applied, nil
+}
+
+// field returns the settable field of cfg for a dotted key, found by the
+// yaml tags of Config.
+func field(cfg *Config, key string) (reflect.Value, error) {
+	v := reflect.ValueOf(cfg).Elem()
+	for _, name := range strings.Split(key, ".") {
+		if v.Kind() != reflect.Struct {
+			return reflect.Value{}, fmt.Errorf("unknown config key '%s'", key)
+		}
+		index, ok := fieldIndex(v.Type(), name)
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("unknown config key '%s'", key)
+		}
+		v = v.Field(index)
+	}
+	if v.Kind() == reflect.Struct {
+		return reflect.Value{}, fmt.Errorf("unknown config key '%s'", key)
+	}
+	return v, nil
+}
+
+// setValue parses raw according to the type of the field for key and sets it.
+func setValue(cfg *Config, key, raw string) error {
+	v, err := field(cfg, key)
+	if err != nil {
+		return err
+	}
+	if vm, name, ok := vmResource(cfg, key); ok {
+		if relative, err := vm.setRelative(name, raw); err != nil || relative {
+			return err
+		}
+	}
+	switch v.Kind() {
+	case reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("'%s' is not an integer", raw)
+		}
+		v.SetInt(int64(n))
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("'%s' is not a boolean", raw)
+		}
+		v.SetBool(b)
+	default:
+		return fmt.Errorf("config key '%s' cannot be set", key)
+	}
+	return nil
+}
+
+// vmResource returns the VM defaults of cfg and the resource's name if key
+// names a resource that can be sized relative to the host.
+func vmResource(cfg *Config, key string) (*VMConfig, string, bool) {
+	name, ok := strings.CutPrefix(key, "isolation.defaults.vm.")
+	if _, resource := findResource(name); !ok || !resource {
+		return nil, "", false
+	}
+	return &cfg.Isolation.Defaults.VM, name, true
+}
+
+// defaultLoadOptions reads environment variables from the process and
+// searches for a project config file from the working directory.
+func defaultLoadOptions(opts []LoadOption) loadOptions {
+	o := loadOptions{lookupEnv: os.LookupEnv, trust: NewDefaultTrustStore()}
+	o.projectDir, _ = os.Getwd()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// profileFile is the schema of a named profile in the profiles section of
+// the global config file:
+//
+//	profiles:
+//	  client:
+//	    resources: {cpu: 4, memory: 8192}
+//	    proxy: {mode: on}
+//	    isolation: {no_mount: true, no_network: true}
+//	  oss:
+//	    resources: {cpu: 10, memory: 24576}
+//	    proxy: {mode: off}
+//
+// It holds the keys of a per-VM file that are not specific to one VM. Like
+// vmFile, its fields point at the values of the effective Config they set.
+type profileFile struct {
+	Resources *VMConfig          `yaml:"resources"`
+	Agent     *string            `yaml:"agent"`
+	GitHub    profileGitHub      `yaml:"github"`
+	Output    *OutputConfig      `yaml:"output"`
+	Proxy     *ProxyConfig       `yaml:"proxy"`
+	Isolation *VMIsolationConfig `yaml:"isolation"`
+}
+
+// profileGitHub is the github section of a profile.
+type profileGitHub struct {
+	DefaultBranchPrefix *string `yaml:"default_branch_prefix"`
+}
+
+// newProfileFile returns a profileFile whose fields point into cfg.
+func newProfileFile(cfg *Config) *profileFile {
+	return &profileFile{
+		Resources: &cfg.Isolation.Defaults.VM,
+		Agent:     &cfg.VM.Agent,
+		GitHub: profileGitHub{
+			DefaultBranchPrefix: &cfg.Isolation.Defaults.GitHub.DefaultBranchPrefix,
+		},
+		Output:    &cfg.Isolation.Defaults.Output,
+		Proxy:     &cfg.Isolation.Defaults.Proxy,
+		Isolation: &cfg.VM.Isolation,
+	}
+}
+
+// applyProfile overlays the profile called name, from the profiles section
+// of the global config file at path, onto cfg.
+func applyProfile(cfg *Config, origins Origins, profiles *yaml.Node, name, path string) error {
+	names := profileNames(profiles)
+	if !slices.Contains(names, name) {
+		msg := fmt.Sprintf("unknown profile '%s' in config file '%s'", name, path)
+		if suggestion := closestMatch(name, names); suggestion != "" {
+			msg += fmt.Sprintf(" (did you mean %s?)", suggestion)
+		}
+		if len(names) > 0 {
+			msg += ": defined profiles are " + strings.Join(names, ", ")
+		}
+		return fmt.Errorf("%s", msg)
+	}
+
+	prefix := joinKey("profiles", name)
+	keys := viewKeys(func(cfg *Config) any { return newProfileFile(cfg) })
+	record := origins.recorder(path)
+	for i := 0; i+1 < len(profiles.Content); i += 2 {
+		if profiles.Content[i].Value != name {
+			continue
+		}
+		err := overlay(reflect.ValueOf(newProfileFile(cfg)).Elem(), profiles.Content[i+1], prefix, func(key string, node *yaml.Node) {
+			record(keys[strings.TrimPrefix(key, prefix+".")], node)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to parse config file '%s': %w", path, err)
+		}
+	}
+	cfg.Profile = name
+	return nil
+}
+
+// profileNames returns the names of the profiles in a profiles section.
+func profileNames(profiles *yaml.Node) []string {
+	var names []string
+	if profiles == nil || profiles.Kind != yaml.MappingNode {
+		return names
+	}
+	for i := 0; i+1 < len(profiles.Content); i += 2 {
+		names = append(names, profiles.Content[i].Value)
+	}
+	return names
+}
+
+// mappingValue returns the value of key in mapping, or nil.
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	if mapping.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// profilesConfig defines a client and an oss profile.
+const profilesConfig = `version: 1
+isolation:
+  defaults:
+    vm:
+      cpu: 4
+      memory: 8192
+profiles:
+  client:
+    resources:
+      cpu: 2
+    proxy:
+      mode: on
+    isolation:
+      no_mount: true
+      no_network: true
+  oss:
+    resources:
+      cpu: 10
+      memory: 24576
+    proxy:
+      mode: off
+`
+
+// writeProfilesConfig writes profilesConfig to a temporary config.yaml.
+func writeProfilesConfig(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(profilesConfig), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	return path
+}
+
+func TestLoadConfigProfile(t *testing.T) {
+	t.Run("when profile selected should overlay it on the global file", func(t *testing.T) {
+		// Arrange
+		path := writeProfilesConfig(t)
+
+		// Act
+		cfg, origins, err := LoadConfigWithOrigins(path, "", WithProfile("client"))
+
+		// Assert
+		if err != nil {
+			t.Fatalf("LoadConfigWithOrigins returned unexpected error: %v", err)
+		}
+		if cfg.Profile != "client" {
+			t.Errorf("Profile = %q, want client", cfg.Profile)
+		}
+		if cfg.Isolation.Defaults.VM.CPU != 2 || cfg.Isolation.Defaults.VM.Memory != 8192 {
+			t.Errorf("VM = %+v, want cpu from profile and memory from file", cfg.Isolation.Defaults.VM)
+		}
+		if cfg.Isolation.Defaults.Proxy.Mode != "on" || !cfg.VM.Isolation.NoMount || !cfg.VM.Isolation.NoNetwork {
+			t.Errorf("proxy %q, isolation %+v, want corporate safe mode", cfg.Isolation.Defaults.Proxy.Mode, cfg.VM.Isolation)
+		}
+		if got := origins["isolation.defaults.vm.cpu"].String(); got != path+":10" {
+			t.Errorf("cpu origin = %q, want %s:10", got, path)
+		}
+		if got := origins["profile"].String(); got != "flag --profile" {
+			t.Errorf("profile origin = %q, want flag --profile", got)
+		}
+	})
+
+	t.Run("when vm file sets a value should override the profile", func(t *testing.T) {
+		// Arrange
+		path := writeProfilesConfig(t)
+		vmPath := filepath.Join(t.TempDir(), "vm.yaml")
+		if err := os.WriteFile(vmPath, []byte("resources:\n  cpu: 6\n"), 0644); err != nil {
+			t.Fatalf("Failed to write VM config: %v", err)
+		}
+
+		// Act
+		cfg, err := LoadConfig(path, vmPath, WithProfile("oss"))
+
+		// Assert
+		if err != nil {
+			t.Fatalf("LoadConfig returned unexpected error: %v", err)
+		}
+		if cfg.Isolation.Defaults.VM.CPU != 6 || cfg.Isolation.Defaults.VM.Memory != 24576 {
+			t.Errorf("VM = %+v, want cpu from vm file and memory from profile", cfg.Isolation.Defaults.VM)
+		}
+	})
+
+	t.Run("when CALF_PROFILE set should select the profile unless overridden", func(t *testing.T) {
+		// Arrange
+		path := writeProfilesConfig(t)
+		env := envLookup(map[string]string{"CALF_PROFILE": "oss"})
+
+		// Act
+		fromEnv, origins, envErr := LoadConfigWithOrigins(path, "", env)
+		fromFlag, flagErr := LoadConfig(path, "", env, WithProfile("client"))
+
+		// Assert
+		if envErr != nil || flagErr != nil {
+			t.Fatalf("LoadConfig returned unexpected errors: %v, %v", envErr, flagErr)
+		}
+		if fromEnv.Profile != "oss" || origins["profile"].String() != "env CALF_PROFILE" {
+			t.Errorf("profile = %q from %v, want oss from env", fromEnv.Profile, origins["profile"])
+		}
+		if fromFlag.Profile != "client" {
+			t.Errorf("profile = %q, want client", fromFlag.Profile)
+		}
+	})
+
+	t.Run("when no profile selected should ignore profiles", func(t *testing.T) {
+		// Arrange
+		path := writeProfilesConfig(t)
+
+		// Act
+		cfg, err := LoadConfig(path, "", envLookup(nil))
+
+		// Assert
+		if err != nil {
+			t.Fatalf("LoadConfig returned unexpected error: %v", err)
+		}
+		if cfg.Profile != "" || cfg.Isolation.Defaults.VM.CPU != 4 {
+			t.Errorf("Profile %q, CPU %d, want no profile and cpu 4", cfg.Profile, cfg.Isolation.Defaults.VM.CPU)
+		}
+	})
+
+	t.Run("when profile is unknown should suggest defined profiles", func(t *testing.T) {
+		// Arrange
+		path := writeProfilesConfig(t)
+
+		// Act
+		_, err := LoadConfig(path, "", WithProfile("clinet"))
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "unknown profile 'clinet'") ||
+			!strings.Contains(err.Error(), "did you mean client?") || !strings.Contains(err.Error(), "client, oss") {
+			t.Errorf("LoadConfig error = %v, want unknown profile with suggestion", err)
+		}
+	})
+
+	t.Run("when profile selected without a config file should return error", func(t *testing.T) {
+		// Act
+		_, err := LoadConfig(filepath.Join(t.TempDir(), "config.yaml"), "", WithProfile("oss"))
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "no config file defines profiles") {
+			t.Errorf("LoadConfig error = %v, want missing profiles error", err)
+		}
+	})
+
+	t.Run("when profile has a typo should report it strictly", func(t *testing.T) {
+		// Arrange
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(path, []byte("profiles:\n  oss:\n    resorces:\n      cpu: 10\n"), 0644); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+
+		// Act
+		_, err := LoadConfig(path, "")
+
+		// Assert
+		var unknown *UnknownKeysError
+		if !errors.As(err, &unknown) || unknown.Keys[0].Key != "profiles.oss.resorces" || unknown.Keys[0].Suggestion != "resources" {
+			t.Errorf("LoadConfig error = %v, want profile key typo", err)
+		}
+	})
+}
+
+func TestValidateFileProfiles(t *testing.T) {
+	t.Run("when a profile has an invalid value should name the profile", func(t *testing.T) {
+		// Arrange
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(path, []byte("profiles:\n  huge:\n    resources:\n      cpu: 99\n"), 0644); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+
+		// Act
+		err := ValidateFile(path)
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "(profile huge)") {
+			t.Errorf("ValidateFile error = %v, want profile validation error", err)
+		}
+	})
+}
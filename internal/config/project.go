@@ -0,0 +1,331 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ProjectFileName is the name of the project config file that a repository
+// can commit to declare what it needs from the VM.
+const ProjectFileName = ".calf.yaml"
+
+// currentProjectVersion is the schema version of project files.
+const currentProjectVersion = 1
+
+// projectMigrations upgrade project files. Step i upgrades version i+1 to
+// i+2, so the last step produces currentProjectVersion.
+var projectMigrations = []migrationStep{}
+
+// projectFile is the schema of a project config file (.calf.yaml):
+//
+//	version: 1
+//	resources: {cpu: 6, memory: 12288}
+//	agent: claude-code
+//	environments: [node, go]
+//	github:
+//	  repos: [{name: my-app}, {name: my-lib, branch: main}]
+//	isolation: {no_network: true}
+//	agents:
+//	  claude-code: {install_command: "npm install -g @anthropic-ai/claude-code"}
+//	hooks:
+//	  setup: ["make bootstrap"]
+//
+// It holds no settings that act on the host, such as output.sync_dir, and
+// no proxy mode. Its isolation modes can only tighten isolation: a mode set
+// to false leaves the mode of lower layers in place, since a repository must
+// not be able to turn off isolation the user asked for. The commands a file
+// sets (agents install commands and hooks) are only applied once the user
+// trusts it; see TrustStore.
+type projectFile struct {
+	Version      int                     `yaml:"version"` // See projectMigrations
+	Resources    *VMConfig               `yaml:"resources"`
+	Agent        *string                 `yaml:"agent"`
+	Environments *[]string               `yaml:"environments"`
+	GitHub       projectGitHub           `yaml:"github"`
+	Isolation    *VMIsolationConfig      `yaml:"isolation"`
+	Agents       *map[string]AgentConfig `yaml:"agents"`
+	Hooks        *HooksConfig            `yaml:"hooks"`
+}
+
+// projectGitHub is the github section of a project file.
+type projectGitHub struct {
+	DefaultBranchPrefix *string       `yaml:"default_branch_prefix"`
+	Repos               *[]RepoConfig `yaml:"repos"`
+}
+
+// newProjectFile returns a projectFile whose fields point into cfg.
+func newProjectFile(cfg *Config) *projectFile {
+	return &projectFile{
+		Resources:    &cfg.Isolation.Defaults.VM,
+		Agent:        &cfg.VM.Agent,
+		Environments: &cfg.VM.Environments,
+		GitHub: projectGitHub{
+			DefaultBranchPrefix: &cfg.Isolation.Defaults.GitHub.DefaultBranchPrefix,
+			Repos:               &cfg.VM.Repos,
+		},
+		Isolation: &cfg.VM.Isolation,
+		Agents:    &cfg.Agents,
+		Hooks:     &cfg.Hooks,
+	}
+}
+
+// TrustFunc asks the user whether to trust the project file at path, which
+// wants to run the given commands. It is called the first time a project
+// file with commands is loaded, and again whenever the file changes.
+type TrustFunc func(path string, commands []string) (bool, error)
+
+// FindProjectConfig returns the path of the nearest project config file in
+// dir or one of its parents, or "" if there is none.
+func FindProjectConfig(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve directory '%s': %w", dir, err)
+	}
+	for {
+		path := filepath.Join(dir, ProjectFileName)
+		info, err := os.Stat(path)
+		if err == nil && !info.IsDir() {
+			return path, nil
+		}
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return "", fmt.Errorf("failed to check for project config '%s': %w", path, err)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// loadProjectConfigFile merges the project config file at path. Its commands
+// are withheld unless the user trusts it.
+func loadProjectConfigFile(cfg *Config, origins Origins, path string, o loadOptions) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read project config file '%s': %w", path, err)
+	}
+	root, err := parseConfigNode(data)
+	if err != nil {
+		return fmt.Errorf("failed to parse project config file '%s': %w", path, err)
+	}
+	if root == nil {
+		return nil
+	}
+	if _, err := upgrade(root, path, projectMigrations, currentProjectVersion); err != nil {
+		return err
+	}
+	if !o.lenient {
+		if err := checkKeys(reflect.TypeOf(projectFile{}), root, path); err != nil {
+			return err
+		}
+	}
+
+	if commands := projectCommands(root); len(commands) > 0 && !o.trustAll {
+		trusted, err := checkTrust(path, data, commands, o)
+		if err != nil {
+			return err
+		}
+		if !trusted {
+			root = withoutCommands(root)
+			cfg.WithheldCommands = commands
+		}
+	}
+
+	root = withoutLoosening(root)
+	keys := viewKeys(func(cfg *Config) any { return newProjectFile(cfg) })
+	record := origins.recorder(path)
+	err = overlay(reflect.ValueOf(newProjectFile(cfg)).Elem(), root, "", func(key string, node *yaml.Node) {
+		record(keys[key], node)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to parse project config file '%s': %w", path, err)
+	}
+	cfg.Project = path
+	return nil
+}
+
+// projectCommands lists the commands a project file would have calf run,
+// each labelled with its key.
+func projectCommands(root *yaml.Node) []string {
+	var file struct {
+		Agents map[string]AgentConfig `yaml:"agents"`
+		Hooks  HooksConfig            `yaml:"hooks"`
+	}
+	// Type errors are reported when the file is merged.
+	_ = root.Decode(&file)
+
+	var commands []string
+	names := make([]string, 0, len(file.Agents))
+	for name := range file.Agents {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		if command := file.Agents[name].InstallCommand; command != "" {
+			commands = append(commands, fmt.Sprintf("agents.%s.install_command: %s", name, command))
+		}
+	}
+	for _, command := range file.Hooks.Setup {
+		commands = append(commands, "hooks.setup: "+command)
+	}
+	return commands
+}
+
+// checkTrust reports whether the project file at path, with contents data,
+// is trusted. If it is not and o.confirmTrust is set, the user is asked, and
+// declining is an error, since the caller needs the commands.
+func checkTrust(path string, data []byte, commands []string, o loadOptions) (bool, error) {
+	digest := fileDigest(data)
+	trusted, err := o.trust.Trusted(path, digest)
+	if err != nil || trusted || o.confirmTrust == nil {
+		return trusted, err
+	}
+	ok, err := o.confirmTrust(path, commands)
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		return false, fmt.Errorf("project config file '%s' is not trusted: review it and run 'calf config trust %s'", path, path)
+	}
+	return true, o.trust.Trust(path, digest)
+}
+
+// withoutLoosening returns a copy of a project file's root without the
+// isolation modes it turns off.
+func withoutLoosening(root *yaml.Node) *yaml.Node {
+	stripped := *root
+	stripped.Content = slices.Clone(root.Content)
+	for i := 0; i+1 < len(stripped.Content); i += 2 {
+		modes := stripped.Content[i+1]
+		if stripped.Content[i].Value != "isolation" || modes.Kind != yaml.MappingNode {
+			continue
+		}
+		tightened := *modes
+		tightened.Content = nil
+		for j := 0; j+1 < len(modes.Content); j += 2 {
+			var on bool
+			// Values that are not booleans are reported when the file is merged.
+			if err := modes.Content[j+1].Decode(&on); err == nil && !on {
+				continue
+			}
+			tightened.Content = append(tightened.Content, modes.Content[j], modes.Content[j+1])
+		}
+		stripped.Content[i+1] = &tightened
+	}
+	return &stripped
+}
+
+// withoutCommands returns a copy of a project file's root without its
+// commands: the hooks section and the agents' install commands.
+func withoutCommands(root *yaml.Node) *yaml.Node {
+	stripped := withoutKey(root, "hooks")
+	for i := 0; i+1 < len(stripped.Content); i += 2 {
+		if agents := stripped.Content[i+1]; stripped.Content[i].Value == "agents" && agents.Kind == yaml.MappingNode {
+			filtered := *agents
+			filtered.Content = nil
+			for j := 0; j+1 < len(agents.Content); j += 2 {
+				filtered.Content = append(filtered.Content, agents.Content[j], withoutKey(agents.Content[j+1], "install_command"))
+			}
+			stripped.Content[i+1] = &filtered
+		}
+	}
+	return stripped
+}
+
+// fileDigest returns the SHA-256 of a file's contents, in hex.
+func fileDigest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// TrustStore records the project config files the user has trusted, by
+// path and content digest, in ~/.calf/trusted-projects.yaml. Changing a
+// trusted file revokes its trust.
+type TrustStore struct {
+	homeDir string
+}
+
+// NewDefaultTrustStore creates a TrustStore rooted at the current user's
+// home directory.
+func NewDefaultTrustStore() *TrustStore {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		homeDir = ""
+	}
+	return NewTrustStore(homeDir)
+}
+
+// NewTrustStore creates a TrustStore rooted at the given home directory.
+func NewTrustStore(homeDir string) *TrustStore {
+	return &TrustStore{homeDir: homeDir}
+}
+
+// path returns the path of the trust file.
+func (s *TrustStore) path() string {
+	return filepath.Join(s.homeDir, ".calf", "trusted-projects.yaml")
+}
+
+// load returns the trusted digests, by project file path.
+func (s *TrustStore) load() (map[string]string, error) {
+	trusted := map[string]string{}
+	data, err := os.ReadFile(s.path())
+	if errors.Is(err, fs.ErrNotExist) {
+		return trusted, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trusted projects file '%s': %w", s.path(), err)
+	}
+	if err := yaml.Unmarshal(data, &trusted); err != nil {
+		return nil, fmt.Errorf("failed to parse trusted projects file '%s': %w", s.path(), err)
+	}
+	return trusted, nil
+}
+
+// Trusted reports whether the project file at path was trusted with the
+// given content digest.
+func (s *TrustStore) Trusted(path, digest string) (bool, error) {
+	trusted, err := s.load()
+	if err != nil {
+		return false, err
+	}
+	return trusted[path] == digest, nil
+}
+
+// Trust records the project file at path as trusted with the given content
+// digest.
+func (s *TrustStore) Trust(path, digest string) error {
+	trusted, err := s.load()
+	if err != nil {
+		return err
+	}
+	trusted[path] = digest
+	data, err := yaml.Marshal(trusted)
+	if err != nil {
+		return fmt.Errorf("failed to encode trusted projects: %w", err)
+	}
+	return writeFileAtomic(s.path(), data)
+}
+
+// TrustProjectConfig trusts the current contents of the project config file
+// at path, so it is applied without asking.
+func (s *TrustStore) TrustProjectConfig(path string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to resolve path '%s': %w", path, err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read project config file '%s': %w", path, err)
+	}
+	return s.Trust(path, fileDigest(data))
+}
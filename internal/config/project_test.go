@@ -0,0 +1,277 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeProjectConfig writes content to dir/.calf.yaml and returns its path.
+func writeProjectConfig(t *testing.T, dir, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, ProjectFileName)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write project config: %v", err)
+	}
+	return path
+}
+
+func TestFindProjectConfig(t *testing.T) {
+	t.Run("when file is in a parent directory should find it", func(t *testing.T) {
+		// Arrange
+		root := t.TempDir()
+		path := writeProjectConfig(t, root, "agent: codex\n")
+		dir := filepath.Join(root, "src", "pkg")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+
+		// Act
+		got, err := FindProjectConfig(dir)
+
+		// Assert
+		if err != nil {
+			t.Fatalf("FindProjectConfig returned unexpected error: %v", err)
+		}
+		if got != path {
+			t.Errorf("FindProjectConfig() = %q, want %q", got, path)
+		}
+	})
+
+	t.Run("when no directory has the file should return empty", func(t *testing.T) {
+		// Act
+		got, err := FindProjectConfig(t.TempDir())
+
+		// Assert
+		if err != nil {
+			t.Fatalf("FindProjectConfig returned unexpected error: %v", err)
+		}
+		if got != "" {
+			t.Errorf("FindProjectConfig() = %q, want empty", got)
+		}
+	})
+}
+
+func TestLoadConfigProject(t *testing.T) {
+	t.Run("when project file found should merge it between global and vm files", func(t *testing.T) {
+		// Arrange
+		dir := t.TempDir()
+		globalPath := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(globalPath, []byte("isolation:\n  defaults:\n    vm:\n      cpu: 2\n      memory: 4096\n"), 0644); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+		projectPath := writeProjectConfig(t, dir, "resources:\n  cpu: 6\n  memory: 12288\nagent: codex\nenvironments: [node, go]\ngithub:\n  repos:\n    - name: my-app\n")
+		vmPath := filepath.Join(t.TempDir(), "vm.yaml")
+		if err := os.WriteFile(vmPath, []byte("resources:\n  memory: 16384\n"), 0644); err != nil {
+			t.Fatalf("Failed to write VM config: %v", err)
+		}
+
+		// Act
+		cfg, origins, err := LoadConfigWithOrigins(globalPath, vmPath, WithProjectDir(dir))
+
+		// Assert
+		if err != nil {
+			t.Fatalf("LoadConfigWithOrigins returned unexpected error: %v", err)
+		}
+		if cfg.Project != projectPath {
+			t.Errorf("Project = %q, want %q", cfg.Project, projectPath)
+		}
+		if cfg.Isolation.Defaults.VM.CPU != 6 || cfg.Isolation.Defaults.VM.Memory != 16384 {
+			t.Errorf("VM = %+v, want cpu from project and memory from vm file", cfg.Isolation.Defaults.VM)
+		}
+		if cfg.VM.Agent != "codex" || !reflect.DeepEqual(cfg.VM.Environments, []string{"node", "go"}) || len(cfg.VM.Repos) != 1 {
+			t.Errorf("VM settings = %+v, want agent, environments and repos from project", cfg.VM)
+		}
+		if got := origins["isolation.defaults.vm.cpu"].String(); got != projectPath+":2" {
+			t.Errorf("cpu origin = %q, want %s:2", got, projectPath)
+		}
+	})
+
+	t.Run("when project dir is empty should load no project file", func(t *testing.T) {
+		// Arrange
+		dir := t.TempDir()
+		writeProjectConfig(t, dir, "agent: codex\n")
+
+		// Act
+		cfg, err := LoadConfig("", "", WithProjectDir(""))
+
+		// Assert
+		if err != nil {
+			t.Fatalf("LoadConfig returned unexpected error: %v", err)
+		}
+		if cfg.Project != "" || cfg.VM.Agent == "codex" {
+			t.Errorf("Project %q, agent %q, want no project applied", cfg.Project, cfg.VM.Agent)
+		}
+	})
+
+	t.Run("when project file has a typo should report it strictly", func(t *testing.T) {
+		// Arrange
+		dir := t.TempDir()
+		writeProjectConfig(t, dir, "enviroments: [node]\n")
+
+		// Act
+		_, err := LoadConfig("", "", WithProjectDir(dir))
+
+		// Assert
+		var unknown *UnknownKeysError
+		if !errors.As(err, &unknown) || unknown.Keys[0].Suggestion != "environments" {
+			t.Errorf("LoadConfig error = %v, want environments suggestion", err)
+		}
+	})
+
+	t.Run("when project file turns isolation off should keep the user's modes", func(t *testing.T) {
+		// Arrange
+		dir := t.TempDir()
+		globalPath := writeGlobalConfig(t, "profiles:\n  locked:\n    isolation:\n      no_network: true\n")
+		writeProjectConfig(t, dir, "isolation:\n  no_network: false\n  no_mount: true\n")
+
+		// Act
+		cfg, err := LoadConfig(globalPath, "", WithProjectDir(dir), WithProfile("locked"))
+
+		// Assert
+		if err != nil {
+			t.Fatalf("LoadConfig returned unexpected error: %v", err)
+		}
+		if !cfg.VM.Isolation.NoNetwork || !cfg.VM.Isolation.NoMount {
+			t.Errorf("Isolation = %+v, want no_network kept and no_mount tightened", cfg.VM.Isolation)
+		}
+	})
+
+	t.Run("when project file sets the proxy mode should reject it", func(t *testing.T) {
+		// Arrange
+		dir := t.TempDir()
+		writeProjectConfig(t, dir, "proxy:\n  mode: off\n")
+
+		// Act
+		_, err := LoadConfig("", "", WithProjectDir(dir))
+
+		// Assert
+		var unknown *UnknownKeysError
+		if !errors.As(err, &unknown) || unknown.Keys[0].Key != "proxy" {
+			t.Errorf("LoadConfig error = %v, want proxy rejected", err)
+		}
+	})
+
+	t.Run("when project file sets a host setting should reject it", func(t *testing.T) {
+		// Arrange
+		dir := t.TempDir()
+		writeProjectConfig(t, dir, "output:\n  sync_dir: /tmp\n")
+
+		// Act
+		_, err := LoadConfig("", "", WithProjectDir(dir))
+
+		// Assert
+		var unknown *UnknownKeysError
+		if !errors.As(err, &unknown) || unknown.Keys[0].Key != "output" {
+			t.Errorf("LoadConfig error = %v, want output rejected", err)
+		}
+	})
+}
+
+func TestLoadConfigProjectTrust(t *testing.T) {
+	const hooks = "hooks:\n  setup:\n    - make bootstrap\n"
+
+	t.Run("when commands are untrusted without a prompt should withhold only the commands", func(t *testing.T) {
+		// Arrange
+		dir := t.TempDir()
+		writeProjectConfig(t, dir, hooks+"agent: codex\nagents:\n  codex:\n    install_command: npm install -g @openai/codex\n")
+
+		// Act
+		cfg, err := LoadConfig("", "", WithProjectDir(dir), WithTrustStore(NewTrustStore(t.TempDir())))
+
+		// Assert
+		if err != nil {
+			t.Fatalf("LoadConfig returned unexpected error: %v", err)
+		}
+		if len(cfg.Hooks.Setup) != 0 || cfg.Agents["codex"].InstallCommand == "npm install -g @openai/codex" {
+			t.Errorf("Hooks %+v, agents %+v, want the commands withheld", cfg.Hooks, cfg.Agents)
+		}
+		if cfg.VM.Agent != "codex" {
+			t.Errorf("Agent = %q, want the rest of the file applied", cfg.VM.Agent)
+		}
+		want := []string{"agents.codex.install_command: npm install -g @openai/codex", "hooks.setup: make bootstrap"}
+		if !reflect.DeepEqual(cfg.WithheldCommands, want) {
+			t.Errorf("WithheldCommands = %v, want %v", cfg.WithheldCommands, want)
+		}
+	})
+
+	t.Run("when prompt accepts should record trust until the file changes", func(t *testing.T) {
+		// Arrange
+		dir := t.TempDir()
+		path := writeProjectConfig(t, dir, hooks)
+		store := WithTrustStore(NewTrustStore(t.TempDir()))
+		var prompted [][]string
+		prompt := WithTrustPrompt(func(_ string, commands []string) (bool, error) {
+			prompted = append(prompted, commands)
+			return true, nil
+		})
+
+		// Act
+		first, firstErr := LoadConfig("", "", WithProjectDir(dir), store, prompt)
+		_, againErr := LoadConfig("", "", WithProjectDir(dir), store, prompt)
+		writeProjectConfig(t, dir, hooks+"agent: codex\n")
+		_, changedErr := LoadConfig("", "", WithProjectDir(dir), store, prompt)
+
+		// Assert
+		if firstErr != nil || againErr != nil || changedErr != nil {
+			t.Fatalf("LoadConfig returned unexpected errors: %v, %v, %v", firstErr, againErr, changedErr)
+		}
+		if !reflect.DeepEqual(first.Hooks.Setup, []string{"make bootstrap"}) || first.Project != path {
+			t.Errorf("Hooks = %+v from %q, want setup hook from project", first.Hooks, first.Project)
+		}
+		if len(prompted) != 2 || !reflect.DeepEqual(prompted[0], []string{"hooks.setup: make bootstrap"}) {
+			t.Errorf("prompted = %v, want the hook listed on first load and after the change", prompted)
+		}
+	})
+
+	t.Run("when prompt declines should return error", func(t *testing.T) {
+		// Arrange
+		dir := t.TempDir()
+		writeProjectConfig(t, dir, "agents:\n  codex:\n    install_command: npm install -g @openai/codex\n")
+		decline := WithTrustPrompt(func(string, []string) (bool, error) { return false, nil })
+
+		// Act
+		_, err := LoadConfig("", "", WithProjectDir(dir), WithTrustStore(NewTrustStore(t.TempDir())), decline)
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "is not trusted: review it and run 'calf config trust") {
+			t.Errorf("LoadConfig error = %v, want not trusted error", err)
+		}
+	})
+
+	t.Run("when file has no commands should apply it without asking", func(t *testing.T) {
+		// Arrange
+		dir := t.TempDir()
+		writeProjectConfig(t, dir, "agent: codex\n")
+
+		// Act
+		cfg, err := LoadConfig("", "", WithProjectDir(dir), WithTrustStore(NewTrustStore(t.TempDir())))
+
+		// Assert
+		if err != nil {
+			t.Fatalf("LoadConfig returned unexpected error: %v", err)
+		}
+		if cfg.VM.Agent != "codex" {
+			t.Errorf("Agent = %q, want codex", cfg.VM.Agent)
+		}
+	})
+
+	t.Run("when trusted with TrustProjectConfig should apply it without asking", func(t *testing.T) {
+		// Arrange
+		dir := t.TempDir()
+		path := writeProjectConfig(t, dir, hooks)
+		trust := NewTrustStore(t.TempDir())
+
+		// Act
+		trustErr := trust.TrustProjectConfig(path)
+		_, err := LoadConfig("", "", WithProjectDir(dir), WithTrustStore(trust))
+
+		// Assert
+		if trustErr != nil || err != nil {
+			t.Errorf("unexpected errors: %v, %v", trustErr, err)
+		}
+	})
+}
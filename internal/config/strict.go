@@ -0,0 +1,143 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// UnknownKey is a key in a config file that is not part of the schema.
+type UnknownKey struct {
+	Key    string // Dotted key, e.g. isolation.defaults.vm.memroy
+	Line   int
+	Column int
+	// Suggestion is the closest key the schema allows at the same place, or
+	// empty if none is close.
+	Suggestion string
+}
+
+// UnknownKeysError reports the keys of a config file that are not part of
+// the schema, which would otherwise be silently ignored.
+type UnknownKeysError struct {
+	Path string
+	Keys []UnknownKey
+}
+
+// Error lists each unknown key with its position, e.g.
+// "~/.calf/config.yaml:5:7: unknown key isolation.defaults.vm.memroy (did you mean memory?)".
+func (e *UnknownKeysError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "unknown keys in config file '%s' (use --lenient to ignore them):", e.Path)
+	for _, k := range e.Keys {
+		fmt.Fprintf(&b, "\n  %s:%d:%d: unknown key %s", e.Path, k.Line, k.Column, k.Key)
+		if k.Suggestion != "" {
+			fmt.Fprintf(&b, " (did you mean %s?)", k.Suggestion)
+		}
+	}
+	return b.String()
+}
+
+// checkKeys returns an UnknownKeysError for the keys of node, the contents of
+// the config file at path, that are not part of schema t.
+func checkKeys(t reflect.Type, node *yaml.Node, path string) error {
+	keys := unknownKeys(t, node, "")
+	if len(keys) == 0 {
+		return nil
+	}
+	return &UnknownKeysError{Path: path, Keys: keys}
+}
+
+// unknownKeys walks node alongside type t the way overlay merges it, and
+// returns the mapping keys that select no struct field.
+func unknownKeys(t reflect.Type, node *yaml.Node, key string) []UnknownKey {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	var unknown []UnknownKey
+	switch t.Kind() {
+	case reflect.Pointer:
+		return unknownKeys(t.Elem(), node, key)
+
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			return nil
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			name := node.Content[i]
+			index, ok := fieldIndex(t, name.Value)
+			if !ok {
+				unknown = append(unknown, UnknownKey{
+					Key:        joinKey(key, name.Value),
+					Line:       name.Line,
+					Column:     name.Column,
+					Suggestion: closestMatch(name.Value, fieldNames(t)),
+				})
+				continue
+			}
+			unknown = append(unknown, unknownKeys(t.Field(index).Type, node.Content[i+1], joinKey(key, name.Value))...)
+		}
+
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			return nil
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			unknown = append(unknown, unknownKeys(t.Elem(), node.Content[i+1], joinKey(key, node.Content[i].Value))...)
+		}
+
+	case reflect.Slice:
+		if node.Kind != yaml.SequenceNode {
+			return nil
+		}
+		for i, item := range node.Content {
+			unknown = append(unknown, unknownKeys(t.Elem(), item, fmt.Sprintf("%s[%d]", key, i))...)
+		}
+	}
+	return unknown
+}
+
+// fieldNames returns the yaml names of the fields of struct type t.
+func fieldNames(t reflect.Type) []string {
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		if name, ok := yamlName(t.Field(i)); ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// closestMatch returns the candidate nearest to name by edit distance, if it
+// is close enough to be a likely typo.
+func closestMatch(name string, candidates []string) string {
+	best, bestDistance := "", max(2, len(name)/3)+1
+	for _, candidate := range candidates {
+		if d := editDistance(name, candidate); d < bestDistance {
+			best, bestDistance = candidate, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
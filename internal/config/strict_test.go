@@ -0,0 +1,179 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStrictDecoding(t *testing.T) {
+	t.Run("when global file has a typo should report key position and suggestion", func(t *testing.T) {
+		// Arrange
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		content := "version: 1\nisolation:\n  defaults:\n    vm:\n      memroy: 16384\n  provder: sim\n"
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+
+		// Act
+		_, err := LoadConfig(path, "")
+
+		// Assert
+		var unknown *UnknownKeysError
+		if !errors.As(err, &unknown) {
+			t.Fatalf("LoadConfig error = %v, want UnknownKeysError", err)
+		}
+		want := []UnknownKey{
+			{Key: "isolation.defaults.vm.memroy", Line: 5, Column: 7, Suggestion: "memory"},
+			{Key: "isolation.provder", Line: 6, Column: 3, Suggestion: "provider"},
+		}
+		if !reflect.DeepEqual(unknown.Keys, want) {
+			t.Errorf("unknown keys = %+v, want %+v", unknown.Keys, want)
+		}
+		if !strings.Contains(err.Error(), path+":5:7: unknown key isolation.defaults.vm.memroy (did you mean memory?)") {
+			t.Errorf("error = %q, want position and suggestion", err)
+		}
+	})
+
+	t.Run("when vm file has a typo in a repo should report its index", func(t *testing.T) {
+		// Arrange
+		path := filepath.Join(t.TempDir(), "vm.yaml")
+		content := "cpu: 4\ngithub:\n  repos:\n    - name: my-app\n      brnch: main\n"
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+
+		// Act
+		_, err := LoadConfig("", path)
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "unknown key github.repos[0].brnch (did you mean branch?)") {
+			t.Errorf("LoadConfig error = %v, want repo key error", err)
+		}
+	})
+
+	t.Run("when unknown key is not close to any field should omit suggestion", func(t *testing.T) {
+		// Arrange
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(path, []byte("telemetry: off\n"), 0644); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+
+		// Act
+		_, err := LoadConfig(path, "")
+
+		// Assert
+		var unknown *UnknownKeysError
+		if !errors.As(err, &unknown) || len(unknown.Keys) != 1 || unknown.Keys[0].Suggestion != "" {
+			t.Errorf("LoadConfig error = %v, want one unknown key without suggestion", err)
+		}
+	})
+
+	t.Run("when lenient should ignore unknown keys", func(t *testing.T) {
+		// Arrange
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(path, []byte("isolation:\n  defaults:\n    vm:\n      memroy: 16384\n"), 0644); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+
+		// Act
+		cfg, err := LoadConfig(path, "", WithLenient())
+
+		// Assert
+		if err != nil {
+			t.Fatalf("LoadConfig returned unexpected error: %v", err)
+		}
+		if cfg.Isolation.Defaults.VM.Memory != 8192 {
+			t.Errorf("Memory = %d, want default 8192", cfg.Isolation.Defaults.VM.Memory)
+		}
+	})
+
+	t.Run("when agents section is documented should accept it", func(t *testing.T) {
+		// Arrange
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		content := "agents:\n  claude-code:\n    install_command: npm install -g @anthropic-ai/claude-code\n"
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+
+		// Act
+		cfg, err := LoadConfig(path, "")
+
+		// Assert
+		if err != nil {
+			t.Fatalf("LoadConfig returned unexpected error: %v", err)
+		}
+		if got := cfg.Agents["claude-code"].InstallCommand; got != "npm install -g @anthropic-ai/claude-code" {
+			t.Errorf("install command = %q", got)
+		}
+	})
+}
+
+func TestValidateFile(t *testing.T) {
+	t.Run("when file is valid should return nil", func(t *testing.T) {
+		// Arrange
+		path := filepath.Join(t.TempDir(), "vm.yaml")
+		if err := os.WriteFile(path, []byte("resources:\n  cpu: 6\n"), 0644); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+
+		// Act
+		err := ValidateFile(path)
+
+		// Assert
+		if err != nil {
+			t.Errorf("ValidateFile returned unexpected error: %v", err)
+		}
+	})
+
+	t.Run("when value is out of range should return validation error", func(t *testing.T) {
+		// Arrange
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(path, []byte("isolation:\n  defaults:\n    vm:\n      cpu: 64\n"), 0644); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+
+		// Act
+		err := ValidateFile(path)
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "invalid CPU") {
+			t.Errorf("ValidateFile error = %v, want CPU error", err)
+		}
+	})
+
+	t.Run("when file is missing should return error", func(t *testing.T) {
+		// Act
+		err := ValidateFile(filepath.Join(t.TempDir(), "config.yaml"))
+
+		// Assert
+		if err == nil {
+			t.Error("ValidateFile returned nil, want read error")
+		}
+	})
+}
+
+func TestClosestMatch(t *testing.T) {
+	t.Run("when name is a transposition should suggest the field", func(t *testing.T) {
+		// Act
+		got := closestMatch("memroy", []string{"cpu", "memory", "disk_size"})
+
+		// Assert
+		if got != "memory" {
+			t.Errorf("closestMatch() = %q, want memory", got)
+		}
+	})
+
+	t.Run("when name is far from every field should return empty", func(t *testing.T) {
+		// Act
+		got := closestMatch("gpu_count", []string{"cpu", "memory"})
+
+		// Assert
+		if got != "" {
+			t.Errorf("closestMatch() = %q, want empty", got)
+		}
+	})
+}
@@ -0,0 +1,153 @@
+package config
+
+import (
+	"reflect"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+// vmFile is the schema of a per-VM config file (vm.yaml):
+//
+//	version: 2
+//	name: my-workspace
+//	resources: {cpu: 6, memory: 12288, disk_size: 80, base_image: ...}
+//	agent: claude-code
+//	github:
+//	  default_branch_prefix: agent/
+//	  repos: [{name: my-app, branch: agent/feature}]
+//	output: {sync_dir: ~/calf-output}
+//	proxy: {mode: auto}
+//	isolation: {no_mount: false, no_network: false}
+//
+// Its fields point at the values of the effective Config they set, so a
+// vm.yaml is merged by overlaying it onto a vmFile, and the mapping from
+// file keys to config keys (see vmFileKeys) follows from the pointers.
+type vmFile struct {
+	Version   int                `yaml:"version"` // See vmMigrations
+	Name      *string            `yaml:"name"`
+	Resources *VMConfig          `yaml:"resources"`
+	Agent     *string            `yaml:"agent"`
+	GitHub    vmGitHub           `yaml:"github"`
+	Output    *OutputConfig      `yaml:"output"`
+	Proxy     *ProxyConfig       `yaml:"proxy"`
+	Isolation *VMIsolationConfig `yaml:"isolation"`
+}
+
+// vmGitHub is the github section of a per-VM file.
+type vmGitHub struct {
+	DefaultBranchPrefix *string       `yaml:"default_branch_prefix"`
+	Repos               *[]RepoConfig `yaml:"repos"`
+}
+
+// flatVMKeys are the resource keys version 1 per-VM files held at their top
+// level, before the resources section was introduced.
+var flatVMKeys = []string{"cpu", "memory", "disk_size", "base_image"}
+
+// newVMFile returns a vmFile whose fields point into cfg.
+func newVMFile(cfg *Config) *vmFile {
+	return &vmFile{
+		Name:      &cfg.VM.Name,
+		Resources: &cfg.Isolation.Defaults.VM,
+		Agent:     &cfg.VM.Agent,
+		GitHub: vmGitHub{
+			DefaultBranchPrefix: &cfg.Isolation.Defaults.GitHub.DefaultBranchPrefix,
+			Repos:               &cfg.VM.Repos,
+		},
+		Output:    &cfg.Isolation.Defaults.Output,
+		Proxy:     &cfg.Isolation.Defaults.Proxy,
+		Isolation: &cfg.VM.Isolation,
+	}
+}
+
+// vmFileKeys maps the dotted keys of a per-VM file to the config keys they
+// set, e.g. resources.cpu to isolation.defaults.vm.cpu.
+func vmFileKeys() map[string]string {
+	return viewKeys(func(cfg *Config) any { return newVMFile(cfg) })
+}
+
+// viewKeys maps the dotted keys of a view of Config, such as vmFile, to the
+// config keys they set. It is derived by matching the addresses the view
+// points at with the fields of Config.
+func viewKeys(newView func(cfg *Config) any) map[string]string {
+	cfg := newDefaultConfig()
+	configKeys := map[uintptr]string{}
+	leafAddrs(reflect.ValueOf(cfg).Elem(), "", func(key string, addr uintptr) { configKeys[addr] = key })
+
+	keys := map[string]string{}
+	leafAddrs(reflect.ValueOf(newView(cfg)).Elem(), "", func(key string, addr uintptr) {
+		if configKey, ok := configKeys[addr]; ok {
+			keys[key] = configKey
+		}
+	})
+	return keys
+}
+
+// vmFileKey returns the per-VM file key that sets a config key.
+func vmFileKey(configKey string) (string, bool) {
+	for fileKey, key := range vmFileKeys() {
+		if key == configKey {
+			return fileKey, true
+		}
+	}
+	return "", false
+}
+
+// leafAddrs calls fn with the dotted key and address of every leaf value
+// below v, following non-nil pointers.
+func leafAddrs(v reflect.Value, prefix string, fn func(key string, addr uintptr)) {
+	if v.Kind() == reflect.Pointer {
+		if !v.IsNil() {
+			leafAddrs(v.Elem(), prefix, fn)
+		}
+		return
+	}
+	if v.Kind() != reflect.Struct {
+		fn(prefix, v.UnsafeAddr())
+		return
+	}
+	for i := 0; i < v.NumField(); i++ {
+		name, ok := yamlName(v.Type().Field(i))
+		if ok {
+			leafAddrs(v.Field(i), joinKey(prefix, name), fn)
+		}
+	}
+}
+
+// migrateFlatVMKeys moves resource keys at the top level of a per-VM file
+// into its resources section, upgrading a version 1 file. Values already in
+// resources win. It reports whether the file was changed.
+func migrateFlatVMKeys(root *yaml.Node) bool {
+	if root.Kind != yaml.MappingNode {
+		return false
+	}
+	var resources *yaml.Node
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "resources" && root.Content[i+1].Kind == yaml.MappingNode {
+			resources = root.Content[i+1]
+		}
+	}
+
+	changed := false
+	for i := 0; i+1 < len(root.Content); {
+		key, value := root.Content[i], root.Content[i+1]
+		if !slices.Contains(flatVMKeys, key.Value) {
+			i += 2
+			continue
+		}
+		if resources == nil {
+			resources = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "resources"}, resources)
+		}
+		if mappingValue(resources, key.Value) == nil {
+			resources.Content = append(resources.Content, key, value)
+		}
+		// A comment heading the file stays at the top.
+		if i == 0 && key.HeadComment != "" && len(root.Content) > 2 {
+			root.Content[2].HeadComment, key.HeadComment = key.HeadComment, root.Content[2].HeadComment
+		}
+		root.Content = slices.Delete(root.Content, i, i+2)
+		changed = true
+	}
+	return changed
+}
@@ -0,0 +1,213 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestLoadVMConfigSchema(t *testing.T) {
+	t.Run("when vm file uses the documented schema should apply every section", func(t *testing.T) {
+		// Arrange
+		vmConfigPath := filepath.Join(t.TempDir(), "vm.yaml")
+		vmConfigContent := `
+name: my-workspace
+resources:
+  cpu: 6
+  memory: 12288
+agent: claude-code
+github:
+  default_branch_prefix: feature/
+  repos:
+    - name: my-app
+      branch: agent/login
+    - name: my-lib
+output:
+  sync_dir: ~/work-output
+proxy:
+  mode: on
+isolation:
+  no_network: true
+`
+		if err := os.WriteFile(vmConfigPath, []byte(vmConfigContent), 0644); err != nil {
+			t.Fatalf("Failed to write VM config: %v", err)
+		}
+
+		// Act
+		cfg, origins, err := LoadConfigWithOrigins("", vmConfigPath)
+
+		// Assert
+		if err != nil {
+			t.Fatalf("LoadConfigWithOrigins returned unexpected error: %v", err)
+		}
+		if cfg.VM.Name != "my-workspace" || cfg.VM.Agent != "claude-code" {
+			t.Errorf("VM = %+v, want name and agent from file", cfg.VM)
+		}
+		if cfg.Isolation.Defaults.VM.CPU != 6 || cfg.Isolation.Defaults.VM.Memory != 12288 {
+			t.Errorf("resources = %+v, want cpu 6 and memory 12288", cfg.Isolation.Defaults.VM)
+		}
+		wantRepos := []RepoConfig{{Name: "my-app", Branch: "agent/login"}, {Name: "my-lib"}}
+		if !reflect.DeepEqual(cfg.VM.Repos, wantRepos) {
+			t.Errorf("Repos = %+v, want %+v", cfg.VM.Repos, wantRepos)
+		}
+		if cfg.Isolation.Defaults.GitHub.DefaultBranchPrefix != "feature/" {
+			t.Errorf("DefaultBranchPrefix = %q, want feature/", cfg.Isolation.Defaults.GitHub.DefaultBranchPrefix)
+		}
+		if cfg.Isolation.Defaults.Output.SyncDir != "~/work-output" {
+			t.Errorf("SyncDir = %q, want ~/work-output", cfg.Isolation.Defaults.Output.SyncDir)
+		}
+		if cfg.Isolation.Defaults.Proxy.Mode != "on" {
+			t.Errorf("Proxy.Mode = %q, want on", cfg.Isolation.Defaults.Proxy.Mode)
+		}
+		if cfg.VM.Isolation.NoMount || !cfg.VM.Isolation.NoNetwork {
+			t.Errorf("Isolation = %+v, want no_network only", cfg.VM.Isolation)
+		}
+		if got := origins["isolation.defaults.vm.cpu"].String(); got != vmConfigPath+":4" {
+			t.Errorf("cpu origin = %q, want %s:4", got, vmConfigPath)
+		}
+		if got := origins["vm.isolation.no_network"].String(); got != vmConfigPath+":18" {
+			t.Errorf("no_network origin = %q, want %s:18", got, vmConfigPath)
+		}
+	})
+
+	t.Run("when vm file sets global-only keys leniently should ignore them", func(t *testing.T) {
+		// Arrange
+		vmConfigPath := filepath.Join(t.TempDir(), "vm.yaml")
+		if err := os.WriteFile(vmConfigPath, []byte("provider: sim\nisolation:\n  provider: sim\n"), 0644); err != nil {
+			t.Fatalf("Failed to write VM config: %v", err)
+		}
+
+		// Act
+		cfg, err := LoadConfig("", vmConfigPath, WithLenient())
+
+		// Assert
+		if err != nil {
+			t.Fatalf("LoadConfig returned unexpected error: %v", err)
+		}
+		if cfg.Isolation.Provider != "tart" {
+			t.Errorf("Provider = %q, want tart", cfg.Isolation.Provider)
+		}
+	})
+
+	t.Run("when global file has a vm section should ignore it", func(t *testing.T) {
+		// Arrange
+		globalConfigPath := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(globalConfigPath, []byte("vm:\n  name: shared\n"), 0644); err != nil {
+			t.Fatalf("Failed to write global config: %v", err)
+		}
+
+		// Act
+		cfg, err := LoadConfig(globalConfigPath, "")
+
+		// Assert
+		if err != nil {
+			t.Fatalf("LoadConfig returned unexpected error: %v", err)
+		}
+		if cfg.VM.Name != "" {
+			t.Errorf("VM.Name = %q, want empty", cfg.VM.Name)
+		}
+	})
+
+	t.Run("when repo has no name should return validation error", func(t *testing.T) {
+		// Arrange
+		vmConfigPath := filepath.Join(t.TempDir(), "vm.yaml")
+		if err := os.WriteFile(vmConfigPath, []byte("github:\n  repos:\n    - branch: main\n"), 0644); err != nil {
+			t.Fatalf("Failed to write VM config: %v", err)
+		}
+
+		// Act
+		_, err := LoadConfig("", vmConfigPath)
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "repo #1 name") {
+			t.Errorf("LoadConfig error = %v, want repo name error", err)
+		}
+	})
+}
+
+func TestVMFileKeys(t *testing.T) {
+	t.Run("when mapping vm file keys should point at the config keys they set", func(t *testing.T) {
+		// Act
+		keys := vmFileKeys()
+
+		// Assert
+		want := map[string]string{
+			"name":                         "vm.name",
+			"resources.cpu":                "isolation.defaults.vm.cpu",
+			"resources.memory":             "isolation.defaults.vm.memory",
+			"resources.disk_size":          "isolation.defaults.vm.disk_size",
+			"resources.base_image":         "isolation.defaults.vm.base_image",
+			"agent":                        "vm.agent",
+			"github.default_branch_prefix": "isolation.defaults.github.default_branch_prefix",
+			"github.repos":                 "vm.repos",
+			"output.sync_dir":              "isolation.defaults.output.sync_dir",
+			"proxy.mode":                   "isolation.defaults.proxy.mode",
+			"isolation.no_mount":           "vm.isolation.no_mount",
+			"isolation.no_network":         "vm.isolation.no_network",
+		}
+		if !reflect.DeepEqual(keys, want) {
+			t.Errorf("vmFileKeys() = %v, want %v", keys, want)
+		}
+	})
+}
+
+func TestMigrateFlatVMKeys(t *testing.T) {
+	t.Run("when file has flat resource keys should move them under resources", func(t *testing.T) {
+		// Arrange
+		root, err := parseConfigNode([]byte("# calf-dev\ncpu: 8\nagent: codex\nmemory: 16384\n"))
+		if err != nil {
+			t.Fatalf("parseConfigNode() unexpected error = %v", err)
+		}
+
+		// Act
+		changed := migrateFlatVMKeys(root)
+
+		// Assert
+		if !changed {
+			t.Error("migrateFlatVMKeys() = false, want true")
+		}
+		out, _ := yaml.Marshal(root)
+		want := "# calf-dev\nagent: codex\nresources:\n    cpu: 8\n    memory: 16384\n"
+		if string(out) != want {
+			t.Errorf("migrated file = %q, want %q", out, want)
+		}
+	})
+
+	t.Run("when resources already sets a key should keep the resources value", func(t *testing.T) {
+		// Arrange
+		root, err := parseConfigNode([]byte("cpu: 8\nresources:\n  cpu: 2\n"))
+		if err != nil {
+			t.Fatalf("parseConfigNode() unexpected error = %v", err)
+		}
+		var cfg Config
+
+		// Act
+		migrateFlatVMKeys(root)
+		err = overlay(reflect.ValueOf(newVMFile(&cfg)).Elem(), root, "", nil)
+
+		// Assert
+		if err != nil || cfg.Isolation.Defaults.VM.CPU != 2 {
+			t.Errorf("CPU = %d, %v, want 2", cfg.Isolation.Defaults.VM.CPU, err)
+		}
+	})
+
+	t.Run("when file has no flat keys should report no change", func(t *testing.T) {
+		// Arrange
+		root, err := parseConfigNode([]byte("resources:\n  cpu: 2\n"))
+		if err != nil {
+			t.Fatalf("parseConfigNode() unexpected error = %v", err)
+		}
+
+		// Act
+		changed := migrateFlatVMKeys(root)
+
+		// Assert
+		if changed {
+			t.Error("migrateFlatVMKeys() = true, want false")
+		}
+	})
+}
@@ -0,0 +1,397 @@
+// Package isolation provides VM isolation and management for CALF.
+package isolation
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// archiveFormatVersion is the current sidecar manifest format.
+	archiveFormatVersion = 1
+
+	// manifestSuffix is appended to an archive path to name its sidecar manifest.
+	manifestSuffix = ".calf.yaml"
+)
+
+// ArchiveManifest is the calf sidecar written next to an exported VM archive.
+// It carries the calf state Tart does not know about and the checksum used to
+// verify the archive on import.
+type ArchiveManifest struct {
+	// FormatVersion is the manifest format, for forward compatibility.
+	FormatVersion int `yaml:"format_version"`
+	// VM is the name of the exported VM, used as the default import name.
+	VM string `yaml:"vm"`
+	// ExportedAt is when the archive was created.
+	ExportedAt time.Time `yaml:"exported_at"`
+	// Isolation is the VM's isolation mode, restored on import.
+	Isolation IsolationMode `yaml:"isolation"`
+	// BaseImage is the image the VM was created from, if known.
+	BaseImage string `yaml:"base_image,omitempty"`
+	// BaseImageDigest is the recorded digest of BaseImage, if known.
+	BaseImageDigest string `yaml:"base_image_digest,omitempty"`
+	// Files holds the VM's calf config files (vm.yaml, snapshot metadata)
+	// from ~/.calf/isolation/vms/{name}/, keyed by file name.
+	Files map[string]string `yaml:"files,omitempty"`
+	// Archive describes the archive file itself.
+	Archive ArchiveFile `yaml:"archive"`
+}
+
+// ArchiveFile records the checksum and encryption of an archive file.
+type ArchiveFile struct {
+	// SHA256 is the hex checksum of the archive file as written to disk.
+	SHA256 string `yaml:"sha256"`
+	// Size is the archive file size in bytes.
+	Size int64 `yaml:"size"`
+	// Encryption is set when the archive is encrypted with a passphrase.
+	Encryption *ArchiveEncryption `yaml:"encryption,omitempty"`
+}
+
+// ArchiveEncryption records the parameters needed to decrypt an archive.
+type ArchiveEncryption struct {
+	Cipher     string `yaml:"cipher"`
+	KDF        string `yaml:"kdf"`
+	Iterations int    `yaml:"iterations"`
+	Salt       string `yaml:"salt"`
+}
+
+// ExportOptions configures ExportArchive.
+type ExportOptions struct {
+	// BaseImage and BaseImageDigest are recorded in the manifest.
+	BaseImage       string
+	BaseImageDigest string
+	// Passphrase encrypts the archive when non-empty.
+	Passphrase string
+}
+
+// ManifestPath returns the sidecar manifest path for an archive.
+func ManifestPath(archivePath string) string {
+	return archivePath + manifestSuffix
+}
+
+// ReadArchiveManifest reads the sidecar manifest for an archive.
+func ReadArchiveManifest(archivePath string) (*ArchiveManifest, error) {
+	path := ManifestPath(archivePath)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("manifest '%s' not found: archives must be imported together with their manifest", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest '%s': %w", path, err)
+	}
+
+	var manifest ArchiveManifest
+	if err := yaml.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest '%s': %w", path, err)
+	}
+	if manifest.FormatVersion > archiveFormatVersion {
+		return nil, fmt.Errorf("manifest '%s' has format version %d; this calf supports up to %d", path, manifest.FormatVersion, archiveFormatVersion)
+	}
+	return &manifest, nil
+}
+
+// Export writes a VM to a Tart archive (.tvm) at path.
+func (c *TartClient) Export(name, path string) error {
+	if err := c.ensureInstalled(); err != nil {
+		return err
+	}
+	if _, err := c.runCommand("export", name, path); err != nil {
+		return fmt.Errorf("failed to export VM %s: %w", name, err)
+	}
+	return nil
+}
+
+// Import creates a VM from a Tart archive at path.
+func (c *TartClient) Import(path, name string) error {
+	defer c.states.invalidate()
+	if err := c.ensureInstalled(); err != nil {
+		return err
+	}
+	if _, err := c.runCommand("import", path, name); err != nil {
+		return fmt.Errorf("failed to import VM %s from %s: %w", name, path, err)
+	}
+	return nil
+}
+
+// ExportArchive exports a stopped VM to path and writes its sidecar manifest
+// with the VM's isolation mode, calf config files, and archive checksum.
+// With a passphrase, the Tart archive is encrypted before it is written to path.
+func (c *TartClient) ExportArchive(name, path string, opts ExportOptions) (*ArchiveManifest, error) {
+	if c.modes == nil {
+		return nil, fmt.Errorf("exporting VM %s requires a mode store", name)
+	}
+	mode, err := c.modes.Load(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load isolation mode for %s: %w", name, err)
+	}
+	files, err := c.modes.vmFiles(name)
+	if err != nil {
+		return nil, err
+	}
+
+	tartPath := path
+	if opts.Passphrase != "" {
+		// Tart writes the plaintext archive into a private directory next to
+		// path, pre-created with mode 0600, which is removed once it has been
+		// encrypted or the export fails.
+		dir, err := os.MkdirTemp(filepath.Dir(path), ".calf-export-*")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create temporary export directory: %w", err)
+		}
+		defer os.RemoveAll(dir)
+		tartPath = filepath.Join(dir, filepath.Base(path))
+		if err := os.WriteFile(tartPath, nil, 0600); err != nil {
+			return nil, fmt.Errorf("failed to create temporary archive: %w", err)
+		}
+	}
+	if err := c.Export(name, tartPath); err != nil {
+		return nil, err
+	}
+
+	manifest := &ArchiveManifest{
+		FormatVersion:   archiveFormatVersion,
+		VM:              name,
+		ExportedAt:      time.Now().UTC(),
+		Isolation:       mode,
+		BaseImage:       opts.BaseImage,
+		BaseImageDigest: opts.BaseImageDigest,
+		Files:           files,
+	}
+	if opts.Passphrase != "" {
+		enc, err := encryptFile(tartPath, path, opts.Passphrase)
+		if err != nil {
+			os.Remove(path)
+			return nil, err
+		}
+		manifest.Archive.Encryption = enc
+	}
+
+	manifest.Archive.SHA256, manifest.Archive.Size, err = fileChecksum(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeManifest(ManifestPath(path), manifest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// ImportArchive verifies an archive against its sidecar manifest, imports it
+// as a VM, and restores its isolation mode and calf config files. The VM is
+// named after the exported VM unless name is non-empty. The passphrase is
+// required for encrypted archives.
+func (c *TartClient) ImportArchive(path, name, passphrase string) (*ArchiveManifest, error) {
+	if c.modes == nil {
+		return nil, fmt.Errorf("importing an archive requires a mode store")
+	}
+	manifest, err := ReadArchiveManifest(path)
+	if err != nil {
+		return nil, err
+	}
+	for file := range manifest.Files {
+		if !isPlainFileName(file) {
+			return nil, fmt.Errorf("invalid file name '%s' in manifest", file)
+		}
+	}
+	if name == "" {
+		name = manifest.VM
+	}
+	if c.Exists(name) {
+		return nil, fmt.Errorf("VM %s already exists; choose another name or delete it first", name)
+	}
+
+	sum, size, err := fileChecksum(path)
+	if err != nil {
+		return nil, err
+	}
+	if size != manifest.Archive.Size || sum != manifest.Archive.SHA256 {
+		return nil, fmt.Errorf("archive '%s' does not match its manifest checksum: file is corrupt or incomplete", path)
+	}
+
+	tartPath := path
+	if enc := manifest.Archive.Encryption; enc != nil {
+		if passphrase == "" {
+			return nil, fmt.Errorf("archive '%s' is encrypted: a passphrase is required", path)
+		}
+		// The decrypted archive is created exclusively with mode 0600 next to
+		// the archive and removed on every return path.
+		out, err := os.CreateTemp(filepath.Dir(path), ".calf-import-*.tvm")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create decrypted archive: %w", err)
+		}
+		tartPath = out.Name()
+		defer os.Remove(tartPath)
+		if err := decryptFile(path, out, passphrase, enc); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := c.Import(tartPath, name); err != nil {
+		return nil, err
+	}
+	if err := c.modes.restoreVMFiles(name, manifest.Files); err != nil {
+		return nil, err
+	}
+	if err := c.modes.Save(name, manifest.Isolation); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// encryptFile encrypts src into dst with a key derived from passphrase.
+func encryptFile(src, dst, passphrase string) (*ArchiveEncryption, error) {
+	salt := make([]byte, archiveSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	aead, err := newArchiveAEAD(passphrase, salt, archiveKDFIterations)
+	if err != nil {
+		return nil, err
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create encrypted archive '%s': %w", dst, err)
+	}
+	if err := encryptArchive(out, in, aead); err != nil {
+		out.Close()
+		return nil, err
+	}
+	if err := out.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write encrypted archive '%s': %w", dst, err)
+	}
+
+	return &ArchiveEncryption{
+		Cipher:     archiveCipher,
+		KDF:        archiveKDF,
+		Iterations: archiveKDFIterations,
+		Salt:       base64.StdEncoding.EncodeToString(salt),
+	}, nil
+}
+
+// decryptFile decrypts src into out using the manifest's encryption parameters.
+// out is always closed.
+func decryptFile(src string, out *os.File, passphrase string, enc *ArchiveEncryption) error {
+	defer out.Close()
+	if enc.Cipher != archiveCipher || enc.KDF != archiveKDF {
+		return fmt.Errorf("unsupported archive encryption %s/%s", enc.Cipher, enc.KDF)
+	}
+	salt, err := base64.StdEncoding.DecodeString(enc.Salt)
+	if err != nil {
+		return fmt.Errorf("invalid archive salt: %w", err)
+	}
+	aead, err := newArchiveAEAD(passphrase, salt, enc.Iterations)
+	if err != nil {
+		return err
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open encrypted archive: %w", err)
+	}
+	defer in.Close()
+	if err := decryptArchive(out, in, aead); err != nil {
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("failed to write decrypted archive '%s': %w", out.Name(), err)
+	}
+	return nil
+}
+
+// fileChecksum returns the hex SHA-256 and size of a file.
+func fileChecksum(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to open archive '%s': %w", path, err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to checksum archive '%s': %w", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), size, nil
+}
+
+// writeManifest writes a sidecar manifest.
+func writeManifest(path string, manifest *ArchiveManifest) error {
+	data, err := yaml.Marshal(manifest)
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write manifest '%s': %w", path, err)
+	}
+	return nil
+}
+
+// vmDir returns the calf config directory for a VM.
+func (s *ModeStore) vmDir(vmName string) string {
+	return filepath.Dir(s.modePath(vmName))
+}
+
+// vmFiles returns the contents of a VM's calf config files, excluding the
+// isolation mode file, which the manifest records separately.
+func (s *ModeStore) vmFiles(vmName string) (map[string]string, error) {
+	dir := s.vmDir(vmName)
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read VM config directory '%s': %w", dir, err)
+	}
+
+	files := make(map[string]string)
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || entry.Name() == modeFileName {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read VM config file: %w", err)
+		}
+		files[entry.Name()] = string(data)
+	}
+	return files, nil
+}
+
+// isPlainFileName reports whether name is a single path element, so a crafted
+// manifest cannot write outside the VM config directory.
+func isPlainFileName(name string) bool {
+	return name != "" && name == filepath.Base(name) && name != "." && name != ".."
+}
+
+// restoreVMFiles writes calf config files for a VM.
+func (s *ModeStore) restoreVMFiles(vmName string, files map[string]string) error {
+	dir := s.vmDir(vmName)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create VM config directory: %w", err)
+	}
+	for name, content := range files {
+		if !isPlainFileName(name) {
+			return fmt.Errorf("invalid file name '%s' in manifest", name)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			return fmt.Errorf("failed to restore VM config file '%s': %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+// Package isolation provides VM isolation and management for CALF.
+package isolation
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	// archiveCipher names the archive encryption scheme recorded in manifests.
+	archiveCipher = "aes-256-gcm-chunked"
+
+	// archiveKDF names the passphrase key derivation recorded in manifests.
+	archiveKDF = "pbkdf2-sha256"
+
+	// archiveKDFIterations follows the OWASP recommendation for PBKDF2-SHA256.
+	archiveKDFIterations = 600_000
+
+	// archiveChunkSize is the plaintext size of each sealed chunk.
+	archiveChunkSize = 1 << 20
+
+	// archiveSaltSize is the size of the random per-archive KDF salt.
+	archiveSaltSize = 16
+)
+
+// errWrongPassphrase is returned when an archive chunk fails authentication,
+// which almost always means the passphrase is wrong.
+var errWrongPassphrase = errors.New("wrong passphrase or corrupted archive")
+
+// newArchiveAEAD derives an AES-256-GCM cipher from a passphrase and salt.
+func newArchiveAEAD(passphrase string, salt []byte, iterations int) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, iterations, 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive archive key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create archive cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// chunkNonce returns the nonce for chunk i. Keys are unique per archive
+// (random salt), so a counter nonce is never reused under the same key.
+func chunkNonce(aead cipher.AEAD, i uint64) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], i)
+	return nonce
+}
+
+// chunkAAD marks whether a chunk is the last one, so truncating the archive
+// at a chunk boundary fails authentication instead of silently succeeding.
+func chunkAAD(final bool) []byte {
+	if final {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+// encryptArchive encrypts src to dst in independently authenticated chunks.
+// Every chunk but the last holds exactly archiveChunkSize plaintext bytes;
+// the last is shorter, possibly empty.
+func encryptArchive(dst io.Writer, src io.Reader, aead cipher.AEAD) error {
+	buf := make([]byte, archiveChunkSize)
+	sealed := make([]byte, 0, archiveChunkSize+aead.Overhead())
+	for i := uint64(0); ; i++ {
+		n, err := io.ReadFull(src, buf)
+		final := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !final {
+			return fmt.Errorf("failed to read archive: %w", err)
+		}
+
+		sealed = aead.Seal(sealed[:0], chunkNonce(aead, i), buf[:n], chunkAAD(final))
+		if _, err := dst.Write(sealed); err != nil {
+			return fmt.Errorf("failed to write encrypted archive: %w", err)
+		}
+		if final {
+			return nil
+		}
+	}
+}
+
+// decryptArchive reverses encryptArchive, failing on a wrong passphrase,
+// tampering, or truncation.
+func decryptArchive(dst io.Writer, src io.Reader, aead cipher.AEAD) error {
+	buf := make([]byte, archiveChunkSize+aead.Overhead())
+	plain := make([]byte, 0, archiveChunkSize)
+	for i := uint64(0); ; i++ {
+		n, err := io.ReadFull(src, buf)
+		final := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !final {
+			return fmt.Errorf("failed to read encrypted archive: %w", err)
+		}
+		if final && n < aead.Overhead() {
+			return fmt.Errorf("encrypted archive is truncated")
+		}
+
+		plain, err = aead.Open(plain[:0], chunkNonce(aead, i), buf[:n], chunkAAD(final))
+		if err != nil {
+			return errWrongPassphrase
+		}
+		if _, err := dst.Write(plain); err != nil {
+			return fmt.Errorf("failed to write decrypted archive: %w", err)
+		}
+		if final {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,283 @@
+// Package isolation provides VM isolation and management for CALF.
+package isolation
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// fakeTartArchiver simulates tart export/import against files on disk.
+type fakeTartArchiver struct {
+	t        *testing.T
+	vms      string // tart list JSON
+	content  string // archive content written by export
+	imported map[string]string
+	modes    map[string]os.FileMode // permissions of each imported file
+	// exportModes are the permissions of each exported file and its directory.
+	exportModes []os.FileMode
+}
+
+func (f *fakeTartArchiver) run(args ...string) (string, error) {
+	switch args[0] {
+	case "list":
+		return f.vms, nil
+	case "export":
+		if err := os.WriteFile(args[2], []byte(f.content), 0644); err != nil {
+			f.t.Fatal(err)
+		}
+		file, _ := os.Stat(args[2])
+		dir, _ := os.Stat(filepath.Dir(args[2]))
+		f.exportModes = append(f.exportModes, file.Mode().Perm(), dir.Mode().Perm())
+	case "import":
+		data, err := os.ReadFile(args[1])
+		if err != nil {
+			f.t.Fatal(err)
+		}
+		f.imported[args[2]] = string(data)
+		if info, err := os.Stat(args[1]); err == nil {
+			f.modes[args[2]] = info.Mode().Perm()
+		}
+	}
+	return "", nil
+}
+
+// createArchiveClient creates a TartClient backed by a fake archiver and a
+// mode store in a temporary home directory.
+func createArchiveClient(t *testing.T, fake *fakeTartArchiver) (*TartClient, *ModeStore) {
+	t.Helper()
+	fake.t = t
+	if fake.vms == "" {
+		fake.vms = "[]"
+	}
+	fake.imported = map[string]string{}
+	fake.modes = map[string]os.FileMode{}
+	modes := NewModeStore(t.TempDir())
+	return NewTartClient(WithTartPath("/mock/tart"), WithRunCommand(fake.run), WithModeStore(modes)), modes
+}
+
+func TestExportImportArchive(t *testing.T) {
+	t.Run("when exported and imported should restore archive mode and config files", func(t *testing.T) {
+		// Arrange
+		fake := &fakeTartArchiver{content: "tvm-data"}
+		client, modes := createArchiveClient(t, fake)
+		if err := modes.Save("calf-dev", SafeMode()); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(modes.vmDir("calf-dev"), "vm.yaml"), []byte("cpu: 6\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		archive := filepath.Join(t.TempDir(), "calf-dev.tvm")
+
+		// Act
+		_, err := client.ExportArchive("calf-dev", archive, ExportOptions{BaseImage: "ghcr.io/org/calf-init:v2", BaseImageDigest: "sha256:abc"})
+		if err != nil {
+			t.Fatalf("ExportArchive() unexpected error = %v", err)
+		}
+		manifest, err := client.ImportArchive(archive, "client-a", "")
+
+		// Assert
+		if err != nil {
+			t.Fatalf("ImportArchive() unexpected error = %v", err)
+		}
+		if fake.imported["client-a"] != "tvm-data" {
+			t.Errorf("ImportArchive() imported %q, want archive content", fake.imported["client-a"])
+		}
+		if manifest.BaseImageDigest != "sha256:abc" || manifest.VM != "calf-dev" {
+			t.Errorf("ImportArchive() manifest = %+v", manifest)
+		}
+		mode, _ := modes.Load("client-a")
+		if mode != SafeMode() {
+			t.Errorf("imported isolation mode = %+v, want safe mode", mode)
+		}
+		data, _ := os.ReadFile(filepath.Join(modes.vmDir("client-a"), "vm.yaml"))
+		if string(data) != "cpu: 6\n" {
+			t.Errorf("imported vm.yaml = %q, want original", data)
+		}
+	})
+
+	t.Run("when encrypted should not store plaintext and should decrypt with passphrase", func(t *testing.T) {
+		// Arrange
+		fake := &fakeTartArchiver{content: "secret-tvm-data"}
+		client, _ := createArchiveClient(t, fake)
+		archive := filepath.Join(t.TempDir(), "calf-dev.tvm")
+
+		// Act
+		manifest, err := client.ExportArchive("calf-dev", archive, ExportOptions{Passphrase: "correct horse"})
+		if err != nil {
+			t.Fatalf("ExportArchive() unexpected error = %v", err)
+		}
+		_, err = client.ImportArchive(archive, "", "correct horse")
+
+		// Assert
+		if err != nil {
+			t.Fatalf("ImportArchive() unexpected error = %v", err)
+		}
+		if manifest.Archive.Encryption == nil {
+			t.Fatal("ExportArchive() manifest should record encryption")
+		}
+		stored, _ := os.ReadFile(archive)
+		if bytes.Contains(stored, []byte("secret-tvm-data")) {
+			t.Error("encrypted archive contains plaintext")
+		}
+		if entries, _ := os.ReadDir(filepath.Dir(archive)); len(entries) != 2 {
+			t.Errorf("archive directory has %d entries, want archive and manifest only", len(entries))
+		}
+		if fake.modes["calf-dev"] != 0600 {
+			t.Errorf("decrypted archive mode = %o, want 600", fake.modes["calf-dev"])
+		}
+		if !slices.Equal(fake.exportModes, []os.FileMode{0600, 0700}) {
+			t.Errorf("plaintext export file and directory modes = %o, want 600 and 700", fake.exportModes)
+		}
+		if fake.imported["calf-dev"] != "secret-tvm-data" {
+			t.Errorf("ImportArchive() imported %q, want decrypted content", fake.imported["calf-dev"])
+		}
+	})
+
+	t.Run("when passphrase is wrong should return error without importing", func(t *testing.T) {
+		// Arrange
+		fake := &fakeTartArchiver{content: "secret-tvm-data"}
+		client, _ := createArchiveClient(t, fake)
+		archive := filepath.Join(t.TempDir(), "calf-dev.tvm")
+		if _, err := client.ExportArchive("calf-dev", archive, ExportOptions{Passphrase: "correct horse"}); err != nil {
+			t.Fatal(err)
+		}
+
+		// Act
+		_, err := client.ImportArchive(archive, "", "battery staple")
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "wrong passphrase") {
+			t.Errorf("ImportArchive() error = %v, want wrong passphrase error", err)
+		}
+		if len(fake.imported) != 0 {
+			t.Errorf("ImportArchive() should not import, got %v", fake.imported)
+		}
+		if entries, _ := os.ReadDir(filepath.Dir(archive)); len(entries) != 2 {
+			t.Errorf("archive directory has %d entries, want no decrypted leftovers", len(entries))
+		}
+	})
+
+	t.Run("when archive modified after export should fail checksum verification", func(t *testing.T) {
+		// Arrange
+		fake := &fakeTartArchiver{content: "tvm-data"}
+		client, _ := createArchiveClient(t, fake)
+		archive := filepath.Join(t.TempDir(), "calf-dev.tvm")
+		if _, err := client.ExportArchive("calf-dev", archive, ExportOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(archive, []byte("tvm-dat"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		// Act
+		_, err := client.ImportArchive(archive, "", "")
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "does not match its manifest checksum") {
+			t.Errorf("ImportArchive() error = %v, want checksum error", err)
+		}
+	})
+
+	t.Run("when manifest is missing should return error", func(t *testing.T) {
+		// Arrange
+		client, _ := createArchiveClient(t, &fakeTartArchiver{})
+		archive := filepath.Join(t.TempDir(), "calf-dev.tvm")
+		if err := os.WriteFile(archive, []byte("tvm-data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		// Act
+		_, err := client.ImportArchive(archive, "", "")
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "manifest") {
+			t.Errorf("ImportArchive() error = %v, want missing manifest error", err)
+		}
+	})
+
+	t.Run("when target VM exists should return error without importing", func(t *testing.T) {
+		// Arrange
+		fake := &fakeTartArchiver{content: "tvm-data", vms: `[{"name":"calf-dev","state":"stopped"}]`}
+		client, _ := createArchiveClient(t, fake)
+		archive := filepath.Join(t.TempDir(), "calf-dev.tvm")
+		if _, err := client.ExportArchive("calf-dev", archive, ExportOptions{}); err != nil {
+			t.Fatal(err)
+		}
+
+		// Act
+		_, err := client.ImportArchive(archive, "", "")
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "already exists") {
+			t.Errorf("ImportArchive() error = %v, want already exists error", err)
+		}
+	})
+
+	t.Run("when manifest file name escapes VM directory should reject", func(t *testing.T) {
+		// Arrange
+		client, _ := createArchiveClient(t, &fakeTartArchiver{})
+		archive := filepath.Join(t.TempDir(), "evil.tvm")
+		if err := writeManifest(ManifestPath(archive), &ArchiveManifest{VM: "evil", Files: map[string]string{"../../x": "boom"}}); err != nil {
+			t.Fatal(err)
+		}
+
+		// Act
+		_, err := client.ImportArchive(archive, "", "")
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "invalid file name") {
+			t.Errorf("ImportArchive() error = %v, want invalid file name error", err)
+		}
+	})
+}
+
+func TestArchiveEncryption(t *testing.T) {
+	t.Run("when plaintext is exact multiple of chunk size should round trip", func(t *testing.T) {
+		// Arrange
+		aead, err := newArchiveAEAD("pw", []byte("0123456789abcdef"), 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		plain := bytes.Repeat([]byte{7}, 2*archiveChunkSize)
+		var sealed, opened bytes.Buffer
+
+		// Act
+		if err := encryptArchive(&sealed, bytes.NewReader(plain), aead); err != nil {
+			t.Fatal(err)
+		}
+		err = decryptArchive(&opened, bytes.NewReader(sealed.Bytes()), aead)
+
+		// Assert
+		if err != nil {
+			t.Fatalf("decryptArchive() unexpected error = %v", err)
+		}
+		if !bytes.Equal(opened.Bytes(), plain) {
+			t.Error("decryptArchive() did not round trip")
+		}
+	})
+
+	t.Run("when truncated at chunk boundary should fail", func(t *testing.T) {
+		// Arrange
+		aead, err := newArchiveAEAD("pw", []byte("0123456789abcdef"), 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var sealed bytes.Buffer
+		if err := encryptArchive(&sealed, bytes.NewReader(bytes.Repeat([]byte{7}, archiveChunkSize+10)), aead); err != nil {
+			t.Fatal(err)
+		}
+		truncated := sealed.Bytes()[:archiveChunkSize+aead.Overhead()]
+
+		// Act
+		err = decryptArchive(&bytes.Buffer{}, bytes.NewReader(truncated), aead)
+
+		// Assert
+		if err == nil {
+			t.Error("decryptArchive() should reject truncated archive")
+		}
+	})
+}
@@ -0,0 +1,160 @@
+// Package isolation provides VM isolation and management for CALF.
+package isolation
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// bootLogName is the current boot log in a VM's log directory.
+	bootLogName = "boot.log"
+
+	// serialLogName is the current serial console log in a VM's log directory.
+	serialLogName = "serial.log"
+
+	// defaultLogKeep is how many boot logs are kept per VM, including the current one.
+	defaultLogKeep = 5
+
+	// bootLogTailLines is how many log lines are included in boot failure errors.
+	bootLogTailLines = 20
+
+	// bootLogTailBytes bounds how much of a log is read to find its last lines,
+	// since serial console output can make logs large.
+	bootLogTailBytes = 64 * 1024
+)
+
+// LogStore keeps per-VM boot logs under ~/.calf/isolation/logs/{vm}/.
+// Each launch starts a new boot.log, and serial.log if the serial console is
+// captured; previous logs are rotated to boot.log.1, serial.log.1, and so on,
+// keeping a fixed number per VM.
+type LogStore struct {
+	homeDir string
+	keep    int
+	host    cacheHost
+}
+
+// NewDefaultLogStore creates a LogStore rooted at the current user's home directory.
+func NewDefaultLogStore() *LogStore {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		homeDir = ""
+	}
+	return NewLogStore(homeDir)
+}
+
+// NewLogStore creates a LogStore rooted at the given home directory.
+func NewLogStore(homeDir string) *LogStore {
+	return &LogStore{homeDir: homeDir, keep: defaultLogKeep, host: localCacheHost{}}
+}
+
+// NewRemoteLogStore creates a LogStore for VMs that tart runs on a remote
+// host. The logs are written and read in the host's home directory.
+func NewRemoteLogStore(host *RemoteHost) *LogStore {
+	return &LogStore{homeDir: "~", keep: defaultLogKeep, host: remoteCacheHost{host: host}}
+}
+
+// Path returns the path of the current boot log for a VM.
+func (s *LogStore) Path(vmName string) string {
+	return filepath.Join(s.homeDir, ".calf", "isolation", "logs", vmName, bootLogName)
+}
+
+// SerialPath returns the path of the current serial console log for a VM.
+func (s *LogStore) SerialPath(vmName string) string {
+	return filepath.Join(filepath.Dir(s.Path(vmName)), serialLogName)
+}
+
+// create rotates a VM's boot and serial logs and starts a new one with a header that
+// records when and how tart was launched. Returns the path of the new log,
+// for tart's output to be appended to.
+func (s *LogStore) create(vmName string, args []string) (string, error) {
+	path := s.Path(vmName)
+	for _, log := range []string{path, s.SerialPath(vmName)} {
+		if err := s.host.rotate(log, s.keep); err != nil {
+			return "", fmt.Errorf("failed to rotate log '%s': %w", log, err)
+		}
+	}
+
+	header := fmt.Sprintf("=== %s tart %s\n", time.Now().Format(time.RFC3339), strings.Join(args, " "))
+	if err := s.host.writeFile(path, []byte(header)); err != nil {
+		return "", fmt.Errorf("failed to create boot log '%s': %w", path, err)
+	}
+	return path, nil
+}
+
+// rotatedName returns the path of the nth previous log (0 is the current log).
+func rotatedName(path string, n int) string {
+	if n == 0 {
+		return path
+	}
+	return fmt.Sprintf("%s.%d", path, n)
+}
+
+// Tail returns up to n last lines of a VM's current boot log, followed by a
+// line naming the serial console log and up to n of its last lines, if the VM
+// has one. Returns no lines and no error if the VM has no logs.
+func (s *LogStore) Tail(vmName string, n int) ([]string, error) {
+	lines, err := s.tail(s.Path(vmName), n)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := s.tail(s.SerialPath(vmName), n)
+	if err != nil {
+		return nil, err
+	}
+	if len(serial) > 0 {
+		lines = append(lines, "--- "+serialLogName+" ---")
+		lines = append(lines, serial...)
+	}
+	return lines, nil
+}
+
+// tail returns up to n last lines of the log at path, or none if it does not
+// exist.
+func (s *LogStore) tail(path string, n int) ([]string, error) {
+	data, cut, err := s.host.readTail(path, bootLogTailBytes)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read log '%s': %w", path, err)
+	}
+
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if cut && len(lines) > 1 {
+		// The first line is probably cut mid-way.
+		lines = lines[1:]
+	}
+	if len(lines) == 1 && lines[0] == "" {
+		return nil, nil
+	}
+	return lines[max(len(lines)-n, 0):], nil
+}
+
+// bootLogHint returns log context to append to a boot failure error: the last
+// lines of the VM's boot and serial logs, and the boot log's path. Returns ""
+// if no log is available.
+func (c *TartClient) bootLogHint(vmName string) string {
+	if c.logs == nil {
+		return ""
+	}
+	lines, err := c.logs.Tail(vmName, bootLogTailLines)
+	if err != nil || len(lines) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	fmt.Fprintln(&b, "\nEnd of boot log:")
+	for _, line := range lines {
+		fmt.Fprintf(&b, "  %s\n", line)
+	}
+	fmt.Fprintf(&b, "Full log: %s", c.logs.Path(vmName))
+	if c.remote != nil {
+		fmt.Fprintf(&b, " on %s", c.remote.Target())
+	}
+	return b.String()
+}
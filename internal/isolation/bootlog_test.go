@@ -0,0 +1,191 @@
+// Package isolation provides VM isolation and management for CALF.
+package isolation
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// appendLog appends text to the log at path, as tart would.
+func appendLog(t *testing.T, path, text string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(text); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLogStoreRotation(t *testing.T) {
+	t.Run("when launched more times than kept should rotate and drop oldest", func(t *testing.T) {
+		// Arrange
+		store := NewLogStore(t.TempDir())
+
+		// Act
+		for i := range defaultLogKeep + 2 {
+			if _, err := store.create("calf-dev", []string{"run", fmt.Sprintf("boot-%d", i)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// Assert
+		current, _ := os.ReadFile(store.Path("calf-dev"))
+		if !strings.Contains(string(current), "boot-6") {
+			t.Errorf("current log = %q, want latest boot", current)
+		}
+		oldest, err := os.ReadFile(rotatedName(store.Path("calf-dev"), defaultLogKeep-1))
+		if err != nil || !strings.Contains(string(oldest), "boot-2") {
+			t.Errorf("oldest kept log = %q, %v, want boot-2", oldest, err)
+		}
+		if _, err := os.Stat(rotatedName(store.Path("calf-dev"), defaultLogKeep)); !os.IsNotExist(err) {
+			t.Errorf("expected no log beyond %d kept, stat err = %v", defaultLogKeep, err)
+		}
+	})
+
+	t.Run("when launched again should rotate the serial log", func(t *testing.T) {
+		// Arrange
+		store := NewLogStore(t.TempDir())
+		if _, err := store.create("calf-dev", []string{"run", "calf-dev"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(store.SerialPath("calf-dev"), []byte("first boot\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		// Act
+		_, err := store.create("calf-dev", []string{"run", "calf-dev"})
+
+		// Assert
+		if err != nil {
+			t.Fatalf("create() unexpected error = %v", err)
+		}
+		previous, err := os.ReadFile(rotatedName(store.SerialPath("calf-dev"), 1))
+		if err != nil || string(previous) != "first boot\n" {
+			t.Errorf("previous serial log = %q, %v, want first boot", previous, err)
+		}
+		if _, err := os.Stat(store.SerialPath("calf-dev")); !os.IsNotExist(err) {
+			t.Errorf("expected no current serial log before tart starts, stat err = %v", err)
+		}
+	})
+}
+
+func TestLogStoreTail(t *testing.T) {
+	t.Run("when log has more lines than requested should return last lines", func(t *testing.T) {
+		// Arrange
+		store := NewLogStore(t.TempDir())
+		path, err := store.create("calf-dev", []string{"run", "calf-dev"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		appendLog(t, path, "line 1\nline 2\nline 3\n")
+
+		// Act
+		lines, err := store.Tail("calf-dev", 2)
+
+		// Assert
+		if err != nil {
+			t.Fatalf("Tail() unexpected error = %v", err)
+		}
+		if !slices.Equal(lines, []string{"line 2", "line 3"}) {
+			t.Errorf("Tail() = %q, want last two lines", lines)
+		}
+	})
+
+	t.Run("when VM has a serial log should append its last lines", func(t *testing.T) {
+		// Arrange
+		store := NewLogStore(t.TempDir())
+		path, err := store.create("calf-dev", []string{"run", "calf-dev"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		appendLog(t, path, "tart: started\n")
+		if err := os.WriteFile(store.SerialPath("calf-dev"), []byte("kernel: 1\nkernel: 2\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		// Act
+		lines, err := store.Tail("calf-dev", 1)
+
+		// Assert
+		if err != nil {
+			t.Fatalf("Tail() unexpected error = %v", err)
+		}
+		if !slices.Equal(lines, []string{"tart: started", "--- serial.log ---", "kernel: 2"}) {
+			t.Errorf("Tail() = %q, want boot log then serial log", lines)
+		}
+	})
+
+	t.Run("when VM has no log should return no lines", func(t *testing.T) {
+		// Arrange
+		store := NewLogStore(t.TempDir())
+
+		// Act
+		lines, err := store.Tail("calf-dev", 5)
+
+		// Assert
+		if err != nil || len(lines) != 0 {
+			t.Errorf("Tail() = %q, %v, want no lines", lines, err)
+		}
+	})
+}
+
+func TestLaunchBootLog(t *testing.T) {
+	t.Run("when log store configured should pass log file to tart and write serial log next to it", func(t *testing.T) {
+		// Arrange
+		store := NewLogStore(t.TempDir())
+		var gotOutput string
+		var gotArgs []string
+		client := createTestClient(newMockCommandRunner(), WithLogStore(store), WithStartCommand(func(output string, args ...string) (int, error) {
+			gotOutput, gotArgs = output, args
+			appendLog(t, output, "serial: booting\n")
+			return 4242, nil
+		}))
+
+		// Act
+		_, err := client.Launch("calf-dev", LaunchOptions{Headless: true, Serial: true})
+
+		// Assert
+		if err != nil {
+			t.Fatalf("Launch() unexpected error = %v", err)
+		}
+		if gotOutput != store.Path("calf-dev") {
+			t.Errorf("Launch() output = %v, want boot log file", gotOutput)
+		}
+		if !slices.Contains(gotArgs, "--serial-path="+store.SerialPath("calf-dev")) {
+			t.Errorf("Launch() args = %v, want --serial-path in log directory", gotArgs)
+		}
+		data, _ := os.ReadFile(store.Path("calf-dev"))
+		if !strings.Contains(string(data), "serial: booting") {
+			t.Errorf("boot log = %q, want tart output", data)
+		}
+	})
+
+	t.Run("when IP times out should include boot log tail and path in error", func(t *testing.T) {
+		// Arrange
+		store := NewLogStore(t.TempDir())
+		path, err := store.create("calf-dev", []string{"run", "calf-dev"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		appendLog(t, path, "Error: disk image is corrupt\n")
+		client := createTestClient(newMockCommandRunner(), WithLogStore(store))
+
+		// Act
+		_, err = client.IP("calf-dev", 20*time.Millisecond)
+
+		// Assert
+		if err == nil {
+			t.Fatal("IP() expected timeout error, got nil")
+		}
+		if !strings.Contains(err.Error(), "Error: disk image is corrupt") || !strings.Contains(err.Error(), store.Path("calf-dev")) {
+			t.Errorf("IP() error = %v, want boot log tail and path", err)
+		}
+	})
+}
@@ -2,8 +2,10 @@
 package isolation
 
 import (
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -17,6 +19,7 @@ type CacheManager struct {
 	homeDir      string
 	cacheBaseDir string
 	writer       io.Writer
+	host         cacheHost
 }
 
 // CacheInfo contains information about a cache.
@@ -56,8 +59,13 @@ func getDiskUsage(path string) int64 {
 	if err != nil {
 		return 0
 	}
+	return parseDiskUsage(string(output))
+}
 
-	parts := strings.Fields(string(output))
+// parseDiskUsage returns the size in bytes reported by du -sk, or 0 if the
+// output cannot be parsed.
+func parseDiskUsage(output string) int64 {
+	parts := strings.Fields(output)
 	if len(parts) == 0 {
 		return 0
 	}
@@ -71,6 +79,131 @@ func getDiskUsage(path string) int64 {
 	return size * 1024
 }
 
+// cacheHost performs the file operations of a CacheManager, and of the mode
+// and boot log stores, on this machine or on a remote host. Missing paths are
+// reported as errors wrapping fs.ErrNotExist.
+type cacheHost interface {
+	// stat returns the modification time of path, following symlinks.
+	stat(path string) (time.Time, error)
+	// isSymlink reports whether path itself is a symlink.
+	isSymlink(path string) (bool, error)
+	// evalSymlinks returns path with all symlinks resolved.
+	evalSymlinks(path string) (string, error)
+	// subdirs returns the names of the directories in path, sorted.
+	subdirs(path string) ([]string, error)
+	mkdirAll(path string) error
+	// removeAll removes a tree, including read-only files.
+	removeAll(path string) error
+	// clearContents removes everything in a directory but the directory.
+	clearContents(path string) error
+	// diskUsage returns the size of a tree in bytes, or 0 on error.
+	diskUsage(path string) int64
+	// git runs git with args.
+	git(args ...string) error
+	readFile(path string) ([]byte, error)
+	// readTail returns up to the last n bytes of a file, and whether any
+	// bytes were left out.
+	readTail(path string, n int64) ([]byte, bool, error)
+	// writeFile replaces a file, creating its directory if needed.
+	writeFile(path string, data []byte) error
+	// rotate shifts path to path.1, path.1 to path.2 and so on, keeping keep
+	// files including path itself. Missing files are skipped.
+	rotate(path string, keep int) error
+}
+
+// localCacheHost performs cache operations on this machine.
+type localCacheHost struct{}
+
+func (localCacheHost) stat(path string) (time.Time, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
+
+func (localCacheHost) isSymlink(path string) (bool, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return false, err
+	}
+	return info.Mode()&os.ModeSymlink != 0, nil
+}
+
+func (localCacheHost) evalSymlinks(path string) (string, error) {
+	return filepath.EvalSymlinks(path)
+}
+
+func (localCacheHost) subdirs(path string) ([]string, error) {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	dirs := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			dirs = append(dirs, entry.Name())
+		}
+	}
+	return dirs, nil
+}
+
+func (localCacheHost) mkdirAll(path string) error {
+	return os.MkdirAll(path, 0755)
+}
+
+func (localCacheHost) removeAll(path string) error {
+	return removeAllWithPermFix(path)
+}
+
+func (localCacheHost) clearContents(path string) error {
+	return clearDirectoryContents(path)
+}
+
+func (localCacheHost) diskUsage(path string) int64 {
+	return getDiskUsage(path)
+}
+
+func (localCacheHost) git(args ...string) error {
+	return exec.Command("git", args...).Run()
+}
+
+func (localCacheHost) readFile(path string) ([]byte, error) {
+	return os.ReadFile(path)
+}
+
+func (localCacheHost) readTail(path string, n int64) ([]byte, bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, false, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, false, err
+	}
+	offset := max(info.Size()-n, 0)
+	data, err := io.ReadAll(io.NewSectionReader(f, offset, info.Size()-offset))
+	return data, offset > 0, err
+}
+
+func (localCacheHost) writeFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func (localCacheHost) rotate(path string, keep int) error {
+	for i := keep - 1; i >= 1; i-- {
+		if err := os.Rename(rotatedName(path, i-1), rotatedName(path, i)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
 // NewCacheManager creates a new CacheManager with default paths.
 func NewCacheManager() *CacheManager {
 	homeDir, err := os.UserHomeDir()
@@ -93,9 +226,26 @@ func NewCacheManagerWithWriter(homeDir, cacheBaseDir string, w io.Writer) *Cache
 		homeDir:      homeDir,
 		cacheBaseDir: cacheBaseDir,
 		writer:       w,
+		host:         localCacheHost{},
 	}
 }
 
+// NewRemoteCacheManager creates a CacheManager for the caches in the home
+// directory of a remote host, writing warnings to w. Sizes, clears and git
+// updates all run on the host.
+func NewRemoteCacheManager(host *RemoteHost, w io.Writer) (*CacheManager, error) {
+	homeDir, err := host.Output(`printf '%s' "$HOME"`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find home directory on %s: %w", host.Target(), err)
+	}
+	if homeDir == "" {
+		return nil, fmt.Errorf("failed to find home directory on %s", host.Target())
+	}
+	cm := NewCacheManagerWithWriter(homeDir, filepath.Join(homeDir, ".calf-cache"), w)
+	cm.host = remoteCacheHost{host: host}
+	return cm, nil
+}
+
 // getHomebrewCachePath returns the host path for Homebrew cache.
 func (c *CacheManager) getHomebrewCachePath() string {
 	return filepath.Join(c.cacheBaseDir, homebrewCacheDir)
@@ -131,17 +281,17 @@ func (c *CacheManager) SetupHomebrewCache() error {
 
 	hostCacheDir := c.getHomebrewCachePath()
 
-	if err := os.MkdirAll(hostCacheDir, 0755); err != nil {
+	if err := c.host.mkdirAll(hostCacheDir); err != nil {
 		return fmt.Errorf("failed to create host cache directory: %w", err)
 	}
 
 	downloadsDir := filepath.Join(hostCacheDir, homebrewDownloadsDir)
-	if err := os.MkdirAll(downloadsDir, 0755); err != nil {
+	if err := c.host.mkdirAll(downloadsDir); err != nil {
 		return fmt.Errorf("failed to create downloads directory: %w", err)
 	}
 
 	caskDir := filepath.Join(hostCacheDir, homebrewCaskDir)
-	if err := os.MkdirAll(caskDir, 0755); err != nil {
+	if err := c.host.mkdirAll(caskDir); err != nil {
 		return fmt.Errorf("failed to create Cask directory: %w", err)
 	}
 
@@ -158,7 +308,7 @@ func (c *CacheManager) SetupVMHomebrewCache() []string {
 	}
 
 	hostCacheDir := c.getHomebrewCachePath()
-	if _, err := os.Stat(hostCacheDir); os.IsNotExist(err) {
+	if _, err := c.host.stat(hostCacheDir); errors.Is(err, fs.ErrNotExist) {
 		return nil
 	}
 
@@ -189,9 +339,9 @@ func (c *CacheManager) getCacheInfo(cachePath string) (*CacheInfo, error) {
 		pathForSize = realPath
 	}
 
-	info, err := os.Stat(cachePath)
+	modTime, err := c.host.stat(cachePath)
 	if err != nil {
-		if os.IsNotExist(err) {
+		if errors.Is(err, fs.ErrNotExist) {
 			return &CacheInfo{
 				Path:      cachePath,
 				Size:      0,
@@ -203,9 +353,9 @@ func (c *CacheManager) getCacheInfo(cachePath string) (*CacheInfo, error) {
 
 	return &CacheInfo{
 		Path:       cachePath,
-		Size:       getDiskUsage(pathForSize),
+		Size:       c.host.diskUsage(pathForSize),
 		Available:  true,
-		LastAccess: info.ModTime(),
+		LastAccess: modTime,
 	}, nil
 }
 
@@ -225,7 +375,7 @@ func (c *CacheManager) SetupNpmCache() error {
 
 	hostCacheDir := c.getNpmCachePath()
 
-	if err := os.MkdirAll(hostCacheDir, 0755); err != nil {
+	if err := c.host.mkdirAll(hostCacheDir); err != nil {
 		return fmt.Errorf("failed to create host npm cache directory: %w", err)
 	}
 
@@ -242,7 +392,7 @@ func (c *CacheManager) SetupVMNpmCache() []string {
 	}
 
 	hostCacheDir := c.getNpmCachePath()
-	if _, err := os.Stat(hostCacheDir); os.IsNotExist(err) {
+	if _, err := c.host.stat(hostCacheDir); errors.Is(err, fs.ErrNotExist) {
 		return nil
 	}
 
@@ -276,17 +426,17 @@ func (c *CacheManager) SetupGoCache() error {
 
 	hostCacheDir := c.getGoCachePath()
 
-	if err := os.MkdirAll(hostCacheDir, 0755); err != nil {
+	if err := c.host.mkdirAll(hostCacheDir); err != nil {
 		return fmt.Errorf("failed to create host Go cache directory: %w", err)
 	}
 
 	pkgModDir := filepath.Join(hostCacheDir, "pkg", "mod")
-	if err := os.MkdirAll(pkgModDir, 0755); err != nil {
+	if err := c.host.mkdirAll(pkgModDir); err != nil {
 		return fmt.Errorf("failed to create pkg/mod directory: %w", err)
 	}
 
 	pkgSumdbDir := filepath.Join(hostCacheDir, "pkg", "sumdb")
-	if err := os.MkdirAll(pkgSumdbDir, 0755); err != nil {
+	if err := c.host.mkdirAll(pkgSumdbDir); err != nil {
 		return fmt.Errorf("failed to create pkg/sumdb directory: %w", err)
 	}
 
@@ -303,7 +453,7 @@ func (c *CacheManager) SetupVMGoCache() []string {
 	}
 
 	hostCacheDir := c.getGoCachePath()
-	if _, err := os.Stat(hostCacheDir); os.IsNotExist(err) {
+	if _, err := c.host.stat(hostCacheDir); errors.Is(err, fs.ErrNotExist) {
 		return nil
 	}
 
@@ -349,21 +499,21 @@ func (c *CacheManager) resolveRealCachePath(localPath string) (string, error) {
 	}
 
 	// Check if path exists
-	info, err := os.Lstat(localPath) // Use Lstat to not follow symlinks yet
+	isSymlink, err := c.host.isSymlink(localPath) // Do not follow symlinks yet
 	if err != nil {
-		if os.IsNotExist(err) {
+		if errors.Is(err, fs.ErrNotExist) {
 			return "", nil // Path doesn't exist
 		}
 		return "", fmt.Errorf("failed to stat path: %w", err)
 	}
 
 	// If it's a symlink, resolve it to find where data actually lives
-	if info.Mode()&os.ModeSymlink != 0 {
-		target, err := filepath.EvalSymlinks(localPath)
+	if isSymlink {
+		target, err := c.host.evalSymlinks(localPath)
 		if err != nil {
 			// If the symlink exists but its target doesn't exist, treat as unavailable
 			// This happens when ~/.calf-cache/{type} is a symlink to a shared volume that isn't mounted
-			if os.IsNotExist(err) {
+			if errors.Is(err, fs.ErrNotExist) {
 				return "", nil
 			}
 			return "", fmt.Errorf("failed to resolve symlink: %w", err)
@@ -385,7 +535,7 @@ func (c *CacheManager) SetupGitCache() error {
 
 	hostCacheDir := c.getGitCachePath()
 
-	if err := os.MkdirAll(hostCacheDir, 0755); err != nil {
+	if err := c.host.mkdirAll(hostCacheDir); err != nil {
 		return fmt.Errorf("failed to create host git cache directory: %w", err)
 	}
 
@@ -402,7 +552,7 @@ func (c *CacheManager) SetupVMGitCache() []string {
 	}
 
 	hostCacheDir := c.getGitCachePath()
-	if _, err := os.Stat(hostCacheDir); os.IsNotExist(err) {
+	if _, err := c.host.stat(hostCacheDir); errors.Is(err, fs.ErrNotExist) {
 		return nil
 	}
 
@@ -428,21 +578,14 @@ func (c *CacheManager) GetGitCacheInfo() (*CacheInfo, error) {
 func (c *CacheManager) GetCachedGitRepos() ([]string, error) {
 	cachePath := c.getGitCachePath()
 
-	entries, err := os.ReadDir(cachePath)
+	repos, err := c.host.subdirs(cachePath)
 	if err != nil {
-		if os.IsNotExist(err) {
+		if errors.Is(err, fs.ErrNotExist) {
 			return []string{}, nil
 		}
 		return nil, fmt.Errorf("failed to read git cache directory: %w", err)
 	}
 
-	repos := []string{}
-	for _, entry := range entries {
-		if entry.IsDir() {
-			repos = append(repos, entry.Name())
-		}
-	}
-
 	return repos, nil
 }
 
@@ -457,16 +600,15 @@ func (c *CacheManager) CacheGitRepo(repoURL, repoName string) (bool, error) {
 
 	repoCacheDir := filepath.Join(c.getGitCachePath(), repoName)
 
-	if _, err := os.Stat(repoCacheDir); err == nil {
+	if _, err := c.host.stat(repoCacheDir); err == nil {
 		return false, nil
 	}
 
-	if err := os.MkdirAll(filepath.Dir(repoCacheDir), 0755); err != nil {
+	if err := c.host.mkdirAll(filepath.Dir(repoCacheDir)); err != nil {
 		return false, fmt.Errorf("failed to create cache directory: %w", err)
 	}
 
-	cmd := exec.Command("git", "clone", repoURL, repoCacheDir)
-	if err := cmd.Run(); err != nil {
+	if err := c.host.git("clone", repoURL, repoCacheDir); err != nil {
 		return false, fmt.Errorf("failed to clone repo %s: %w", repoURL, err)
 	}
 
@@ -489,11 +631,11 @@ func (c *CacheManager) UpdateGitRepos() (int, error) {
 	failed := 0
 	for _, repo := range repos {
 		repoPath := filepath.Join(c.getGitCachePath(), repo)
-		if err := exec.Command("git", "-C", repoPath, "rev-parse", "--git-dir").Run(); err != nil {
+		if err := c.host.git("-C", repoPath, "rev-parse", "--git-dir"); err != nil {
 			// Not a git repository — skip silently
 			continue
 		}
-		if err := exec.Command("git", "-C", repoPath, "fetch", "--all").Run(); err != nil {
+		if err := c.host.git("-C", repoPath, "fetch", "--all"); err != nil {
 			fmt.Fprintf(c.writer, "Warning: failed to update git cache for %s: %v\n", repo, err)
 			failed++
 			continue
@@ -689,17 +831,15 @@ func (c *CacheManager) Clear(cacheType string, dryRun bool) (bool, error) {
 	}
 
 	// Check if local path exists
-	info, err := os.Lstat(localCachePath) // Use Lstat to detect symlinks
+	// Check if this is a symlink (e.g., inside a VM pointing to shared volume)
+	isSymlink, err := c.host.isSymlink(localCachePath)
 	if err != nil {
-		if os.IsNotExist(err) {
+		if errors.Is(err, fs.ErrNotExist) {
 			return false, nil // Cache doesn't exist
 		}
 		return false, fmt.Errorf("failed to check cache directory: %w", err)
 	}
 
-	// Check if this is a symlink (e.g., inside a VM pointing to shared volume)
-	isSymlink := info.Mode()&os.ModeSymlink != 0
-
 	// Resolve symlink to find where data actually lives
 	realPath, err := c.resolveRealCachePath(localCachePath)
 	if err != nil {
@@ -711,14 +851,14 @@ func (c *CacheManager) Clear(cacheType string, dryRun bool) (bool, error) {
 			// For symlinked caches (VM scenario):
 			// - Clear contents of the target directory (shared volume)
 			// - Preserve the symlink itself so cache continues working after clear
-			if err := clearDirectoryContents(realPath); err != nil {
+			if err := c.host.clearContents(realPath); err != nil {
 				return false, fmt.Errorf("failed to clear cache contents: %w", err)
 			}
 		} else {
 			// For regular directory caches (host scenario):
 			// - Remove the entire directory
 			// - Recreate empty structure
-			if err := removeAllWithPermFix(localCachePath); err != nil {
+			if err := c.host.removeAll(localCachePath); err != nil {
 				return false, fmt.Errorf("failed to remove cache directory: %w", err)
 			}
 
@@ -0,0 +1,268 @@
+// Package isolation provides VM isolation and management for CALF.
+package isolation
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// imagesFileName records the OCI images pushed or pulled by calf.
+	imagesFileName = "images.yaml"
+
+	// digestPrefix is the only digest algorithm Tart uses for OCI manifests.
+	digestPrefix = "sha256:"
+)
+
+// ImageRef is a parsed OCI image reference such as
+// ghcr.io/org/calf-init:latest or ghcr.io/org/calf-init@sha256:....
+type ImageRef struct {
+	// Repository is the registry host and repository path, e.g. ghcr.io/org/calf-init.
+	Repository string
+	// Tag is the image tag. Empty when the reference is pinned by digest.
+	Tag string
+	// Digest is the manifest digest. Empty when the reference uses a tag.
+	Digest string
+}
+
+// ParseImageRef parses an OCI image reference. References without a tag or
+// digest default to the latest tag. The repository must include a registry host.
+func ParseImageRef(ref string) (ImageRef, error) {
+	repo, digest, pinned := strings.Cut(ref, "@")
+	if pinned && !isDigest(digest) {
+		return ImageRef{}, fmt.Errorf("invalid image reference '%s': digest must be %s followed by 64 hex characters", ref, digestPrefix)
+	}
+
+	tag := ""
+	if i := strings.LastIndex(repo, ":"); i > strings.LastIndex(repo, "/") {
+		repo, tag = repo[:i], repo[i+1:]
+	}
+	if !pinned && tag == "" {
+		tag = "latest"
+	}
+
+	host, path, ok := strings.Cut(repo, "/")
+	if !ok || path == "" || (!strings.ContainsAny(host, ".:") && host != "localhost") {
+		return ImageRef{}, fmt.Errorf("invalid image reference '%s': must include a registry host, e.g. ghcr.io/org/image:tag", ref)
+	}
+	if pinned && tag != "" {
+		return ImageRef{}, fmt.Errorf("invalid image reference '%s': use either a tag or a digest, not both", ref)
+	}
+
+	return ImageRef{Repository: repo, Tag: tag, Digest: digest}, nil
+}
+
+// String returns the reference in repository:tag or repository@digest form.
+func (r ImageRef) String() string {
+	if r.Digest != "" {
+		return r.Repository + "@" + r.Digest
+	}
+	return r.Repository + ":" + r.Tag
+}
+
+// Pinned returns the digest-pinned form of the reference for the given digest.
+func (r ImageRef) Pinned(digest string) ImageRef {
+	return ImageRef{Repository: r.Repository, Digest: digest}
+}
+
+// isDigest reports whether s is a well-formed sha256 digest.
+func isDigest(s string) bool {
+	hex, ok := strings.CutPrefix(s, digestPrefix)
+	if !ok || len(hex) != 64 {
+		return false
+	}
+	return !strings.ContainsFunc(hex, func(r rune) bool {
+		return !(r >= '0' && r <= '9' || r >= 'a' && r <= 'f')
+	})
+}
+
+// Login stores registry credentials in Tart's keychain entry for host.
+// The password is passed on stdin so it never appears in the process list.
+// Set insecure for plain HTTP registries such as a local test registry.
+func (c *TartClient) Login(host, username, password string, insecure bool) error {
+	if err := c.ensureInstalled(); err != nil {
+		return err
+	}
+	args := []string{"login", host, "--username", username, "--password-stdin"}
+	if insecure {
+		args = append(args, "--insecure")
+	}
+	if _, err := c.inputCommand(password+"\n", args...); err != nil {
+		return fmt.Errorf("failed to log in to %s: %w", host, err)
+	}
+	return nil
+}
+
+// Push uploads a local VM to one or more registry references. The pushed
+// image is also stored in Tart's OCI cache, so its digest can be resolved
+// with ImageDigest afterwards.
+func (c *TartClient) Push(name string, remotes []string, insecure bool) error {
+	if err := c.ensureInstalled(); err != nil {
+		return err
+	}
+	if len(remotes) == 0 {
+		return fmt.Errorf("push of VM %s requires at least one remote reference", name)
+	}
+	args := append([]string{"push", name}, remotes...)
+	args = append(args, "--populate-cache")
+	if insecure {
+		args = append(args, "--insecure")
+	}
+	if _, err := c.runCommand(args...); err != nil {
+		return fmt.Errorf("failed to push VM %s: %w", name, err)
+	}
+	return nil
+}
+
+// PullWithProgress downloads an image from a registry into Tart's OCI cache,
+// streaming tart's output so that download progress is reported as it
+// happens. Pulling a digest-pinned reference makes Tart verify the downloaded
+// content against it.
+func (c *TartClient) PullWithProgress(remote string, insecure bool, progress ProgressFunc) error {
+	defer c.states.invalidate()
+	if err := c.ensureInstalled(); err != nil {
+		return err
+	}
+	args := []string{"pull", remote}
+	if insecure {
+		args = append(args, "--insecure")
+	}
+	if err := c.runWithProgress(progress, args...); err != nil {
+		return fmt.Errorf("failed to pull image %s: %w", remote, err)
+	}
+	return nil
+}
+
+// ImageDigest returns the manifest digest of a cached OCI image. Tart stores
+// each pulled manifest in a directory named after its digest under
+// $TART_HOME/cache/OCIs/<repository>/, with tags as symlinks to it.
+// The image must have been pulled or pushed first.
+func (c *TartClient) ImageDigest(ref ImageRef) (string, error) {
+	if ref.Digest != "" {
+		return ref.Digest, nil
+	}
+
+	tagPath := filepath.Join(c.tartHome, "cache", "OCIs", filepath.FromSlash(ref.Repository), ref.Tag)
+	target, err := os.Readlink(tagPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("image %s is not in the Tart cache; pull it first", ref)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve digest of %s: %w", ref, err)
+	}
+
+	digest := filepath.Base(target)
+	if !isDigest(digest) {
+		return "", fmt.Errorf("failed to resolve digest of %s: unexpected cache entry '%s'", ref, target)
+	}
+	return digest, nil
+}
+
+// ImageRecord records the digest of an image pushed or pulled by calf.
+type ImageRecord struct {
+	// Reference is the tag or digest reference the image was pushed or pulled as.
+	Reference string `yaml:"reference"`
+	// Digest is the manifest digest the reference resolved to.
+	Digest string `yaml:"digest"`
+	// Source is "push" or "pull".
+	Source string `yaml:"source"`
+	// Time is when the image was last pushed or pulled.
+	Time time.Time `yaml:"time"`
+}
+
+// Pinned returns the digest-pinned reference for this record, suitable for
+// use as base_image so every engineer gets exactly the same image.
+func (r ImageRecord) Pinned() string {
+	ref, err := ParseImageRef(r.Reference)
+	if err != nil {
+		return r.Reference
+	}
+	return ref.Pinned(r.Digest).String()
+}
+
+// ImageStore persists image digest records in ~/.calf/isolation/images.yaml.
+type ImageStore struct {
+	homeDir string
+}
+
+// NewDefaultImageStore creates an ImageStore rooted at the current user's home directory.
+func NewDefaultImageStore() *ImageStore {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		homeDir = ""
+	}
+	return NewImageStore(homeDir)
+}
+
+// NewImageStore creates an ImageStore rooted at the given home directory.
+func NewImageStore(homeDir string) *ImageStore {
+	return &ImageStore{homeDir: homeDir}
+}
+
+// path returns the path of the image records file.
+func (s *ImageStore) path() string {
+	return filepath.Join(s.homeDir, ".calf", "isolation", imagesFileName)
+}
+
+// List returns all image records sorted by reference.
+// Returns an empty list if no images have been recorded.
+func (s *ImageStore) List() ([]ImageRecord, error) {
+	path := s.path()
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image records '%s': %w", path, err)
+	}
+
+	var records []ImageRecord
+	if err := yaml.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("failed to parse image records '%s': %w", path, err)
+	}
+	return records, nil
+}
+
+// Get returns the record for a reference, or false if none exists.
+func (s *ImageStore) Get(reference string) (ImageRecord, bool, error) {
+	records, err := s.List()
+	if err != nil {
+		return ImageRecord{}, false, err
+	}
+	i := slices.IndexFunc(records, func(r ImageRecord) bool { return r.Reference == reference })
+	if i < 0 {
+		return ImageRecord{}, false, nil
+	}
+	return records[i], true, nil
+}
+
+// Record adds or replaces the record for rec.Reference.
+func (s *ImageStore) Record(rec ImageRecord) error {
+	records, err := s.List()
+	if err != nil {
+		return err
+	}
+	records = slices.DeleteFunc(records, func(r ImageRecord) bool { return r.Reference == rec.Reference })
+	records = append(records, rec)
+	slices.SortFunc(records, func(a, b ImageRecord) int { return strings.Compare(a.Reference, b.Reference) })
+
+	path := s.path()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create isolation config directory: %w", err)
+	}
+	data, err := yaml.Marshal(records)
+	if err != nil {
+		return fmt.Errorf("failed to encode image records: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write image records '%s': %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,325 @@
+// Package isolation provides VM isolation and management for CALF.
+package isolation
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testDigest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+// cacheImage simulates Tart's OCI cache layout for a pulled image: a digest
+// directory with the tag as a symlink to it.
+func cacheImage(t *testing.T, tartHome, repository, tag, digest string) {
+	t.Helper()
+	repoDir := filepath.Join(tartHome, "cache", "OCIs", filepath.FromSlash(repository))
+	if err := os.MkdirAll(filepath.Join(repoDir, digest), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(repoDir, digest), filepath.Join(repoDir, tag)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseImageRef(t *testing.T) {
+	t.Run("when reference has tag should split repository and tag", func(t *testing.T) {
+		// Act
+		ref, err := ParseImageRef("ghcr.io/org/calf-init:v2")
+
+		// Assert
+		if err != nil {
+			t.Fatalf("ParseImageRef() unexpected error = %v", err)
+		}
+		if ref.Repository != "ghcr.io/org/calf-init" || ref.Tag != "v2" || ref.Digest != "" {
+			t.Errorf("ParseImageRef() = %+v, want repository ghcr.io/org/calf-init tag v2", ref)
+		}
+	})
+
+	t.Run("when reference has no tag should default to latest", func(t *testing.T) {
+		// Act
+		ref, err := ParseImageRef("ghcr.io/org/calf-init")
+
+		// Assert
+		if err != nil {
+			t.Fatalf("ParseImageRef() unexpected error = %v", err)
+		}
+		if ref.String() != "ghcr.io/org/calf-init:latest" {
+			t.Errorf("ParseImageRef().String() = %q, want latest tag", ref.String())
+		}
+	})
+
+	t.Run("when registry has port should not treat port as tag", func(t *testing.T) {
+		// Act
+		ref, err := ParseImageRef("localhost:5000/calf-init")
+
+		// Assert
+		if err != nil {
+			t.Fatalf("ParseImageRef() unexpected error = %v", err)
+		}
+		if ref.Repository != "localhost:5000/calf-init" || ref.Tag != "latest" {
+			t.Errorf("ParseImageRef() = %+v, want localhost:5000/calf-init:latest", ref)
+		}
+	})
+
+	t.Run("when reference is pinned by digest should keep digest", func(t *testing.T) {
+		// Act
+		ref, err := ParseImageRef("ghcr.io/org/calf-init@" + testDigest)
+
+		// Assert
+		if err != nil {
+			t.Fatalf("ParseImageRef() unexpected error = %v", err)
+		}
+		if ref.Digest != testDigest || ref.Tag != "" {
+			t.Errorf("ParseImageRef() = %+v, want digest only", ref)
+		}
+	})
+
+	t.Run("when digest is malformed should return error", func(t *testing.T) {
+		// Act
+		_, err := ParseImageRef("ghcr.io/org/calf-init@sha256:abc")
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "64 hex characters") {
+			t.Errorf("ParseImageRef() error = %v, want malformed digest error", err)
+		}
+	})
+
+	t.Run("when registry host is missing should return error", func(t *testing.T) {
+		// Act
+		_, err := ParseImageRef("org/calf-init:latest")
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "must include a registry host") {
+			t.Errorf("ParseImageRef() error = %v, want missing host error", err)
+		}
+	})
+}
+
+func TestLogin(t *testing.T) {
+	t.Run("when login succeeds should pass password on stdin only", func(t *testing.T) {
+		// Arrange
+		mock := newMockCommandRunner()
+		var gotInput string
+		var gotArgs []string
+		client := createTestClient(mock, WithInputCommand(func(input string, args ...string) (string, error) {
+			gotInput, gotArgs = input, args
+			return "", nil
+		}))
+
+		// Act
+		err := client.Login("localhost:5000", "ci", "s3cret", true)
+
+		// Assert
+		if err != nil {
+			t.Fatalf("Login() unexpected error = %v", err)
+		}
+		expected := []string{"login", "localhost:5000", "--username", "ci", "--password-stdin", "--insecure"}
+		if !slices.Equal(gotArgs, expected) {
+			t.Errorf("Login() args = %v, want %v", gotArgs, expected)
+		}
+		if gotInput != "s3cret\n" {
+			t.Errorf("Login() stdin = %q, want password line", gotInput)
+		}
+	})
+
+	t.Run("when login fails should return wrapped error", func(t *testing.T) {
+		// Arrange
+		mock := newMockCommandRunner()
+		client := createTestClient(mock, WithInputCommand(func(input string, args ...string) (string, error) {
+			return "", fmt.Errorf("unauthorized")
+		}))
+
+		// Act
+		err := client.Login("ghcr.io", "ci", "wrong", false)
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "failed to log in to ghcr.io") {
+			t.Errorf("Login() error = %v, want wrapped login error", err)
+		}
+	})
+}
+
+func TestPush(t *testing.T) {
+	t.Run("when push succeeds should push to all remotes and populate cache", func(t *testing.T) {
+		// Arrange
+		mock := newMockCommandRunner()
+		client := createTestClient(mock)
+
+		// Act
+		err := client.Push("calf-init", []string{"ghcr.io/org/calf-init:v2", "ghcr.io/org/calf-init:latest"}, false)
+
+		// Assert
+		if err != nil {
+			t.Fatalf("Push() unexpected error = %v", err)
+		}
+		expected := []string{"tart", "push", "calf-init", "ghcr.io/org/calf-init:v2", "ghcr.io/org/calf-init:latest", "--populate-cache"}
+		if !slices.Equal(mock.commands[0], expected) {
+			t.Errorf("Push() command = %v, want %v", mock.commands[0], expected)
+		}
+	})
+
+	t.Run("when no remotes should return error without running tart", func(t *testing.T) {
+		// Arrange
+		mock := newMockCommandRunner()
+		client := createTestClient(mock)
+
+		// Act
+		err := client.Push("calf-init", nil, false)
+
+		// Assert
+		if err == nil {
+			t.Fatal("Push() expected error, got nil")
+		}
+		if len(mock.commands) != 0 {
+			t.Errorf("Push() should not run tart, got %v", mock.commands)
+		}
+	})
+}
+
+func TestPullWithProgress(t *testing.T) {
+	t.Run("when registry is insecure should pass insecure flag", func(t *testing.T) {
+		// Arrange
+		mock := newMockCommandRunner()
+		client := createTestClient(mock)
+
+		// Act
+		err := client.PullWithProgress("localhost:5000/calf-init:latest", true, nil)
+
+		// Assert
+		if err != nil {
+			t.Fatalf("PullWithProgress() unexpected error = %v", err)
+		}
+		expected := []string{"tart", "pull", "localhost:5000/calf-init:latest", "--insecure"}
+		if !slices.Equal(mock.commands[0], expected) {
+			t.Errorf("PullWithProgress() command = %v, want %v", mock.commands[0], expected)
+		}
+	})
+
+	t.Run("when pull fails should return wrapped error", func(t *testing.T) {
+		// Arrange
+		mock := newMockCommandRunner()
+		mock.addError("pull ghcr.io/org/calf-init:latest", fmt.Errorf("manifest unknown"))
+		client := createTestClient(mock)
+
+		// Act
+		err := client.PullWithProgress("ghcr.io/org/calf-init:latest", false, nil)
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "failed to pull image ghcr.io/org/calf-init:latest") {
+			t.Errorf("PullWithProgress() error = %v, want wrapped pull error", err)
+		}
+	})
+}
+
+func TestImageDigest(t *testing.T) {
+	t.Run("when tag is cached should resolve digest from symlink", func(t *testing.T) {
+		// Arrange
+		tartHome := t.TempDir()
+		cacheImage(t, tartHome, "ghcr.io/org/calf-init", "latest", testDigest)
+		client := createTestClient(newMockCommandRunner(), WithTartHome(tartHome))
+		ref, _ := ParseImageRef("ghcr.io/org/calf-init:latest")
+
+		// Act
+		digest, err := client.ImageDigest(ref)
+
+		// Assert
+		if err != nil {
+			t.Fatalf("ImageDigest() unexpected error = %v", err)
+		}
+		if digest != testDigest {
+			t.Errorf("ImageDigest() = %q, want %q", digest, testDigest)
+		}
+	})
+
+	t.Run("when tag is not cached should return error suggesting pull", func(t *testing.T) {
+		// Arrange
+		client := createTestClient(newMockCommandRunner(), WithTartHome(t.TempDir()))
+		ref, _ := ParseImageRef("ghcr.io/org/calf-init:latest")
+
+		// Act
+		_, err := client.ImageDigest(ref)
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "pull it first") {
+			t.Errorf("ImageDigest() error = %v, want not cached error", err)
+		}
+	})
+
+	t.Run("when reference is pinned should return its digest", func(t *testing.T) {
+		// Arrange
+		client := createTestClient(newMockCommandRunner(), WithTartHome(t.TempDir()))
+		ref, _ := ParseImageRef("ghcr.io/org/calf-init@" + testDigest)
+
+		// Act
+		digest, err := client.ImageDigest(ref)
+
+		// Assert
+		if err != nil || digest != testDigest {
+			t.Errorf("ImageDigest() = %q, %v, want %q", digest, err, testDigest)
+		}
+	})
+}
+
+func TestImageStore(t *testing.T) {
+	t.Run("when no records exist should return empty list", func(t *testing.T) {
+		// Arrange
+		store := NewImageStore(t.TempDir())
+
+		// Act
+		records, err := store.List()
+
+		// Assert
+		if err != nil {
+			t.Fatalf("List() unexpected error = %v", err)
+		}
+		if len(records) != 0 {
+			t.Errorf("List() = %v, want empty", records)
+		}
+	})
+
+	t.Run("when reference recorded twice should keep latest record only", func(t *testing.T) {
+		// Arrange
+		store := NewImageStore(t.TempDir())
+		first := ImageRecord{Reference: "ghcr.io/org/calf-init:latest", Digest: "sha256:old", Source: "pull", Time: time.Unix(1, 0).UTC()}
+		second := ImageRecord{Reference: "ghcr.io/org/calf-init:latest", Digest: testDigest, Source: "push", Time: time.Unix(2, 0).UTC()}
+
+		// Act
+		if err := store.Record(first); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Record(second); err != nil {
+			t.Fatal(err)
+		}
+		got, found, err := store.Get("ghcr.io/org/calf-init:latest")
+
+		// Assert
+		if err != nil || !found {
+			t.Fatalf("Get() found = %v, err = %v", found, err)
+		}
+		if got != second {
+			t.Errorf("Get() = %+v, want %+v", got, second)
+		}
+		records, _ := store.List()
+		if len(records) != 1 {
+			t.Errorf("List() = %v, want one record", records)
+		}
+	})
+
+	t.Run("when record is pinned should return digest reference", func(t *testing.T) {
+		// Arrange
+		rec := ImageRecord{Reference: "ghcr.io/org/calf-init:v2", Digest: testDigest}
+
+		// Act
+		got := rec.Pinned()
+
+		// Assert
+		if got != "ghcr.io/org/calf-init@"+testDigest {
+			t.Errorf("Pinned() = %q, want digest reference", got)
+		}
+	})
+}
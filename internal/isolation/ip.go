@@ -0,0 +1,206 @@
+// Package isolation provides VM isolation and management for CALF.
+package isolation
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultMaxPollInterval caps the exponential IP polling backoff.
+	defaultMaxPollInterval = 10 * time.Second
+
+	// defaultPollJitter randomizes each delay by up to ±20%.
+	defaultPollJitter = 0.2
+
+	// defaultSSHPort is the port probed when waiting for SSH.
+	defaultSSHPort = 22
+
+	// sshDialTimeout bounds each SSH reachability probe.
+	sshDialTimeout = 2 * time.Second
+)
+
+// IPResolver selects how tart discovers a VM's IP address.
+type IPResolver string
+
+const (
+	// ResolverDefault uses tart's default resolver (DHCP lease lookup).
+	ResolverDefault IPResolver = ""
+
+	// ResolverDHCP reads the host's DHCP lease file. Works for NAT and softnet.
+	ResolverDHCP IPResolver = "dhcp"
+
+	// ResolverARP looks the VM's MAC up in the host ARP table. Required for
+	// bridged networking and nested setups, where the host hands out no lease.
+	ResolverARP IPResolver = "arp"
+)
+
+// Resolver returns the IP resolver suited to these network options:
+// ARP for bridged networking, tart's default otherwise.
+func (n NetworkOptions) Resolver() IPResolver {
+	if n.Mode == NetworkBridged {
+		return ResolverARP
+	}
+	return ResolverDefault
+}
+
+// IPWaitPhase identifies what ResolveIP is waiting for.
+type IPWaitPhase string
+
+const (
+	// IPWaitAddress is reported while polling tart for the VM's IP.
+	IPWaitAddress IPWaitPhase = "ip"
+
+	// IPWaitSSH is reported while probing the VM's SSH port.
+	IPWaitSSH IPWaitPhase = "ssh"
+)
+
+// IPWaitEvent reports one unsuccessful resolution attempt.
+type IPWaitEvent struct {
+	// Phase is what is being waited for.
+	Phase IPWaitPhase
+	// Attempt is the 1-based attempt number within the phase.
+	Attempt int
+	// Elapsed is the time since ResolveIP was called.
+	Elapsed time.Duration
+	// NextDelay is how long until the next attempt.
+	NextDelay time.Duration
+	// IP is the resolved address during the SSH phase.
+	IP string
+	// Err is why the attempt failed, if tart or the dial returned an error.
+	Err error
+}
+
+// IPOptions configures ResolveIP. Zero values select the client's defaults.
+type IPOptions struct {
+	// Resolver selects tart's IP resolver.
+	Resolver IPResolver
+	// Timeout bounds the whole wait, including SSH. Defaults to the client's poll timeout.
+	Timeout time.Duration
+	// InitialInterval is the first retry delay. Defaults to the client's poll interval.
+	InitialInterval time.Duration
+	// MaxInterval caps the exponentially growing delay.
+	MaxInterval time.Duration
+	// Jitter randomizes each delay by up to this fraction (0 to 1).
+	// Defaults to 0.2; set a negative value to disable.
+	Jitter float64
+	// WaitForSSH keeps waiting after the IP is found until the SSH port accepts connections.
+	WaitForSSH bool
+	// SSHPort is the port probed when WaitForSSH is set. Defaults to 22.
+	SSHPort int
+	// OnWait is called after each unsuccessful attempt, before sleeping.
+	OnWait func(IPWaitEvent)
+}
+
+// withDefaults fills unset options from a client's poll configuration.
+func (o IPOptions) withDefaults(pollInterval, pollTimeout time.Duration) IPOptions {
+	if o.Timeout == 0 {
+		o.Timeout = pollTimeout
+	}
+	if o.InitialInterval == 0 {
+		o.InitialInterval = pollInterval
+	}
+	if o.MaxInterval == 0 {
+		o.MaxInterval = max(defaultMaxPollInterval, o.InitialInterval)
+	}
+	if o.Jitter == 0 {
+		o.Jitter = defaultPollJitter
+	}
+	if o.SSHPort == 0 {
+		o.SSHPort = defaultSSHPort
+	}
+	return o
+}
+
+// backoffDelay returns the delay before attempt+1: InitialInterval doubled per
+// attempt, capped at MaxInterval, then scaled by a jitter factor derived from
+// r in [0, 1).
+func backoffDelay(attempt int, opts IPOptions, r float64) time.Duration {
+	delay := opts.InitialInterval
+	for i := 1; i < attempt && delay < opts.MaxInterval; i++ {
+		delay *= 2
+	}
+	delay = min(delay, opts.MaxInterval)
+	if opts.Jitter > 0 {
+		delay = time.Duration(float64(delay) * (1 + opts.Jitter*(2*r-1)))
+	}
+	return delay
+}
+
+// ResolveIP waits for a VM's IP address, polling tart with exponential
+// backoff and reporting each unsuccessful attempt through opts.OnWait.
+// With WaitForSSH it then waits until the VM's SSH port is reachable.
+func (c *TartClient) ResolveIP(name string, opts IPOptions) (string, error) {
+	if err := c.ensureInstalled(); err != nil {
+		return "", err
+	}
+	opts = opts.withDefaults(c.pollInterval, c.pollTimeout)
+	start := time.Now()
+	deadline := start.Add(opts.Timeout)
+
+	args := []string{"ip", name}
+	if opts.Resolver != ResolverDefault {
+		args = append(args, "--resolver", string(opts.Resolver))
+	}
+
+	var ip string
+	err := retryWait(IPWaitAddress, opts, start, deadline, func() (string, error) {
+		output, err := c.runCommand(args...)
+		if err != nil {
+			return "", err
+		}
+		ip = strings.TrimSpace(output)
+		return ip, nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("VM %s did not acquire an IP address within %v%s", name, opts.Timeout, c.bootLogHint(name))
+	}
+	if !opts.WaitForSSH {
+		return ip, nil
+	}
+
+	addr := net.JoinHostPort(ip, strconv.Itoa(opts.SSHPort))
+	err = retryWait(IPWaitSSH, opts, start, deadline, func() (string, error) {
+		conn, err := c.dial("tcp", addr, sshDialTimeout)
+		if err != nil {
+			return ip, err
+		}
+		conn.Close()
+		return ip, nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("VM %s got IP %s but SSH was not reachable within %v%s", name, ip, opts.Timeout, c.bootLogHint(name))
+	}
+	return ip, nil
+}
+
+// retryWait calls attempt until it succeeds (no error and a non-empty IP) or
+// the deadline passes, backing off between attempts.
+func retryWait(phase IPWaitPhase, opts IPOptions, start, deadline time.Time, attempt func() (string, error)) error {
+	for n := 1; ; n++ {
+		ip, err := attempt()
+		if err == nil && ip != "" {
+			return nil
+		}
+
+		delay := backoffDelay(n, opts, rand.Float64())
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return fmt.Errorf("timed out")
+		}
+		delay = min(delay, remaining)
+
+		if opts.OnWait != nil {
+			event := IPWaitEvent{Phase: phase, Attempt: n, Elapsed: time.Since(start), NextDelay: delay, Err: err}
+			if phase == IPWaitSSH {
+				event.IP = ip
+			}
+			opts.OnWait(event)
+		}
+		time.Sleep(delay)
+	}
+}
@@ -0,0 +1,187 @@
+// Package isolation provides VM isolation and management for CALF.
+package isolation
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	opts := IPOptions{InitialInterval: time.Second, MaxInterval: 5 * time.Second, Jitter: 0.2}
+
+	t.Run("when attempts increase should double delay up to max", func(t *testing.T) {
+		// Arrange
+		noJitter := 0.5
+
+		// Act
+		first := backoffDelay(1, opts, noJitter)
+		third := backoffDelay(3, opts, noJitter)
+		tenth := backoffDelay(10, opts, noJitter)
+
+		// Assert
+		if first != time.Second || third != 4*time.Second || tenth != 5*time.Second {
+			t.Errorf("backoffDelay() = %v, %v, %v, want 1s, 4s, 5s", first, third, tenth)
+		}
+	})
+
+	t.Run("when jitter applied should stay within jitter bounds", func(t *testing.T) {
+		// Act
+		low := backoffDelay(1, opts, 0)
+		high := backoffDelay(1, opts, 0.999999)
+
+		// Assert
+		if low != 800*time.Millisecond {
+			t.Errorf("backoffDelay(r=0) = %v, want 800ms", low)
+		}
+		if high <= time.Second || high > 1200*time.Millisecond {
+			t.Errorf("backoffDelay(r≈1) = %v, want just under 1.2s", high)
+		}
+	})
+
+	t.Run("when jitter disabled should ignore random factor", func(t *testing.T) {
+		// Arrange
+		noJitterOpts := opts
+		noJitterOpts.Jitter = -1
+
+		// Act
+		delay := backoffDelay(2, noJitterOpts, 0)
+
+		// Assert
+		if delay != 2*time.Second {
+			t.Errorf("backoffDelay() = %v, want 2s", delay)
+		}
+	})
+}
+
+func TestResolveIP(t *testing.T) {
+	t.Run("when resolver is arp should pass resolver flag to tart", func(t *testing.T) {
+		// Arrange
+		mock := newMockCommandRunner()
+		mock.addOutput("ip calf-dev --resolver arp", "192.168.1.40\n")
+		client := createTestClient(mock)
+
+		// Act
+		ip, err := client.ResolveIP("calf-dev", IPOptions{Resolver: ResolverARP})
+
+		// Assert
+		if err != nil {
+			t.Fatalf("ResolveIP() unexpected error = %v", err)
+		}
+		if ip != "192.168.1.40" {
+			t.Errorf("ResolveIP() = %v, want 192.168.1.40", ip)
+		}
+	})
+
+	t.Run("when ip not ready should report each wait through callback", func(t *testing.T) {
+		// Arrange
+		calls := 0
+		client := createTestClient(newMockCommandRunner(), WithRunCommand(func(args ...string) (string, error) {
+			calls++
+			if calls < 3 {
+				return "", fmt.Errorf("no IP address found")
+			}
+			return "192.168.64.5", nil
+		}))
+		var events []IPWaitEvent
+
+		// Act
+		ip, err := client.ResolveIP("calf-dev", IPOptions{
+			InitialInterval: time.Millisecond,
+			OnWait:          func(e IPWaitEvent) { events = append(events, e) },
+		})
+
+		// Assert
+		if err != nil || ip != "192.168.64.5" {
+			t.Fatalf("ResolveIP() = %q, %v, want 192.168.64.5", ip, err)
+		}
+		if len(events) != 2 {
+			t.Fatalf("OnWait called %d times, want 2", len(events))
+		}
+		if events[1].Phase != IPWaitAddress || events[1].Attempt != 2 || events[1].Err == nil {
+			t.Errorf("second event = %+v, want ip phase attempt 2 with error", events[1])
+		}
+	})
+
+	t.Run("when waiting for ssh should dial ssh port until reachable", func(t *testing.T) {
+		// Arrange
+		mock := newMockCommandRunner()
+		mock.addOutput("ip calf-dev", "192.168.64.5")
+		var dialed []string
+		client := createTestClient(mock, WithDialer(func(network, address string, timeout time.Duration) (net.Conn, error) {
+			dialed = append(dialed, address)
+			if len(dialed) < 2 {
+				return nil, fmt.Errorf("connection refused")
+			}
+			server, conn := net.Pipe()
+			server.Close()
+			return conn, nil
+		}))
+		var phases []IPWaitPhase
+
+		// Act
+		ip, err := client.ResolveIP("calf-dev", IPOptions{
+			WaitForSSH:      true,
+			InitialInterval: time.Millisecond,
+			OnWait:          func(e IPWaitEvent) { phases = append(phases, e.Phase) },
+		})
+
+		// Assert
+		if err != nil || ip != "192.168.64.5" {
+			t.Fatalf("ResolveIP() = %q, %v, want 192.168.64.5", ip, err)
+		}
+		if len(dialed) != 2 || dialed[0] != "192.168.64.5:22" {
+			t.Errorf("dialed %v, want two attempts at 192.168.64.5:22", dialed)
+		}
+		if len(phases) != 1 || phases[0] != IPWaitSSH {
+			t.Errorf("wait phases = %v, want one ssh wait", phases)
+		}
+	})
+
+	t.Run("when ssh never reachable should return ssh timeout error", func(t *testing.T) {
+		// Arrange
+		mock := newMockCommandRunner()
+		mock.addOutput("ip calf-dev", "192.168.64.5")
+		client := createTestClient(mock, WithDialer(func(network, address string, timeout time.Duration) (net.Conn, error) {
+			return nil, fmt.Errorf("connection refused")
+		}))
+
+		// Act
+		_, err := client.ResolveIP("calf-dev", IPOptions{WaitForSSH: true, SSHPort: 2222, Timeout: 30 * time.Millisecond})
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "SSH was not reachable") {
+			t.Errorf("ResolveIP() error = %v, want SSH timeout", err)
+		}
+	})
+}
+
+func TestNetworkOptionsResolver(t *testing.T) {
+	t.Run("when bridged should use arp resolver", func(t *testing.T) {
+		// Arrange
+		network := NetworkOptions{Mode: NetworkBridged, BridgedInterface: "en0"}
+
+		// Act
+		resolver := network.Resolver()
+
+		// Assert
+		if resolver != ResolverARP {
+			t.Errorf("Resolver() = %q, want arp", resolver)
+		}
+	})
+
+	t.Run("when softnet should use default resolver", func(t *testing.T) {
+		// Arrange
+		network := NetworkOptions{Mode: NetworkSoftnet}
+
+		// Act
+		resolver := network.Resolver()
+
+		// Assert
+		if resolver != ResolverDefault {
+			t.Errorf("Resolver() = %q, want default", resolver)
+		}
+	})
+}
@@ -0,0 +1,422 @@
+// Package isolation provides VM isolation and management for CALF.
+package isolation
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os/exec"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LimaInstallHint is the error shown when limactl is not installed.
+const LimaInstallHint = "limactl is not installed. Install Lima: https://lima-vm.io/docs/installation/"
+
+// limaGuestShareRoot is where named shares are mounted in Lima guests.
+const limaGuestShareRoot = "/mnt/calf"
+
+// limaInstance is one entry of `limactl list --json`, which prints one JSON
+// object per line.
+type limaInstance struct {
+	Name         string `json:"name"`
+	Status       string `json:"status"`
+	Disk         int64  `json:"disk"`
+	SSHAddress   string `json:"sshAddress"`
+	SSHLocalPort int    `json:"sshLocalPort"`
+	HostAgentPID int    `json:"hostAgentPID"`
+}
+
+// state maps a Lima status (Running, Stopped, Broken) to a VMState.
+func (i limaInstance) state() VMState {
+	if i.Status == "Running" {
+		return StateRunning
+	}
+	return StateStopped
+}
+
+// limaMount is an entry of a Lima instance's mounts list.
+type limaMount struct {
+	Location   string `json:"location"`
+	MountPoint string `json:"mountPoint,omitempty"`
+	Writable   bool   `json:"writable"`
+}
+
+// LimaClientOption configures a LimaClient.
+type LimaClientOption func(*LimaClient)
+
+// WithLimaRunCommand overrides the command runner used to dispatch limactl commands.
+// Intended for use in tests.
+func WithLimaRunCommand(fn commandRunner) LimaClientOption {
+	return func(c *LimaClient) { c.runCommand = fn }
+}
+
+// WithLimactlPath sets the limactl binary path, skipping discovery.
+// Intended for use in tests.
+func WithLimactlPath(path string) LimaClientOption {
+	return func(c *LimaClient) { c.limactlPath = path }
+}
+
+// WithLimaModeStore sets the store used to look up each VM's isolation mode
+// when it is started. Without a store, VMs run in shared mode.
+func WithLimaModeStore(store *ModeStore) LimaClientOption {
+	return func(c *LimaClient) { c.modes = store }
+}
+
+// WithLimaPollInterval overrides the interval between readiness checks.
+// Intended for use in tests.
+func WithLimaPollInterval(d time.Duration) LimaClientOption {
+	return func(c *LimaClient) { c.pollInterval = d }
+}
+
+// WithLimaPollTimeout overrides how long ResolveIP waits for a VM.
+// Intended for use in tests.
+func WithLimaPollTimeout(d time.Duration) LimaClientOption {
+	return func(c *LimaClient) { c.pollTimeout = d }
+}
+
+// WithLimaDialer overrides the dialer used to probe a VM's SSH port.
+// Intended for use in tests.
+func WithLimaDialer(dial func(network, address string, timeout time.Duration) (net.Conn, error)) LimaClientOption {
+	return func(c *LimaClient) { c.dial = dial }
+}
+
+// LimaClient is a Provider that runs VMs with Lima via limactl, so calf can
+// run on Linux hosts. Lima VMs are reached through Lima's SSH port forward, so
+// ResolveIP returns the forwarded address (usually 127.0.0.1) rather than the
+// guest's own IP.
+type LimaClient struct {
+	limactlPath  string
+	pollInterval time.Duration
+	pollTimeout  time.Duration
+	runCommand   commandRunner
+	lookPath     func(string) (string, error)
+	dial         func(network, address string, timeout time.Duration) (net.Conn, error)
+	modes        *ModeStore
+}
+
+// NewLimaClient creates a new LimaClient with optional configuration overrides.
+func NewLimaClient(opts ...LimaClientOption) *LimaClient {
+	client := &LimaClient{
+		pollInterval: defaultPollInterval,
+		pollTimeout:  defaultPollTimeout,
+		lookPath:     exec.LookPath,
+		dial:         net.DialTimeout,
+	}
+	client.runCommand = client.runLimactlCommand
+	for _, opt := range opts {
+		opt(client)
+	}
+	return client
+}
+
+// Name returns "lima".
+func (c *LimaClient) Name() string {
+	return ProviderLima
+}
+
+// ensureInstalled locates limactl.
+func (c *LimaClient) ensureInstalled() error {
+	if c.limactlPath != "" {
+		return nil
+	}
+	path, err := c.lookPath("limactl")
+	if err != nil {
+		return fmt.Errorf("%s", LimaInstallHint)
+	}
+	c.limactlPath = path
+	return nil
+}
+
+// runLimactlCommand executes a limactl command and returns its stdout.
+func (c *LimaClient) runLimactlCommand(args ...string) (string, error) {
+	cmd := exec.Command(c.limactlPath, args...)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("limactl %s failed: %w\nstdout: %s\nstderr: %s",
+			strings.Join(args, " "), err, stdout.String(), stderr.String())
+	}
+
+	return stdout.String(), nil
+}
+
+// Clone creates VM name. If image names an existing Lima instance it is
+// cloned; otherwise image is a Lima template (e.g. template://ubuntu-lts or a
+// path or URL to a template YAML) that a new instance is created from.
+func (c *LimaClient) Clone(image, name string) error {
+	instances, err := c.instances()
+	if err != nil {
+		return err
+	}
+	args := []string{"create", "--tty=false", "--name=" + name, image}
+	if slices.ContainsFunc(instances, func(i limaInstance) bool { return i.Name == image }) {
+		args = []string{"clone", "--tty=false", image, name}
+	}
+	if _, err := c.runCommand(args...); err != nil {
+		return fmt.Errorf("failed to clone %s to %s: %w", image, name, err)
+	}
+	return nil
+}
+
+// Set configures VM resources. Memory is given in MB and converted to the
+// GiB that Lima expects.
+func (c *LimaClient) Set(name string, cpu int, memory int, disk string) error {
+	if err := c.ensureInstalled(); err != nil {
+		return err
+	}
+	args := []string{"edit", "--tty=false"}
+
+	if cpu > 0 {
+		args = append(args, fmt.Sprintf("--cpus=%d", cpu))
+	}
+
+	if memory > 0 {
+		args = append(args, "--memory="+strconv.FormatFloat(float64(memory)/1024, 'g', -1, 64))
+	}
+
+	if disk != "" {
+		args = append(args, fmt.Sprintf("--disk=%s", disk))
+	}
+
+	args = append(args, name)
+	if _, err := c.runCommand(args...); err != nil {
+		return fmt.Errorf("failed to configure VM %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// Launch sets a VM's mounts from its isolation mode and opts.Shares, starts
+// it, and returns the PID of its Lima host agent. limactl start returns once
+// the guest has booted. Lima VMs always run headless and always log the
+// serial console to the instance directory, so Headless and Serial are
+// ignored. VNC, Suspendable, and network modes other than the default are
+// not supported.
+func (c *LimaClient) Launch(name string, opts LaunchOptions) (int, error) {
+	if err := c.ensureInstalled(); err != nil {
+		return 0, err
+	}
+
+	mode := IsolationMode{}
+	if c.modes != nil {
+		var err error
+		if mode, err = c.modes.Load(name); err != nil {
+			return 0, fmt.Errorf("failed to start VM %s: failed to load isolation mode: %w", name, err)
+		}
+	}
+	if err := c.VerifyMode(mode); err != nil {
+		return 0, fmt.Errorf("failed to start VM %s: %w", name, err)
+	}
+	network, err := opts.Network.withIsolation(mode)
+	if err != nil {
+		return 0, fmt.Errorf("failed to start VM %s: %w", name, err)
+	}
+
+	switch {
+	case opts.VNC:
+		return 0, fmt.Errorf("failed to start VM %s: VNC is not supported by the %s provider", name, ProviderLima)
+	case opts.Suspendable:
+		return 0, fmt.Errorf("failed to start VM %s: suspend is not supported by the %s provider", name, ProviderLima)
+	case network.Mode != NetworkDefault:
+		return 0, fmt.Errorf("failed to start VM %s: %s networking is not supported by the %s provider", name, network.describeMode(), ProviderLima)
+	}
+
+	mounts, err := limaMounts(mode, opts.Shares)
+	if err != nil {
+		return 0, fmt.Errorf("failed to start VM %s: %w", name, err)
+	}
+	if _, err := c.runCommand("edit", "--tty=false", "--set", ".mounts = "+mounts, name); err != nil {
+		return 0, fmt.Errorf("failed to configure mounts for VM %s: %w", name, err)
+	}
+
+	if _, err := c.runCommand("start", "--tty=false", name); err != nil {
+		return 0, fmt.Errorf("failed to start VM %s: %w", name, err)
+	}
+
+	inst, found, err := c.instance(name)
+	if err != nil {
+		return 0, err
+	}
+	if !found {
+		return 0, fmt.Errorf("VM %s not found after start", name)
+	}
+	return inst.HostAgentPID, nil
+}
+
+// VerifyMode returns an error for no-network mode: Lima has no softnet to
+// block the local network with. No-mount mode is enforced by sharing nothing.
+func (c *LimaClient) VerifyMode(mode IsolationMode) error {
+	if mode.NoNetwork {
+		return fmt.Errorf("no-network isolation is not supported by the %s provider", ProviderLima)
+	}
+	return nil
+}
+
+// limaMounts returns the mounts list for a VM as a JSON array, which Lima's
+// --set expressions accept. No-mount mode shares nothing.
+func limaMounts(mode IsolationMode, shares []DirShare) (string, error) {
+	mounts := []limaMount{}
+	if !mode.NoMount {
+		for _, share := range shares {
+			mount := limaMount{Location: share.Path, Writable: !share.ReadOnly}
+			if share.Name != "" {
+				mount.MountPoint = path.Join(limaGuestShareRoot, share.Name)
+			}
+			mounts = append(mounts, mount)
+		}
+	}
+	data, err := json.Marshal(mounts)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode mounts: %w", err)
+	}
+	return string(data), nil
+}
+
+// Stop stops a running VM.
+func (c *LimaClient) Stop(name string, force bool) error {
+	if err := c.ensureInstalled(); err != nil {
+		return err
+	}
+	args := []string{"stop"}
+	if force {
+		args = append(args, "--force")
+	}
+	args = append(args, name)
+
+	if _, err := c.runCommand(args...); err != nil {
+		return fmt.Errorf("failed to stop VM %s: %w", name, err)
+	}
+	return nil
+}
+
+// Delete removes a VM.
+func (c *LimaClient) Delete(name string) error {
+	if err := c.ensureInstalled(); err != nil {
+		return err
+	}
+	if _, err := c.runCommand("delete", name); err != nil {
+		return fmt.Errorf("failed to delete VM %s: %w", name, err)
+	}
+	return nil
+}
+
+// List lists all Lima instances. Size is the instance's disk size in GB.
+func (c *LimaClient) List() (TartListOutput, error) {
+	instances, err := c.instances()
+	if err != nil {
+		return nil, err
+	}
+	vms := make(TartListOutput, 0, len(instances))
+	for _, inst := range instances {
+		vms = append(vms, VMInfo{Name: inst.Name, State: inst.state(), Size: float64(inst.Disk) / (1 << 30)})
+	}
+	return vms, nil
+}
+
+// instances runs `limactl list --json` and parses its JSON lines.
+func (c *LimaClient) instances() ([]limaInstance, error) {
+	if err := c.ensureInstalled(); err != nil {
+		return nil, err
+	}
+	output, err := c.runCommand("list", "--json")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list VMs: %w", err)
+	}
+
+	var instances []limaInstance
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var inst limaInstance
+		if err := json.Unmarshal([]byte(line), &inst); err != nil {
+			return nil, fmt.Errorf("failed to parse VM list JSON: %w", err)
+		}
+		instances = append(instances, inst)
+	}
+	return instances, nil
+}
+
+// instance returns the named Lima instance, if it exists.
+func (c *LimaClient) instance(name string) (limaInstance, bool, error) {
+	instances, err := c.instances()
+	if err != nil {
+		return limaInstance{}, false, err
+	}
+	idx := slices.IndexFunc(instances, func(i limaInstance) bool { return i.Name == name })
+	if idx == -1 {
+		return limaInstance{}, false, nil
+	}
+	return instances[idx], true, nil
+}
+
+// ResolveIP waits until a VM is running and returns the host address of its
+// SSH port forward. With WaitForSSH it then waits until the forwarded port
+// accepts connections. opts.Resolver and opts.SSHPort do not apply, since
+// Lima picks the forwarded port.
+func (c *LimaClient) ResolveIP(name string, opts IPOptions) (string, error) {
+	opts = opts.withDefaults(c.pollInterval, c.pollTimeout)
+	start := time.Now()
+	deadline := start.Add(opts.Timeout)
+
+	var inst limaInstance
+	err := retryWait(IPWaitAddress, opts, start, deadline, func() (string, error) {
+		found, ok, err := c.instance(name)
+		if err != nil {
+			return "", err
+		}
+		if !ok || found.state() != StateRunning || found.SSHLocalPort == 0 {
+			return "", nil
+		}
+		inst = found
+		if inst.SSHAddress == "" {
+			inst.SSHAddress = "127.0.0.1"
+		}
+		return inst.SSHAddress, nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("VM %s was not running with SSH forwarded within %v; see 'limactl list' and the instance's ha.stderr.log", name, opts.Timeout)
+	}
+	if !opts.WaitForSSH {
+		return inst.SSHAddress, nil
+	}
+
+	addr := net.JoinHostPort(inst.SSHAddress, strconv.Itoa(inst.SSHLocalPort))
+	err = retryWait(IPWaitSSH, opts, start, deadline, func() (string, error) {
+		conn, err := c.dial("tcp", addr, sshDialTimeout)
+		if err != nil {
+			return inst.SSHAddress, err
+		}
+		conn.Close()
+		return inst.SSHAddress, nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("VM %s is running but SSH at %s was not reachable within %v", name, addr, opts.Timeout)
+	}
+	return inst.SSHAddress, nil
+}
+
+// Snapshot lists all VMs once and returns their states.
+func (c *LimaClient) Snapshot() (*StateSnapshot, error) {
+	return newSnapshot(c.List())
+}
+
+// GetState returns the current state of a VM.
+func (c *LimaClient) GetState(name string) VMState {
+	inst, found, err := c.instance(name)
+	if err != nil || !found {
+		return StateNotFound
+	}
+	return inst.state()
+}
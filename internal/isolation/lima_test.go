@@ -0,0 +1,300 @@
+// Package isolation provides VM isolation and management for CALF.
+package isolation
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeLimactl simulates limactl: it records commands and answers
+// `limactl list --json` from a set of instances.
+type fakeLimactl struct {
+	instances []string
+	commands  [][]string
+	errors    map[string]error
+}
+
+func (f *fakeLimactl) run(args ...string) (string, error) {
+	f.commands = append(f.commands, args)
+	if err, ok := f.errors[args[0]]; ok {
+		return "", err
+	}
+	if args[0] == "list" {
+		return strings.Join(f.instances, "\n") + "\n", nil
+	}
+	return "", nil
+}
+
+// ran reports whether a command with exactly these args was run.
+func (f *fakeLimactl) ran(args ...string) bool {
+	return slices.ContainsFunc(f.commands, func(c []string) bool { return slices.Equal(c, args) })
+}
+
+func createTestLimaClient(fake *fakeLimactl, extra ...LimaClientOption) *LimaClient {
+	return NewLimaClient(append([]LimaClientOption{
+		WithLimactlPath("/usr/local/bin/limactl"),
+		WithLimaRunCommand(fake.run),
+		WithLimaPollInterval(time.Millisecond),
+		WithLimaPollTimeout(20 * time.Millisecond),
+	}, extra...)...)
+}
+
+const (
+	limaRunning = `{"name":"calf-dev","status":"Running","disk":107374182400,"sshAddress":"127.0.0.1","sshLocalPort":60022,"hostAgentPID":5151}`
+	limaStopped = `{"name":"calf-init","status":"Stopped","disk":107374182400,"sshLocalPort":0}`
+)
+
+func TestLimaList(t *testing.T) {
+	t.Run("when instances exist should map json lines to VM states", func(t *testing.T) {
+		// Arrange
+		client := createTestLimaClient(&fakeLimactl{instances: []string{limaRunning, limaStopped}})
+
+		// Act
+		vms, err := client.List()
+
+		// Assert
+		if err != nil {
+			t.Fatalf("List() unexpected error = %v", err)
+		}
+		want := TartListOutput{{Name: "calf-dev", State: StateRunning, Size: 100}, {Name: "calf-init", State: StateStopped, Size: 100}}
+		if !slices.Equal(vms, want) {
+			t.Errorf("List() = %+v, want %+v", vms, want)
+		}
+	})
+
+	t.Run("when no instances should return empty list", func(t *testing.T) {
+		// Arrange
+		client := createTestLimaClient(&fakeLimactl{})
+
+		// Act
+		vms, err := client.List()
+
+		// Assert
+		if err != nil || len(vms) != 0 {
+			t.Errorf("List() = %+v, %v, want empty", vms, err)
+		}
+	})
+
+	t.Run("when limactl is missing should return install hint", func(t *testing.T) {
+		// Arrange
+		client := NewLimaClient(WithLimaRunCommand((&fakeLimactl{}).run), func(c *LimaClient) {
+			c.lookPath = func(string) (string, error) { return "", fmt.Errorf("not found") }
+		})
+
+		// Act
+		_, err := client.List()
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "lima-vm.io") {
+			t.Errorf("List() error = %v, want install hint", err)
+		}
+	})
+}
+
+func TestLimaClone(t *testing.T) {
+	t.Run("when image is a template should create instance", func(t *testing.T) {
+		// Arrange
+		fake := &fakeLimactl{}
+		client := createTestLimaClient(fake)
+
+		// Act
+		err := client.Clone("template://ubuntu-lts", "calf-dev")
+
+		// Assert
+		if err != nil {
+			t.Fatalf("Clone() unexpected error = %v", err)
+		}
+		if !fake.ran("create", "--tty=false", "--name=calf-dev", "template://ubuntu-lts") {
+			t.Errorf("expected limactl create, got %v", fake.commands)
+		}
+	})
+
+	t.Run("when image is an existing instance should clone it", func(t *testing.T) {
+		// Arrange
+		fake := &fakeLimactl{instances: []string{limaStopped}}
+		client := createTestLimaClient(fake)
+
+		// Act
+		err := client.Clone("calf-init", "calf-dev")
+
+		// Assert
+		if err != nil {
+			t.Fatalf("Clone() unexpected error = %v", err)
+		}
+		if !fake.ran("clone", "--tty=false", "calf-init", "calf-dev") {
+			t.Errorf("expected limactl clone, got %v", fake.commands)
+		}
+	})
+}
+
+func TestLimaSet(t *testing.T) {
+	t.Run("when resources given should convert memory to GiB", func(t *testing.T) {
+		// Arrange
+		fake := &fakeLimactl{}
+		client := createTestLimaClient(fake)
+
+		// Act
+		err := client.Set("calf-dev", 4, 6144, "80")
+
+		// Assert
+		if err != nil {
+			t.Fatalf("Set() unexpected error = %v", err)
+		}
+		if !fake.ran("edit", "--tty=false", "--cpus=4", "--memory=6", "--disk=80", "calf-dev") {
+			t.Errorf("expected limactl edit with resources, got %v", fake.commands)
+		}
+	})
+}
+
+func TestLimaLaunch(t *testing.T) {
+	t.Run("when shares given should set mounts start and return host agent pid", func(t *testing.T) {
+		// Arrange
+		fake := &fakeLimactl{instances: []string{limaRunning}}
+		client := createTestLimaClient(fake)
+
+		// Act
+		pid, err := client.Launch("calf-dev", LaunchOptions{Headless: true, Shares: []DirShare{
+			{Name: "src", Path: "/home/dev/src"},
+			{Path: "/home/dev/docs", ReadOnly: true},
+		}})
+
+		// Assert
+		if err != nil {
+			t.Fatalf("Launch() unexpected error = %v", err)
+		}
+		if pid != 5151 {
+			t.Errorf("Launch() pid = %d, want host agent pid 5151", pid)
+		}
+		mounts := `.mounts = [{"location":"/home/dev/src","mountPoint":"/mnt/calf/src","writable":true},{"location":"/home/dev/docs","writable":false}]`
+		if !fake.ran("edit", "--tty=false", "--set", mounts, "calf-dev") {
+			t.Errorf("expected mounts edit, got %v", fake.commands)
+		}
+		if !fake.ran("start", "--tty=false", "calf-dev") {
+			t.Errorf("expected limactl start, got %v", fake.commands)
+		}
+	})
+
+	t.Run("when no-mount mode should clear mounts", func(t *testing.T) {
+		// Arrange
+		fake := &fakeLimactl{instances: []string{limaRunning}}
+		modes := NewModeStore(t.TempDir())
+		if err := modes.Save("calf-dev", IsolationMode{NoMount: true}); err != nil {
+			t.Fatal(err)
+		}
+		client := createTestLimaClient(fake, WithLimaModeStore(modes))
+
+		// Act
+		_, err := client.Launch("calf-dev", LaunchOptions{Shares: []DirShare{{Path: "/home/dev/src"}}})
+
+		// Assert
+		if err != nil {
+			t.Fatalf("Launch() unexpected error = %v", err)
+		}
+		if !fake.ran("edit", "--tty=false", "--set", ".mounts = []", "calf-dev") {
+			t.Errorf("expected empty mounts, got %v", fake.commands)
+		}
+	})
+
+	t.Run("when suspendable requested should return unsupported error", func(t *testing.T) {
+		// Arrange
+		fake := &fakeLimactl{instances: []string{limaStopped}}
+		client := createTestLimaClient(fake)
+
+		// Act
+		_, err := client.Launch("calf-init", LaunchOptions{Suspendable: true})
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "not supported by the lima provider") {
+			t.Errorf("Launch() error = %v, want unsupported", err)
+		}
+		if fake.ran("start", "--tty=false", "calf-init") {
+			t.Error("expected VM not to be started")
+		}
+	})
+
+	t.Run("when no-network mode should return unsupported error", func(t *testing.T) {
+		// Arrange
+		modes := NewModeStore(t.TempDir())
+		if err := modes.Save("calf-dev", IsolationMode{NoNetwork: true}); err != nil {
+			t.Fatal(err)
+		}
+		client := createTestLimaClient(&fakeLimactl{}, WithLimaModeStore(modes))
+
+		// Act
+		_, err := client.Launch("calf-dev", LaunchOptions{})
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "no-network isolation is not supported by the lima provider") {
+			t.Errorf("Launch() error = %v, want no-network unsupported", err)
+		}
+	})
+}
+
+func TestLimaResolveIP(t *testing.T) {
+	t.Run("when running should return forwarded ssh address", func(t *testing.T) {
+		// Arrange
+		client := createTestLimaClient(&fakeLimactl{instances: []string{limaRunning}})
+
+		// Act
+		ip, err := client.ResolveIP("calf-dev", IPOptions{})
+
+		// Assert
+		if err != nil || ip != "127.0.0.1" {
+			t.Errorf("ResolveIP() = %q, %v, want 127.0.0.1", ip, err)
+		}
+	})
+
+	t.Run("when waiting for ssh should dial forwarded port", func(t *testing.T) {
+		// Arrange
+		var dialed string
+		client := createTestLimaClient(&fakeLimactl{instances: []string{limaRunning}}, WithLimaDialer(func(network, address string, timeout time.Duration) (net.Conn, error) {
+			dialed = address
+			server, conn := net.Pipe()
+			server.Close()
+			return conn, nil
+		}))
+
+		// Act
+		_, err := client.ResolveIP("calf-dev", IPOptions{WaitForSSH: true})
+
+		// Assert
+		if err != nil {
+			t.Fatalf("ResolveIP() unexpected error = %v", err)
+		}
+		if dialed != "127.0.0.1:60022" {
+			t.Errorf("dialed %q, want 127.0.0.1:60022", dialed)
+		}
+	})
+
+	t.Run("when VM stays stopped should time out", func(t *testing.T) {
+		// Arrange
+		client := createTestLimaClient(&fakeLimactl{instances: []string{limaStopped}})
+
+		// Act
+		_, err := client.ResolveIP("calf-init", IPOptions{})
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "was not running") {
+			t.Errorf("ResolveIP() error = %v, want timeout", err)
+		}
+	})
+}
+
+func TestLimaGetState(t *testing.T) {
+	t.Run("when VM missing should return not found", func(t *testing.T) {
+		// Arrange
+		client := createTestLimaClient(&fakeLimactl{instances: []string{limaRunning}})
+
+		// Act
+		state := client.GetState("calf-missing")
+
+		// Assert
+		if state != StateNotFound {
+			t.Errorf("GetState() = %v, want not found", state)
+		}
+	})
+}
@@ -0,0 +1,169 @@
+// Package isolation provides VM isolation and management for CALF.
+package isolation
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// modeFileName is the per-VM file that records the isolation mode chosen at init.
+	modeFileName = "isolation.yaml"
+
+	// noMountMarker is the host marker file calf-bootstrap uses for no-mount mode.
+	noMountMarker = ".calf-vm-no-mount"
+
+	// noNetworkMarker is the host marker file calf-bootstrap uses for no-network mode.
+	noNetworkMarker = ".calf-vm-no-network"
+
+	// softnetMulticastBlock blocks all multicast (mDNS/Bonjour discovery) in no-network mode.
+	softnetMulticastBlock = "224.0.0.0/4"
+)
+
+// bootstrapVMs are the VMs managed by calf-bootstrap, whose isolation mode was
+// tracked by host-wide marker files before per-VM mode files existed.
+var bootstrapVMs = []string{"calf-dev", "calf-init"}
+
+// IsolationMode describes how a VM is isolated from the host.
+// The mode is chosen when a VM is initialized and cannot be changed afterwards;
+// the VM must be destroyed and recreated to switch modes.
+type IsolationMode struct {
+	// NoMount disables all host directory shares (tart-cache, calf-cache, user dirs).
+	NoMount bool `yaml:"no_mount"`
+	// NoNetwork runs the VM on softnet with local network access blocked.
+	NoNetwork bool `yaml:"no_network"`
+}
+
+// SafeMode returns the isolation mode with both no-mount and no-network enabled.
+func SafeMode() IsolationMode {
+	return IsolationMode{NoMount: true, NoNetwork: true}
+}
+
+// IsShared reports whether the mode applies no isolation restrictions.
+func (m IsolationMode) IsShared() bool {
+	return !m.NoMount && !m.NoNetwork
+}
+
+// Description returns a human-readable summary of the mode for status output.
+func (m IsolationMode) Description() string {
+	switch {
+	case m.NoMount && m.NoNetwork:
+		return "Safe mode (no mounts, network isolated)"
+	case m.NoMount:
+		return "Isolated filesystem (no host mounts)"
+	case m.NoNetwork:
+		return "Isolated network (local network blocked)"
+	default:
+		return "Shared mode (mounts enabled, network unrestricted)"
+	}
+}
+
+// ModeStore persists per-VM isolation modes under ~/.calf/isolation/vms/{name}/.
+type ModeStore struct {
+	// homeDir holds calf-bootstrap's marker files, or is "" if modes are
+	// never migrated from markers.
+	homeDir string
+	// dir holds a directory for each VM.
+	dir  string
+	host cacheHost
+}
+
+// NewDefaultModeStore creates a ModeStore rooted at the current user's home directory.
+func NewDefaultModeStore() *ModeStore {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		homeDir = ""
+	}
+	return NewModeStore(homeDir)
+}
+
+// NewModeStore creates a ModeStore rooted at the given home directory.
+func NewModeStore(homeDir string) *ModeStore {
+	return &ModeStore{homeDir: homeDir, dir: vmsDir(homeDir), host: localCacheHost{}}
+}
+
+// NewRemoteModeStore creates a ModeStore for VMs that tart runs on a remote
+// host. Modes are kept in the host's home directory, next to the VMs, so every
+// machine driving the host enforces the same modes.
+func NewRemoteModeStore(host *RemoteHost) *ModeStore {
+	return &ModeStore{homeDir: "~", dir: vmsDir("~"), host: remoteCacheHost{host: host}}
+}
+
+// vmsDir returns the directory of per-VM calf config under a home directory.
+func vmsDir(homeDir string) string {
+	return filepath.Join(homeDir, ".calf", "isolation", "vms")
+}
+
+// modePath returns the path of the mode file for a VM.
+func (s *ModeStore) modePath(vmName string) string {
+	return filepath.Join(s.dir, vmName, modeFileName)
+}
+
+// Load returns the isolation mode recorded for a VM.
+// If no mode file exists and the VM is managed by calf-bootstrap, the host
+// marker files are migrated into a mode file. The markers are left in place
+// so calf-bootstrap continues to see the same mode.
+// VMs with no recorded mode use shared mode.
+func (s *ModeStore) Load(vmName string) (IsolationMode, error) {
+	path := s.modePath(vmName)
+	data, err := s.host.readFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s.migrateMarkers(vmName)
+	}
+	if err != nil {
+		return IsolationMode{}, fmt.Errorf("failed to read isolation mode file '%s': %w", path, err)
+	}
+
+	var mode IsolationMode
+	if err := yaml.Unmarshal(data, &mode); err != nil {
+		return IsolationMode{}, fmt.Errorf("failed to parse isolation mode file '%s': %w", path, err)
+	}
+	return mode, nil
+}
+
+// Save records the isolation mode for a VM, replacing any previous mode.
+// Only init should call Save; the mode is permanent for the life of the VM.
+func (s *ModeStore) Save(vmName string, mode IsolationMode) error {
+	path := s.modePath(vmName)
+	data, err := yaml.Marshal(mode)
+	if err != nil {
+		return fmt.Errorf("failed to encode isolation mode: %w", err)
+	}
+	if err := s.host.writeFile(path, data); err != nil {
+		return fmt.Errorf("failed to write isolation mode file '%s': %w", path, err)
+	}
+	return nil
+}
+
+// migrateMarkers converts calf-bootstrap host marker files into a mode file.
+// Returns shared mode without writing anything when no markers exist, the
+// store has no marker directory, or the VM is not managed by calf-bootstrap.
+func (s *ModeStore) migrateMarkers(vmName string) (IsolationMode, error) {
+	if s.homeDir == "" || !slices.Contains(bootstrapVMs, vmName) {
+		return IsolationMode{}, nil
+	}
+
+	mode := IsolationMode{
+		NoMount:   s.exists(filepath.Join(s.homeDir, noMountMarker)),
+		NoNetwork: s.exists(filepath.Join(s.homeDir, noNetworkMarker)),
+	}
+	if mode.IsShared() {
+		return mode, nil
+	}
+
+	if err := s.Save(vmName, mode); err != nil {
+		return IsolationMode{}, fmt.Errorf("failed to migrate isolation markers for %s: %w", vmName, err)
+	}
+	return mode, nil
+}
+
+// exists reports whether a regular file or directory exists at path.
+func (s *ModeStore) exists(path string) bool {
+	_, err := s.host.stat(path)
+	return err == nil
+}
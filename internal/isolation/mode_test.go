@@ -0,0 +1,255 @@
+// Package isolation provides VM isolation and management for CALF.
+package isolation
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIsolationModeDescription(t *testing.T) {
+	t.Run("when mode is shared should describe shared mode", func(t *testing.T) {
+		// Arrange
+		mode := IsolationMode{}
+
+		// Act
+		got := mode.Description()
+
+		// Assert
+		if got != "Shared mode (mounts enabled, network unrestricted)" {
+			t.Errorf("Description() = %q, want shared mode description", got)
+		}
+	})
+
+	t.Run("when only no-mount is set should describe isolated filesystem", func(t *testing.T) {
+		// Arrange
+		mode := IsolationMode{NoMount: true}
+
+		// Act
+		got := mode.Description()
+
+		// Assert
+		if got != "Isolated filesystem (no host mounts)" {
+			t.Errorf("Description() = %q, want isolated filesystem description", got)
+		}
+	})
+
+	t.Run("when only no-network is set should describe isolated network", func(t *testing.T) {
+		// Arrange
+		mode := IsolationMode{NoNetwork: true}
+
+		// Act
+		got := mode.Description()
+
+		// Assert
+		if got != "Isolated network (local network blocked)" {
+			t.Errorf("Description() = %q, want isolated network description", got)
+		}
+	})
+
+	t.Run("when safe mode should describe safe mode", func(t *testing.T) {
+		// Arrange
+		mode := SafeMode()
+
+		// Act
+		got := mode.Description()
+
+		// Assert
+		if got != "Safe mode (no mounts, network isolated)" {
+			t.Errorf("Description() = %q, want safe mode description", got)
+		}
+	})
+}
+
+func TestModeStore(t *testing.T) {
+	t.Run("when mode saved should load same mode", func(t *testing.T) {
+		// Arrange
+		store := NewModeStore(t.TempDir())
+		if err := store.Save("test-vm", IsolationMode{NoNetwork: true}); err != nil {
+			t.Fatalf("Save() unexpected error = %v", err)
+		}
+
+		// Act
+		got, err := store.Load("test-vm")
+
+		// Assert
+		if err != nil {
+			t.Fatalf("Load() unexpected error = %v", err)
+		}
+		if got != (IsolationMode{NoNetwork: true}) {
+			t.Errorf("Load() = %+v, want NoNetwork only", got)
+		}
+	})
+
+	t.Run("when mode saved should write file under per-VM config directory", func(t *testing.T) {
+		// Arrange
+		homeDir := t.TempDir()
+		store := NewModeStore(homeDir)
+
+		// Act
+		err := store.Save("test-vm", SafeMode())
+
+		// Assert
+		if err != nil {
+			t.Fatalf("Save() unexpected error = %v", err)
+		}
+		path := filepath.Join(homeDir, ".calf", "isolation", "vms", "test-vm", "isolation.yaml")
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("expected mode file at %s: %v", path, err)
+		}
+	})
+
+	t.Run("when no mode recorded should return shared mode", func(t *testing.T) {
+		// Arrange
+		store := NewModeStore(t.TempDir())
+
+		// Act
+		got, err := store.Load("test-vm")
+
+		// Assert
+		if err != nil {
+			t.Fatalf("Load() unexpected error = %v", err)
+		}
+		if !got.IsShared() {
+			t.Errorf("Load() = %+v, want shared mode", got)
+		}
+	})
+
+	t.Run("when mode file is malformed should return parse error", func(t *testing.T) {
+		// Arrange
+		homeDir := t.TempDir()
+		dir := filepath.Join(homeDir, ".calf", "isolation", "vms", "test-vm")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "isolation.yaml"), []byte("no_mount: [oops"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		store := NewModeStore(homeDir)
+
+		// Act
+		_, err := store.Load("test-vm")
+
+		// Assert
+		if err == nil {
+			t.Fatal("Load() expected error, got nil")
+		}
+		if !strings.Contains(err.Error(), "failed to parse isolation mode file") {
+			t.Errorf("Load() error should mention parse failure, got: %v", err)
+		}
+	})
+}
+
+func TestModeStoreMarkerMigration(t *testing.T) {
+	t.Run("when bootstrap markers exist for calf-dev should migrate to mode file", func(t *testing.T) {
+		// Arrange
+		homeDir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(homeDir, ".calf-vm-no-mount"), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(homeDir, ".calf-vm-no-network"), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		store := NewModeStore(homeDir)
+
+		// Act
+		got, err := store.Load("calf-dev")
+
+		// Assert
+		if err != nil {
+			t.Fatalf("Load() unexpected error = %v", err)
+		}
+		if got != SafeMode() {
+			t.Errorf("Load() = %+v, want safe mode", got)
+		}
+		modeFile := filepath.Join(homeDir, ".calf", "isolation", "vms", "calf-dev", "isolation.yaml")
+		if _, err := os.Stat(modeFile); err != nil {
+			t.Errorf("expected migrated mode file at %s: %v", modeFile, err)
+		}
+	})
+
+	t.Run("when markers migrated should leave markers in place for calf-bootstrap", func(t *testing.T) {
+		// Arrange
+		homeDir := t.TempDir()
+		marker := filepath.Join(homeDir, ".calf-vm-no-mount")
+		if err := os.WriteFile(marker, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		store := NewModeStore(homeDir)
+
+		// Act
+		_, err := store.Load("calf-dev")
+
+		// Assert
+		if err != nil {
+			t.Fatalf("Load() unexpected error = %v", err)
+		}
+		if _, err := os.Stat(marker); err != nil {
+			t.Errorf("expected marker to remain at %s: %v", marker, err)
+		}
+	})
+
+	t.Run("when mode file exists should ignore bootstrap markers", func(t *testing.T) {
+		// Arrange
+		homeDir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(homeDir, ".calf-vm-no-mount"), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		store := NewModeStore(homeDir)
+		if err := store.Save("calf-dev", IsolationMode{}); err != nil {
+			t.Fatal(err)
+		}
+
+		// Act
+		got, err := store.Load("calf-dev")
+
+		// Assert
+		if err != nil {
+			t.Fatalf("Load() unexpected error = %v", err)
+		}
+		if !got.IsShared() {
+			t.Errorf("Load() = %+v, want shared mode from mode file", got)
+		}
+	})
+
+	t.Run("when VM is not managed by bootstrap should ignore markers", func(t *testing.T) {
+		// Arrange
+		homeDir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(homeDir, ".calf-vm-no-network"), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		store := NewModeStore(homeDir)
+
+		// Act
+		got, err := store.Load("other-vm")
+
+		// Assert
+		if err != nil {
+			t.Fatalf("Load() unexpected error = %v", err)
+		}
+		if !got.IsShared() {
+			t.Errorf("Load() = %+v, want shared mode", got)
+		}
+	})
+	t.Run("when store is for simulated VMs should ignore bootstrap markers", func(t *testing.T) {
+		// Arrange
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, ".calf-vm-no-network"), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		t.Chdir(dir)
+		store := NewSimModeStore(filepath.Join(dir, "sim-vms"))
+
+		// Act
+		got, err := store.Load("calf-dev")
+
+		// Assert
+		if err != nil {
+			t.Fatalf("Load() unexpected error = %v", err)
+		}
+		if !got.IsShared() {
+			t.Errorf("Load() = %+v, want shared mode", got)
+		}
+	})
+}
@@ -0,0 +1,125 @@
+// Package isolation provides VM isolation and management for CALF.
+package isolation
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+)
+
+// NetworkMode selects how a VM is attached to the network.
+type NetworkMode string
+
+const (
+	// NetworkDefault uses Tart's default shared (NAT) networking.
+	NetworkDefault NetworkMode = ""
+
+	// NetworkSoftnet uses softnet, optionally restricted by allow/block CIDR lists.
+	NetworkSoftnet NetworkMode = "softnet"
+
+	// NetworkBridged bridges the VM to a named host interface.
+	NetworkBridged NetworkMode = "bridged"
+
+	// NetworkHostOnly restricts the VM to host-only networking.
+	NetworkHostOnly NetworkMode = "host-only"
+)
+
+// NetworkOptions configures VM networking for `tart run`.
+// The zero value selects default NAT networking.
+type NetworkOptions struct {
+	// Mode selects the network attachment.
+	Mode NetworkMode
+	// SoftnetAllow lists CIDRs the VM may reach (softnet only).
+	SoftnetAllow []string
+	// SoftnetBlock lists CIDRs the VM may not reach (softnet only).
+	SoftnetBlock []string
+	// BridgedInterface is the host interface to bridge to (bridged only), e.g. "en0".
+	BridgedInterface string
+}
+
+// Validate rejects unknown modes, malformed CIDRs, and contradictory combinations
+// such as CIDR lists outside softnet or a CIDR that is both allowed and blocked.
+func (n NetworkOptions) Validate() error {
+	switch n.Mode {
+	case NetworkDefault, NetworkSoftnet, NetworkBridged, NetworkHostOnly:
+	default:
+		return fmt.Errorf("invalid network mode '%s': must be one of: softnet, bridged, host-only", n.Mode)
+	}
+
+	if n.Mode != NetworkSoftnet && (len(n.SoftnetAllow) > 0 || len(n.SoftnetBlock) > 0) {
+		return fmt.Errorf("softnet allow/block lists require softnet network mode, got %s", n.describeMode())
+	}
+
+	if n.Mode == NetworkBridged && n.BridgedInterface == "" {
+		return fmt.Errorf("bridged network mode requires an interface name")
+	}
+	if n.Mode != NetworkBridged && n.BridgedInterface != "" {
+		return fmt.Errorf("bridged interface %s requires bridged network mode, got %s", n.BridgedInterface, n.describeMode())
+	}
+
+	for _, cidr := range slices.Concat(n.SoftnetAllow, n.SoftnetBlock) {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return fmt.Errorf("invalid softnet CIDR '%s': %w", cidr, err)
+		}
+	}
+	for _, cidr := range n.SoftnetAllow {
+		if slices.Contains(n.SoftnetBlock, cidr) {
+			return fmt.Errorf("softnet CIDR %s cannot be both allowed and blocked", cidr)
+		}
+	}
+
+	return nil
+}
+
+// describeMode returns the mode name for error messages.
+func (n NetworkOptions) describeMode() string {
+	if n.Mode == NetworkDefault {
+		return "default"
+	}
+	return string(n.Mode)
+}
+
+// args returns the `tart run` flags for these options.
+func (n NetworkOptions) args() []string {
+	switch n.Mode {
+	case NetworkSoftnet:
+		args := []string{"--net-softnet"}
+		if len(n.SoftnetAllow) > 0 {
+			args = append(args, fmt.Sprintf("--net-softnet-allow=%s", strings.Join(n.SoftnetAllow, ",")))
+		}
+		if len(n.SoftnetBlock) > 0 {
+			args = append(args, fmt.Sprintf("--net-softnet-block=%s", strings.Join(n.SoftnetBlock, ",")))
+		}
+		return args
+	case NetworkBridged:
+		return []string{fmt.Sprintf("--net-bridged=%s", n.BridgedInterface)}
+	case NetworkHostOnly:
+		return []string{"--net-host"}
+	default:
+		return nil
+	}
+}
+
+// withIsolation applies an isolation mode to these options.
+// No-network mode requires softnet: default networking is upgraded to softnet,
+// and multicast is always blocked to prevent mDNS/Bonjour discovery.
+// Bridged and host-only networking contradict no-network mode and are rejected.
+func (n NetworkOptions) withIsolation(mode IsolationMode) (NetworkOptions, error) {
+	if !mode.NoNetwork {
+		return n, nil
+	}
+
+	switch n.Mode {
+	case NetworkDefault:
+		n.Mode = NetworkSoftnet
+	case NetworkSoftnet:
+	default:
+		return n, fmt.Errorf("%s networking is not allowed in no-network isolation mode", n.Mode)
+	}
+
+	if !slices.Contains(n.SoftnetBlock, softnetMulticastBlock) {
+		n.SoftnetBlock = append(slices.Clone(n.SoftnetBlock), softnetMulticastBlock)
+	}
+	return n, nil
+}
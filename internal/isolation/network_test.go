@@ -0,0 +1,245 @@
+// Package isolation provides VM isolation and management for CALF.
+package isolation
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestNetworkOptionsValidate(t *testing.T) {
+	t.Run("when options are zero value should accept default networking", func(t *testing.T) {
+		// Arrange
+		opts := NetworkOptions{}
+
+		// Act
+		err := opts.Validate()
+
+		// Assert
+		if err != nil {
+			t.Errorf("Validate() unexpected error = %v", err)
+		}
+	})
+
+	t.Run("when softnet with allow and block lists should accept", func(t *testing.T) {
+		// Arrange
+		opts := NetworkOptions{
+			Mode:         NetworkSoftnet,
+			SoftnetAllow: []string{"10.20.0.0/16"},
+			SoftnetBlock: []string{"192.168.0.0/16"},
+		}
+
+		// Act
+		err := opts.Validate()
+
+		// Assert
+		if err != nil {
+			t.Errorf("Validate() unexpected error = %v", err)
+		}
+	})
+
+	t.Run("when mode is unknown should reject", func(t *testing.T) {
+		// Arrange
+		opts := NetworkOptions{Mode: "vpn"}
+
+		// Act
+		err := opts.Validate()
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "invalid network mode 'vpn'") {
+			t.Errorf("Validate() error = %v, want invalid network mode error", err)
+		}
+	})
+
+	t.Run("when CIDR lists set without softnet should reject", func(t *testing.T) {
+		// Arrange
+		opts := NetworkOptions{Mode: NetworkHostOnly, SoftnetBlock: []string{"10.0.0.0/8"}}
+
+		// Act
+		err := opts.Validate()
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "require softnet network mode") {
+			t.Errorf("Validate() error = %v, want softnet required error", err)
+		}
+	})
+
+	t.Run("when bridged without interface should reject", func(t *testing.T) {
+		// Arrange
+		opts := NetworkOptions{Mode: NetworkBridged}
+
+		// Act
+		err := opts.Validate()
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "requires an interface name") {
+			t.Errorf("Validate() error = %v, want interface required error", err)
+		}
+	})
+
+	t.Run("when interface set without bridged mode should reject", func(t *testing.T) {
+		// Arrange
+		opts := NetworkOptions{Mode: NetworkSoftnet, BridgedInterface: "en0"}
+
+		// Act
+		err := opts.Validate()
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "requires bridged network mode") {
+			t.Errorf("Validate() error = %v, want bridged required error", err)
+		}
+	})
+
+	t.Run("when CIDR is malformed should reject", func(t *testing.T) {
+		// Arrange
+		opts := NetworkOptions{Mode: NetworkSoftnet, SoftnetAllow: []string{"10.0.0.0"}}
+
+		// Act
+		err := opts.Validate()
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "invalid softnet CIDR '10.0.0.0'") {
+			t.Errorf("Validate() error = %v, want invalid CIDR error", err)
+		}
+	})
+
+	t.Run("when CIDR is both allowed and blocked should reject", func(t *testing.T) {
+		// Arrange
+		opts := NetworkOptions{
+			Mode:         NetworkSoftnet,
+			SoftnetAllow: []string{"10.0.0.0/8"},
+			SoftnetBlock: []string{"10.0.0.0/8"},
+		}
+
+		// Act
+		err := opts.Validate()
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "both allowed and blocked") {
+			t.Errorf("Validate() error = %v, want contradiction error", err)
+		}
+	})
+}
+
+func TestRunWithNetwork(t *testing.T) {
+	t.Run("when softnet with allow and block lists should pass comma-joined flags", func(t *testing.T) {
+		// Arrange
+		mock := newMockCommandRunner()
+		client := createTestClient(mock)
+		opts := NetworkOptions{
+			Mode:         NetworkSoftnet,
+			SoftnetAllow: []string{"10.20.0.0/16", "172.16.5.0/24"},
+			SoftnetBlock: []string{"0.0.0.0/0"},
+		}
+
+		// Act
+		err := client.RunWithNetwork("test-vm", true, false, nil, opts)
+
+		// Assert
+		if err != nil {
+			t.Fatalf("RunWithNetwork() unexpected error = %v", err)
+		}
+		expected := []string{"tart", "run", "--headless", "--dir=tart-cache:~/.tart/cache:ro",
+			"--net-softnet", "--net-softnet-allow=10.20.0.0/16,172.16.5.0/24", "--net-softnet-block=0.0.0.0/0", "test-vm"}
+		if !slices.Equal(mock.commands[0], expected) {
+			t.Errorf("RunWithNetwork() command = %v, want %v", mock.commands[0], expected)
+		}
+	})
+
+	t.Run("when bridged should pass interface flag", func(t *testing.T) {
+		// Arrange
+		mock := newMockCommandRunner()
+		client := createTestClient(mock)
+
+		// Act
+		err := client.RunWithNetwork("test-vm", false, false, nil, NetworkOptions{Mode: NetworkBridged, BridgedInterface: "en0"})
+
+		// Assert
+		if err != nil {
+			t.Fatalf("RunWithNetwork() unexpected error = %v", err)
+		}
+		if !slices.Contains(mock.commands[0], "--net-bridged=en0") {
+			t.Errorf("RunWithNetwork() command %v should contain --net-bridged=en0", mock.commands[0])
+		}
+	})
+
+	t.Run("when host-only should pass net-host flag", func(t *testing.T) {
+		// Arrange
+		mock := newMockCommandRunner()
+		client := createTestClient(mock)
+
+		// Act
+		err := client.RunWithNetwork("test-vm", false, false, nil, NetworkOptions{Mode: NetworkHostOnly})
+
+		// Assert
+		if err != nil {
+			t.Fatalf("RunWithNetwork() unexpected error = %v", err)
+		}
+		if !slices.Contains(mock.commands[0], "--net-host") {
+			t.Errorf("RunWithNetwork() command %v should contain --net-host", mock.commands[0])
+		}
+	})
+
+	t.Run("when options are invalid should return error without running", func(t *testing.T) {
+		// Arrange
+		mock := newMockCommandRunner()
+		client := createTestClient(mock)
+
+		// Act
+		err := client.RunWithNetwork("test-vm", false, false, nil, NetworkOptions{Mode: NetworkBridged})
+
+		// Assert
+		if err == nil {
+			t.Fatal("RunWithNetwork() expected error, got nil")
+		}
+		if len(mock.commands) != 0 {
+			t.Errorf("RunWithNetwork() should not run tart with invalid options, got %v", mock.commands)
+		}
+	})
+
+	t.Run("when no-network mode and softnet options should append multicast block", func(t *testing.T) {
+		// Arrange
+		mock := newMockCommandRunner()
+		store := NewModeStore(t.TempDir())
+		if err := store.Save("test-vm", IsolationMode{NoNetwork: true}); err != nil {
+			t.Fatal(err)
+		}
+		client := createTestClient(mock, WithModeStore(store))
+		opts := NetworkOptions{Mode: NetworkSoftnet, SoftnetAllow: []string{"10.20.0.0/16"}}
+
+		// Act
+		err := client.RunWithNetwork("test-vm", false, false, nil, opts)
+
+		// Assert
+		if err != nil {
+			t.Fatalf("RunWithNetwork() unexpected error = %v", err)
+		}
+		if !slices.Contains(mock.commands[0], "--net-softnet-block=224.0.0.0/4") {
+			t.Errorf("RunWithNetwork() command %v should block multicast in no-network mode", mock.commands[0])
+		}
+		if opts.SoftnetBlock != nil {
+			t.Errorf("RunWithNetwork() should not modify caller options, got %v", opts.SoftnetBlock)
+		}
+	})
+
+	t.Run("when no-network mode and bridged options should reject as contradictory", func(t *testing.T) {
+		// Arrange
+		mock := newMockCommandRunner()
+		store := NewModeStore(t.TempDir())
+		if err := store.Save("test-vm", IsolationMode{NoNetwork: true}); err != nil {
+			t.Fatal(err)
+		}
+		client := createTestClient(mock, WithModeStore(store))
+
+		// Act
+		err := client.RunWithNetwork("test-vm", false, false, nil, NetworkOptions{Mode: NetworkBridged, BridgedInterface: "en0"})
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "not allowed in no-network isolation mode") {
+			t.Errorf("RunWithNetwork() error = %v, want isolation contradiction error", err)
+		}
+		if len(mock.commands) != 0 {
+			t.Errorf("RunWithNetwork() should not run tart, got %v", mock.commands)
+		}
+	})
+}
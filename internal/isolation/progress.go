@@ -0,0 +1,126 @@
+// Package isolation provides VM isolation and management for CALF.
+package isolation
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// PullStage identifies which part of an OCI image Tart is downloading.
+type PullStage string
+
+const (
+	// PullStageManifest is reported while Tart fetches the image manifest.
+	PullStageManifest PullStage = "manifest"
+
+	// PullStageDisk is reported while Tart downloads the VM disk layers.
+	// Byte counts are only known during this stage.
+	PullStageDisk PullStage = "disk"
+
+	// PullStageDone is reported once tart exits successfully.
+	PullStageDone PullStage = "done"
+)
+
+// PullProgress describes how far an OCI pull has progressed.
+type PullProgress struct {
+	// Stage is the part of the image being downloaded.
+	Stage PullStage
+	// BytesDownloaded is the compressed disk bytes downloaded so far.
+	BytesDownloaded int64
+	// BytesTotal is the compressed disk size, or 0 if not yet known.
+	BytesTotal int64
+}
+
+// ProgressFunc receives pull progress updates. It is called on the goroutine
+// reading tart's output, so it must not block for long.
+type ProgressFunc func(PullProgress)
+
+var (
+	// pullDiskPattern matches Tart's "pulling disk (25.3 GB compressed)..." line.
+	pullDiskPattern = regexp.MustCompile(`pulling disk \(([\d.]+) ?([KMGT]?B|bytes?) compressed\)`)
+
+	// pullPercentPattern matches Tart's percentage progress lines, e.g. "42%".
+	pullPercentPattern = regexp.MustCompile(`^(\d+(?:\.\d+)?)%$`)
+
+	// byteUnits are the decimal multipliers Tart's byte formatter uses.
+	byteUnits = map[string]float64{
+		"byte": 1, "bytes": 1, "B": 1,
+		"KB": 1e3, "MB": 1e6, "GB": 1e9, "TB": 1e12,
+	}
+)
+
+// pullProgressParser turns tart pull output lines into progress updates.
+// Tart reports the compressed disk size once and then percentages, so bytes
+// downloaded are derived from the percentage of the announced size.
+type pullProgressParser struct {
+	current PullProgress
+}
+
+// parse consumes one output line and reports whether progress changed.
+func (p *pullProgressParser) parse(line string) (PullProgress, bool) {
+	line = strings.TrimSpace(line)
+	switch {
+	case strings.HasPrefix(line, "pulling manifest"):
+		p.current = PullProgress{Stage: PullStageManifest}
+		return p.current, true
+
+	case pullDiskPattern.MatchString(line):
+		m := pullDiskPattern.FindStringSubmatch(line)
+		size, err := strconv.ParseFloat(m[1], 64)
+		if err != nil {
+			return p.current, false
+		}
+		p.current = PullProgress{Stage: PullStageDisk, BytesTotal: int64(size * byteUnits[m[2]])}
+		return p.current, true
+
+	case p.current.Stage == PullStageDisk && pullPercentPattern.MatchString(line):
+		percent, err := strconv.ParseFloat(pullPercentPattern.FindStringSubmatch(line)[1], 64)
+		if err != nil || percent > 100 {
+			return p.current, false
+		}
+		downloaded := int64(float64(p.current.BytesTotal) * percent / 100)
+		if downloaded == p.current.BytesDownloaded {
+			return p.current, false
+		}
+		p.current.BytesDownloaded = downloaded
+		return p.current, true
+	}
+	return p.current, false
+}
+
+// scanProgressLines is a bufio.SplitFunc that splits on both newlines and
+// carriage returns, since interactive progress output redraws with \r.
+func scanProgressLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// runWithProgress runs a tart command that may pull an image, streaming its
+// output through the progress parser. A nil progress func discards updates.
+func (c *TartClient) runWithProgress(progress ProgressFunc, args ...string) error {
+	parser := &pullProgressParser{}
+	if _, err := c.streamCommand(func(line string) {
+		if update, changed := parser.parse(line); changed && progress != nil {
+			progress(update)
+		}
+	}, args...); err != nil {
+		return err
+	}
+	if progress != nil {
+		final := parser.current
+		final.Stage = PullStageDone
+		final.BytesDownloaded = final.BytesTotal
+		progress(final)
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+// Package isolation provides VM isolation and management for CALF.
+package isolation
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// streamLines returns a commandStreamer that emits lines and records args.
+func streamLines(called *[]string, err error, lines ...string) commandStreamer {
+	return func(onLine func(string), args ...string) (string, error) {
+		*called = args
+		for _, line := range lines {
+			onLine(line)
+		}
+		return strings.Join(lines, "\n"), err
+	}
+}
+
+func TestPullProgressParser(t *testing.T) {
+	t.Run("when disk size announced should report total bytes", func(t *testing.T) {
+		// Arrange
+		parser := &pullProgressParser{}
+
+		// Act
+		got, changed := parser.parse("pulling disk (25.3 GB compressed)...")
+
+		// Assert
+		if !changed || got.Stage != PullStageDisk || got.BytesTotal != 25_300_000_000 {
+			t.Errorf("parse() = %+v, %v, want disk stage with 25.3 GB total", got, changed)
+		}
+	})
+
+	t.Run("when percentage follows disk size should derive bytes downloaded", func(t *testing.T) {
+		// Arrange
+		parser := &pullProgressParser{}
+		parser.parse("pulling disk (512 MB compressed)...")
+
+		// Act
+		got, changed := parser.parse("25%")
+
+		// Assert
+		if !changed || got.BytesDownloaded != 128_000_000 || got.BytesTotal != 512_000_000 {
+			t.Errorf("parse() = %+v, %v, want 128 MB of 512 MB", got, changed)
+		}
+	})
+
+	t.Run("when percentage appears before disk stage should ignore it", func(t *testing.T) {
+		// Arrange
+		parser := &pullProgressParser{}
+		parser.parse("pulling manifest...")
+
+		// Act
+		_, changed := parser.parse("50%")
+
+		// Assert
+		if changed {
+			t.Error("parse() reported change for percentage outside disk stage")
+		}
+	})
+
+	t.Run("when line is unrelated should not report change", func(t *testing.T) {
+		// Arrange
+		parser := &pullProgressParser{}
+
+		// Act
+		_, changed := parser.parse("pulling NVRAM...")
+
+		// Assert
+		if changed {
+			t.Error("parse() reported change for unrelated line")
+		}
+	})
+}
+
+func TestCloneWithProgress(t *testing.T) {
+	t.Run("when pulling from registry should report progress then done", func(t *testing.T) {
+		// Arrange
+		var called []string
+		client := createTestClient(newMockCommandRunner(), WithStreamCommand(streamLines(&called, nil,
+			"pulling manifest...", "pulling disk (2 GB compressed)...", "0%", "50%", "100%")))
+		var updates []PullProgress
+
+		// Act
+		err := client.CloneWithProgress("ghcr.io/org/calf-init:latest", "calf-dev", func(p PullProgress) {
+			updates = append(updates, p)
+		})
+
+		// Assert
+		if err != nil {
+			t.Fatalf("CloneWithProgress() unexpected error = %v", err)
+		}
+		if !slices.Equal(called, []string{"clone", "ghcr.io/org/calf-init:latest", "calf-dev"}) {
+			t.Errorf("CloneWithProgress() args = %v", called)
+		}
+		expected := []PullProgress{
+			{Stage: PullStageManifest},
+			{Stage: PullStageDisk, BytesTotal: 2e9},
+			{Stage: PullStageDisk, BytesDownloaded: 1e9, BytesTotal: 2e9},
+			{Stage: PullStageDisk, BytesDownloaded: 2e9, BytesTotal: 2e9},
+			{Stage: PullStageDone, BytesDownloaded: 2e9, BytesTotal: 2e9},
+		}
+		if !slices.Equal(updates, expected) {
+			t.Errorf("CloneWithProgress() updates = %+v, want %+v", updates, expected)
+		}
+	})
+
+	t.Run("when cloning through the provider should stream to the client's callback", func(t *testing.T) {
+		// Arrange
+		var called []string
+		var updates []PullProgress
+		client := createTestClient(newMockCommandRunner(),
+			WithStreamCommand(streamLines(&called, nil, "pulling disk (2 GB compressed)...", "50%")),
+			WithCloneProgress(func(p PullProgress) { updates = append(updates, p) }),
+		)
+
+		// Act
+		err := client.Clone("ghcr.io/org/calf-init:latest", "calf-dev")
+
+		// Assert
+		if err != nil {
+			t.Fatalf("Clone() unexpected error = %v", err)
+		}
+		if len(updates) != 3 || updates[1] != (PullProgress{Stage: PullStageDisk, BytesDownloaded: 1e9, BytesTotal: 2e9}) {
+			t.Errorf("Clone() updates = %+v, want disk progress then done", updates)
+		}
+	})
+
+	t.Run("when clone fails should return wrapped error without done update", func(t *testing.T) {
+		// Arrange
+		var called []string
+		client := createTestClient(newMockCommandRunner(), WithStreamCommand(streamLines(&called, fmt.Errorf("exit status 1"))))
+		var updates []PullProgress
+
+		// Act
+		err := client.CloneWithProgress("ghcr.io/org/calf-init:latest", "calf-dev", func(p PullProgress) {
+			updates = append(updates, p)
+		})
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "failed to clone VM calf-dev") {
+			t.Errorf("CloneWithProgress() error = %v, want wrapped clone error", err)
+		}
+		if len(updates) != 0 {
+			t.Errorf("CloneWithProgress() updates = %+v, want none", updates)
+		}
+	})
+}
+
+func TestStreamTartCommand(t *testing.T) {
+	t.Run("when command redraws with carriage returns should deliver each line", func(t *testing.T) {
+		// Arrange
+		script := filepath.Join(t.TempDir(), "tart")
+		content := "#!/bin/sh\nprintf 'pulling disk (1 GB compressed)...\\n10%%\\r20%%\\r'\necho done >&2\n"
+		if err := os.WriteFile(script, []byte(content), 0755); err != nil {
+			t.Fatal(err)
+		}
+		client := NewTartClient(WithTartPath(script))
+		var lines []string
+
+		// Act
+		output, err := client.streamTartCommand(func(line string) { lines = append(lines, line) }, "pull")
+
+		// Assert
+		if err != nil {
+			t.Fatalf("streamTartCommand() unexpected error = %v", err)
+		}
+		expected := []string{"pulling disk (1 GB compressed)...", "10%", "20%", "done"}
+		if !slices.Equal(lines, expected) {
+			t.Errorf("streamTartCommand() lines = %q, want %q", lines, expected)
+		}
+		if !strings.Contains(output, "20%") {
+			t.Errorf("streamTartCommand() output = %q, want full output", output)
+		}
+	})
+}
@@ -0,0 +1,88 @@
+// Package isolation provides VM isolation and management for CALF.
+package isolation
+
+import "fmt"
+
+const (
+	// ProviderTart runs VMs with Tart on macOS hosts. The default.
+	ProviderTart = "tart"
+
+	// ProviderLima runs VMs with Lima (QEMU or vz) via limactl, for Linux hosts.
+	ProviderLima = "lima"
+)
+
+// Provider is a VM backend. TartClient, LimaClient and SimProvider implement
+// it; the isolation commands only use this interface, so the backend can be
+// chosen from config.
+type Provider interface {
+	// Name returns the provider name, e.g. "tart".
+	Name() string
+	// Clone creates VM name from an image, template, or existing VM.
+	Clone(image, name string) error
+	// Set configures VM resources: CPUs, memory in MB, and disk size in GB.
+	// Zero or empty values are left unchanged.
+	Set(name string, cpu int, memory int, disk string) error
+	// Launch starts a VM in the background with the given options and host
+	// directory shares, and returns the PID of the process running it.
+	Launch(name string, opts LaunchOptions) (int, error)
+	// Stop stops a running VM.
+	Stop(name string, force bool) error
+	// Delete removes a VM.
+	Delete(name string) error
+	// List returns all VMs and their states.
+	List() (TartListOutput, error)
+	// ResolveIP waits for the address at which a running VM is reachable.
+	ResolveIP(name string, opts IPOptions) (string, error)
+	// Snapshot lists all VMs once to answer many state queries.
+	Snapshot() (*StateSnapshot, error)
+	// GetState returns the current state of a VM.
+	GetState(name string) VMState
+}
+
+var (
+	_ Provider     = (*TartClient)(nil)
+	_ Provider     = (*LimaClient)(nil)
+	_ Provider     = (*SimProvider)(nil)
+	_ Suspender    = (*TartClient)(nil)
+	_ Suspender    = (*SimProvider)(nil)
+	_ Remote       = (*TartClient)(nil)
+	_ ModeVerifier = (*LimaClient)(nil)
+)
+
+// Suspender is implemented by providers that can save a running VM's memory
+// to disk and resume it later. Launch with Suspendable set requires it.
+type Suspender interface {
+	Suspend(name string) error
+}
+
+// Remote is implemented by providers that can run VMs on another machine.
+type Remote interface {
+	// RemoteHost returns the host the VMs run on, or nil if they run locally.
+	RemoteHost() *RemoteHost
+}
+
+// ModeVerifier is implemented by providers that cannot enforce every
+// isolation mode. Init checks the requested mode with it before recording it.
+type ModeVerifier interface {
+	// VerifyMode returns an error if the provider cannot enforce mode.
+	VerifyMode(mode IsolationMode) error
+}
+
+// Name returns "tart".
+func (c *TartClient) Name() string {
+	return ProviderTart
+}
+
+// RemoteHost returns the host set by WithRemoteHost, or nil if tart runs locally.
+func (c *TartClient) RemoteHost() *RemoteHost {
+	return c.remote
+}
+
+// ValidateProvider checks that name is a known provider.
+func ValidateProvider(name string) error {
+	switch name {
+	case ProviderTart, ProviderLima, ProviderSim:
+		return nil
+	}
+	return fmt.Errorf("unknown VM provider '%s': must be one of: %s, %s, %s", name, ProviderTart, ProviderLima, ProviderSim)
+}
@@ -0,0 +1,342 @@
+// Package isolation provides VM isolation and management for CALF.
+package isolation
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RemoteHost is a Mac reached over SSH that runs tart and holds the caches
+// on behalf of calf, so several laptops can share one host. Commands run
+// non-interactively (BatchMode), so the host must accept key authentication.
+type RemoteHost struct {
+	target  string
+	sshPath string
+}
+
+// RemoteHostOption configures a RemoteHost.
+type RemoteHostOption func(*RemoteHost)
+
+// WithSSHPath overrides the ssh binary used to reach the host.
+// Intended for use in tests.
+func WithSSHPath(path string) RemoteHostOption {
+	return func(h *RemoteHost) { h.sshPath = path }
+}
+
+// NewRemoteHost returns a RemoteHost for an ssh destination: a host alias
+// from ~/.ssh/config, [user@]host, or ssh://[user@]host[:port].
+func NewRemoteHost(target string, opts ...RemoteHostOption) (*RemoteHost, error) {
+	if target == "" || strings.HasPrefix(target, "-") || strings.ContainsAny(target, " \t\n") {
+		return nil, fmt.Errorf("invalid remote host '%s': must be an ssh destination such as user@host", target)
+	}
+	h := &RemoteHost{target: target, sshPath: "ssh"}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h, nil
+}
+
+// Target returns the ssh destination of the host.
+func (h *RemoteHost) Target() string {
+	return h.target
+}
+
+// Command returns a command that runs name with args on the host. Arguments
+// are quoted, so they reach the remote program unchanged.
+func (h *RemoteHost) Command(name string, args ...string) *exec.Cmd {
+	return h.Shell(shellJoin(append([]string{name}, args...)))
+}
+
+// Shell returns a command that runs script with the host's login shell.
+func (h *RemoteHost) Shell(script string) *exec.Cmd {
+	return exec.Command(h.sshPath, "-o", "BatchMode=yes", "--", h.target, script)
+}
+
+// Output runs script on the host and returns its stdout.
+func (h *RemoteHost) Output(script string) (string, error) {
+	cmd := h.Shell(script)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("command on %s failed: %w\nstderr: %s", h.target, err, stderr.String())
+	}
+	return stdout.String(), nil
+}
+
+// Start runs name with args on the host in the background, detached from the
+// SSH session so it outlives calf, and returns its PID on the host. Output is
+// appended to the file output on the host, or discarded if output is empty.
+func (h *RemoteHost) Start(output, name string, args ...string) (int, error) {
+	redirect := "/dev/null"
+	if output != "" {
+		redirect = shellQuote(output)
+	}
+	script := fmt.Sprintf("nohup %s >>%s 2>&1 </dev/null & echo $!", shellJoin(append([]string{name}, args...)), redirect)
+	output, err := h.Output(script)
+	if err != nil {
+		return 0, err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(output))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read PID of %s on %s: %q", name, h.target, output)
+	}
+	return pid, nil
+}
+
+// JumpArgs returns ssh arguments that tunnel a connection to a VM through
+// the host, for VMs whose addresses are only reachable from the host:
+//
+//	ssh $(JumpArgs) admin@<vm ip>
+//
+// Batch mode is left off, so the VM can still ask for a password.
+func (h *RemoteHost) JumpArgs() []string {
+	return []string{"-J", h.target}
+}
+
+// Dial connects to address as seen from the host, tunnelled over SSH. The
+// address is probed from the host first, so an unreachable port fails fast
+// instead of yielding a connection that closes immediately. It has the
+// signature of net.DialTimeout and is used to wait for a VM's SSH server.
+func (h *RemoteHost) Dial(network, address string, timeout time.Duration) (net.Conn, error) {
+	ip, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	seconds := max(int(timeout/time.Second), 1)
+	if _, err := h.Output(shellJoin([]string{"nc", "-z", "-w", strconv.Itoa(seconds), ip, port})); err != nil {
+		return nil, fmt.Errorf("failed to reach %s from %s: %w", address, h.target, err)
+	}
+
+	cmd := exec.Command(h.sshPath, "-o", "BatchMode=yes", "-W", address, "--", h.target)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to tunnel to %s through %s: %w", address, h.target, err)
+	}
+	return &tunnelConn{cmd: cmd, Reader: stdout, WriteCloser: stdin, address: address}, nil
+}
+
+// tunnelConn is a connection carried by the stdin and stdout of `ssh -W`.
+// Deadlines are not supported.
+type tunnelConn struct {
+	io.Reader
+	io.WriteCloser
+	cmd     *exec.Cmd
+	address string
+}
+
+// Close ends the tunnel.
+func (c *tunnelConn) Close() error {
+	c.WriteCloser.Close()
+	c.cmd.Process.Kill()
+	c.cmd.Wait()
+	return nil
+}
+
+func (c *tunnelConn) LocalAddr() net.Addr                { return tunnelAddr("localhost") }
+func (c *tunnelConn) RemoteAddr() net.Addr               { return tunnelAddr(c.address) }
+func (c *tunnelConn) SetDeadline(t time.Time) error      { return errors.ErrUnsupported }
+func (c *tunnelConn) SetReadDeadline(t time.Time) error  { return errors.ErrUnsupported }
+func (c *tunnelConn) SetWriteDeadline(t time.Time) error { return errors.ErrUnsupported }
+
+// tunnelAddr is an endpoint of a tunnelConn.
+type tunnelAddr string
+
+func (a tunnelAddr) Network() string { return "ssh" }
+func (a tunnelAddr) String() string  { return string(a) }
+
+// shellJoin quotes each word for a POSIX shell and joins them with spaces.
+func shellJoin(words []string) string {
+	quoted := make([]string, len(words))
+	for i, w := range words {
+		quoted[i] = shellQuote(w)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// shellQuote quotes s for a POSIX shell on a remote host. Words made only of
+// safe characters are left bare so remote commands stay readable in errors.
+// A leading ~/ is left to expand to the remote home directory, as it would
+// unquoted, so paths under stores rooted at "~" work without looking it up.
+func shellQuote(s string) string {
+	if rest, ok := strings.CutPrefix(s, "~/"); ok {
+		return `"$HOME"/` + shellQuote(rest)
+	}
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_=+./:,@%") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// remoteArgPath returns path as an argument for a program run on a remote
+// host. Paths under ~/ are made relative, since ssh starts programs in the
+// home directory and does not expand quoted tildes.
+func remoteArgPath(path string) string {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		return rest
+	}
+	return path
+}
+
+// remoteCacheHost performs cache operations on a remote host with POSIX
+// shell tools. Scripts print "missing" when a path does not exist.
+type remoteCacheHost struct {
+	host *RemoteHost
+}
+
+// output runs script on the host, mapping the "missing" marker to an error
+// wrapping fs.ErrNotExist.
+func (r remoteCacheHost) output(path, script string) (string, error) {
+	output, err := r.host.Output(script)
+	if err != nil {
+		return "", err
+	}
+	output = strings.TrimSpace(output)
+	if output == "missing" {
+		return "", &fs.PathError{Op: "stat", Path: path, Err: fs.ErrNotExist}
+	}
+	return output, nil
+}
+
+func (r remoteCacheHost) stat(path string) (time.Time, error) {
+	p := shellQuote(path)
+	// GNU stat takes -c, BSD (macOS) stat takes -f.
+	output, err := r.output(path, fmt.Sprintf("if [ -e %s ]; then stat -c %%Y %s 2>/dev/null || stat -f %%m %s; else echo missing; fi", p, p, p))
+	if err != nil {
+		return time.Time{}, err
+	}
+	seconds, err := strconv.ParseInt(output, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read modification time of %s: %q", path, output)
+	}
+	return time.Unix(seconds, 0), nil
+}
+
+func (r remoteCacheHost) isSymlink(path string) (bool, error) {
+	p := shellQuote(path)
+	output, err := r.output(path, fmt.Sprintf("if [ -L %s ]; then echo link; elif [ -e %s ]; then echo file; else echo missing; fi", p, p))
+	return output == "link", err
+}
+
+func (r remoteCacheHost) evalSymlinks(path string) (string, error) {
+	return r.output(path, fmt.Sprintf("cd -P %s 2>/dev/null && pwd -P || echo missing", shellQuote(path)))
+}
+
+func (r remoteCacheHost) subdirs(path string) ([]string, error) {
+	p := shellQuote(path)
+	output, err := r.output(path, fmt.Sprintf("if [ -d %s ]; then find %s/ -mindepth 1 -maxdepth 1 -type d; else echo missing; fi", p, p))
+	if err != nil {
+		return nil, err
+	}
+	dirs := []string{}
+	for _, line := range strings.Split(output, "\n") {
+		if line != "" {
+			dirs = append(dirs, filepath.Base(line))
+		}
+	}
+	slices.Sort(dirs)
+	return dirs, nil
+}
+
+func (r remoteCacheHost) mkdirAll(path string) error {
+	_, err := r.host.Output("mkdir -p " + shellQuote(path))
+	return err
+}
+
+func (r remoteCacheHost) removeAll(path string) error {
+	p := shellQuote(path)
+	_, err := r.host.Output(fmt.Sprintf("chmod -R u+w %s 2>/dev/null; rm -rf %s", p, p))
+	return err
+}
+
+func (r remoteCacheHost) clearContents(path string) error {
+	p := shellQuote(path)
+	_, err := r.host.Output(fmt.Sprintf("find %s/ -mindepth 1 -maxdepth 1 -exec chmod -R u+w {} + 2>/dev/null; find %s/ -mindepth 1 -maxdepth 1 -exec rm -rf {} +", p, p))
+	return err
+}
+
+func (r remoteCacheHost) diskUsage(path string) int64 {
+	output, err := r.host.Output(shellJoin([]string{"du", "-sk", path}))
+	if err != nil {
+		return 0
+	}
+	return parseDiskUsage(output)
+}
+
+func (r remoteCacheHost) git(args ...string) error {
+	_, err := r.host.Output(shellJoin(append([]string{"git"}, args...)))
+	return err
+}
+
+// readFile prints a "found" line before the contents, since a file may
+// contain anything, including the "missing" marker.
+func (r remoteCacheHost) readFile(path string) ([]byte, error) {
+	p := shellQuote(path)
+	output, err := r.host.Output(fmt.Sprintf("if [ -f %s ]; then echo found; cat %s; else echo missing; fi", p, p))
+	if err != nil {
+		return nil, err
+	}
+	marker, data, _ := strings.Cut(output, "\n")
+	if marker != "found" {
+		return nil, &fs.PathError{Op: "open", Path: path, Err: fs.ErrNotExist}
+	}
+	return []byte(data), nil
+}
+
+// readTail prints the size of the file before its last n bytes.
+func (r remoteCacheHost) readTail(path string, n int64) ([]byte, bool, error) {
+	p := shellQuote(path)
+	output, err := r.host.Output(fmt.Sprintf("if [ -f %s ]; then wc -c < %s; tail -c %d %s; else echo missing; fi", p, p, n, p))
+	if err != nil {
+		return nil, false, err
+	}
+	line, data, _ := strings.Cut(output, "\n")
+	if line == "missing" {
+		return nil, false, &fs.PathError{Op: "open", Path: path, Err: fs.ErrNotExist}
+	}
+	size, err := strconv.ParseInt(strings.TrimSpace(line), 10, 64)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read size of %s: %q", path, line)
+	}
+	return []byte(data), size > n, nil
+}
+
+func (r remoteCacheHost) writeFile(path string, data []byte) error {
+	script := fmt.Sprintf("mkdir -p %s && cat > %s", shellQuote(filepath.Dir(path)), shellQuote(path))
+	cmd := r.host.Shell(script)
+	cmd.Stdin = bytes.NewReader(data)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("command on %s failed: %w\nstderr: %s", r.host.Target(), err, stderr.String())
+	}
+	return nil
+}
+
+// rotate moves all files in one script, so rotating costs one connection.
+func (r remoteCacheHost) rotate(path string, keep int) error {
+	var script []string
+	for i := keep - 1; i >= 1; i-- {
+		from := shellQuote(rotatedName(path, i-1))
+		script = append(script, fmt.Sprintf("if [ -e %s ]; then mv -f %s %s; fi", from, from, shellQuote(rotatedName(path, i))))
+	}
+	_, err := r.host.Output(strings.Join(script, "; "))
+	return err
+}
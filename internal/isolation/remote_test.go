@@ -0,0 +1,254 @@
+// Package isolation provides VM isolation and management for CALF.
+package isolation
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSSHScript stands in for ssh: it skips options up to "--" and the
+// destination, logs the remote script, and runs it with the local shell.
+const fakeSSHScript = `#!/bin/sh
+while [ "$1" != "--" ]; do shift; done
+shift 2
+printf '%s\n' "$1" >> "$(dirname "$0")/ssh.log"
+exec sh -c "$1"
+`
+
+// newFakeRemoteHost returns a RemoteHost whose commands run locally, with a
+// fake tart on the PATH that echoes its arguments, and the path of the log
+// of remote scripts.
+func newFakeRemoteHost(t *testing.T) (*RemoteHost, string) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "ssh"), []byte(fakeSSHScript), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "tart"), []byte("#!/bin/sh\necho \"tart $*\"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	host, err := NewRemoteHost("dev@studio.local", WithSSHPath(filepath.Join(dir, "ssh")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return host, filepath.Join(dir, "ssh.log")
+}
+
+func TestNewRemoteHost(t *testing.T) {
+	t.Run("when target looks like an option should return error", func(t *testing.T) {
+		// Act
+		_, err := NewRemoteHost("-oProxyCommand=evil")
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "ssh destination") {
+			t.Errorf("NewRemoteHost() error = %v, want invalid destination", err)
+		}
+	})
+}
+
+func TestRemoteHostCommand(t *testing.T) {
+	t.Run("when args need quoting should reach remote program unchanged", func(t *testing.T) {
+		// Arrange
+		host, _ := newFakeRemoteHost(t)
+
+		// Act
+		output, err := host.Command("printf", "%s|", "a b", "it's", "$HOME").Output()
+
+		// Assert
+		if err != nil {
+			t.Fatalf("Command() unexpected error = %v", err)
+		}
+		if string(output) != "a b|it's|$HOME|" {
+			t.Errorf("output = %q, want args unchanged", output)
+		}
+	})
+
+	t.Run("when starting in background should return remote pid", func(t *testing.T) {
+		// Arrange
+		host, _ := newFakeRemoteHost(t)
+
+		// Act
+		pid, err := host.Start("", "sleep", "0")
+
+		// Assert
+		if err != nil || pid <= 0 {
+			t.Errorf("Start() = %d, %v, want pid", pid, err)
+		}
+	})
+
+	t.Run("when tunnelling to a VM should jump through host", func(t *testing.T) {
+		// Arrange
+		host, _ := newFakeRemoteHost(t)
+
+		// Act
+		args := host.JumpArgs()
+
+		// Assert
+		if !slices.Equal(args, []string{"-J", "dev@studio.local"}) {
+			t.Errorf("JumpArgs() = %v, want -J through host", args)
+		}
+	})
+}
+
+func TestTartClientRemoteHost(t *testing.T) {
+	t.Run("when remote host set should run tart on host without local install", func(t *testing.T) {
+		// Arrange
+		host, log := newFakeRemoteHost(t)
+		client := NewTartClient(WithRemoteHost(host), WithLookPath(func(string) (string, error) {
+			t.Fatal("expected no local tart lookup")
+			return "", nil
+		}))
+
+		// Act
+		err := client.Stop("calf-dev", true)
+
+		// Assert
+		if err != nil {
+			t.Fatalf("Stop() unexpected error = %v", err)
+		}
+		scripts, _ := os.ReadFile(log)
+		if strings.TrimSpace(string(scripts)) != "tart stop calf-dev --timeout=0" {
+			t.Errorf("remote scripts = %q, want tart stop", scripts)
+		}
+	})
+
+	t.Run("when launching should start tart detached on host", func(t *testing.T) {
+		// Arrange
+		host, log := newFakeRemoteHost(t)
+		client := NewTartClient(WithRemoteHost(host), WithLogStore(NewLogStore(t.TempDir())))
+
+		// Act
+		pid, err := client.Launch("calf-dev", LaunchOptions{Headless: true})
+
+		// Assert
+		if err != nil || pid <= 0 {
+			t.Fatalf("Launch() = %d, %v, want remote pid", pid, err)
+		}
+		scripts, _ := os.ReadFile(log)
+		if !strings.HasPrefix(string(scripts), "nohup tart run --headless") {
+			t.Errorf("remote scripts = %q, want nohup tart run", scripts)
+		}
+	})
+}
+
+func TestRemoteStores(t *testing.T) {
+	t.Run("when VM runs on host should keep its mode and boot log in the host's home", func(t *testing.T) {
+		// Arrange
+		host, _ := newFakeRemoteHost(t)
+		home := t.TempDir()
+		t.Setenv("HOME", home)
+		modes := NewRemoteModeStore(host)
+		logs := NewRemoteLogStore(host)
+		if err := modes.Save("calf-dev", IsolationMode{NoMount: true}); err != nil {
+			t.Fatalf("Save() unexpected error = %v", err)
+		}
+		client := NewTartClient(WithRemoteHost(host), WithModeStore(modes), WithLogStore(logs))
+
+		// Act
+		_, err := client.Launch("calf-dev", LaunchOptions{Headless: true, Serial: true})
+
+		// Assert
+		if err != nil {
+			t.Fatalf("Launch() unexpected error = %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(home, ".calf", "isolation", "vms", "calf-dev", modeFileName)); err != nil {
+			t.Errorf("expected mode file in host home, got %v", err)
+		}
+		want := []string{"tart run --headless --serial-path=.calf/isolation/logs/calf-dev/serial.log calf-dev"}
+		var lines []string
+		for range 100 {
+			if lines, _ = logs.Tail("calf-dev", 1); slices.Equal(lines, want) {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if !slices.Equal(lines, want) {
+			t.Errorf("boot log tail = %q, want tart output with serial log relative to home and no shares", lines)
+		}
+	})
+
+	t.Run("when host has no mode file should use shared mode", func(t *testing.T) {
+		// Arrange
+		host, _ := newFakeRemoteHost(t)
+		t.Setenv("HOME", t.TempDir())
+
+		// Act
+		mode, err := NewRemoteModeStore(host).Load("dev-1")
+
+		// Assert
+		if err != nil || !mode.IsShared() {
+			t.Errorf("Load() = %+v, %v, want shared mode", mode, err)
+		}
+	})
+}
+
+func TestRemoteCacheManager(t *testing.T) {
+	t.Run("when caches set up remotely should report them in remote home", func(t *testing.T) {
+		// Arrange
+		host, _ := newFakeRemoteHost(t)
+		home := t.TempDir()
+		t.Setenv("HOME", home)
+		cm, err := NewRemoteCacheManager(host, &strings.Builder{})
+		if err != nil {
+			t.Fatalf("NewRemoteCacheManager() unexpected error = %v", err)
+		}
+		if err := cm.SetupGitCache(); err != nil {
+			t.Fatal(err)
+		}
+		os.MkdirAll(filepath.Join(home, ".calf-cache", "git", "repo-b"), 0755)
+		os.MkdirAll(filepath.Join(home, ".calf-cache", "git", "repo-a"), 0755)
+
+		// Act
+		info, infoErr := cm.GetGitCacheInfo()
+		repos, reposErr := cm.GetCachedGitRepos()
+		npm, npmErr := cm.GetNpmCacheInfo()
+
+		// Assert
+		if infoErr != nil || !info.Available || info.Path != filepath.Join(home, ".calf-cache", "git") || info.LastAccess.IsZero() {
+			t.Errorf("GetGitCacheInfo() = %+v, %v, want available remote cache", info, infoErr)
+		}
+		if reposErr != nil || !slices.Equal(repos, []string{"repo-a", "repo-b"}) {
+			t.Errorf("GetCachedGitRepos() = %v, %v, want [repo-a repo-b]", repos, reposErr)
+		}
+		if npmErr != nil || npm.Available {
+			t.Errorf("GetNpmCacheInfo() = %+v, %v, want unavailable", npm, npmErr)
+		}
+	})
+
+	t.Run("when clearing remotely should remove read-only files and recreate cache", func(t *testing.T) {
+		// Arrange
+		host, _ := newFakeRemoteHost(t)
+		home := t.TempDir()
+		t.Setenv("HOME", home)
+		cm, err := NewRemoteCacheManager(host, &strings.Builder{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := cm.SetupGoCache(); err != nil {
+			t.Fatal(err)
+		}
+		module := filepath.Join(home, ".calf-cache", "go", "pkg", "mod", "example.com")
+		os.MkdirAll(module, 0755)
+		os.WriteFile(filepath.Join(module, "go.mod"), []byte("module example.com\n"), 0444)
+		os.Chmod(module, 0555)
+
+		// Act
+		cleared, err := cm.Clear("go", false)
+
+		// Assert
+		if err != nil || !cleared {
+			t.Fatalf("Clear() = %v, %v, want cleared", cleared, err)
+		}
+		if _, err := os.Stat(module); !os.IsNotExist(err) {
+			t.Errorf("expected module cache removed, stat error = %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(home, ".calf-cache", "go", "pkg", "mod")); err != nil {
+			t.Errorf("expected cache recreated, stat error = %v", err)
+		}
+	})
+}
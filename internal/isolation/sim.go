@@ -0,0 +1,479 @@
+// Package isolation provides VM isolation and management for CALF.
+package isolation
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// ProviderSim is the in-memory simulator, for demos and end-to-end tests
+	// on hosts without a hypervisor.
+	ProviderSim = "sim"
+
+	// simStateFileName is the simulator state file under ~/.calf/isolation/.
+	simStateFileName = "sim.yaml"
+
+	// simVMsDirName is the directory of simulated VMs' calf config, such as
+	// their isolation modes, under ~/.calf/isolation/.
+	simVMsDirName = "sim-vms"
+
+	// simDefaultDiskGB is the disk size of VMs cloned from an image.
+	simDefaultDiskGB = 50
+
+	// simPollInterval is how often the simulator's ResolveIP polls.
+	simPollInterval = 10 * time.Millisecond
+)
+
+// SimOp names a simulator operation that failures can be injected into.
+type SimOp string
+
+// Simulator operations, one per Provider method that can fail.
+const (
+	SimClone   SimOp = "clone"
+	SimSet     SimOp = "set"
+	SimLaunch  SimOp = "launch"
+	SimStop    SimOp = "stop"
+	SimSuspend SimOp = "suspend"
+	SimDelete  SimOp = "delete"
+	SimList    SimOp = "list"
+	SimIP      SimOp = "ip"
+)
+
+// SimVM is a simulated VM.
+type SimVM struct {
+	Name   string  `yaml:"name"`
+	State  VMState `yaml:"state"`
+	Source string  `yaml:"source"` // Image or VM it was cloned from
+	CPU    int     `yaml:"cpu,omitempty"`
+	Memory int     `yaml:"memory,omitempty"` // MB
+	DiskGB int     `yaml:"disk_gb"`
+	IP     string  `yaml:"ip,omitempty"`
+	PID    int     `yaml:"pid,omitempty"`
+	// Suspendable records that the VM was launched suspendable.
+	Suspendable bool `yaml:"suspendable,omitempty"`
+	// BootPolls is how many more IP polls return no address before the VM
+	// has "booted".
+	BootPolls int `yaml:"boot_polls,omitempty"`
+}
+
+// simState is everything the simulator knows, as persisted in its state file.
+type simState struct {
+	VMs []SimVM `yaml:"vms"`
+	// Failures maps an operation to the error message it fails with.
+	Failures map[SimOp]string `yaml:"failures,omitempty"`
+	NextIP   int              `yaml:"next_ip"`
+	NextPID  int              `yaml:"next_pid"`
+}
+
+// vm returns the named VM, or nil.
+func (s *simState) vm(name string) *SimVM {
+	idx := slices.IndexFunc(s.VMs, func(vm SimVM) bool { return vm.Name == name })
+	if idx == -1 {
+		return nil
+	}
+	return &s.VMs[idx]
+}
+
+// SimOption configures a SimProvider.
+type SimOption func(*SimProvider)
+
+// WithSimStateFile persists simulator state to path, so separate calf
+// invocations share the same simulated host. Without it, state lives only in
+// memory.
+func WithSimStateFile(path string) SimOption {
+	return func(s *SimProvider) { s.path = path }
+}
+
+// WithSimBootPolls sets how many IP polls a freshly launched VM answers
+// without an address, to simulate boot time.
+func WithSimBootPolls(n int) SimOption {
+	return func(s *SimProvider) { s.bootPolls = n }
+}
+
+// WithSimVMs seeds the simulator with VMs.
+func WithSimVMs(vms ...SimVM) SimOption {
+	return func(s *SimProvider) { s.state.VMs = append(s.state.VMs, vms...) }
+}
+
+// SimProvider is a Provider that simulates VMs without a hypervisor. It
+// models clones, states, IPs, disk sizes and PIDs, supports suspend, and can
+// fail any operation on request (see Fail), so whole workflows can be
+// rehearsed and tested on any host.
+type SimProvider struct {
+	mu        sync.Mutex
+	path      string
+	bootPolls int
+	state     simState
+}
+
+// NewDefaultSimProvider creates a SimProvider persisted under the current
+// user's home directory (~/.calf/isolation/sim.yaml).
+func NewDefaultSimProvider() *SimProvider {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		homeDir = ""
+	}
+	return NewSimProvider(WithSimStateFile(filepath.Join(homeDir, ".calf", "isolation", simStateFileName)))
+}
+
+// NewDefaultSimModeStore creates the ModeStore for the simulated VMs persisted
+// by NewDefaultSimProvider (~/.calf/isolation/sim-vms/), so rehearsals never
+// touch the modes of real VMs with the same names.
+func NewDefaultSimModeStore() *ModeStore {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		homeDir = ""
+	}
+	return NewSimModeStore(filepath.Join(homeDir, ".calf", "isolation", simVMsDirName))
+}
+
+// NewSimModeStore creates a ModeStore for simulated VMs that keeps a directory
+// per VM under dir. Modes are never migrated from calf-bootstrap markers.
+func NewSimModeStore(dir string) *ModeStore {
+	return &ModeStore{dir: dir, host: localCacheHost{}}
+}
+
+// NewSimProvider creates a SimProvider with optional configuration. State
+// lives only in memory unless WithSimStateFile is given.
+func NewSimProvider(opts ...SimOption) *SimProvider {
+	s := &SimProvider{}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Name returns "sim".
+func (s *SimProvider) Name() string {
+	return ProviderSim
+}
+
+// Fail makes every later call of op fail with message, until cleared by
+// calling Fail with an empty message. Failures are persisted with the state,
+// so they can also be set by editing the state file.
+func (s *SimProvider) Fail(op SimOp, message string) error {
+	return s.update("", func(st *simState) error {
+		if message == "" {
+			delete(st.Failures, op)
+			return nil
+		}
+		if st.Failures == nil {
+			st.Failures = map[SimOp]string{}
+		}
+		st.Failures[op] = message
+		return nil
+	})
+}
+
+// VM returns a copy of a simulated VM, for inspecting details that the
+// Provider interface does not expose.
+func (s *SimProvider) VM(name string) (SimVM, bool, error) {
+	var vm SimVM
+	found := false
+	err := s.read("", func(st *simState) error {
+		if v := st.vm(name); v != nil {
+			vm, found = *v, true
+		}
+		return nil
+	})
+	return vm, found, err
+}
+
+// Clone creates VM name. If image is an existing VM it is copied, disk and
+// resources included, which is how snapshots are taken and restored;
+// otherwise image is treated as a base image.
+func (s *SimProvider) Clone(image, name string) error {
+	err := s.update(SimClone, func(st *simState) error {
+		if st.vm(name) != nil {
+			return fmt.Errorf("VM %s already exists", name)
+		}
+		if image == "" {
+			return fmt.Errorf("no image to clone %s from", name)
+		}
+		vm := SimVM{Name: name, State: StateStopped, Source: image, DiskGB: simDefaultDiskGB}
+		if src := st.vm(image); src != nil {
+			if src.State == StateRunning {
+				return fmt.Errorf("VM %s must be stopped before cloning", image)
+			}
+			vm.CPU, vm.Memory, vm.DiskGB = src.CPU, src.Memory, src.DiskGB
+		}
+		st.VMs = append(st.VMs, vm)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to clone %s to %s: %w", image, name, err)
+	}
+	return nil
+}
+
+// Set configures VM resources. Disks can grow but not shrink, like tart.
+func (s *SimProvider) Set(name string, cpu int, memory int, disk string) error {
+	err := s.update(SimSet, func(st *simState) error {
+		vm, err := st.existing(name)
+		if err != nil {
+			return err
+		}
+		if cpu > 0 {
+			vm.CPU = cpu
+		}
+		if memory > 0 {
+			vm.Memory = memory
+		}
+		if disk != "" {
+			var gb int
+			if _, err := fmt.Sscanf(disk, "%d", &gb); err != nil || gb <= 0 {
+				return fmt.Errorf("invalid disk size '%s'", disk)
+			}
+			if gb < vm.DiskGB {
+				return fmt.Errorf("cannot shrink disk of %s from %d GB to %d GB", name, vm.DiskGB, gb)
+			}
+			vm.DiskGB = gb
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to configure VM %s: %w", name, err)
+	}
+	return nil
+}
+
+// Launch starts or resumes a VM and returns its simulated PID. Its IP is
+// assigned on first launch and kept, like a DHCP lease.
+func (s *SimProvider) Launch(name string, opts LaunchOptions) (int, error) {
+	var pid int
+	err := s.update(SimLaunch, func(st *simState) error {
+		vm, err := st.existing(name)
+		if err != nil {
+			return err
+		}
+		if vm.State == StateRunning {
+			return fmt.Errorf("VM %s is already running", name)
+		}
+		if vm.State != StateSuspended {
+			vm.BootPolls = s.bootPolls
+		}
+		if vm.IP == "" {
+			st.NextIP++
+			vm.IP = fmt.Sprintf("192.168.64.%d", st.NextIP+1)
+		}
+		st.NextPID++
+		vm.PID = 10000 + st.NextPID
+		vm.State = StateRunning
+		vm.Suspendable = opts.Suspendable
+		pid = vm.PID
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to start VM %s: %w", name, err)
+	}
+	return pid, nil
+}
+
+// Stop stops a running VM.
+func (s *SimProvider) Stop(name string, force bool) error {
+	err := s.update(SimStop, func(st *simState) error {
+		vm, err := st.existing(name)
+		if err != nil {
+			return err
+		}
+		if vm.State != StateRunning {
+			return fmt.Errorf("VM %s is not running", name)
+		}
+		vm.State, vm.PID = StateStopped, 0
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to stop VM %s: %w", name, err)
+	}
+	return nil
+}
+
+// Suspend suspends a VM that was launched suspendable.
+func (s *SimProvider) Suspend(name string) error {
+	err := s.update(SimSuspend, func(st *simState) error {
+		vm, err := st.existing(name)
+		if err != nil {
+			return err
+		}
+		if vm.State != StateRunning {
+			return fmt.Errorf("VM %s is not running", name)
+		}
+		if !vm.Suspendable {
+			return fmt.Errorf("VM %s was not started with --suspendable", name)
+		}
+		vm.State, vm.PID = StateSuspended, 0
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to suspend VM %s: %w", name, err)
+	}
+	return nil
+}
+
+// Delete removes a VM that is not running.
+func (s *SimProvider) Delete(name string) error {
+	err := s.update(SimDelete, func(st *simState) error {
+		vm, err := st.existing(name)
+		if err != nil {
+			return err
+		}
+		if vm.State == StateRunning {
+			return fmt.Errorf("VM %s is running", name)
+		}
+		st.VMs = slices.DeleteFunc(st.VMs, func(v SimVM) bool { return v.Name == name })
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete VM %s: %w", name, err)
+	}
+	return nil
+}
+
+// List returns all simulated VMs, sorted by name, with their disk sizes.
+func (s *SimProvider) List() (TartListOutput, error) {
+	var vms TartListOutput
+	err := s.read(SimList, func(st *simState) error {
+		for _, vm := range st.VMs {
+			vms = append(vms, VMInfo{Name: vm.Name, State: vm.State, Size: float64(vm.DiskGB)})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list VMs: %w", err)
+	}
+	slices.SortFunc(vms, func(a, b VMInfo) int { return strings.Compare(a.Name, b.Name) })
+	return vms, nil
+}
+
+// ResolveIP waits for a running VM's IP. Each poll of a booting VM uses up one
+// of its boot polls. Simulated SSH is reachable as soon as the IP is.
+func (s *SimProvider) ResolveIP(name string, opts IPOptions) (string, error) {
+	opts = opts.withDefaults(simPollInterval, 100*simPollInterval)
+	start := time.Now()
+
+	var ip string
+	err := retryWait(IPWaitAddress, opts, start, start.Add(opts.Timeout), func() (string, error) {
+		err := s.update(SimIP, func(st *simState) error {
+			vm, err := st.existing(name)
+			if err != nil {
+				return err
+			}
+			if vm.State != StateRunning {
+				return fmt.Errorf("VM %s is not running", name)
+			}
+			if vm.BootPolls > 0 {
+				vm.BootPolls--
+				return fmt.Errorf("VM %s is still booting", name)
+			}
+			ip = vm.IP
+			return nil
+		})
+		return ip, err
+	})
+	if err != nil {
+		return "", fmt.Errorf("VM %s did not acquire an IP address within %v", name, opts.Timeout)
+	}
+	return ip, nil
+}
+
+// Snapshot lists all VMs once and returns their states.
+func (s *SimProvider) Snapshot() (*StateSnapshot, error) {
+	return newSnapshot(s.List())
+}
+
+// GetState returns the current state of a VM.
+func (s *SimProvider) GetState(name string) VMState {
+	vm, found, err := s.VM(name)
+	if err != nil || !found {
+		return StateNotFound
+	}
+	return vm.State
+}
+
+// existing returns the named VM, or an error if it does not exist.
+func (st *simState) existing(name string) (*SimVM, error) {
+	vm := st.vm(name)
+	if vm == nil {
+		return nil, fmt.Errorf("VM %s does not exist", name)
+	}
+	return vm, nil
+}
+
+// update applies fn to the state, as apply does, and saves the result.
+func (s *SimProvider) update(op SimOp, fn func(*simState) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.apply(op, fn); err != nil {
+		return err
+	}
+	return s.save()
+}
+
+// read is update for operations that only inspect the state: it never
+// writes the state file.
+func (s *SimProvider) read(op SimOp, fn func(*simState) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.apply(op, fn)
+}
+
+// apply loads the state, fails with the injected error for op if one is set,
+// and applies fn. An empty op is never failed. Callers must hold s.mu.
+func (s *SimProvider) apply(op SimOp, fn func(*simState) error) error {
+	if err := s.load(); err != nil {
+		return err
+	}
+	if message, ok := s.state.Failures[op]; ok && op != "" {
+		return fmt.Errorf("simulated %s failure: %s", op, message)
+	}
+	return fn(&s.state)
+}
+
+// load reads the state file, if persisting. A missing file is an empty host.
+func (s *SimProvider) load() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read simulator state '%s': %w", s.path, err)
+	}
+	var state simState
+	if err := yaml.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("failed to parse simulator state '%s': %w", s.path, err)
+	}
+	s.state = state
+	return nil
+}
+
+// save writes the state file, if persisting.
+func (s *SimProvider) save() error {
+	if s.path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create simulator state directory: %w", err)
+	}
+	data, err := yaml.Marshal(s.state)
+	if err != nil {
+		return fmt.Errorf("failed to encode simulator state: %w", err)
+	}
+	if err := os.WriteFile(s.path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write simulator state '%s': %w", s.path, err)
+	}
+	return nil
+}
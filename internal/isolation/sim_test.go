@@ -0,0 +1,176 @@
+// Package isolation provides VM isolation and management for CALF.
+package isolation
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSimProviderLifecycle(t *testing.T) {
+	t.Run("when snapshotting and restoring should copy disk and resources", func(t *testing.T) {
+		// Arrange
+		sim := NewSimProvider()
+		if err := sim.Clone("ghcr.io/cirruslabs/macos-sequoia-base:latest", "calf-dev"); err != nil {
+			t.Fatal(err)
+		}
+		if err := sim.Set("calf-dev", 8, 16384, "120"); err != nil {
+			t.Fatal(err)
+		}
+
+		// Act
+		snapErr := sim.Clone("calf-dev", "calf-init")
+		deleteErr := sim.Delete("calf-dev")
+		restoreErr := sim.Clone("calf-init", "calf-dev")
+
+		// Assert
+		if snapErr != nil || deleteErr != nil || restoreErr != nil {
+			t.Fatalf("snapshot/restore errors: %v, %v, %v", snapErr, deleteErr, restoreErr)
+		}
+		vm, found, _ := sim.VM("calf-dev")
+		if !found || vm.Source != "calf-init" || vm.CPU != 8 || vm.Memory != 16384 || vm.DiskGB != 120 {
+			t.Errorf("restored VM = %+v, want clone of calf-init with 8 CPU, 16384 MB, 120 GB", vm)
+		}
+	})
+
+	t.Run("when launched should run with stable ip across restarts", func(t *testing.T) {
+		// Arrange
+		sim := NewSimProvider(WithSimVMs(SimVM{Name: "calf-dev", State: StateStopped, DiskGB: 50}))
+
+		// Act
+		pid, err := sim.Launch("calf-dev", LaunchOptions{Headless: true})
+		ip, ipErr := sim.ResolveIP("calf-dev", IPOptions{})
+		sim.Stop("calf-dev", false)
+		sim.Launch("calf-dev", LaunchOptions{Headless: true})
+		ipAgain, _ := sim.ResolveIP("calf-dev", IPOptions{})
+
+		// Assert
+		if err != nil || pid == 0 {
+			t.Fatalf("Launch() = %d, %v, want pid", pid, err)
+		}
+		if ipErr != nil || ip == "" || ip != ipAgain {
+			t.Errorf("ResolveIP() = %q then %q (%v), want same non-empty IP", ip, ipAgain, ipErr)
+		}
+		if sim.GetState("calf-dev") != StateRunning {
+			t.Errorf("GetState() = %v, want running", sim.GetState("calf-dev"))
+		}
+	})
+
+	t.Run("when booting should return ip after boot polls", func(t *testing.T) {
+		// Arrange
+		sim := NewSimProvider(WithSimBootPolls(2), WithSimVMs(SimVM{Name: "calf-dev", State: StateStopped}))
+		sim.Launch("calf-dev", LaunchOptions{})
+		waits := 0
+
+		// Act
+		ip, err := sim.ResolveIP("calf-dev", IPOptions{InitialInterval: time.Millisecond, OnWait: func(IPWaitEvent) { waits++ }})
+
+		// Assert
+		if err != nil || ip == "" {
+			t.Fatalf("ResolveIP() = %q, %v, want ip", ip, err)
+		}
+		if waits != 2 {
+			t.Errorf("waited %d times, want 2", waits)
+		}
+	})
+
+	t.Run("when suspending non-suspendable VM should return error", func(t *testing.T) {
+		// Arrange
+		sim := NewSimProvider(WithSimVMs(SimVM{Name: "calf-dev", State: StateStopped}))
+		sim.Launch("calf-dev", LaunchOptions{})
+
+		// Act
+		err := sim.Suspend("calf-dev")
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "--suspendable") {
+			t.Errorf("Suspend() error = %v, want suspendable error", err)
+		}
+	})
+
+	t.Run("when shrinking disk should return error", func(t *testing.T) {
+		// Arrange
+		sim := NewSimProvider(WithSimVMs(SimVM{Name: "calf-dev", State: StateStopped, DiskGB: 80}))
+
+		// Act
+		err := sim.Set("calf-dev", 0, 0, "40")
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "cannot shrink") {
+			t.Errorf("Set() error = %v, want shrink error", err)
+		}
+	})
+}
+
+func TestSimProviderFailures(t *testing.T) {
+	t.Run("when failure injected should fail operation until cleared", func(t *testing.T) {
+		// Arrange
+		sim := NewSimProvider(WithSimVMs(SimVM{Name: "calf-dev", State: StateStopped}))
+		if err := sim.Fail(SimLaunch, "out of memory"); err != nil {
+			t.Fatal(err)
+		}
+
+		// Act
+		_, failed := sim.Launch("calf-dev", LaunchOptions{})
+		sim.Fail(SimLaunch, "")
+		_, cleared := sim.Launch("calf-dev", LaunchOptions{})
+
+		// Assert
+		if failed == nil || !strings.Contains(failed.Error(), "simulated launch failure: out of memory") {
+			t.Errorf("Launch() error = %v, want injected failure", failed)
+		}
+		if cleared != nil {
+			t.Errorf("Launch() after clear error = %v, want nil", cleared)
+		}
+	})
+}
+
+func TestSimProviderPersistence(t *testing.T) {
+	t.Run("when state file set should share state between providers", func(t *testing.T) {
+		// Arrange
+		path := filepath.Join(t.TempDir(), "sim.yaml")
+		first := NewSimProvider(WithSimStateFile(path))
+		if err := first.Clone("base", "calf-dev"); err != nil {
+			t.Fatal(err)
+		}
+		if err := first.Fail(SimStop, "hung"); err != nil {
+			t.Fatal(err)
+		}
+
+		// Act
+		second := NewSimProvider(WithSimStateFile(path))
+		vms, err := second.List()
+		stopErr := second.Stop("calf-dev", false)
+
+		// Assert
+		if err != nil || len(vms) != 1 || vms[0].Name != "calf-dev" || vms[0].Size != 50 {
+			t.Errorf("List() = %+v, %v, want persisted calf-dev of 50 GB", vms, err)
+		}
+		if stopErr == nil || !strings.Contains(stopErr.Error(), "hung") {
+			t.Errorf("Stop() error = %v, want persisted failure", stopErr)
+		}
+	})
+
+	t.Run("when only reading state should not write the state file", func(t *testing.T) {
+		// Arrange
+		path := filepath.Join(t.TempDir(), "sim.yaml")
+		sim := NewSimProvider(WithSimStateFile(path))
+
+		// Act
+		_, err := sim.List()
+		state := sim.GetState("calf-dev")
+
+		// Assert
+		if err != nil {
+			t.Fatalf("List() unexpected error = %v", err)
+		}
+		if state != StateNotFound {
+			t.Errorf("GetState() = %v, want not found", state)
+		}
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("expected no state file after reads, got stat error %v", err)
+		}
+	})
+}
@@ -0,0 +1,120 @@
+// Package isolation provides VM isolation and management for CALF.
+package isolation
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// StateSnapshot holds the state of all VMs from a single `tart list`, so a
+// caller can answer many state queries without shelling out for each one.
+// A snapshot is not updated; take a new one after changing VMs.
+type StateSnapshot struct {
+	vms   TartListOutput
+	taken time.Time
+}
+
+// Snapshot lists all VMs once and returns their states.
+// On error the snapshot is empty, so every VM reads as not found, matching
+// how GetState treats a failed list.
+func (c *TartClient) Snapshot() (*StateSnapshot, error) {
+	return newSnapshot(c.List())
+}
+
+// newSnapshot wraps the result of a provider's List in a snapshot.
+func newSnapshot(vms TartListOutput, err error) (*StateSnapshot, error) {
+	if err != nil {
+		return &StateSnapshot{taken: time.Now()}, err
+	}
+	return &StateSnapshot{vms: vms, taken: time.Now()}, nil
+}
+
+// Taken returns when the snapshot was created.
+func (s *StateSnapshot) Taken() time.Time {
+	return s.taken
+}
+
+// VMs returns all VMs in the snapshot, in tart's list order.
+func (s *StateSnapshot) VMs() TartListOutput {
+	return slices.Clone(s.vms)
+}
+
+// Get returns the VM with the given name, if present.
+func (s *StateSnapshot) Get(name string) (VMInfo, bool) {
+	idx := slices.IndexFunc(s.vms, func(vm VMInfo) bool { return vm.Name == name })
+	if idx == -1 {
+		return VMInfo{}, false
+	}
+	return s.vms[idx], true
+}
+
+// GetState returns the state of a VM, or StateNotFound if it does not exist.
+func (s *StateSnapshot) GetState(name string) VMState {
+	vm, ok := s.Get(name)
+	if !ok {
+		return StateNotFound
+	}
+	return vm.State
+}
+
+// Exists reports whether a VM exists.
+func (s *StateSnapshot) Exists(name string) bool {
+	return s.GetState(name) != StateNotFound
+}
+
+// IsRunning reports whether a VM is running.
+func (s *StateSnapshot) IsRunning(name string) bool {
+	return s.GetState(name) == StateRunning
+}
+
+// IsSuspended reports whether a VM is suspended.
+func (s *StateSnapshot) IsSuspended(name string) bool {
+	return s.GetState(name) == StateSuspended
+}
+
+// stateCache remembers the last `tart list` result for a short TTL.
+// The client invalidates it whenever it runs a tart command that can change
+// VMs, so a cached list never hides the client's own changes. Changes made
+// outside the client (another calf process, tart directly, a VM shutting
+// itself down) are visible once the TTL expires.
+type stateCache struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	vms      TartListOutput
+	cachedAt time.Time
+}
+
+// get returns the cached list if it is still fresh.
+func (s *stateCache) get() (TartListOutput, bool) {
+	if s.ttl <= 0 {
+		return nil, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.vms == nil || time.Since(s.cachedAt) > s.ttl {
+		return nil, false
+	}
+	return slices.Clone(s.vms), true
+}
+
+// put stores a freshly listed result.
+func (s *stateCache) put(vms TartListOutput) {
+	if s.ttl <= 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.vms = slices.Clone(vms)
+	if s.vms == nil {
+		s.vms = TartListOutput{}
+	}
+	s.cachedAt = time.Now()
+}
+
+// invalidate drops the cached list.
+func (s *stateCache) invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.vms = nil
+}
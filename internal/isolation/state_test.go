@@ -0,0 +1,151 @@
+// Package isolation provides VM isolation and management for CALF.
+package isolation
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// countingListRunner returns a runner that answers `tart list` with vms and
+// counts how often tart is asked to list.
+func countingListRunner(vms string, lists *int) func(args ...string) (string, error) {
+	return func(args ...string) (string, error) {
+		if args[0] == "list" {
+			*lists++
+			return vms, nil
+		}
+		return "", nil
+	}
+}
+
+const snapshotVMs = `[
+	{"name":"calf-dev","state":"running","size":10.5},
+	{"name":"calf-init","state":"stopped","size":8.2},
+	{"name":"calf-old","state":"suspended","size":9.0}
+]`
+
+func TestSnapshot(t *testing.T) {
+	t.Run("when querying many VMs should list once", func(t *testing.T) {
+		// Arrange
+		lists := 0
+		client := createTestClient(newMockCommandRunner(), WithRunCommand(countingListRunner(snapshotVMs, &lists)))
+
+		// Act
+		states, err := client.Snapshot()
+
+		// Assert
+		if err != nil {
+			t.Fatalf("Snapshot() unexpected error = %v", err)
+		}
+		if !states.IsRunning("calf-dev") || !states.Exists("calf-init") || !states.IsSuspended("calf-old") {
+			t.Errorf("snapshot states wrong: %+v", states.VMs())
+		}
+		if states.Exists("calf-missing") || states.GetState("calf-missing") != StateNotFound {
+			t.Error("expected missing VM to be not found")
+		}
+		if lists != 1 {
+			t.Errorf("tart list called %d times, want 1", lists)
+		}
+	})
+
+	t.Run("when list fails should return empty snapshot and error", func(t *testing.T) {
+		// Arrange
+		client := createTestClient(newMockCommandRunner(), WithRunCommand(func(args ...string) (string, error) {
+			return "", fmt.Errorf("tart crashed")
+		}))
+
+		// Act
+		states, err := client.Snapshot()
+
+		// Assert
+		if err == nil {
+			t.Error("Snapshot() expected error, got nil")
+		}
+		if states.Exists("calf-dev") {
+			t.Error("expected empty snapshot on error")
+		}
+	})
+}
+
+func TestStateCache(t *testing.T) {
+	t.Run("when cache disabled should list on every query", func(t *testing.T) {
+		// Arrange
+		lists := 0
+		client := createTestClient(newMockCommandRunner(), WithRunCommand(countingListRunner(snapshotVMs, &lists)))
+
+		// Act
+		client.Exists("calf-dev")
+		client.IsRunning("calf-dev")
+
+		// Assert
+		if lists != 2 {
+			t.Errorf("tart list called %d times, want 2", lists)
+		}
+	})
+
+	t.Run("when cache enabled should share one list across queries", func(t *testing.T) {
+		// Arrange
+		lists := 0
+		client := createTestClient(newMockCommandRunner(), WithRunCommand(countingListRunner(snapshotVMs, &lists)), WithStateCacheTTL(time.Minute))
+
+		// Act
+		client.Exists("calf-dev")
+		client.IsRunning("calf-dev")
+		client.GetState("calf-init")
+
+		// Assert
+		if lists != 1 {
+			t.Errorf("tart list called %d times, want 1", lists)
+		}
+	})
+
+	t.Run("when client changes a VM should invalidate cache", func(t *testing.T) {
+		// Arrange
+		lists := 0
+		client := createTestClient(newMockCommandRunner(), WithRunCommand(countingListRunner(snapshotVMs, &lists)), WithStateCacheTTL(time.Minute))
+		client.IsRunning("calf-dev")
+
+		// Act
+		if err := client.Stop("calf-dev", false); err != nil {
+			t.Fatal(err)
+		}
+		client.IsRunning("calf-dev")
+
+		// Assert
+		if lists != 2 {
+			t.Errorf("tart list called %d times, want 2 (relist after stop)", lists)
+		}
+	})
+
+	t.Run("when ttl expires should list again", func(t *testing.T) {
+		// Arrange
+		lists := 0
+		client := createTestClient(newMockCommandRunner(), WithRunCommand(countingListRunner(snapshotVMs, &lists)), WithStateCacheTTL(time.Millisecond))
+		client.Exists("calf-dev")
+
+		// Act
+		time.Sleep(5 * time.Millisecond)
+		client.Exists("calf-dev")
+
+		// Assert
+		if lists != 2 {
+			t.Errorf("tart list called %d times, want 2", lists)
+		}
+	})
+
+	t.Run("when caller modifies listed VMs should not change cache", func(t *testing.T) {
+		// Arrange
+		lists := 0
+		client := createTestClient(newMockCommandRunner(), WithRunCommand(countingListRunner(snapshotVMs, &lists)), WithStateCacheTTL(time.Minute))
+		vms, _ := client.List()
+
+		// Act
+		vms[0].State = StateStopped
+
+		// Assert
+		if !client.IsRunning("calf-dev") {
+			t.Error("expected cached state unaffected by caller mutation")
+		}
+	})
+}
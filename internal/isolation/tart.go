@@ -7,9 +7,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
+	"syscall"
 	"time"
 )
 
@@ -22,16 +25,16 @@ const (
 
 	// Default IP polling timeout.
 	defaultPollTimeout = 60 * time.Second
-
-	// Cache sharing directory mount path (read-only).
-	// TODO: Use virtio-fs mount system (like calf-cache) instead of symlink approach.
-	// calf-bootstrap uses symlinks for tart-cache (fine for bootstrap), but the Go
-	// implementation should mount /Volumes/My Shared Files/tart-cache via virtio-fs
-	// for consistency with the calf-cache architecture. See calf-mount-shares.sh and
-	// ADR-003 for mount system details.
-	cacheDirMount = "tart-cache:~/.tart/cache:ro"
 )
 
+// tartCacheShare shares the host Tart cache with the VM (read-only).
+// TODO: Use virtio-fs mount system (like calf-cache) instead of symlink approach.
+// calf-bootstrap uses symlinks for tart-cache (fine for bootstrap), but the Go
+// implementation should mount /Volumes/My Shared Files/tart-cache via virtio-fs
+// for consistency with the calf-cache architecture. See calf-mount-shares.sh and
+// ADR-003 for mount system details.
+var tartCacheShare = DirShare{Name: "tart-cache", Path: "~/.tart/cache", ReadOnly: true}
+
 // VMState represents the current state of a Tart VM.
 type VMState string
 
@@ -42,6 +45,10 @@ const (
 	// StateStopped indicates the VM is stopped but exists.
 	StateStopped VMState = "stopped"
 
+	// StateSuspended indicates the VM's memory is saved to disk. Running it
+	// again resumes where it left off instead of cold-booting.
+	StateSuspended VMState = "suspended"
+
 	// StateNotFound indicates the VM does not exist.
 	StateNotFound VMState = "not_found"
 )
@@ -56,9 +63,56 @@ type VMInfo struct {
 // TartListOutput is the JSON output from `tart list --format json`.
 type TartListOutput []VMInfo
 
+// DirShare describes a host directory shared with a VM via `tart run --dir`.
+type DirShare struct {
+	// Name is the share name visible in the guest. Optional.
+	Name string
+	// Path is the host directory to share. A raw tart --dir spec is also accepted
+	// here when Name, ReadOnly and Tag are unset.
+	Path string
+	// ReadOnly mounts the share read-only in the guest.
+	ReadOnly bool
+	// Tag is the virtio-fs mount tag. Optional.
+	Tag string
+}
+
+// String returns the share in tart's `[name:]path[:options]` --dir format.
+func (d DirShare) String() string {
+	spec := d.Path
+	if d.Name != "" {
+		spec = d.Name + ":" + spec
+	}
+
+	var options []string
+	if d.ReadOnly {
+		options = append(options, "ro")
+	}
+	if d.Tag != "" {
+		options = append(options, "tag="+d.Tag)
+	}
+	if len(options) > 0 {
+		spec += ":" + strings.Join(options, ",")
+	}
+	return spec
+}
+
 // commandRunner is a function type for executing commands (allows mocking in tests).
 type commandRunner func(args ...string) (string, error)
 
+// commandStarter is a function type for launching a command without waiting
+// for it to exit. Output is appended to the file at the given path, or
+// discarded if the path is empty. Returns the process ID.
+type commandStarter func(output string, args ...string) (int, error)
+
+// commandInputRunner is a function type for executing commands that read
+// their input from stdin (allows mocking in tests).
+type commandInputRunner func(input string, args ...string) (string, error)
+
+// commandStreamer is a function type for executing commands while passing each
+// line of output to onLine as it is produced (allows mocking in tests).
+// Returns the full output.
+type commandStreamer func(onLine func(string), args ...string) (string, error)
+
 // TartClientOption configures a TartClient.
 type TartClientOption func(*TartClient)
 
@@ -68,6 +122,31 @@ func WithRunCommand(fn commandRunner) TartClientOption {
 	return func(c *TartClient) { c.runCommand = fn }
 }
 
+// WithStartCommand overrides the starter used to launch detached tart commands.
+// Intended for use in tests.
+func WithStartCommand(fn commandStarter) TartClientOption {
+	return func(c *TartClient) { c.startCommand = fn }
+}
+
+// WithInputCommand overrides the runner used for tart commands that read stdin.
+// Intended for use in tests.
+func WithInputCommand(fn commandInputRunner) TartClientOption {
+	return func(c *TartClient) { c.inputCommand = fn }
+}
+
+// WithStreamCommand overrides the runner used for long-running tart commands
+// whose output is streamed, such as clone and pull.
+// Intended for use in tests.
+func WithStreamCommand(fn commandStreamer) TartClientOption {
+	return func(c *TartClient) { c.streamCommand = fn }
+}
+
+// WithTartHome overrides the Tart home directory (default: $TART_HOME or ~/.tart).
+// Intended for use in tests.
+func WithTartHome(dir string) TartClientOption {
+	return func(c *TartClient) { c.tartHome = dir }
+}
+
 // WithPollInterval overrides the IP polling interval.
 // Intended for use in tests.
 func WithPollInterval(d time.Duration) TartClientOption {
@@ -104,6 +183,51 @@ func WithBrewRunner(fn commandRunner) TartClientOption {
 	return func(c *TartClient) { c.runBrewCommand = fn }
 }
 
+// WithModeStore sets the store used to look up each VM's isolation mode when
+// it is started. Without a store, VMs run in shared mode.
+func WithModeStore(store *ModeStore) TartClientOption {
+	return func(c *TartClient) { c.modes = store }
+}
+
+// WithLogStore sets the store that captures detached tart output (and the
+// serial console, if enabled) as per-VM boot logs. Without a store, output
+// of detached VMs is discarded. With a remote host, use a store from
+// NewRemoteLogStore, since tart writes the logs on the host.
+func WithLogStore(store *LogStore) TartClientOption {
+	return func(c *TartClient) { c.logs = store }
+}
+
+// WithCloneProgress sets the callback Clone reports the progress of OCI pulls
+// to. Without it, Clone still streams tart's output but reports nothing.
+func WithCloneProgress(progress ProgressFunc) TartClientOption {
+	return func(c *TartClient) { c.cloneProgress = progress }
+}
+
+// WithStateCacheTTL caches the result of `tart list` for ttl, so bursts of
+// state queries share one tart call. The cache is dropped whenever the client
+// runs a tart command that changes VMs. Zero (the default) disables caching.
+func WithStateCacheTTL(ttl time.Duration) TartClientOption {
+	return func(c *TartClient) { c.states.ttl = ttl }
+}
+
+// WithDialer overrides the dialer used to probe a VM's SSH port.
+// Intended for use in tests.
+func WithDialer(dial func(network, address string, timeout time.Duration) (net.Conn, error)) TartClientOption {
+	return func(c *TartClient) { c.dial = dial }
+}
+
+// WithRemoteHost runs tart on a remote Mac over SSH instead of locally. The
+// host's tart is used as is (it is not installed on demand), detached VMs run
+// on the host, and SSH waits are tunnelled through the host. Pair it with
+// stores from NewRemoteModeStore and NewRemoteLogStore. Image digests are
+// read from the local Tart cache, so image commands need a local Tart as well.
+func WithRemoteHost(host *RemoteHost) TartClientOption {
+	return func(c *TartClient) {
+		c.remote = host
+		c.dial = host.Dial
+	}
+}
+
 // TartClient wraps the Tart CLI for VM operations.
 type TartClient struct {
 	tartPath       string
@@ -113,9 +237,19 @@ type TartClient struct {
 	pollInterval   time.Duration
 	pollTimeout    time.Duration
 	runCommand     commandRunner
+	startCommand   commandStarter
+	inputCommand   commandInputRunner
+	streamCommand  commandStreamer
 	runBrewCommand commandRunner
 	stdinReader    io.Reader
 	lookPath       func(string) (string, error)
+	modes          *ModeStore
+	logs           *LogStore
+	tartHome       string
+	dial           func(network, address string, timeout time.Duration) (net.Conn, error)
+	states         *stateCache
+	remote         *RemoteHost
+	cloneProgress  ProgressFunc
 }
 
 // NewTartClient creates a new TartClient with optional configuration overrides.
@@ -128,9 +262,15 @@ func NewTartClient(opts ...TartClientOption) *TartClient {
 		pollTimeout:   defaultPollTimeout,
 		stdinReader:   os.Stdin,
 		lookPath:      exec.LookPath,
+		tartHome:      defaultTartHome(),
+		dial:          net.DialTimeout,
+		states:        &stateCache{},
 	}
 	// Set default command runners
 	client.runCommand = client.runTartCommand
+	client.startCommand = client.startTartCommand
+	client.inputCommand = client.runTartCommandWithInput
+	client.streamCommand = client.streamTartCommand
 	client.runBrewCommand = func(args ...string) (string, error) {
 		brewPath, err := client.lookPath("brew")
 		if err != nil {
@@ -152,7 +292,7 @@ func NewTartClient(opts ...TartClientOption) *TartClient {
 
 // ensureInstalled checks if Tart is installed and offers to install via Homebrew if not.
 func (c *TartClient) ensureInstalled() error {
-	if c.tartPath != "" {
+	if c.tartPath != "" || c.remote != nil {
 		return nil
 	}
 
@@ -194,9 +334,18 @@ func (c *TartClient) ensureInstalled() error {
 	return nil
 }
 
+// tartCommand returns the command that runs tart with args, locally or on the
+// remote host.
+func (c *TartClient) tartCommand(args ...string) *exec.Cmd {
+	if c.remote != nil {
+		return c.remote.Command("tart", args...)
+	}
+	return exec.Command(c.tartPath, args...)
+}
+
 // runTartCommand executes a Tart CLI command and returns combined stdout/stderr.
 func (c *TartClient) runTartCommand(args ...string) (string, error) {
-	cmd := exec.Command(c.tartPath, args...)
+	cmd := c.tartCommand(args...)
 
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
@@ -210,12 +359,115 @@ func (c *TartClient) runTartCommand(args ...string) (string, error) {
 	return stdout.String(), nil
 }
 
-// Clone clones a VM from an image or local VM.
+// runTartCommandWithInput executes a Tart CLI command with input on stdin.
+func (c *TartClient) runTartCommandWithInput(input string, args ...string) (string, error) {
+	cmd := c.tartCommand(args...)
+	cmd.Stdin = strings.NewReader(input)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("tart %s failed: %w\nstderr: %s",
+			strings.Join(args, " "), err, stderr.String())
+	}
+
+	return stdout.String(), nil
+}
+
+// streamTartCommand executes a Tart CLI command, passing each line of combined
+// stdout/stderr to onLine while it runs instead of buffering until exit.
+// Lines are split on both \n and \r so redrawn progress lines are seen.
+func (c *TartClient) streamTartCommand(onLine func(string), args ...string) (string, error) {
+	cmd := c.tartCommand(args...)
+	reader, writer := io.Pipe()
+	cmd.Stdout = writer
+	cmd.Stderr = writer
+
+	var output bytes.Buffer
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		scanner := bufio.NewScanner(io.TeeReader(reader, &output))
+		scanner.Split(scanProgressLines)
+		for scanner.Scan() {
+			onLine(scanner.Text())
+		}
+		// Drain so tart never blocks writing if the scanner stopped early.
+		io.Copy(io.Discard, reader)
+	}()
+
+	err := cmd.Run()
+	writer.Close()
+	<-done
+
+	if err != nil {
+		return "", fmt.Errorf("tart %s failed: %w\noutput: %s",
+			strings.Join(args, " "), err, output.String())
+	}
+	return output.String(), nil
+}
+
+// defaultTartHome returns the directory Tart stores VMs and caches in.
+func defaultTartHome() string {
+	if home := os.Getenv("TART_HOME"); home != "" {
+		return home
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(homeDir, ".tart")
+}
+
+// startTartCommand launches a Tart CLI command in its own process group, so it
+// is unaffected by terminal signals and outlives calf. Output is appended to
+// the file at output, which the child inherits, or discarded if output is
+// empty. With a remote host, the command is started there instead, and output
+// names a file on the host.
+func (c *TartClient) startTartCommand(output string, args ...string) (int, error) {
+	if c.remote != nil {
+		return c.remote.Start(output, "tart", args...)
+	}
+	cmd := c.tartCommand(args...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if output != "" {
+		f, err := os.OpenFile(output, os.O_WRONLY|os.O_APPEND, 0)
+		if err != nil {
+			return 0, fmt.Errorf("failed to open log '%s': %w", output, err)
+		}
+		// The child inherits its own descriptor; ours is not needed after start.
+		defer f.Close()
+		cmd.Stdout = f
+		cmd.Stderr = f
+	}
+
+	if err := cmd.Start(); err != nil {
+		return 0, fmt.Errorf("tart %s failed to start: %w", strings.Join(args, " "), err)
+	}
+
+	pid := cmd.Process.Pid
+	if err := cmd.Process.Release(); err != nil {
+		return 0, fmt.Errorf("failed to detach tart process %d: %w", pid, err)
+	}
+	return pid, nil
+}
+
+// Clone clones a VM from an image or local VM, reporting the progress of an
+// OCI pull to the callback set by WithCloneProgress.
 func (c *TartClient) Clone(image, name string) error {
+	return c.CloneWithProgress(image, name, c.cloneProgress)
+}
+
+// CloneWithProgress clones a VM, streaming tart's output so that progress of
+// an OCI pull (e.g. from ghcr.io) is reported to progress as it downloads.
+func (c *TartClient) CloneWithProgress(image, name string, progress ProgressFunc) error {
+	defer c.states.invalidate()
 	if err := c.ensureInstalled(); err != nil {
 		return err
 	}
-	if _, err := c.runCommand("clone", image, name); err != nil {
+	if err := c.runWithProgress(progress, "clone", image, name); err != nil {
 		return fmt.Errorf("failed to clone VM %s from %s: %w", name, image, err)
 	}
 	return nil
@@ -223,6 +475,7 @@ func (c *TartClient) Clone(image, name string) error {
 
 // Set configures VM resources (CPU, memory, disk size).
 func (c *TartClient) Set(name string, cpu int, memory int, disk string) error {
+	defer c.states.invalidate()
 	if err := c.ensureInstalled(); err != nil {
 		return err
 	}
@@ -256,40 +509,163 @@ func (c *TartClient) Run(name string, headless, vnc bool, dirs []string) error {
 // RunWithCacheDirs starts a VM with cache directories shared.
 // cacheDirs specifies additional directories to share for caching (e.g., Homebrew cache).
 func (c *TartClient) RunWithCacheDirs(name string, headless, vnc bool, dirs []string, cacheDirs []string) error {
-	if err := c.ensureInstalled(); err != nil {
+	shares := make([]DirShare, 0, len(cacheDirs)+len(dirs))
+	for _, dir := range cacheDirs {
+		shares = append(shares, DirShare{Path: dir})
+	}
+	for _, dir := range dirs {
+		shares = append(shares, DirShare{Path: dir})
+	}
+	return c.RunWithShares(name, headless, vnc, shares)
+}
+
+// RunWithShares starts a VM with the given directory shares and default
+// networking, enforcing the VM's isolation mode.
+func (c *TartClient) RunWithShares(name string, headless, vnc bool, shares []DirShare) error {
+	return c.RunWithNetwork(name, headless, vnc, shares, NetworkOptions{})
+}
+
+// RunWithNetwork starts a VM with the given directory shares and network options,
+// enforcing the VM's isolation mode. In no-mount mode no directories are shared,
+// including the Tart cache. In no-network mode the VM runs on softnet with
+// multicast blocked; SMB to the host is blocked separately via pf.
+// Returns an error without starting the VM if the network options are invalid
+// or contradict the isolation mode.
+func (c *TartClient) RunWithNetwork(name string, headless, vnc bool, shares []DirShare, network NetworkOptions) error {
+	defer c.states.invalidate()
+	args, err := c.runArgs(name, LaunchOptions{Headless: headless, VNC: vnc, Shares: shares, Network: network})
+	if err != nil {
 		return err
 	}
+
+	if _, err := c.runCommand(args...); err != nil {
+		return fmt.Errorf("failed to start VM %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// LaunchOptions configures a detached VM launch.
+type LaunchOptions struct {
+	// Headless runs the VM without a window.
+	Headless bool
+	// VNC enables --vnc-experimental for bidirectional clipboard.
+	VNC bool
+	// Suspendable allows the VM to be suspended later. Incompatible with VNC.
+	Suspendable bool
+	// Serial writes the VM's serial console to serial.log next to the boot
+	// log. Ignored without a log store.
+	Serial bool
+	// Shares are host directories to share, in addition to the Tart cache.
+	Shares []DirShare
+	// Network configures VM networking.
+	Network NetworkOptions
+}
+
+// Launch starts a VM like RunWithNetwork but returns as soon as tart has been
+// launched, leaving it running after calf exits. With a log store configured,
+// tart's output is captured in the VM's boot log. Returns the tart PID, which
+// lives exactly as long as the VM.
+func (c *TartClient) Launch(name string, opts LaunchOptions) (int, error) {
+	defer c.states.invalidate()
+	args, err := c.runArgs(name, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	var output string
+	if c.logs != nil {
+		output, err = c.logs.create(name, args)
+		if err != nil {
+			return 0, fmt.Errorf("failed to start VM %s: %w", name, err)
+		}
+	}
+
+	pid, err := c.startCommand(output, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to start VM %s: %w", name, err)
+	}
+	return pid, nil
+}
+
+// RunDetached starts a VM detached. See Launch.
+func (c *TartClient) RunDetached(name string, headless, vnc bool, shares []DirShare, network NetworkOptions) (int, error) {
+	return c.Launch(name, LaunchOptions{Headless: headless, VNC: vnc, Shares: shares, Network: network})
+}
+
+// RunSuspendable starts a VM detached with --suspendable so that it can later
+// be suspended with Suspend. If the VM is suspended, tart resumes it from its
+// saved state. Suspendable VMs have no audio device and no VNC.
+func (c *TartClient) RunSuspendable(name string, headless bool, shares []DirShare, network NetworkOptions) (int, error) {
+	return c.Launch(name, LaunchOptions{Headless: headless, Suspendable: true, Shares: shares, Network: network})
+}
+
+// runArgs builds the `tart run` arguments for a VM, applying its isolation mode.
+func (c *TartClient) runArgs(name string, opts LaunchOptions) ([]string, error) {
+	if err := c.ensureInstalled(); err != nil {
+		return nil, err
+	}
+
+	mode, err := c.isolationMode(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start VM %s: %w", name, err)
+	}
+
+	network, err := opts.Network.withIsolation(mode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start VM %s: %w", name, err)
+	}
+	if err := network.Validate(); err != nil {
+		return nil, fmt.Errorf("failed to start VM %s: %w", name, err)
+	}
+
 	args := []string{"run"}
 
-	if headless {
+	if opts.Headless {
 		args = append(args, "--headless")
 	}
 
-	if vnc {
+	if opts.VNC {
 		args = append(args, "--vnc-experimental")
 	}
 
-	args = append(args, fmt.Sprintf("--dir=%s", cacheDirMount))
+	if opts.Suspendable {
+		args = append(args, "--suspendable")
+	}
 
-	for _, dir := range cacheDirs {
-		args = append(args, fmt.Sprintf("--dir=%s", dir))
+	if opts.Serial && c.logs != nil {
+		path := c.logs.SerialPath(name)
+		if c.remote != nil {
+			path = remoteArgPath(path)
+		}
+		args = append(args, "--serial-path="+path)
 	}
 
-	for _, dir := range dirs {
-		args = append(args, fmt.Sprintf("--dir=%s", dir))
+	if !mode.NoMount {
+		args = append(args, fmt.Sprintf("--dir=%s", tartCacheShare))
+		for _, share := range opts.Shares {
+			args = append(args, fmt.Sprintf("--dir=%s", share))
+		}
 	}
 
+	args = append(args, network.args()...)
 	args = append(args, name)
 
-	if _, err := c.runCommand(args...); err != nil {
-		return fmt.Errorf("failed to start VM %s: %w", name, err)
-	}
+	return args, nil
+}
 
-	return nil
+// isolationMode returns the recorded isolation mode for a VM, or shared mode
+// when no mode store is configured.
+func (c *TartClient) isolationMode(name string) (IsolationMode, error) {
+	if c.modes == nil {
+		return IsolationMode{}, nil
+	}
+	return c.modes.Load(name)
 }
 
 // Stop stops a running VM.
 func (c *TartClient) Stop(name string, force bool) error {
+	defer c.states.invalidate()
 	if err := c.ensureInstalled(); err != nil {
 		return err
 	}
@@ -305,8 +681,22 @@ func (c *TartClient) Stop(name string, force bool) error {
 	return nil
 }
 
+// Suspend saves a running VM's memory to disk and stops it.
+// The VM must have been started with RunSuspendable.
+func (c *TartClient) Suspend(name string) error {
+	defer c.states.invalidate()
+	if err := c.ensureInstalled(); err != nil {
+		return err
+	}
+	if _, err := c.runCommand("suspend", name); err != nil {
+		return fmt.Errorf("failed to suspend VM %s: %w", name, err)
+	}
+	return nil
+}
+
 // Delete deletes a VM.
 func (c *TartClient) Delete(name string) error {
+	defer c.states.invalidate()
 	if err := c.ensureInstalled(); err != nil {
 		return err
 	}
@@ -316,11 +706,15 @@ func (c *TartClient) Delete(name string) error {
 	return nil
 }
 
-// List lists all VMs with JSON format for sizes.
+// List lists all VMs with JSON format for sizes. With WithStateCacheTTL, a
+// recent result may be returned without calling tart.
 func (c *TartClient) List() (TartListOutput, error) {
 	if err := c.ensureInstalled(); err != nil {
 		return nil, err
 	}
+	if vms, ok := c.states.get(); ok {
+		return vms, nil
+	}
 	output, err := c.runCommand("list", "--format", "json")
 	if err != nil {
 		return nil, fmt.Errorf("failed to list VMs: %w", err)
@@ -331,38 +725,15 @@ func (c *TartClient) List() (TartListOutput, error) {
 		return nil, fmt.Errorf("failed to parse VM list JSON: %w", err)
 	}
 
+	c.states.put(vms)
 	return vms, nil
 }
 
-// IP gets the IP address of a running VM, with optional polling for boot.
+// IP gets the IP address of a running VM, waiting up to timeout (0 for the
+// client's default) for it to boot. Use ResolveIP for resolver, backoff and
+// progress control.
 func (c *TartClient) IP(name string, timeout time.Duration) (string, error) {
-	if err := c.ensureInstalled(); err != nil {
-		return "", err
-	}
-	if timeout == 0 {
-		timeout = c.pollTimeout
-	}
-
-	startTime := time.Now()
-	elapsed := 0 * time.Second
-
-	for time.Since(startTime) < timeout {
-		output, err := c.runCommand("ip", name)
-		if err == nil {
-			ip := strings.TrimSpace(output)
-			if ip != "" {
-				return ip, nil
-			}
-		}
-
-		elapsed = time.Since(startTime)
-		fmt.Fprintf(c.outputWriter, "\rWaiting for VM to boot... %ds", int(elapsed.Seconds()))
-
-		time.Sleep(c.pollInterval)
-	}
-
-	fmt.Fprint(c.outputWriter, "\n")
-	return "", fmt.Errorf("VM %s did not acquire an IP address within %v", name, timeout)
+	return c.ResolveIP(name, IPOptions{Timeout: timeout})
 }
 
 // Get retrieves information about a specific VM.
@@ -387,6 +758,11 @@ func (c *TartClient) IsRunning(name string) bool {
 	return state == StateRunning
 }
 
+// IsSuspended checks if a VM is suspended.
+func (c *TartClient) IsSuspended(name string) bool {
+	return c.GetState(name) == StateSuspended
+}
+
 // Exists checks if a VM exists.
 func (c *TartClient) Exists(name string) bool {
 	state := c.GetState(name)
@@ -3,6 +3,8 @@ package isolation
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"slices"
 	"strings"
 	"testing"
@@ -56,9 +58,20 @@ func createTestClient(mock *mockCommandRunner, extra ...TartClientOption) *TartC
 		WithRunCommand(func(args ...string) (string, error) {
 			return mock.runCommand("tart", args...)
 		}),
+		WithStreamCommand(mock.streamCommand),
 	}, extra...)...)
 }
 
+// streamCommand runs a tart command through the mock, passing each line of
+// its output to onLine.
+func (m *mockCommandRunner) streamCommand(onLine func(string), args ...string) (string, error) {
+	output, err := m.runCommand("tart", args...)
+	for _, line := range strings.Split(output, "\n") {
+		onLine(line)
+	}
+	return output, err
+}
+
 func TestVMStateString(t *testing.T) {
 	t.Run("when state is running should return string running", func(t *testing.T) {
 		// Arrange
@@ -86,6 +99,19 @@ func TestVMStateString(t *testing.T) {
 		}
 	})
 
+	t.Run("when state is suspended should return string suspended", func(t *testing.T) {
+		// Arrange
+		state := StateSuspended
+
+		// Act
+		got := string(state)
+
+		// Assert
+		if got != "suspended" {
+			t.Errorf("VMState string = %q, want %q", got, "suspended")
+		}
+	})
+
 	t.Run("when state is not found should return string not_found", func(t *testing.T) {
 		// Arrange
 		state := StateNotFound
@@ -640,7 +666,7 @@ func TestRunWithCacheDirs(t *testing.T) {
 		if len(mock.commands) == 0 {
 			t.Fatal("RunWithCacheDirs() should have executed a command")
 		}
-		expectedDir := fmt.Sprintf("--dir=%s", cacheDirMount)
+		expectedDir := fmt.Sprintf("--dir=%s", tartCacheShare)
 		if !slices.Contains(mock.commands[0], expectedDir) {
 			t.Errorf("RunWithCacheDirs() command %v should contain %s", mock.commands[0], expectedDir)
 		}
@@ -661,7 +687,7 @@ func TestRunWithCacheDirs(t *testing.T) {
 		if len(mock.commands) == 0 {
 			t.Fatal("RunWithCacheDirs() should have executed a command")
 		}
-		expectedDir := fmt.Sprintf("--dir=%s", cacheDirMount)
+		expectedDir := fmt.Sprintf("--dir=%s", tartCacheShare)
 		if !slices.Contains(mock.commands[0], expectedDir) {
 			t.Errorf("RunWithCacheDirs() command %v should contain %s", mock.commands[0], expectedDir)
 		}
@@ -688,6 +714,301 @@ func TestRunWithCacheDirs(t *testing.T) {
 	})
 }
 
+func TestDirShareString(t *testing.T) {
+	t.Run("when name and read-only set should format name path and ro option", func(t *testing.T) {
+		// Arrange
+		share := DirShare{Name: "tart-cache", Path: "~/.tart/cache", ReadOnly: true}
+
+		// Act
+		got := share.String()
+
+		// Assert
+		if got != "tart-cache:~/.tart/cache:ro" {
+			t.Errorf("String() = %q, want %q", got, "tart-cache:~/.tart/cache:ro")
+		}
+	})
+
+	t.Run("when tag set without name should format path and tag option", func(t *testing.T) {
+		// Arrange
+		share := DirShare{Path: "/Users/me/.calf-cache", Tag: "calf-cache"}
+
+		// Act
+		got := share.String()
+
+		// Assert
+		if got != "/Users/me/.calf-cache:tag=calf-cache" {
+			t.Errorf("String() = %q, want %q", got, "/Users/me/.calf-cache:tag=calf-cache")
+		}
+	})
+
+	t.Run("when read-only and tag set should join options with comma", func(t *testing.T) {
+		// Arrange
+		share := DirShare{Name: "src", Path: "/src", ReadOnly: true, Tag: "src"}
+
+		// Act
+		got := share.String()
+
+		// Assert
+		if got != "src:/src:ro,tag=src" {
+			t.Errorf("String() = %q, want %q", got, "src:/src:ro,tag=src")
+		}
+	})
+}
+
+func TestRunWithSharesIsolationMode(t *testing.T) {
+	t.Run("when VM is in no-mount mode should omit all dir shares", func(t *testing.T) {
+		// Arrange
+		mock := newMockCommandRunner()
+		store := NewModeStore(t.TempDir())
+		if err := store.Save("test-vm", IsolationMode{NoMount: true}); err != nil {
+			t.Fatal(err)
+		}
+		client := createTestClient(mock, WithModeStore(store))
+
+		// Act
+		err := client.RunWithShares("test-vm", true, false, []DirShare{{Name: "src", Path: "/src"}})
+
+		// Assert
+		if err != nil {
+			t.Fatalf("RunWithShares() unexpected error = %v", err)
+		}
+		for _, arg := range mock.commands[0] {
+			if strings.HasPrefix(arg, "--dir") {
+				t.Errorf("RunWithShares() command %v should not share dirs in no-mount mode", mock.commands[0])
+			}
+		}
+	})
+
+	t.Run("when VM is in no-network mode should run on softnet with multicast blocked", func(t *testing.T) {
+		// Arrange
+		mock := newMockCommandRunner()
+		store := NewModeStore(t.TempDir())
+		if err := store.Save("test-vm", IsolationMode{NoNetwork: true}); err != nil {
+			t.Fatal(err)
+		}
+		client := createTestClient(mock, WithModeStore(store))
+
+		// Act
+		err := client.RunWithShares("test-vm", true, false, nil)
+
+		// Assert
+		if err != nil {
+			t.Fatalf("RunWithShares() unexpected error = %v", err)
+		}
+		expected := []string{"tart", "run", "--headless", "--dir=tart-cache:~/.tart/cache:ro", "--net-softnet", "--net-softnet-block=224.0.0.0/4", "test-vm"}
+		if !slices.Equal(mock.commands[0], expected) {
+			t.Errorf("RunWithShares() command = %v, want %v", mock.commands[0], expected)
+		}
+	})
+
+	t.Run("when VM is in shared mode should include shares and default network", func(t *testing.T) {
+		// Arrange
+		mock := newMockCommandRunner()
+		client := createTestClient(mock, WithModeStore(NewModeStore(t.TempDir())))
+
+		// Act
+		err := client.RunWithShares("test-vm", false, false, []DirShare{{Name: "src", Path: "/src"}})
+
+		// Assert
+		if err != nil {
+			t.Fatalf("RunWithShares() unexpected error = %v", err)
+		}
+		expected := []string{"tart", "run", "--dir=tart-cache:~/.tart/cache:ro", "--dir=src:/src", "test-vm"}
+		if !slices.Equal(mock.commands[0], expected) {
+			t.Errorf("RunWithShares() command = %v, want %v", mock.commands[0], expected)
+		}
+	})
+
+	t.Run("when started via Run should still enforce the recorded mode", func(t *testing.T) {
+		// Arrange
+		mock := newMockCommandRunner()
+		store := NewModeStore(t.TempDir())
+		if err := store.Save("test-vm", SafeMode()); err != nil {
+			t.Fatal(err)
+		}
+		client := createTestClient(mock, WithModeStore(store))
+
+		// Act
+		err := client.Run("test-vm", false, false, []string{"src:/src"})
+
+		// Assert
+		if err != nil {
+			t.Fatalf("Run() unexpected error = %v", err)
+		}
+		if slices.Contains(mock.commands[0], "--dir=src:/src") {
+			t.Errorf("Run() command %v should not share dirs in safe mode", mock.commands[0])
+		}
+		if !slices.Contains(mock.commands[0], "--net-softnet") {
+			t.Errorf("Run() command %v should enable softnet in safe mode", mock.commands[0])
+		}
+	})
+
+	t.Run("when mode file cannot be parsed should return error without running", func(t *testing.T) {
+		// Arrange
+		mock := newMockCommandRunner()
+		homeDir := t.TempDir()
+		dir := filepath.Join(homeDir, ".calf", "isolation", "vms", "test-vm")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "isolation.yaml"), []byte("no_mount: [oops"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		client := createTestClient(mock, WithModeStore(NewModeStore(homeDir)))
+
+		// Act
+		err := client.RunWithShares("test-vm", false, false, nil)
+
+		// Assert
+		if err == nil {
+			t.Fatal("RunWithShares() expected error, got nil")
+		}
+		if len(mock.commands) != 0 {
+			t.Errorf("RunWithShares() should not run tart when mode is unreadable, got %v", mock.commands)
+		}
+	})
+}
+
+func TestRunDetached(t *testing.T) {
+	t.Run("when start succeeds should return tart pid without waiting", func(t *testing.T) {
+		// Arrange
+		mock := newMockCommandRunner()
+		var started []string
+		client := createTestClient(mock, WithStartCommand(func(_ string, args ...string) (int, error) {
+			started = args
+			return 4242, nil
+		}))
+
+		// Act
+		pid, err := client.RunDetached("test-vm", false, true, nil, NetworkOptions{})
+
+		// Assert
+		if err != nil {
+			t.Fatalf("RunDetached() unexpected error = %v", err)
+		}
+		if pid != 4242 {
+			t.Errorf("RunDetached() pid = %d, want 4242", pid)
+		}
+		expected := []string{"run", "--vnc-experimental", "--dir=tart-cache:~/.tart/cache:ro", "test-vm"}
+		if !slices.Equal(started, expected) {
+			t.Errorf("RunDetached() args = %v, want %v", started, expected)
+		}
+		if len(mock.commands) != 0 {
+			t.Errorf("RunDetached() should not use the blocking runner, got %v", mock.commands)
+		}
+	})
+
+	t.Run("when start fails should return wrapped error", func(t *testing.T) {
+		// Arrange
+		mock := newMockCommandRunner()
+		client := createTestClient(mock, WithStartCommand(func(_ string, args ...string) (int, error) {
+			return 0, fmt.Errorf("exec failed")
+		}))
+
+		// Act
+		_, err := client.RunDetached("test-vm", false, true, nil, NetworkOptions{})
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "failed to start VM test-vm") {
+			t.Errorf("RunDetached() error = %v, want wrapped start error", err)
+		}
+	})
+}
+
+func TestRunSuspendable(t *testing.T) {
+	t.Run("when start succeeds should pass suspendable flag", func(t *testing.T) {
+		// Arrange
+		mock := newMockCommandRunner()
+		var started []string
+		client := createTestClient(mock, WithStartCommand(func(_ string, args ...string) (int, error) {
+			started = args
+			return 4242, nil
+		}))
+
+		// Act
+		pid, err := client.RunSuspendable("test-vm", true, nil, NetworkOptions{})
+
+		// Assert
+		if err != nil {
+			t.Fatalf("RunSuspendable() unexpected error = %v", err)
+		}
+		if pid != 4242 {
+			t.Errorf("RunSuspendable() pid = %d, want 4242", pid)
+		}
+		expected := []string{"run", "--headless", "--suspendable", "--dir=tart-cache:~/.tart/cache:ro", "test-vm"}
+		if !slices.Equal(started, expected) {
+			t.Errorf("RunSuspendable() args = %v, want %v", started, expected)
+		}
+	})
+}
+
+func TestSuspend(t *testing.T) {
+	t.Run("when suspend succeeds should run tart suspend", func(t *testing.T) {
+		// Arrange
+		mock := newMockCommandRunner()
+		client := createTestClient(mock)
+
+		// Act
+		err := client.Suspend("test-vm")
+
+		// Assert
+		if err != nil {
+			t.Fatalf("Suspend() unexpected error = %v", err)
+		}
+		expected := []string{"tart", "suspend", "test-vm"}
+		if !slices.Equal(mock.commands[0], expected) {
+			t.Errorf("Suspend() command = %v, want %v", mock.commands[0], expected)
+		}
+	})
+
+	t.Run("when suspend fails should return wrapped error", func(t *testing.T) {
+		// Arrange
+		mock := newMockCommandRunner()
+		mock.addError("suspend test-vm", fmt.Errorf("VM was not started with --suspendable"))
+		client := createTestClient(mock)
+
+		// Act
+		err := client.Suspend("test-vm")
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "failed to suspend VM test-vm") {
+			t.Errorf("Suspend() error = %v, want wrapped suspend error", err)
+		}
+	})
+}
+
+func TestIsSuspended(t *testing.T) {
+	t.Run("when VM is suspended should return true", func(t *testing.T) {
+		// Arrange
+		mock := newMockCommandRunner()
+		mock.addOutput("list --format json", `[{"name":"test-vm","state":"suspended"}]`)
+		client := createTestClient(mock)
+
+		// Act
+		got := client.IsSuspended("test-vm")
+
+		// Assert
+		if !got {
+			t.Error("IsSuspended() = false, want true")
+		}
+	})
+
+	t.Run("when VM is running should return false", func(t *testing.T) {
+		// Arrange
+		mock := newMockCommandRunner()
+		mock.addOutput("list --format json", `[{"name":"test-vm","state":"running"}]`)
+		client := createTestClient(mock)
+
+		// Act
+		got := client.IsSuspended("test-vm")
+
+		// Assert
+		if got {
+			t.Error("IsSuspended() = true, want false")
+		}
+	})
+}
+
 func TestCloneWhenTartIsInstalled(t *testing.T) {
 	t.Run("when tart is installed should dispatch clone command", func(t *testing.T) {
 		// Arrange
@@ -763,6 +1084,7 @@ func TestCloneWhenTartIsNotInstalledAndUserConfirmsAndBrewSucceeds(t *testing.T)
 			WithRunCommand(func(args ...string) (string, error) {
 				return mock.runCommand("tart", args...)
 			}),
+			WithStreamCommand(mock.streamCommand),
 		)
 
 		// Act
@@ -823,4 +1145,3 @@ func TestCloneWhenBrewIsNotAvailableAndTartNotFound(t *testing.T) {
 		}
 	})
 }
-
@@ -0,0 +1,84 @@
+package netd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"time"
+)
+
+// defaultClientTimeout bounds a single request round trip.
+const defaultClientTimeout = 10 * time.Second
+
+// Client talks to calf-netd over its Unix socket.
+type Client struct {
+	socketPath string
+	timeout    time.Duration
+}
+
+// NewClient creates a Client for the daemon listening at socketPath.
+func NewClient(socketPath string) *Client {
+	return &Client{socketPath: socketPath, timeout: defaultClientTimeout}
+}
+
+// LoadAnchor asks the daemon to block SMB from vmIP until tartPID exits.
+func (c *Client) LoadAnchor(vmIP string, tartPID int) error {
+	_, err := c.do(Request{Op: OpLoadAnchor, IP: vmIP, PID: tartPID})
+	return err
+}
+
+// UnloadAnchor asks the daemon to flush the SMB block anchor for every VM.
+func (c *Client) UnloadAnchor() error {
+	_, err := c.do(Request{Op: OpUnloadAnchor})
+	return err
+}
+
+// ReloadAnchor asks the daemon to replace the SMB block anchor with the rules
+// for the VMs it owns, clearing stuck rules without unblocking any VM.
+func (c *Client) ReloadAnchor() error {
+	_, err := c.do(Request{Op: OpReloadAnchor})
+	return err
+}
+
+// Status returns the VMs the daemon's anchor currently blocks.
+func (c *Client) Status() (State, error) {
+	resp, err := c.do(Request{Op: OpStatus})
+	if err != nil {
+		return State{}, err
+	}
+	return resp.State, nil
+}
+
+// do sends req and returns the daemon's response, converting daemon-side
+// failures into errors.
+func (c *Client) do(req Request) (Response, error) {
+	req.Version = ProtocolVersion
+
+	conn, err := net.DialTimeout("unix", c.socketPath, c.timeout)
+	if err != nil {
+		return Response{}, fmt.Errorf("failed to connect to calf-netd at %s (is it installed and running?): %w", c.socketPath, err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(c.timeout))
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return Response{}, fmt.Errorf("failed to send %s request: %w", req.Op, err)
+	}
+
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil {
+		return Response{}, fmt.Errorf("failed to read %s response: %w", req.Op, err)
+	}
+	var resp Response
+	if err := json.Unmarshal(line, &resp); err != nil {
+		return Response{}, fmt.Errorf("failed to parse %s response: %w", req.Op, err)
+	}
+	if resp.Version != ProtocolVersion {
+		return Response{}, fmt.Errorf("calf-netd speaks protocol version %d, expected %d", resp.Version, ProtocolVersion)
+	}
+	if !resp.OK {
+		return resp, fmt.Errorf("calf-netd %s failed: %s", req.Op, resp.Error)
+	}
+	return resp, nil
+}
@@ -0,0 +1,88 @@
+// Package netd implements calf-netd, the privileged helper daemon that owns
+// the pf SMB-block anchor, and the client library used by the calf CLI.
+//
+// calf-netd runs as root from a LaunchDaemon and listens on a Unix socket.
+// Clients ask it to block a VM IP until a tart PID exits; the anchor blocks
+// every such VM at once. The daemon watches each PID and drops its VM from
+// the anchor as soon as tart exits, even if the calf process that requested
+// the block has already exited.
+//
+// Each connection carries one JSON request and one JSON response, both
+// terminated by a newline. Requests and responses carry a protocol version;
+// the daemon rejects versions it does not speak.
+package netd
+
+const (
+	// ProtocolVersion is the wire protocol version spoken by this package.
+	ProtocolVersion = 1
+
+	// DefaultSocketPath is where calf-netd listens by default.
+	DefaultSocketPath = "/var/run/calf-netd.sock"
+
+	// DefaultStatePath is where calf-netd records the blocked VMs so it can
+	// reconcile after a crash or restart.
+	DefaultStatePath = "/var/db/calf-netd/state.json"
+)
+
+// Op names a daemon operation.
+type Op string
+
+const (
+	// OpLoadAnchor adds IP to the SMB block anchor until PID exits.
+	OpLoadAnchor Op = "load-anchor"
+
+	// OpUnloadAnchor flushes the SMB block anchor for every VM.
+	OpUnloadAnchor Op = "unload-anchor"
+
+	// OpReloadAnchor replaces the SMB block anchor with the rules for the VMs
+	// the daemon owns, in one step, dropping any rules it does not own.
+	OpReloadAnchor Op = "reload-anchor"
+
+	// OpStatus reports the VMs the anchor currently blocks.
+	OpStatus Op = "status"
+)
+
+// Request is a single client request.
+type Request struct {
+	Version int    `json:"version"`
+	Op      Op     `json:"op"`
+	IP      string `json:"ip,omitempty"`
+	PID     int    `json:"pid,omitempty"`
+}
+
+// Response is the daemon's reply to a Request.
+type Response struct {
+	Version int    `json:"version"`
+	OK      bool   `json:"ok"`
+	Error   string `json:"error,omitempty"`
+	State   State  `json:"state"`
+}
+
+// State describes the anchor owned by the daemon.
+// The zero value means no anchor is loaded.
+type State struct {
+	// VMs are the VMs the anchor blocks, ordered by IP.
+	VMs []BlockedVM `json:"vms,omitempty"`
+}
+
+// BlockedVM is a VM whose SMB traffic the anchor blocks.
+type BlockedVM struct {
+	// IP is the VM IP the anchor blocks.
+	IP string `json:"ip"`
+	// PID is the tart process whose exit drops the VM from the anchor.
+	PID int `json:"pid"`
+}
+
+// Loaded reports whether an anchor is loaded.
+func (s State) Loaded() bool {
+	return len(s.VMs) > 0
+}
+
+// IPs returns the IPs the anchor blocks.
+func (s State) IPs() []string {
+	ips := make([]string, len(s.VMs))
+	for i, vm := range s.VMs {
+		ips[i] = vm.IP
+	}
+	return ips
+}
@@ -0,0 +1,428 @@
+package netd
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/will-head/coding-agent-loader/internal/smbblock"
+)
+
+// connTimeout bounds how long a client may take to send its request.
+const connTimeout = 10 * time.Second
+
+// ServerOption configures a Server.
+type ServerOption func(*Server)
+
+// WithAnchorManager overrides the pf anchor manager.
+// Intended for use in tests.
+func WithAnchorManager(pf *smbblock.Manager) ServerOption {
+	return func(s *Server) { s.pf = pf }
+}
+
+// WithProcessWatcher overrides the process watcher.
+// Intended for use in tests.
+func WithProcessWatcher(w ProcessWatcher) ServerOption {
+	return func(s *Server) { s.watcher = w }
+}
+
+// WithAllowedUIDs sets the UIDs allowed to send requests, in addition to root.
+func WithAllowedUIDs(uids ...uint32) ServerOption {
+	return func(s *Server) { s.allowedUIDs = append(s.allowedUIDs, uids...) }
+}
+
+// WithPeerUID overrides how the peer UID of a connection is determined.
+// Intended for use in tests.
+func WithPeerUID(fn func(*net.UnixConn) (uint32, error)) ServerOption {
+	return func(s *Server) { s.peerUID = fn }
+}
+
+// WithLogWriter sets where the server logs anchor changes and errors.
+func WithLogWriter(w io.Writer) ServerOption {
+	return func(s *Server) { s.logWriter = w }
+}
+
+// Server is the calf-netd daemon. It owns the anchor, which blocks every VM
+// it has been asked to until that VM's tart process exits.
+type Server struct {
+	statePath   string
+	pf          *smbblock.Manager
+	watcher     ProcessWatcher
+	allowedUIDs []uint32
+	peerUID     func(*net.UnixConn) (uint32, error)
+	logWriter   io.Writer
+
+	mu sync.Mutex
+	// vms are the blocked VMs, keyed by tart PID.
+	vms map[int]blockedVM
+}
+
+// blockedVM is a VM in the anchor and the watch on its tart process.
+type blockedVM struct {
+	ip string
+	// stop ends the watch when the VM leaves the anchor for another reason.
+	stop chan struct{}
+}
+
+// NewServer creates a Server that persists its state at statePath.
+// Only root may send requests unless more UIDs are allowed via WithAllowedUIDs.
+func NewServer(statePath string, opts ...ServerOption) *Server {
+	s := &Server{
+		statePath:   statePath,
+		pf:          smbblock.NewManager(smbblock.WithDirectPfctl()),
+		watcher:     NewProcessWatcher(),
+		allowedUIDs: []uint32{0},
+		peerUID:     unixPeerUID,
+		logWriter:   os.Stderr,
+		vms:         map[int]blockedVM{},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Reconcile restores consistency between the persisted state, pf, and running
+// processes after a crash or restart. The daemon resumes watching the recorded
+// tart processes that are still running and keeps their VMs blocked; the
+// others are dropped, and the anchor is flushed if none remain.
+// Rules present in pf without a recorded owner are flushed as stuck.
+func (s *Server) Reconcile() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, err := s.readState()
+	if err != nil {
+		fmt.Fprintf(s.logWriter, "calf-netd: discarding unreadable state: %v\n", err)
+		state = State{}
+	}
+
+	vms := map[int]blockedVM{}
+	exits := map[int]<-chan struct{}{}
+	for _, vm := range state.VMs {
+		if !s.watcher.Alive(vm.PID) {
+			fmt.Fprintf(s.logWriter, "calf-netd: tart pid %d exited while daemon was down, unblocked %s\n", vm.PID, vm.IP)
+			continue
+		}
+		stop := make(chan struct{})
+		exited, err := s.watcher.Watch(vm.PID, stop)
+		if err != nil {
+			fmt.Fprintf(s.logWriter, "calf-netd: %v, unblocked %s\n", err, vm.IP)
+			continue
+		}
+		vms[vm.PID] = blockedVM{ip: vm.IP, stop: stop}
+		exits[vm.PID] = exited
+	}
+
+	if err := s.apply(vms); err != nil {
+		stopAll(vms)
+		return fmt.Errorf("failed to restore anchor: %w", err)
+	}
+	s.setVMs(vms)
+	for pid, exited := range exits {
+		s.watchExit(pid, exited, vms[pid].stop)
+		fmt.Fprintf(s.logWriter, "calf-netd: resumed watching tart pid %d for %s\n", pid, vms[pid].ip)
+	}
+	return nil
+}
+
+// ListenAndServe removes any stale socket at socketPath, listens on it, and
+// serves requests until the listener is closed. The socket is world-writable;
+// access is controlled by peer UID.
+func (s *Server) ListenAndServe(socketPath string) error {
+	if err := os.Remove(socketPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove stale socket '%s': %w", socketPath, err)
+	}
+	ln, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return fmt.Errorf("failed to listen on '%s': %w", socketPath, err)
+	}
+	if err := os.Chmod(socketPath, 0666); err != nil {
+		ln.Close()
+		return fmt.Errorf("failed to set socket permissions: %w", err)
+	}
+	return s.Serve(ln)
+}
+
+// Serve accepts connections on ln until it is closed.
+// Returns nil when the listener is closed.
+func (s *Server) Serve(ln net.Listener) error {
+	for {
+		conn, err := ln.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to accept connection: %w", err)
+		}
+		go s.serveConn(conn)
+	}
+}
+
+// serveConn authenticates the peer, reads one request, and writes one response.
+func (s *Server) serveConn(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(connTimeout))
+
+	resp := s.respond(conn)
+	resp.Version = ProtocolVersion
+	if err := json.NewEncoder(conn).Encode(resp); err != nil {
+		fmt.Fprintf(s.logWriter, "calf-netd: failed to write response: %v\n", err)
+	}
+}
+
+// respond produces the response for a connection.
+func (s *Server) respond(conn net.Conn) Response {
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return errorResponse(fmt.Errorf("connection is not a unix socket"))
+	}
+	uid, err := s.peerUID(unixConn)
+	if err != nil {
+		return errorResponse(err)
+	}
+	if !slices.Contains(s.allowedUIDs, uid) {
+		fmt.Fprintf(s.logWriter, "calf-netd: rejected request from uid %d\n", uid)
+		return errorResponse(fmt.Errorf("uid %d is not allowed to use calf-netd", uid))
+	}
+
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil {
+		return errorResponse(fmt.Errorf("failed to read request: %w", err))
+	}
+	var req Request
+	if err := json.Unmarshal(line, &req); err != nil {
+		return errorResponse(fmt.Errorf("failed to parse request: %w", err))
+	}
+	return s.handle(req)
+}
+
+// handle executes an authenticated request.
+func (s *Server) handle(req Request) Response {
+	if req.Version != ProtocolVersion {
+		return errorResponse(fmt.Errorf("unsupported protocol version %d (calf-netd speaks %d)", req.Version, ProtocolVersion))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+	switch req.Op {
+	case OpLoadAnchor:
+		err = s.loadAnchor(req.IP, req.PID)
+	case OpUnloadAnchor:
+		err = s.unloadAnchor()
+	case OpReloadAnchor:
+		err = s.reloadAnchor()
+	case OpStatus:
+	default:
+		err = fmt.Errorf("unknown operation '%s'", req.Op)
+	}
+
+	if err != nil {
+		resp := errorResponse(err)
+		resp.State = s.state()
+		return resp
+	}
+	return Response{OK: true, State: s.state()}
+}
+
+// loadAnchor adds ip to the anchor and drops it again when pid exits; the
+// other blocked VMs stay blocked. Loading the same ip and pid again is a
+// no-op. A new pid for a blocked ip replaces the old one, since the IP has
+// been handed to a new VM.
+func (s *Server) loadAnchor(ip string, pid int) error {
+	if pid <= 0 {
+		return fmt.Errorf("load-anchor requires a tart pid")
+	}
+	if _, err := smbblock.Ruleset(ip); err != nil {
+		return err
+	}
+	current, watched := s.vms[pid]
+	if watched && current.ip == ip {
+		return nil
+	}
+
+	var exited <-chan struct{}
+	if !watched {
+		current.stop = make(chan struct{})
+		var err error
+		if exited, err = s.watcher.Watch(pid, current.stop); err != nil {
+			return err
+		}
+	}
+
+	vms := map[int]blockedVM{pid: {ip: ip, stop: current.stop}}
+	var replaced []blockedVM
+	for otherPID, vm := range s.vms {
+		if otherPID == pid {
+			continue
+		}
+		if vm.ip == ip {
+			replaced = append(replaced, vm)
+			continue
+		}
+		vms[otherPID] = vm
+	}
+	if err := s.apply(vms); err != nil {
+		if !watched {
+			close(current.stop)
+		}
+		return err
+	}
+	for _, vm := range replaced {
+		close(vm.stop)
+	}
+	s.setVMs(vms)
+	if !watched {
+		s.watchExit(pid, exited, current.stop)
+	}
+	fmt.Fprintf(s.logWriter, "calf-netd: blocked %s (tart pid %d)\n", ip, pid)
+	return nil
+}
+
+// unloadAnchor flushes the anchor for every VM. Unloading when nothing is
+// loaded still flushes, so stuck rules are always cleared.
+func (s *Server) unloadAnchor() error {
+	if err := s.pf.Flush(); err != nil {
+		return err
+	}
+	if len(s.vms) > 0 {
+		fmt.Fprintf(s.logWriter, "calf-netd: unloaded anchor for %s\n", strings.Join(s.state().IPs(), ", "))
+	}
+	stopAll(s.vms)
+	s.setVMs(map[int]blockedVM{})
+	return nil
+}
+
+// reloadAnchor replaces the anchor with the rules for the blocked VMs. pf
+// swaps the ruleset atomically, so the blocked VMs are never unblocked while
+// rules the daemon does not own are dropped.
+func (s *Server) reloadAnchor() error {
+	if err := s.apply(s.vms); err != nil {
+		return err
+	}
+	if len(s.vms) > 0 {
+		fmt.Fprintf(s.logWriter, "calf-netd: reloaded anchor for %s\n", strings.Join(s.state().IPs(), ", "))
+	}
+	return nil
+}
+
+// watchExit drops pid's VM from the anchor when exited closes. It gives up
+// when stop closes because the VM has left the anchor for another reason.
+// The VM leaves the recorded state even if pf cannot be updated, so its IP
+// is not blocked again by later loads.
+func (s *Server) watchExit(pid int, exited <-chan struct{}, stop chan struct{}) {
+	go func() {
+		select {
+		case <-exited:
+		case <-stop:
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		vm, ok := s.vms[pid]
+		if !ok || vm.stop != stop {
+			return
+		}
+		fmt.Fprintf(s.logWriter, "calf-netd: tart pid %d exited, unblocking %s\n", pid, vm.ip)
+		vms := maps.Clone(s.vms)
+		delete(vms, pid)
+		if err := s.apply(vms); err != nil {
+			// The VM is gone either way: its stale rule is dropped by the
+			// next successful load of the anchor.
+			fmt.Fprintf(s.logWriter, "calf-netd: %v; %s stays in the anchor until its next change\n", err, vm.ip)
+		}
+		s.setVMs(vms)
+	}()
+}
+
+// apply loads the anchor with the rules for vms, or flushes it if there are
+// none.
+func (s *Server) apply(vms map[int]blockedVM) error {
+	if len(vms) == 0 {
+		return s.pf.Flush()
+	}
+	return s.pf.Load(stateOf(vms).IPs()...)
+}
+
+// setVMs records the blocked VMs in memory and on disk.
+// Callers must hold s.mu.
+func (s *Server) setVMs(vms map[int]blockedVM) {
+	s.vms = vms
+	if err := s.writeState(stateOf(vms)); err != nil {
+		fmt.Fprintf(s.logWriter, "calf-netd: %v\n", err)
+	}
+}
+
+// state returns the blocked VMs. Callers must hold s.mu.
+func (s *Server) state() State {
+	return stateOf(s.vms)
+}
+
+// stateOf returns the State describing vms.
+func stateOf(vms map[int]blockedVM) State {
+	state := State{}
+	for pid, vm := range vms {
+		state.VMs = append(state.VMs, BlockedVM{IP: vm.ip, PID: pid})
+	}
+	slices.SortFunc(state.VMs, func(a, b BlockedVM) int { return strings.Compare(a.IP, b.IP) })
+	return state
+}
+
+// stopAll ends the watches on vms.
+func stopAll(vms map[int]blockedVM) {
+	for _, vm := range vms {
+		close(vm.stop)
+	}
+}
+
+// readState loads the persisted state. A missing file means no anchor.
+func (s *Server) readState() (State, error) {
+	data, err := os.ReadFile(s.statePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return State{}, nil
+	}
+	if err != nil {
+		return State{}, fmt.Errorf("failed to read state file '%s': %w", s.statePath, err)
+	}
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return State{}, fmt.Errorf("failed to parse state file '%s': %w", s.statePath, err)
+	}
+	return state, nil
+}
+
+// writeState persists state atomically via rename.
+func (s *Server) writeState(state State) error {
+	if err := os.MkdirAll(filepath.Dir(s.statePath), 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+	tmp := s.statePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := os.Rename(tmp, s.statePath); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	return nil
+}
+
+// errorResponse builds a failed response for err.
+func errorResponse(err error) Response {
+	return Response{OK: false, Error: err.Error()}
+}
@@ -0,0 +1,680 @@
+package netd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/will-head/coding-agent-loader/internal/smbblock"
+)
+
+// fakePfctl records pfctl invocations. Safe for concurrent use because the
+// server flushes from watcher goroutines.
+type fakePfctl struct {
+	mu      sync.Mutex
+	calls   []string
+	rules   string
+	loadErr error
+}
+
+func (f *fakePfctl) run(stdin string, args ...string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, strings.Join(args, " "))
+	if slices.Contains(args, "-f") {
+		if f.loadErr != nil {
+			return "", f.loadErr
+		}
+		f.rules = stdin
+	}
+	return "", nil
+}
+
+// failLoads makes later loads fail with err, or succeed again if err is nil.
+func (f *fakePfctl) failLoads(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.loadErr = err
+}
+
+// lastRules returns the ruleset of the last successful load.
+func (f *fakePfctl) lastRules() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.rules
+}
+
+// count returns how many times pfctl was invoked with the given flag (e.g. "-f", "-F").
+func (f *fakePfctl) count(flag string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, call := range f.calls {
+		if slices.Contains(strings.Fields(call), flag) {
+			n++
+		}
+	}
+	return n
+}
+
+// fakeWatcher simulates tart processes. Processes are alive until exit is called.
+type fakeWatcher struct {
+	mu    sync.Mutex
+	alive map[int]bool
+	exits map[int][]chan struct{}
+	stops map[int][]<-chan struct{}
+}
+
+func newFakeWatcher(pids ...int) *fakeWatcher {
+	w := &fakeWatcher{alive: map[int]bool{}, exits: map[int][]chan struct{}{}, stops: map[int][]<-chan struct{}{}}
+	for _, pid := range pids {
+		w.alive[pid] = true
+	}
+	return w
+}
+
+func (w *fakeWatcher) Alive(pid int) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.alive[pid]
+}
+
+func (w *fakeWatcher) Watch(pid int, stop <-chan struct{}) (<-chan struct{}, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.alive[pid] {
+		return nil, fmt.Errorf("failed to watch process %d: process does not exist", pid)
+	}
+	ch := make(chan struct{})
+	w.exits[pid] = append(w.exits[pid], ch)
+	w.stops[pid] = append(w.stops[pid], stop)
+	return ch, nil
+}
+
+// watching returns how many watches on pid have not been stopped.
+func (w *fakeWatcher) watching(pid int) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	n := 0
+	for _, stop := range w.stops[pid] {
+		select {
+		case <-stop:
+		default:
+			n++
+		}
+	}
+	return n
+}
+
+func (w *fakeWatcher) exit(pid int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.alive[pid] = false
+	for _, ch := range w.exits[pid] {
+		close(ch)
+	}
+	w.exits[pid] = nil
+}
+
+var socketCounter atomic.Int64
+
+// shortSocketPath returns a unique socket path under os.TempDir.
+// t.TempDir paths include the test name and can exceed the 104-byte
+// sun_path limit on macOS.
+func shortSocketPath(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("calf-netd-%d-%d.sock", os.Getpid(), socketCounter.Add(1)))
+	t.Cleanup(func() { os.Remove(path) })
+	return path
+}
+
+// startTestServer serves a fresh Server on a temporary socket and returns a
+// client for it and the server's state file path.
+func startTestServer(t *testing.T, pf *fakePfctl, watcher ProcessWatcher, opts ...ServerOption) (*Client, string) {
+	t.Helper()
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	server := NewServer(statePath, append([]ServerOption{
+		WithAnchorManager(smbblock.NewManager(smbblock.WithPfctlRunner(pf.run))),
+		WithProcessWatcher(watcher),
+		WithAllowedUIDs(uint32(os.Getuid())),
+		WithLogWriter(&strings.Builder{}),
+	}, opts...)...)
+
+	socketPath := shortSocketPath(t)
+	ln, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go server.Serve(ln)
+
+	return NewClient(socketPath), statePath
+}
+
+// waitFor polls cond until it returns true or a second elapses.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("condition not met within 1s")
+}
+
+func TestServerLoadAnchor(t *testing.T) {
+	t.Run("when tart is running should load anchor and report state", func(t *testing.T) {
+		// Arrange
+		pf := &fakePfctl{}
+		client, _ := startTestServer(t, pf, newFakeWatcher(4242))
+
+		// Act
+		err := client.LoadAnchor("192.168.64.5", 4242)
+
+		// Assert
+		if err != nil {
+			t.Fatalf("LoadAnchor() unexpected error = %v", err)
+		}
+		if pf.count("-f") != 1 {
+			t.Errorf("expected one pfctl load, calls: %v", pf.calls)
+		}
+		state, err := client.Status()
+		if err != nil {
+			t.Fatalf("Status() unexpected error = %v", err)
+		}
+		if !slices.Equal(state.VMs, []BlockedVM{{IP: "192.168.64.5", PID: 4242}}) {
+			t.Errorf("Status() = %+v, want loaded state", state)
+		}
+	})
+
+	t.Run("when same load repeated should not reload pf", func(t *testing.T) {
+		// Arrange
+		pf := &fakePfctl{}
+		client, _ := startTestServer(t, pf, newFakeWatcher(4242))
+		if err := client.LoadAnchor("192.168.64.5", 4242); err != nil {
+			t.Fatal(err)
+		}
+
+		// Act
+		err := client.LoadAnchor("192.168.64.5", 4242)
+
+		// Assert
+		if err != nil {
+			t.Fatalf("LoadAnchor() unexpected error = %v", err)
+		}
+		if pf.count("-f") != 1 {
+			t.Errorf("expected repeated load to be a no-op, calls: %v", pf.calls)
+		}
+	})
+
+	t.Run("when tart exits should unload anchor and clear state", func(t *testing.T) {
+		// Arrange
+		pf := &fakePfctl{}
+		watcher := newFakeWatcher(4242)
+		client, _ := startTestServer(t, pf, watcher)
+		if err := client.LoadAnchor("192.168.64.5", 4242); err != nil {
+			t.Fatal(err)
+		}
+
+		// Act
+		watcher.exit(4242)
+
+		// Assert
+		waitFor(t, func() bool { return pf.count("-F") == 1 })
+		state, err := client.Status()
+		if err != nil {
+			t.Fatalf("Status() unexpected error = %v", err)
+		}
+		if state.Loaded() {
+			t.Errorf("Status() = %+v, want no anchor after tart exit", state)
+		}
+	})
+
+	t.Run("when first of two tarts exits should keep blocking the second VM", func(t *testing.T) {
+		// Arrange
+		pf := &fakePfctl{}
+		watcher := newFakeWatcher(4242, 5353)
+		client, _ := startTestServer(t, pf, watcher)
+		if err := client.LoadAnchor("192.168.64.5", 4242); err != nil {
+			t.Fatal(err)
+		}
+		if err := client.LoadAnchor("192.168.64.6", 5353); err != nil {
+			t.Fatal(err)
+		}
+		if rules := pf.lastRules(); !strings.Contains(rules, "192.168.64.5") || !strings.Contains(rules, "192.168.64.6") {
+			t.Fatalf("rules = %q, want both VMs blocked", rules)
+		}
+
+		// Act
+		watcher.exit(4242)
+
+		// Assert
+		waitFor(t, func() bool { return pf.count("-f") == 3 })
+		if rules := pf.lastRules(); strings.Contains(rules, "192.168.64.5") || !strings.Contains(rules, "192.168.64.6") {
+			t.Errorf("rules = %q, want only 192.168.64.6 blocked", rules)
+		}
+		if pf.count("-F") != 0 {
+			t.Errorf("expected no flush while a VM is blocked, calls: %v", pf.calls)
+		}
+		state, err := client.Status()
+		if err != nil {
+			t.Fatalf("Status() unexpected error = %v", err)
+		}
+		if !slices.Equal(state.VMs, []BlockedVM{{IP: "192.168.64.6", PID: 5353}}) {
+			t.Errorf("Status() = %+v, want only 192.168.64.6", state)
+		}
+	})
+
+	t.Run("when second of two tarts exits should keep blocking the first VM", func(t *testing.T) {
+		// Arrange
+		pf := &fakePfctl{}
+		watcher := newFakeWatcher(4242, 5353)
+		client, _ := startTestServer(t, pf, watcher)
+		if err := client.LoadAnchor("192.168.64.5", 4242); err != nil {
+			t.Fatal(err)
+		}
+		if err := client.LoadAnchor("192.168.64.6", 5353); err != nil {
+			t.Fatal(err)
+		}
+
+		// Act
+		watcher.exit(5353)
+		waitFor(t, func() bool { return pf.count("-f") == 3 })
+		secondRules := pf.lastRules()
+		watcher.exit(4242)
+
+		// Assert
+		if !strings.Contains(secondRules, "192.168.64.5") || strings.Contains(secondRules, "192.168.64.6") {
+			t.Errorf("rules = %q, want only 192.168.64.5 blocked", secondRules)
+		}
+		waitFor(t, func() bool { return pf.count("-F") == 1 })
+		state, err := client.Status()
+		if err != nil {
+			t.Fatalf("Status() unexpected error = %v", err)
+		}
+		if state.Loaded() {
+			t.Errorf("Status() = %+v, want no anchor after both exit", state)
+		}
+	})
+
+	t.Run("when pf fails after a tart exits should drop its VM and its rule on the next load", func(t *testing.T) {
+		// Arrange
+		pf := &fakePfctl{}
+		watcher := newFakeWatcher(4242, 5353, 6464)
+		client, _ := startTestServer(t, pf, watcher)
+		if err := client.LoadAnchor("192.168.64.5", 4242); err != nil {
+			t.Fatal(err)
+		}
+		if err := client.LoadAnchor("192.168.64.6", 5353); err != nil {
+			t.Fatal(err)
+		}
+		pf.failLoads(fmt.Errorf("pfctl failed"))
+
+		// Act
+		watcher.exit(5353)
+		waitFor(t, func() bool { return pf.count("-f") == 3 })
+		waitFor(t, func() bool {
+			state, err := client.Status()
+			return err == nil && len(state.VMs) == 1
+		})
+		pf.failLoads(nil)
+		err := client.LoadAnchor("192.168.64.7", 6464)
+
+		// Assert
+		if err != nil {
+			t.Fatalf("LoadAnchor() unexpected error = %v", err)
+		}
+		if rules := pf.lastRules(); strings.Contains(rules, "192.168.64.6") || !strings.Contains(rules, "192.168.64.5") {
+			t.Errorf("rules = %q, want exited VM dropped and first VM kept", rules)
+		}
+	})
+
+	t.Run("when pf load fails should stop watching tart", func(t *testing.T) {
+		// Arrange
+		pf := &fakePfctl{loadErr: fmt.Errorf("pfctl failed")}
+		watcher := newFakeWatcher(4242)
+		client, _ := startTestServer(t, pf, watcher)
+
+		// Act
+		err := client.LoadAnchor("192.168.64.5", 4242)
+
+		// Assert
+		if err == nil {
+			t.Fatal("LoadAnchor() expected error, got nil")
+		}
+		if watcher.watching(4242) != 0 {
+			t.Errorf("expected the watch on tart to be stopped")
+		}
+	})
+
+	t.Run("when tart is not running should fail without loading pf", func(t *testing.T) {
+		// Arrange
+		pf := &fakePfctl{}
+		client, _ := startTestServer(t, pf, newFakeWatcher())
+
+		// Act
+		err := client.LoadAnchor("192.168.64.5", 4242)
+
+		// Assert
+		if err == nil {
+			t.Fatal("LoadAnchor() expected error, got nil")
+		}
+		if pf.count("-f") != 0 {
+			t.Errorf("expected no pfctl load, calls: %v", pf.calls)
+		}
+	})
+
+	t.Run("when IP is invalid should fail without loading pf", func(t *testing.T) {
+		// Arrange
+		pf := &fakePfctl{}
+		client, _ := startTestServer(t, pf, newFakeWatcher(4242))
+
+		// Act
+		err := client.LoadAnchor("any", 4242)
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "invalid VM IP address") {
+			t.Errorf("LoadAnchor() error = %v, want invalid IP error", err)
+		}
+		if pf.count("-f") != 0 {
+			t.Errorf("expected no pfctl load, calls: %v", pf.calls)
+		}
+	})
+
+	t.Run("when loaded should persist state for crash recovery", func(t *testing.T) {
+		// Arrange
+		pf := &fakePfctl{}
+		client, statePath := startTestServer(t, pf, newFakeWatcher(4242))
+
+		// Act
+		err := client.LoadAnchor("192.168.64.5", 4242)
+
+		// Assert
+		if err != nil {
+			t.Fatalf("LoadAnchor() unexpected error = %v", err)
+		}
+		data, err := os.ReadFile(statePath)
+		if err != nil {
+			t.Fatalf("expected state file: %v", err)
+		}
+		var state State
+		if err := json.Unmarshal(data, &state); err != nil {
+			t.Fatalf("state file is not valid JSON: %v", err)
+		}
+		if !slices.Equal(state.VMs, []BlockedVM{{IP: "192.168.64.5", PID: 4242}}) {
+			t.Errorf("persisted state = %+v, want loaded state", state)
+		}
+	})
+}
+
+func TestServerUnloadAnchor(t *testing.T) {
+	t.Run("when nothing loaded should succeed and still flush", func(t *testing.T) {
+		// Arrange
+		pf := &fakePfctl{}
+		client, _ := startTestServer(t, pf, newFakeWatcher())
+
+		// Act
+		err := client.UnloadAnchor()
+
+		// Assert
+		if err != nil {
+			t.Fatalf("UnloadAnchor() unexpected error = %v", err)
+		}
+		if pf.count("-F") != 1 {
+			t.Errorf("expected one pfctl flush, calls: %v", pf.calls)
+		}
+	})
+
+	t.Run("when loaded should flush and clear state", func(t *testing.T) {
+		// Arrange
+		pf := &fakePfctl{}
+		client, _ := startTestServer(t, pf, newFakeWatcher(4242))
+		if err := client.LoadAnchor("192.168.64.5", 4242); err != nil {
+			t.Fatal(err)
+		}
+
+		// Act
+		err := client.UnloadAnchor()
+
+		// Assert
+		if err != nil {
+			t.Fatalf("UnloadAnchor() unexpected error = %v", err)
+		}
+		state, err := client.Status()
+		if err != nil {
+			t.Fatalf("Status() unexpected error = %v", err)
+		}
+		if state.Loaded() {
+			t.Errorf("Status() = %+v, want no anchor", state)
+		}
+	})
+}
+
+func TestServerReloadAnchor(t *testing.T) {
+	t.Run("when VMs are blocked should load their rules in one step without flushing", func(t *testing.T) {
+		// Arrange
+		pf := &fakePfctl{}
+		client, _ := startTestServer(t, pf, newFakeWatcher(4242))
+		if err := client.LoadAnchor("192.168.64.5", 4242); err != nil {
+			t.Fatal(err)
+		}
+
+		// Act
+		err := client.ReloadAnchor()
+
+		// Assert
+		if err != nil {
+			t.Fatalf("ReloadAnchor() unexpected error = %v", err)
+		}
+		if pf.count("-F") != 0 || pf.count("-f") != 2 {
+			t.Errorf("expected a second load and no flush, calls: %v", pf.calls)
+		}
+		if !strings.Contains(pf.lastRules(), "192.168.64.5") {
+			t.Errorf("reloaded rules = %q, want owned VM", pf.lastRules())
+		}
+		state, _ := client.Status()
+		if !slices.Equal(state.VMs, []BlockedVM{{IP: "192.168.64.5", PID: 4242}}) {
+			t.Errorf("Status() = %+v, want owned VM still blocked", state)
+		}
+	})
+
+	t.Run("when nothing is blocked should flush the anchor", func(t *testing.T) {
+		// Arrange
+		pf := &fakePfctl{}
+		client, _ := startTestServer(t, pf, newFakeWatcher())
+
+		// Act
+		err := client.ReloadAnchor()
+
+		// Assert
+		if err != nil {
+			t.Fatalf("ReloadAnchor() unexpected error = %v", err)
+		}
+		if pf.count("-F") != 1 {
+			t.Errorf("expected one pfctl flush, calls: %v", pf.calls)
+		}
+	})
+}
+
+func TestServerAuthentication(t *testing.T) {
+	t.Run("when peer uid is not allowed should reject without touching pf", func(t *testing.T) {
+		// Arrange
+		pf := &fakePfctl{}
+		client, _ := startTestServer(t, pf, newFakeWatcher(4242),
+			WithPeerUID(func(*net.UnixConn) (uint32, error) { return 9999, nil }))
+
+		// Act
+		err := client.LoadAnchor("192.168.64.5", 4242)
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "uid 9999 is not allowed") {
+			t.Errorf("LoadAnchor() error = %v, want uid rejection", err)
+		}
+		if len(pf.calls) != 0 {
+			t.Errorf("expected no pfctl calls, got %v", pf.calls)
+		}
+	})
+
+	t.Run("when request uses another protocol version should reject", func(t *testing.T) {
+		// Arrange
+		pf := &fakePfctl{}
+		client, _ := startTestServer(t, pf, newFakeWatcher(4242))
+		conn, err := net.Dial("unix", client.socketPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		// Act
+		fmt.Fprintln(conn, `{"version":2,"op":"unload-anchor"}`)
+		line, err := bufio.NewReader(conn).ReadBytes('\n')
+
+		// Assert
+		if err != nil {
+			t.Fatalf("failed to read response: %v", err)
+		}
+		var resp Response
+		if err := json.Unmarshal(line, &resp); err != nil {
+			t.Fatalf("invalid response: %v", err)
+		}
+		if resp.OK || !strings.Contains(resp.Error, "unsupported protocol version 2") {
+			t.Errorf("response = %+v, want version rejection", resp)
+		}
+		if resp.Version != ProtocolVersion {
+			t.Errorf("response version = %d, want %d", resp.Version, ProtocolVersion)
+		}
+	})
+}
+
+func TestServerReconcile(t *testing.T) {
+	t.Run("when recorded tart has exited should flush anchor and clear state", func(t *testing.T) {
+		// Arrange
+		pf := &fakePfctl{}
+		statePath := filepath.Join(t.TempDir(), "state.json")
+		if err := os.WriteFile(statePath, []byte(`{"vms":[{"ip":"192.168.64.5","pid":4242}]}`), 0644); err != nil {
+			t.Fatal(err)
+		}
+		server := NewServer(statePath,
+			WithAnchorManager(smbblock.NewManager(smbblock.WithPfctlRunner(pf.run))),
+			WithProcessWatcher(newFakeWatcher()),
+			WithLogWriter(&strings.Builder{}))
+
+		// Act
+		err := server.Reconcile()
+
+		// Assert
+		if err != nil {
+			t.Fatalf("Reconcile() unexpected error = %v", err)
+		}
+		if pf.count("-F") != 1 {
+			t.Errorf("expected pfctl flush, calls: %v", pf.calls)
+		}
+		data, _ := os.ReadFile(statePath)
+		if strings.Contains(string(data), "192.168.64.5") {
+			t.Errorf("expected state cleared, got %s", data)
+		}
+	})
+
+	t.Run("when recorded tart is still running should reload and resume watching", func(t *testing.T) {
+		// Arrange
+		pf := &fakePfctl{}
+		watcher := newFakeWatcher(4242)
+		statePath := filepath.Join(t.TempDir(), "state.json")
+		if err := os.WriteFile(statePath, []byte(`{"vms":[{"ip":"192.168.64.5","pid":4242}]}`), 0644); err != nil {
+			t.Fatal(err)
+		}
+		server := NewServer(statePath,
+			WithAnchorManager(smbblock.NewManager(smbblock.WithPfctlRunner(pf.run))),
+			WithProcessWatcher(watcher),
+			WithLogWriter(&strings.Builder{}))
+
+		// Act
+		err := server.Reconcile()
+		watcher.exit(4242)
+
+		// Assert
+		if err != nil {
+			t.Fatalf("Reconcile() unexpected error = %v", err)
+		}
+		if pf.count("-f") != 1 {
+			t.Errorf("expected anchor reloaded, calls: %v", pf.calls)
+		}
+		waitFor(t, func() bool { return pf.count("-F") == 1 })
+	})
+
+	t.Run("when one of several recorded tarts is running should keep only its VM blocked", func(t *testing.T) {
+		// Arrange
+		pf := &fakePfctl{}
+		watcher := newFakeWatcher(5353)
+		statePath := filepath.Join(t.TempDir(), "state.json")
+		state := `{"vms":[{"ip":"192.168.64.5","pid":4242},{"ip":"192.168.64.6","pid":5353}]}`
+		if err := os.WriteFile(statePath, []byte(state), 0644); err != nil {
+			t.Fatal(err)
+		}
+		server := NewServer(statePath,
+			WithAnchorManager(smbblock.NewManager(smbblock.WithPfctlRunner(pf.run))),
+			WithProcessWatcher(watcher),
+			WithLogWriter(&strings.Builder{}))
+
+		// Act
+		err := server.Reconcile()
+
+		// Assert
+		if err != nil {
+			t.Fatalf("Reconcile() unexpected error = %v", err)
+		}
+		if rules := pf.lastRules(); strings.Contains(rules, "192.168.64.5") || !strings.Contains(rules, "192.168.64.6") {
+			t.Errorf("rules = %q, want only 192.168.64.6 blocked", rules)
+		}
+		data, _ := os.ReadFile(statePath)
+		if strings.Contains(string(data), "192.168.64.5") || !strings.Contains(string(data), "192.168.64.6") {
+			t.Errorf("state = %s, want only 192.168.64.6 recorded", data)
+		}
+	})
+
+	t.Run("when no state recorded should flush stuck rules", func(t *testing.T) {
+		// Arrange
+		pf := &fakePfctl{}
+		server := NewServer(filepath.Join(t.TempDir(), "state.json"),
+			WithAnchorManager(smbblock.NewManager(smbblock.WithPfctlRunner(pf.run))),
+			WithProcessWatcher(newFakeWatcher()),
+			WithLogWriter(&strings.Builder{}))
+
+		// Act
+		err := server.Reconcile()
+
+		// Assert
+		if err != nil {
+			t.Fatalf("Reconcile() unexpected error = %v", err)
+		}
+		if pf.count("-F") != 1 {
+			t.Errorf("expected pfctl flush, calls: %v", pf.calls)
+		}
+	})
+}
+
+func TestClientConnectionFailure(t *testing.T) {
+	t.Run("when daemon is not listening should return helpful error", func(t *testing.T) {
+		// Arrange
+		client := NewClient(filepath.Join(t.TempDir(), "missing.sock"))
+
+		// Act
+		err := client.UnloadAnchor()
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "is it installed and running?") {
+			t.Errorf("UnloadAnchor() error = %v, want connection hint", err)
+		}
+	})
+}
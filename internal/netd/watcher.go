@@ -0,0 +1,43 @@
+package netd
+
+import (
+	"errors"
+	"syscall"
+	"time"
+)
+
+// watcherPollInterval is how often a polling watch checks whether a process
+// exists.
+const watcherPollInterval = time.Second
+
+// ProcessWatcher observes process lifetimes.
+type ProcessWatcher interface {
+	// Alive reports whether a process with the given PID exists.
+	Alive(pid int) bool
+	// Watch returns a channel that is closed when the process exits. Closing
+	// stop ends the watch without closing the channel.
+	// Returns an error if the process cannot be watched (e.g. it has already exited).
+	Watch(pid int, stop <-chan struct{}) (<-chan struct{}, error)
+}
+
+// processAlive reports whether pid exists, using signal 0.
+// EPERM means the process exists but belongs to another user.
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// pollExit polls pid with signal 0 and closes exited once it no longer
+// exists. It returns without closing exited when stop closes.
+func pollExit(pid int, stop <-chan struct{}, exited chan struct{}) {
+	ticker := time.NewTicker(watcherPollInterval)
+	defer ticker.Stop()
+	for processAlive(pid) {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+	close(exited)
+}
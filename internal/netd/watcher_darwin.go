@@ -0,0 +1,78 @@
+//go:build darwin
+
+package netd
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// kqueueStopInterval is how often a blocked watch checks whether it has been
+// stopped.
+const kqueueStopInterval = time.Second
+
+// kqueueWatcher watches processes with kqueue EVFILT_PROC/NOTE_EXIT, which
+// fires as soon as the process exits without polling. If kqueue fails while
+// waiting, the watch falls back to polling.
+type kqueueWatcher struct{}
+
+// NewProcessWatcher returns the platform process watcher.
+func NewProcessWatcher() ProcessWatcher {
+	return kqueueWatcher{}
+}
+
+// Alive reports whether a process with the given PID exists.
+func (kqueueWatcher) Alive(pid int) bool {
+	return processAlive(pid)
+}
+
+// Watch registers a NOTE_EXIT filter for pid and closes the returned channel
+// when it fires.
+func (kqueueWatcher) Watch(pid int, stop <-chan struct{}) (<-chan struct{}, error) {
+	kq, err := unix.Kqueue()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kqueue: %w", err)
+	}
+
+	change := unix.Kevent_t{
+		Ident:  uint64(pid),
+		Filter: unix.EVFILT_PROC,
+		Flags:  unix.EV_ADD | unix.EV_ONESHOT,
+		Fflags: unix.NOTE_EXIT,
+	}
+	if _, err := unix.Kevent(kq, []unix.Kevent_t{change}, nil, nil); err != nil {
+		unix.Close(kq)
+		return nil, fmt.Errorf("failed to watch process %d: %w", pid, err)
+	}
+
+	exited := make(chan struct{})
+	go func() {
+		defer unix.Close(kq)
+		events := make([]unix.Kevent_t, 1)
+		timeout := unix.NsecToTimespec(int64(kqueueStopInterval))
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			n, err := unix.Kevent(kq, nil, events, &timeout)
+			if err == unix.EINTR {
+				continue
+			}
+			if err != nil {
+				// An error says nothing about the process, so keep the
+				// VM blocked and watch it by polling instead.
+				pollExit(pid, stop, exited)
+				return
+			}
+			if n > 0 {
+				close(exited)
+				return
+			}
+		}
+	}()
+	return exited, nil
+}
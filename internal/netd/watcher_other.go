@@ -0,0 +1,30 @@
+//go:build !darwin
+
+package netd
+
+import "fmt"
+
+// pollWatcher watches processes by polling with signal 0. It exists so the
+// daemon builds and runs on platforms without kqueue process filters.
+type pollWatcher struct{}
+
+// NewProcessWatcher returns the platform process watcher.
+func NewProcessWatcher() ProcessWatcher {
+	return pollWatcher{}
+}
+
+// Alive reports whether a process with the given PID exists.
+func (pollWatcher) Alive(pid int) bool {
+	return processAlive(pid)
+}
+
+// Watch polls pid and closes the returned channel once it no longer exists.
+func (pollWatcher) Watch(pid int, stop <-chan struct{}) (<-chan struct{}, error) {
+	if !processAlive(pid) {
+		return nil, fmt.Errorf("failed to watch process %d: process does not exist", pid)
+	}
+
+	exited := make(chan struct{})
+	go pollExit(pid, stop, exited)
+	return exited, nil
+}
@@ -0,0 +1,174 @@
+// Package smbblock manages the pf anchor that blocks SMB and NetBIOS traffic
+// from CALF VMs to the host and local network in no-network isolation mode.
+//
+// Rules are loaded into the com.apple/calf.smb-block anchor, which is covered
+// by the com.apple/* wildcard anchor already present in /etc/pf.conf, so no
+// pf configuration files are changed. Rules are in-memory only.
+package smbblock
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os/exec"
+	"slices"
+	"strings"
+)
+
+// Anchor is the pf anchor holding the SMB block rules.
+const Anchor = "com.apple/calf.smb-block"
+
+// pfctlRunner executes pfctl with the given stdin and arguments and returns stdout.
+type pfctlRunner func(stdin string, args ...string) (string, error)
+
+// Option configures a Manager.
+type Option func(*Manager)
+
+// WithPfctlRunner overrides the runner used to invoke pfctl.
+// Intended for use in tests.
+func WithPfctlRunner(fn pfctlRunner) Option {
+	return func(m *Manager) { m.runPfctl = fn }
+}
+
+// WithDirectPfctl runs pfctl directly instead of through sudo.
+// Intended for the calf-netd helper daemon, which already runs as root.
+func WithDirectPfctl() Option {
+	return func(m *Manager) { m.runPfctl = runPfctl("pfctl") }
+}
+
+// Manager loads, flushes, and inspects the SMB block anchor via pfctl.
+type Manager struct {
+	runPfctl pfctlRunner
+}
+
+// NewManager creates a Manager that runs pfctl through sudo.
+// Passwordless access is granted for this anchor only by the
+// /etc/sudoers.d/calf-pfctl drop-in installed by calf-bootstrap.
+func NewManager(opts ...Option) *Manager {
+	m := &Manager{runPfctl: runPfctl("sudo", "pfctl")}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// runPfctl returns a runner that executes command (e.g. "sudo pfctl") with
+// the pfctl arguments appended, feeding stdin to the process.
+func runPfctl(command ...string) pfctlRunner {
+	return func(stdin string, args ...string) (string, error) {
+		cmd := exec.Command(command[0], append(command[1:], args...)...)
+		cmd.Stdin = strings.NewReader(stdin)
+
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+
+		if err := cmd.Run(); err != nil {
+			return "", fmt.Errorf("pfctl %s failed: %w\nstderr: %s", strings.Join(args, " "), err, stderr.String())
+		}
+		return stdout.String(), nil
+	}
+}
+
+// Ruleset returns the pf rules that block SMB (TCP 445, 139) and NetBIOS
+// (UDP 137, 138) from each of vmIPs. Returns an error if no IP is given or
+// any is not a valid IP address.
+func Ruleset(vmIPs ...string) (string, error) {
+	if len(vmIPs) == 0 {
+		return "", fmt.Errorf("no VM IP address to block")
+	}
+	var rules strings.Builder
+	for _, vmIP := range vmIPs {
+		if net.ParseIP(vmIP) == nil {
+			return "", fmt.Errorf("invalid VM IP address '%s'", vmIP)
+		}
+		fmt.Fprintf(&rules, "block in quick proto tcp from %s to any port {445, 139}\n"+
+			"block in quick proto udp from %s to any port {137, 138}\n", vmIP, vmIP)
+	}
+	return rules.String(), nil
+}
+
+// Load replaces the anchor's rules with the SMB block ruleset for vmIPs, so
+// one anchor covers every running no-network VM.
+// The VMs must not be left running in no-network mode if Load fails.
+func (m *Manager) Load(vmIPs ...string) error {
+	rules, err := Ruleset(vmIPs...)
+	if err != nil {
+		return err
+	}
+	if _, err := m.runPfctl(rules, "-a", Anchor, "-f", "-"); err != nil {
+		return fmt.Errorf("failed to load SMB block rules for %s: %w", strings.Join(vmIPs, ", "), err)
+	}
+	return nil
+}
+
+// Flush removes all rules from the anchor.
+func (m *Manager) Flush() error {
+	if _, err := m.runPfctl("", "-a", Anchor, "-F", "all"); err != nil {
+		return fmt.Errorf("failed to remove SMB block rules (manual cleanup: sudo pfctl -a %s -F all): %w", Anchor, err)
+	}
+	return nil
+}
+
+// ActiveRules returns the rules currently loaded in the anchor, one per line.
+// Returns an empty slice when the anchor is empty.
+func (m *Manager) ActiveRules() ([]string, error) {
+	output, err := m.runPfctl("", "-a", Anchor, "-sr")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SMB block rules: %w", err)
+	}
+
+	rules := []string{}
+	for _, line := range strings.Split(output, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			rules = append(rules, line)
+		}
+	}
+	return rules, nil
+}
+
+// BlockedIPs returns the distinct source IPs blocked by the anchor's active rules.
+func (m *Manager) BlockedIPs() ([]string, error) {
+	rules, err := m.ActiveRules()
+	if err != nil {
+		return nil, err
+	}
+
+	ips := []string{}
+	for _, rule := range rules {
+		ip := sourceIP(rule)
+		if ip != "" && !slices.Contains(ips, ip) {
+			ips = append(ips, ip)
+		}
+	}
+	return ips, nil
+}
+
+// StuckIPs returns blocked IPs that do not belong to any running VM.
+// Rules for these IPs were left behind by a session that did not clean up,
+// e.g. after a crash, and are what --clear-smb-block removes.
+func (m *Manager) StuckIPs(runningVMIPs []string) ([]string, error) {
+	blocked, err := m.BlockedIPs()
+	if err != nil {
+		return nil, err
+	}
+
+	stuck := []string{}
+	for _, ip := range blocked {
+		if !slices.Contains(runningVMIPs, ip) {
+			stuck = append(stuck, ip)
+		}
+	}
+	return stuck, nil
+}
+
+// sourceIP extracts the address following "from" in a pf rule,
+// or returns "" if the rule has no from clause.
+func sourceIP(rule string) string {
+	fields := strings.Fields(rule)
+	idx := slices.Index(fields, "from")
+	if idx == -1 || idx+1 >= len(fields) {
+		return ""
+	}
+	return fields[idx+1]
+}
@@ -0,0 +1,303 @@
+package smbblock
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// fakePfctl is a test helper that records pfctl invocations.
+type fakePfctl struct {
+	calls  [][]string
+	stdins []string
+	output map[string]string
+	errors map[string]error
+}
+
+func newFakePfctl() *fakePfctl {
+	return &fakePfctl{output: map[string]string{}, errors: map[string]error{}}
+}
+
+func (f *fakePfctl) run(stdin string, args ...string) (string, error) {
+	f.calls = append(f.calls, args)
+	f.stdins = append(f.stdins, stdin)
+	key := strings.Join(args, " ")
+	if err, ok := f.errors[key]; ok {
+		return "", err
+	}
+	return f.output[key], nil
+}
+
+const activeRulesOutput = `block drop in quick inet proto tcp from 192.168.64.5 to any port = 445
+block drop in quick inet proto tcp from 192.168.64.5 to any port = 139
+block drop in quick inet proto udp from 192.168.64.5 to any port = 137
+block drop in quick inet proto udp from 192.168.64.5 to any port = 138
+`
+
+func TestRuleset(t *testing.T) {
+	t.Run("when IP is valid should block SMB and NetBIOS ports from that IP", func(t *testing.T) {
+		// Arrange
+		ip := "192.168.64.5"
+
+		// Act
+		got, err := Ruleset(ip)
+
+		// Assert
+		if err != nil {
+			t.Fatalf("Ruleset() unexpected error = %v", err)
+		}
+		want := "block in quick proto tcp from 192.168.64.5 to any port {445, 139}\n" +
+			"block in quick proto udp from 192.168.64.5 to any port {137, 138}\n"
+		if got != want {
+			t.Errorf("Ruleset() = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("when several IPs are given should block each of them", func(t *testing.T) {
+		// Act
+		got, err := Ruleset("192.168.64.5", "192.168.64.6")
+
+		// Assert
+		if err != nil {
+			t.Fatalf("Ruleset() unexpected error = %v", err)
+		}
+		if !strings.Contains(got, "from 192.168.64.5 to any port {445, 139}") || !strings.Contains(got, "from 192.168.64.6 to any port {137, 138}") {
+			t.Errorf("Ruleset() = %q, want rules for both IPs", got)
+		}
+	})
+
+	t.Run("when no IP is given should return error", func(t *testing.T) {
+		// Act
+		_, err := Ruleset()
+
+		// Assert
+		if err == nil {
+			t.Fatal("Ruleset() expected error, got nil")
+		}
+	})
+
+	t.Run("when IP is invalid should return error", func(t *testing.T) {
+		// Arrange
+		ip := "192.168.64.5; pass all"
+
+		// Act
+		_, err := Ruleset(ip)
+
+		// Assert
+		if err == nil {
+			t.Fatal("Ruleset() expected error, got nil")
+		}
+	})
+
+	t.Run("when IP is empty should return error", func(t *testing.T) {
+		// Arrange
+		ip := ""
+
+		// Act
+		_, err := Ruleset(ip)
+
+		// Assert
+		if err == nil {
+			t.Fatal("Ruleset() expected error, got nil")
+		}
+	})
+}
+
+func TestManagerLoad(t *testing.T) {
+	t.Run("when load succeeds should pipe ruleset to pfctl for the anchor", func(t *testing.T) {
+		// Arrange
+		fake := newFakePfctl()
+		m := NewManager(WithPfctlRunner(fake.run))
+
+		// Act
+		err := m.Load("192.168.64.5")
+
+		// Assert
+		if err != nil {
+			t.Fatalf("Load() unexpected error = %v", err)
+		}
+		want := []string{"-a", "com.apple/calf.smb-block", "-f", "-"}
+		if !slices.Equal(fake.calls[0], want) {
+			t.Errorf("Load() pfctl args = %v, want %v", fake.calls[0], want)
+		}
+		if !strings.Contains(fake.stdins[0], "from 192.168.64.5 to any port {445, 139}") {
+			t.Errorf("Load() stdin = %q, want SMB ruleset", fake.stdins[0])
+		}
+	})
+
+	t.Run("when IP is invalid should not invoke pfctl", func(t *testing.T) {
+		// Arrange
+		fake := newFakePfctl()
+		m := NewManager(WithPfctlRunner(fake.run))
+
+		// Act
+		err := m.Load("not-an-ip")
+
+		// Assert
+		if err == nil {
+			t.Fatal("Load() expected error, got nil")
+		}
+		if len(fake.calls) != 0 {
+			t.Errorf("Load() should not invoke pfctl, got %v", fake.calls)
+		}
+	})
+
+	t.Run("when pfctl fails should return wrapped error", func(t *testing.T) {
+		// Arrange
+		fake := newFakePfctl()
+		fake.errors["-a com.apple/calf.smb-block -f -"] = errors.New("sudo: a password is required")
+		m := NewManager(WithPfctlRunner(fake.run))
+
+		// Act
+		err := m.Load("192.168.64.5")
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "failed to load SMB block rules") {
+			t.Errorf("Load() error = %v, want wrapped load error", err)
+		}
+	})
+}
+
+func TestManagerFlush(t *testing.T) {
+	t.Run("when flush succeeds should flush all rules in the anchor", func(t *testing.T) {
+		// Arrange
+		fake := newFakePfctl()
+		m := NewManager(WithPfctlRunner(fake.run))
+
+		// Act
+		err := m.Flush()
+
+		// Assert
+		if err != nil {
+			t.Fatalf("Flush() unexpected error = %v", err)
+		}
+		want := []string{"-a", "com.apple/calf.smb-block", "-F", "all"}
+		if !slices.Equal(fake.calls[0], want) {
+			t.Errorf("Flush() pfctl args = %v, want %v", fake.calls[0], want)
+		}
+	})
+
+	t.Run("when pfctl fails should include manual cleanup command", func(t *testing.T) {
+		// Arrange
+		fake := newFakePfctl()
+		fake.errors["-a com.apple/calf.smb-block -F all"] = errors.New("permission denied")
+		m := NewManager(WithPfctlRunner(fake.run))
+
+		// Act
+		err := m.Flush()
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "sudo pfctl -a com.apple/calf.smb-block -F all") {
+			t.Errorf("Flush() error = %v, want manual cleanup hint", err)
+		}
+	})
+}
+
+func TestManagerInspect(t *testing.T) {
+	t.Run("when anchor has rules should return each rule", func(t *testing.T) {
+		// Arrange
+		fake := newFakePfctl()
+		fake.output["-a com.apple/calf.smb-block -sr"] = activeRulesOutput
+		m := NewManager(WithPfctlRunner(fake.run))
+
+		// Act
+		rules, err := m.ActiveRules()
+
+		// Assert
+		if err != nil {
+			t.Fatalf("ActiveRules() unexpected error = %v", err)
+		}
+		if len(rules) != 4 {
+			t.Errorf("ActiveRules() returned %d rules, want 4", len(rules))
+		}
+	})
+
+	t.Run("when anchor is empty should return no rules", func(t *testing.T) {
+		// Arrange
+		fake := newFakePfctl()
+		m := NewManager(WithPfctlRunner(fake.run))
+
+		// Act
+		rules, err := m.ActiveRules()
+
+		// Assert
+		if err != nil {
+			t.Fatalf("ActiveRules() unexpected error = %v", err)
+		}
+		if len(rules) != 0 {
+			t.Errorf("ActiveRules() = %v, want empty", rules)
+		}
+	})
+
+	t.Run("when rules loaded should report distinct blocked IPs", func(t *testing.T) {
+		// Arrange
+		fake := newFakePfctl()
+		fake.output["-a com.apple/calf.smb-block -sr"] = activeRulesOutput
+		m := NewManager(WithPfctlRunner(fake.run))
+
+		// Act
+		ips, err := m.BlockedIPs()
+
+		// Assert
+		if err != nil {
+			t.Fatalf("BlockedIPs() unexpected error = %v", err)
+		}
+		if !slices.Equal(ips, []string{"192.168.64.5"}) {
+			t.Errorf("BlockedIPs() = %v, want [192.168.64.5]", ips)
+		}
+	})
+
+	t.Run("when pfctl fails should return wrapped error", func(t *testing.T) {
+		// Arrange
+		fake := newFakePfctl()
+		fake.errors["-a com.apple/calf.smb-block -sr"] = errors.New("pf not available")
+		m := NewManager(WithPfctlRunner(fake.run))
+
+		// Act
+		_, err := m.BlockedIPs()
+
+		// Assert
+		if err == nil || !strings.Contains(err.Error(), "failed to read SMB block rules") {
+			t.Errorf("BlockedIPs() error = %v, want wrapped read error", err)
+		}
+	})
+}
+
+func TestManagerStuckIPs(t *testing.T) {
+	t.Run("when blocked IP has no running VM should report it as stuck", func(t *testing.T) {
+		// Arrange
+		fake := newFakePfctl()
+		fake.output["-a com.apple/calf.smb-block -sr"] = activeRulesOutput
+		m := NewManager(WithPfctlRunner(fake.run))
+
+		// Act
+		stuck, err := m.StuckIPs(nil)
+
+		// Assert
+		if err != nil {
+			t.Fatalf("StuckIPs() unexpected error = %v", err)
+		}
+		if !slices.Equal(stuck, []string{"192.168.64.5"}) {
+			t.Errorf("StuckIPs() = %v, want [192.168.64.5]", stuck)
+		}
+	})
+
+	t.Run("when blocked IP belongs to a running VM should not report it", func(t *testing.T) {
+		// Arrange
+		fake := newFakePfctl()
+		fake.output["-a com.apple/calf.smb-block -sr"] = activeRulesOutput
+		m := NewManager(WithPfctlRunner(fake.run))
+
+		// Act
+		stuck, err := m.StuckIPs([]string{"192.168.64.5"})
+
+		// Assert
+		if err != nil {
+			t.Fatalf("StuckIPs() unexpected error = %v", err)
+		}
+		if len(stuck) != 0 {
+			t.Errorf("StuckIPs() = %v, want none", stuck)
+		}
+	})
+}